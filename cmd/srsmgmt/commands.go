@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"srsmgmt/config"
+	"srsmgmt/internal/srsmgmtrepo"
+	"srsmgmt/pkg/playlist"
+	"srsmgmt/pkg/srsconfig"
+
+	"github.com/go-kit/log"
+	"github.com/gofrs/uuid"
+	glogger "gorm.io/gorm/logger"
+)
+
+// runCommand выполняет служебную подкоманду и возвращает код выхода
+func runCommand(cfg *config.Config, name string, args []string) int {
+	switch name {
+	case "verify-playlists":
+		return verifyPlaylistsCmd(cfg, args)
+	case "render-srs-config":
+		return renderSRSConfigCmd(cfg, args)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", name)
+		fmt.Fprintf(os.Stderr, "commands:\n  verify-playlists [-repair] [-json] <stream id|dir>...\n  render-srs-config [-db] [-node name]\n")
+		return 2
+	}
+}
+
+func verifyPlaylistsCmd(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("verify-playlists", flag.ExitOnError)
+	repair := fs.Bool("repair", false, "rewrite playlists without broken segments")
+	asJSON := fs.Bool("json", false, "print report as JSON")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "usage: verify-playlists [-repair] [-json] <stream id|dir>...\n")
+		return 2
+	}
+
+	nodes, err := cfg.Nodes()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 2
+	}
+
+	plist := playlist.New()
+	code := 0
+	for _, target := range fs.Args() {
+		livePath := target
+		if id, err := uuid.FromString(target); err == nil {
+			// каталог стрима ищется в LiveTSPath всех узлов пула
+			livePath = path.Join(nodes[0].LiveTSPath, id.String())
+			for _, n := range nodes {
+				if _, err := os.Stat(path.Join(n.LiveTSPath, id.String())); err == nil {
+					livePath = path.Join(n.LiveTSPath, id.String())
+					break
+				}
+			}
+		}
+
+		report, err := plist.Verify(livePath, *repair)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", livePath, err)
+			code = 1
+			continue
+		}
+		if report.Broken > 0 {
+			code = 1
+		}
+
+		if *asJSON {
+			json.NewEncoder(os.Stdout).Encode(report)
+			continue
+		}
+
+		fmt.Printf("%s: %d segments, %d broken\n", report.Path, report.Segments, report.Broken)
+		for _, pl := range report.Playlists {
+			status := ""
+			if pl.Repaired {
+				status = " (repaired)"
+			}
+			if pl.Error != "" {
+				status = " error: " + pl.Error
+			}
+			fmt.Printf("  %s: %d segments, %d broken%s\n", pl.Name, pl.Segments, len(pl.Broken), status)
+			for _, seg := range pl.Broken {
+				fmt.Printf("    %s %s extinf=%.3f actual=%.3f\n", seg.Problem, seg.URI, seg.Duration, seg.Actual)
+			}
+		}
+	}
+
+	return code
+}
+
+// renderSRSConfigCmd печатает конфигурацию SRS, которую сгенерирует сервис
+// из шаблонов SRS_TPL_DIR и встроенных, ничего не записывая
+func renderSRSConfigCmd(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("render-srs-config", flag.ExitOnError)
+	fromDB := fs.Bool("db", false, "include active streams and transcoding profiles from DATABASE_URI")
+	nodeName := fs.String("node", "", "SRS_NODES node to render, the first node by default")
+	fs.Parse(args)
+
+	nodes, err := cfg.Nodes()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 2
+	}
+	node := nodes[0]
+	if *nodeName != "" {
+		found := false
+		for _, n := range nodes {
+			if n.Name == *nodeName {
+				node, found = n, true
+			}
+		}
+		if !found {
+			fmt.Fprintf(os.Stderr, "unknown node %q\n", *nodeName)
+			return 2
+		}
+	}
+
+	srsConfig := nodeSRSConfig(cfg, node, nil)
+
+	if *fromDB {
+		logger := log.NewLogfmtLogger(os.Stderr)
+		repo := srsmgmtrepo.New(logger, glogger.Silent, cfg)
+		streams, err := repo.GetRTCStreams()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "streams: %v\n", err)
+			return 1
+		}
+		for _, v := range *streams {
+			// стримы без узла принадлежат первому узлу
+			if v.Node != node.Name && !(v.Node == "" && node.Name == nodes[0].Name) {
+				continue
+			}
+			srsConfig.Streams = append(srsConfig.Streams, srsconfig.SRSstream{ID: v.StreamID.String(), App: v.App, DVR: v.DVR})
+		}
+		profiles, err := repo.GetProfiles()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "profiles: %v\n", err)
+			return 1
+		}
+		for _, p := range *profiles {
+			srsConfig.Profiles = append(srsConfig.Profiles, srsconfig.Profile{Name: p.Name, Rungs: p.Rungs})
+		}
+	}
+
+	srsCfg, err := srsConfig.Render()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	os.Stdout.Write(srsCfg.Bytes())
+	return 0
+}
+
+// nodeSRSConfig - конфигурация SRS узла с его шаблоном общей части и данными шаблонов
+func nodeSRSConfig(cfg *config.Config, node config.SRSNode, client srsconfig.ConfigReloader) *srsconfig.SRSConfig {
+	srsConfig := srsconfig.New(node.ConfPath, srsconfig.Templates(cfg.SRSTplDir, cfg.TplStorage), client)
+	srsConfig.TemplateData = cfg.TemplateData(node)
+	srsConfig.BaseTemplate = "srs_base." + node.Name + ".tpl"
+	return srsConfig
+}
@@ -6,6 +6,7 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"path"
 	"strings"
 	"testing"
 
@@ -13,6 +14,10 @@ import (
 	"srsmgmt/internal/srsmgmt"
 	"srsmgmt/internal/srsmgmtrepo"
 	pb "srsmgmt/pb"
+	"srsmgmt/pkg/playlist"
+	"srsmgmt/pkg/srsclient"
+	"srsmgmt/pkg/srsconfig"
+	"srsmgmt/pkg/srstest"
 
 	"github.com/go-kit/log"
 	"google.golang.org/grpc"
@@ -22,11 +27,29 @@ import (
 	glogger "gorm.io/gorm/logger"
 )
 
+// newTestService создает сервис с поддельным SRS
+func newTestService(t *testing.T, repo srsmgmt.Repository, logger log.Logger) srsmgmt.Service {
+	cfg := config.GetConfig()
+	srs := srstest.NewServer(t.TempDir())
+	t.Cleanup(srs.Close)
+	srs.ConfigPath = path.Join(t.TempDir(), "srs.conf")
+
+	client := srsclient.New(srs.URL, srsclient.DefaultOptions(), logger)
+	srsConfig := srsconfig.New(srs.ConfigPath, srsconfig.Templates("", cfg.TplStorage), client)
+	srsConfig.TemplateData = cfg
+	nodes := []*srsmgmt.Node{{
+		SRSNode:   config.SRSNode{Name: config.DefaultNode, LiveTSPath: srs.LiveTSPath, ConfPath: srs.ConfigPath},
+		Client:    client,
+		SRSConfig: srsConfig,
+	}}
+	return srsmgmt.NewSrsMgmtService(repo, logger, playlist.New(), nodes, nil)
+}
+
 func TestHTTP(t *testing.T) {
 	logger := log.NewNopLogger()
 	repo := srsmgmtrepo.New(logger, glogger.Silent, config.GetConfig())
 
-	svc := srsmgmt.NewSrsMgmtService(repo, logger, nil, nil)
+	svc := newTestService(t, repo, logger)
 	httpHandler := srsmgmt.MakeHTTPHandler(svc, logger)
 	srv := httptest.NewServer(httpHandler)
 
@@ -72,7 +95,7 @@ func TestHTTP(t *testing.T) {
 func TestGRPC(t *testing.T) {
 	logger := log.NewNopLogger()
 	repo := srsmgmtrepo.New(logger, glogger.Silent, config.GetConfig())
-	svc := srsmgmt.NewSrsMgmtService(repo, logger, nil, nil)
+	svc := newTestService(t, repo, logger)
 	grpcListener, err := net.Listen("tcp", config.GetConfig().GRPCAddr)
 	if err != nil {
 		t.Fatalf("GRPC Connection failure: %v", err)
@@ -1,15 +1,18 @@
 package main
 
 import (
+	"expvar"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"path"
 	"srsmgmt/config"
 	"srsmgmt/internal/srsmgmt"
 	"srsmgmt/internal/srsmgmtrepo"
 	pb "srsmgmt/pb"
+	"srsmgmt/pkg/objstore"
 	"srsmgmt/pkg/playlist"
 	"srsmgmt/pkg/srsclient"
 	"srsmgmt/pkg/srsconfig"
@@ -27,6 +30,10 @@ import (
 func main() {
 	cfg := config.GetConfig()
 
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(cfg, os.Args[1], os.Args[2:]))
+	}
+
 	logLevel := level.AllowError()
 	if cfg.IsDebug || true {
 		logLevel = level.AllowDebug()
@@ -42,19 +49,79 @@ func main() {
 
 	repo := srsmgmtrepo.New(logger, 0, cfg)
 	plist := playlist.New()
+	plist.SetWaitTimes(time.Duration(cfg.PlaylistWait)*time.Second, time.Duration(cfg.PlaylistRenditionWait)*time.Second)
 
-	var srsClient srsclient.SrsClient
-	{
-		srsClient = srsclient.New(cfg.SRSAddr, logger)
-		srsClient = srsclient.LoggingMiddleware(logger)(srsClient)
+	srsNodes, err := cfg.Nodes()
+	if err != nil {
+		logger.Log("config", "SRS_NODES", "err", err)
+		os.Exit(1)
+	}
+	tlsConfig, err := srsclient.TLSOptions{
+		CAFile:   cfg.SRSAPICAFile,
+		CertFile: cfg.SRSAPICertFile,
+		KeyFile:  cfg.SRSAPIKeyFile,
+		Insecure: cfg.SRSAPIInsecure,
+	}.Config()
+	if err != nil {
+		logger.Log("srsclient", "TLS", "err", err)
+		os.Exit(1)
 	}
+	nodes := []*srsmgmt.Node{}
+	for _, n := range srsNodes {
+		var srsClient srsclient.SrsClient
+		{
+			srsClient = srsclient.New(n.APIAddr, srsclient.Options{
+				Timeout:          time.Duration(cfg.SRSTimeout) * time.Second,
+				Retries:          cfg.SRSRetries,
+				RetryBackoff:     time.Duration(cfg.SRSRetryBackoff) * time.Millisecond,
+				BreakerThreshold: cfg.SRSBreakerThreshold,
+				BreakerCooldown:  time.Duration(cfg.SRSBreakerCooldown) * time.Second,
 
-	srsConfigClient := srsClient.(srsconfig.ConfigReloader)
-	srsConfig := srsconfig.New(cfg.SRSConfPath, cfg.TplStorage, srsConfigClient)
+				DialTimeout:         time.Duration(cfg.SRSDialTimeout) * time.Second,
+				TLSHandshakeTimeout: time.Duration(cfg.SRSDialTimeout) * time.Second,
+				TLSConfig:           tlsConfig,
+				Auth:                srsclient.Auth{User: n.APIUser, Password: n.APIPassword, Token: n.APIToken},
+			}, log.With(logger, "node", n.Name))
+			srsClient = srsclient.LoggingMiddleware(log.With(logger, "node", n.Name))(srsClient)
+		}
+
+		srsConfigClient := srsClient.(srsconfig.ConfigReloader)
+		srsConfig := nodeSRSConfig(cfg, n, srsConfigClient)
+		if cfg.SRSTplDir != "" {
+			// у каждого узла своя принятая с диска общая часть
+			srsConfig.AdoptPath = path.Join(cfg.SRSTplDir, srsConfig.BaseTemplate)
+		}
+		srsConfig.BatchWindow = time.Duration(cfg.SRSReloadBatch) * time.Millisecond
+		nodes = append(nodes, &srsmgmt.Node{SRSNode: n, Client: srsClient, SRSConfig: srsConfig})
+	}
+	// метрики перезагрузок узлов доступны в /debug/vars при PPROF_ENABLED
+	expvar.Publish("srs_reload", expvar.Func(func() interface{} {
+		stats := map[string]srsconfig.ReloadStats{}
+		for _, n := range nodes {
+			stats[n.Name] = n.SRSConfig.Stats()
+		}
+		return stats
+	}))
+	expvar.Publish("srs_drift", expvar.Func(func() interface{} {
+		drift := map[string]srsconfig.DriftReport{}
+		for _, n := range nodes {
+			drift[n.Name] = n.SRSConfig.Drift()
+		}
+		return drift
+	}))
+
+	var store *objstore.Store
+	if cfg.S3Endpoint != "" {
+		store, err = objstore.New(cfg.S3Endpoint, cfg.S3Region, cfg.S3Bucket, cfg.S3AccessKey, cfg.S3SecretKey, cfg.S3PathStyle, cfg.S3PublicURL)
+		if err != nil {
+			logger.Log("objstore", "New", "err", err)
+			os.Exit(1)
+		}
+	}
 
 	var s srsmgmt.Service
 	{
-		s = srsmgmt.NewSrsMgmtService(repo, logger, plist, srsClient, srsConfig)
+		s = srsmgmt.NewSrsMgmtService(repo, logger, plist, nodes, store)
 		s = srsmgmt.LoggingMiddleware(logger)(s)
 	}
 
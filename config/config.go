@@ -25,6 +25,65 @@ type Config struct {
 	IsDebug     bool
 	SRSConfPath string
 	TplStorage  embed.FS
+	SRSTplDir   string
+
+	SRSReloadBatch   int
+	SRSDriftInterval int
+	SRSDriftPolicy   string
+
+	SRSTimeout          int
+	SRSRetries          int
+	SRSRetryBackoff     int
+	SRSBreakerThreshold int
+	SRSBreakerCooldown  int
+	SRSDialTimeout      int
+
+	SRSAPIUser     string
+	SRSAPIPassword string
+	SRSAPIToken    string
+	SRSAPICAFile   string
+	SRSAPICertFile string
+	SRSAPIKeyFile  string
+	SRSAPIInsecure bool
+
+	SRSNodes string
+
+	S3Endpoint      string
+	S3Region        string
+	S3Bucket        string
+	S3AccessKey     string
+	S3SecretKey     string
+	S3PublicURL     string
+	S3PathStyle     bool
+	OffloadAge      int
+	OffloadInterval int
+
+	HLSKeyRotation int
+	HLSKeyURL      string
+
+	PlaybackSecret   string
+	PlaybackTokenTTL int
+
+	PlaylistWait          int
+	PlaylistRenditionWait int
+
+	StallThreshold int
+	StallKick      bool
+
+	HLSOrigin bool
+
+	TrustedProxies string
+
+	FFmpegPath    string
+	LocalRTMPAddr string
+
+	RTCAddr      string
+	RTCPort      int
+	RTCCandidate string
+
+	DVRPath      string
+	DVRFormat    string
+	DVRLocalPath string
 }
 
 var cfg *Config
@@ -53,6 +112,65 @@ func readConfig() *Config {
 		IsDebug:     fromEnv("DEBUG", false).(bool),
 		SRSConfPath: fromEnv("SRS_CONF_PATH", "/opt/srs/trunk/cfg/hls_transcode.conf").(string),
 		TplStorage:  embedFS,
+		SRSTplDir:   fromEnv("SRS_TPL_DIR", "").(string),
+
+		SRSReloadBatch:   fromEnv("SRS_RELOAD_BATCH", 200).(int),
+		SRSDriftInterval: fromEnv("SRS_DRIFT_INTERVAL", 60).(int),
+		SRSDriftPolicy:   fromEnv("SRS_DRIFT_POLICY", "alert").(string),
+
+		SRSTimeout:          fromEnv("SRS_TIMEOUT", 5).(int),
+		SRSRetries:          fromEnv("SRS_RETRIES", 2).(int),
+		SRSRetryBackoff:     fromEnv("SRS_RETRY_BACKOFF", 200).(int),
+		SRSBreakerThreshold: fromEnv("SRS_BREAKER_THRESHOLD", 5).(int),
+		SRSBreakerCooldown:  fromEnv("SRS_BREAKER_COOLDOWN", 30).(int),
+		SRSDialTimeout:      fromEnv("SRS_DIAL_TIMEOUT", 3).(int),
+
+		SRSAPIUser:     fromEnv("SRS_API_USER", "").(string),
+		SRSAPIPassword: fromEnv("SRS_API_PASSWORD", "").(string),
+		SRSAPIToken:    fromEnv("SRS_API_TOKEN", "").(string),
+		SRSAPICAFile:   fromEnv("SRS_API_CA_FILE", "").(string),
+		SRSAPICertFile: fromEnv("SRS_API_CERT_FILE", "").(string),
+		SRSAPIKeyFile:  fromEnv("SRS_API_KEY_FILE", "").(string),
+		SRSAPIInsecure: fromEnv("SRS_API_INSECURE", false).(bool),
+
+		SRSNodes: fromEnv("SRS_NODES", "").(string),
+
+		S3Endpoint:      fromEnv("S3_ENDPOINT", "").(string),
+		S3Region:        fromEnv("S3_REGION", "us-east-1").(string),
+		S3Bucket:        fromEnv("S3_BUCKET", "").(string),
+		S3AccessKey:     fromEnv("S3_ACCESS_KEY", "").(string),
+		S3SecretKey:     fromEnv("S3_SECRET_KEY", "").(string),
+		S3PublicURL:     fromEnv("S3_PUBLIC_URL", "").(string),
+		S3PathStyle:     fromEnv("S3_PATH_STYLE", true).(bool),
+		OffloadAge:      fromEnv("OFFLOAD_AGE", 0).(int),
+		OffloadInterval: fromEnv("OFFLOAD_INTERVAL", 60).(int),
+
+		HLSKeyRotation: fromEnv("HLS_KEY_ROTATION", 10).(int),
+		HLSKeyURL:      fromEnv("HLS_KEY_URL", "").(string),
+
+		PlaybackSecret:   fromEnv("PLAYBACK_SECRET", "").(string),
+		PlaybackTokenTTL: fromEnv("PLAYBACK_TOKEN_TTL", 3600).(int),
+
+		PlaylistWait:          fromEnv("PLAYLIST_WAIT", 12).(int),
+		PlaylistRenditionWait: fromEnv("PLAYLIST_RENDITION_WAIT", 60).(int),
+
+		StallThreshold: fromEnv("STALL_THRESHOLD", 30).(int),
+		StallKick:      fromEnv("STALL_KICK", false).(bool),
+
+		HLSOrigin: fromEnv("HLS_ORIGIN", false).(bool),
+
+		TrustedProxies: fromEnv("TRUSTED_PROXIES", "127.0.0.1,::1").(string),
+
+		FFmpegPath:    fromEnv("FFMPEG_PATH", "/usr/bin/ffmpeg").(string),
+		LocalRTMPAddr: fromEnv("LOCAL_RTMP_ADDR", "rtmp://127.0.0.1:1935").(string),
+
+		RTCAddr:      fromEnv("RTC_ADDR", "").(string),
+		RTCPort:      fromEnv("RTC_PORT", 8000).(int),
+		RTCCandidate: fromEnv("RTC_CANDIDATE", "*").(string),
+
+		DVRPath:      fromEnv("DVR_PATH", "./objs/nginx/html/dvr").(string),
+		DVRFormat:    fromEnv("DVR_FORMAT", "mp4").(string),
+		DVRLocalPath: fromEnv("DVR_LOCAL_PATH", "").(string),
 	}
 }
 
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const DefaultNode = "default"
+
+var ErrSRSNodes = errors.New("SRS_NODES_INVALID")
+
+// SRSNode - узел пула SRS. LiveTSPath и ConfPath - каталог HLS и файл
+// конфигурации узла, как они видны сервису
+type SRSNode struct {
+	Name          string `json:"name"`
+	APIAddr       string `json:"apiAddr"`
+	RTMPAddr      string `json:"rtmpAddr"`
+	SRTAddr       string `json:"srtAddr"`
+	HLSAddr       string `json:"hlsAddr"`
+	RTCAddr       string `json:"rtcAddr,omitempty"`
+	LocalRTMPAddr string `json:"localRtmpAddr,omitempty"`
+	LiveTSPath    string `json:"liveTsPath"`
+	ConfPath      string `json:"confPath"`
+	// Capacity - предел неостановленных стримов узла, 0 - без предела
+	Capacity int `json:"capacity,omitempty"`
+	// учетные данные API узла, без них - SRS_API_USER и т.д.
+	APIUser     string `json:"apiUser,omitempty"`
+	APIPassword string `json:"apiPassword,omitempty"`
+	APIToken    string `json:"apiToken,omitempty"`
+}
+
+// NodeTemplateData - данные шаблонов SRS узла: поля конфигурации сервиса
+// (.Config.HTTPAddr) и узел (.Config.Node.LiveTSPath, .Config.Node.ConfPath)
+type NodeTemplateData struct {
+	Config
+	Node SRSNode
+}
+
+func (c *Config) TemplateData(n SRSNode) NodeTemplateData {
+	return NodeTemplateData{Config: *c, Node: n}
+}
+
+// Nodes возвращает пул SRS из SRS_NODES (JSON-массив узлов). Без SRS_NODES
+// пул состоит из одного узла default с адресами SRS_ADDR, RTMP_ADDR и т.д.
+func (c *Config) Nodes() ([]SRSNode, error) {
+	if c.SRSNodes == "" {
+		return []SRSNode{{
+			Name:          DefaultNode,
+			APIAddr:       c.SRSAddr,
+			RTMPAddr:      c.RTMPAddr,
+			SRTAddr:       c.SRTAddr,
+			HLSAddr:       c.HLSAddr,
+			RTCAddr:       c.RTCAddr,
+			LocalRTMPAddr: c.LocalRTMPAddr,
+			LiveTSPath:    c.LiveTSPath,
+			ConfPath:      c.SRSConfPath,
+			APIUser:       c.SRSAPIUser,
+			APIPassword:   c.SRSAPIPassword,
+			APIToken:      c.SRSAPIToken,
+		}}, nil
+	}
+
+	nodes := []SRSNode{}
+	if err := json.Unmarshal([]byte(c.SRSNodes), &nodes); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSRSNodes, err)
+	}
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("%w: empty pool", ErrSRSNodes)
+	}
+	names := map[string]bool{}
+	for i, n := range nodes {
+		switch {
+		case n.Name == "":
+			return nil, fmt.Errorf("%w: node %d has no name", ErrSRSNodes, i)
+		case strings.ContainsAny(n.Name, `/\`) || n.Name == "." || n.Name == "..":
+			// имя узла входит в имя файла принятой конфигурации
+			return nil, fmt.Errorf("%w: invalid node name %q", ErrSRSNodes, n.Name)
+		case names[n.Name]:
+			return nil, fmt.Errorf("%w: duplicate node %q", ErrSRSNodes, n.Name)
+		case n.APIAddr == "" || n.LiveTSPath == "" || n.ConfPath == "":
+			return nil, fmt.Errorf("%w: node %q needs apiAddr, liveTsPath and confPath", ErrSRSNodes, n.Name)
+		case n.Capacity < 0:
+			return nil, fmt.Errorf("%w: node %q has negative capacity", ErrSRSNodes, n.Name)
+		}
+		names[n.Name] = true
+		if n.LocalRTMPAddr == "" {
+			nodes[i].LocalRTMPAddr = n.RTMPAddr
+		}
+		if n.APIUser == "" && n.APIToken == "" {
+			nodes[i].APIUser, nodes[i].APIPassword, nodes[i].APIToken = c.SRSAPIUser, c.SRSAPIPassword, c.SRSAPIToken
+		}
+	}
+	return nodes, nil
+}
@@ -34,14 +34,36 @@ srt_server {
     listen 9998;
 }
 
+rtc_server {
+    enabled     on;
+    listen      {{.Config.RTCPort}};
+    candidate   {{.Config.RTCCandidate}};
+}
+
 vhost __defaultVhost__ {
     mix_correct on;
 
+    # WHIP публикация конвертируется в RTMP для транскодирования и HLS,
+    # RTMP и SRT публикации доступны по WHEP
+    rtc {
+        enabled     on;
+        rtmp_to_rtc on;
+        rtc_to_rtmp on;
+    }
+
+    # запись сессии в один файл, dvr_apply генерируется по стримам с записью
+    dvr {
+        enabled     off;
+        dvr_plan    session;
+        dvr_path    {{.Config.DVRPath}}/[app]/[stream]/[2006]-[01]-[02]-[15]-[04]-[05].{{.Config.DVRFormat}};
+    }
+
     http_hooks {
         enabled     on;
-        on_publish  http://127.0.0.1:8887/api/v1/webhook/stream/live;
-        on_unpublish  http://127.0.0.1:8887/api/v1/webhook/stream/live;
-        on_hls  http://127.0.0.1:8887/api/v1/webhook/stream/hls;
+        on_publish  http://{{hostport .Config.HTTPAddr}}/api/v1/webhook/stream/live;
+        on_unpublish  http://{{hostport .Config.HTTPAddr}}/api/v1/webhook/stream/live;
+        on_hls  http://{{hostport .Config.HTTPAddr}}/api/v1/webhook/stream/hls;
+        on_dvr  http://{{hostport .Config.HTTPAddr}}/api/v1/webhook/stream/dvr;
     }
     transcode {
         enabled     on;
@@ -149,7 +171,7 @@ vhost high {
 
     http_hooks {
         enabled     on;
-        on_hls  http://127.0.0.1:8887/api/v1/webhook/stream/hls;
+        on_hls  http://{{hostport .Config.HTTPAddr}}/api/v1/webhook/stream/hls;
     }
 }
 
@@ -171,7 +193,7 @@ vhost mid {
 
     http_hooks {
         enabled     on;
-        on_hls  http://127.0.0.1:8887/api/v1/webhook/stream/hls;
+        on_hls  http://{{hostport .Config.HTTPAddr}}/api/v1/webhook/stream/hls;
     }
 }
 
@@ -193,7 +215,7 @@ vhost low {
 
     http_hooks {
         enabled     on;
-        on_hls  http://127.0.0.1:8887/api/v1/webhook/stream/hls;
+        on_hls  http://{{hostport .Config.HTTPAddr}}/api/v1/webhook/stream/hls;
     }
 }
 
@@ -1,2 +0,0 @@
-# ======== RTC Custom config {{.RTCStreamUUID}} ===========
-
@@ -0,0 +1,192 @@
+package srsmgmt
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"srsmgmt/pkg/media"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/gofrs/uuid"
+)
+
+// Типы записей: выгрузка HLS в объектное хранилище и файл сессии SRS dvr
+const (
+	RecordingTypeHLS = "hls"
+	RecordingTypeDVR = "dvr"
+)
+
+var dvrContentTypes = map[string]string{
+	"flv": "video/x-flv",
+	"mp4": "video/mp4",
+}
+
+// RecordingFile - файл записи DVR для скачивания, Body закрывает вызывающий
+type RecordingFile struct {
+	Name        string
+	ContentType string
+	Size        int64
+	Body        io.ReadCloser
+}
+
+func recordingFileURL(rec Recording) string {
+	return fmt.Sprintf("/api/v1/stream/%s/recordings/%s/file", rec.StreamID, rec.ID)
+}
+
+// UpdateDvrSRS обрабатывает on_dvr: SRS закрыл файл сессии стрима,
+// файл регистрируется как запись
+func (s *srsMgmtService) UpdateDvrSRS(ctx context.Context, st SRSStream) (int, error) {
+	if st.Action != "on_dvr" {
+		return SRSfail, ErrBadRequest
+	}
+	streamUuid, err := uuid.FromString(st.StreamID)
+	if err != nil {
+		return SRSfail, ErrNotFound
+	}
+	stream, err := s.repo.GetStream(streamUuid)
+	if err != nil {
+		return SRSfail, ErrNotFound
+	}
+
+	file := s.dvrFile(stream, st)
+	if !s.inDVRDir(stream, file, st.Cwd) {
+		level.Error(s.logger).Log("dvr", "path", "id", stream.StreamID, "file", file)
+		return SRSfail, ErrBadRequest
+	}
+	fi, err := os.Stat(file)
+	if err != nil {
+		level.Error(s.logger).Log("dvr", "Stat", "id", stream.StreamID, "file", file, "err", err)
+		return SRSfail, ErrInternalError
+	}
+	duration, err := media.Duration(file)
+	if err != nil {
+		level.Error(s.logger).Log("dvr", "Duration", "id", stream.StreamID, "file", file, "err", err)
+	}
+
+	stopped := fi.ModTime()
+	started := stopped.Add(-duration)
+	_, err = s.repo.CreateRecording(Recording{
+		StreamID:  stream.StreamID,
+		Type:      RecordingTypeDVR,
+		Status:    RecordingStatusRecorded,
+		Format:    strings.TrimPrefix(path.Ext(file), "."),
+		Duration:  duration.Round(time.Millisecond).Seconds(),
+		Size:      fi.Size(),
+		File:      file,
+		StartedAt: &started,
+		StopedAt:  &stopped,
+	})
+	if err != nil {
+		level.Error(s.logger).Log("dvr", "CreateRecording", "id", stream.StreamID, "err", err)
+		return SRSfail, ErrInternalError
+	}
+	return SRSok, nil
+}
+
+// dvrFile - путь к файлу записи для сервиса. SRS сообщает путь относительно
+// своего рабочего каталога; если каталог записей смонтирован в сервис по
+// другому пути (DVR_LOCAL_PATH), файл ищется там по схеме dvr_path
+func (s *srsMgmtService) dvrFile(stream *Stream, st SRSStream) string {
+	if s.cfg.DVRLocalPath != "" {
+		return path.Join(s.cfg.DVRLocalPath, stream.App, stream.StreamID.String(), path.Base(st.File))
+	}
+	if path.IsAbs(st.File) {
+		return st.File
+	}
+	return path.Join(st.Cwd, st.File)
+}
+
+// dvrRoot - каталог записей DVR для сервиса. cwd - рабочий каталог SRS
+// из on_dvr, пустой, если неизвестен
+func (s *srsMgmtService) dvrRoot(cwd string) string {
+	if s.cfg.DVRLocalPath != "" {
+		return path.Clean(s.cfg.DVRLocalPath)
+	}
+	if path.IsAbs(s.cfg.DVRPath) || cwd == "" {
+		return path.Clean(s.cfg.DVRPath)
+	}
+	return path.Join(cwd, s.cfg.DVRPath)
+}
+
+// inDVRDir проверяет, что file лежит в каталоге записей стрима по схеме
+// dvr_path. Путь из webhook не должен выводить за его пределы
+func (s *srsMgmtService) inDVRDir(stream *Stream, file, cwd string) bool {
+	if !path.IsAbs(file) {
+		return false
+	}
+	dir := path.Join(s.dvrRoot(cwd), stream.App, stream.StreamID.String())
+	if path.IsAbs(dir) {
+		return path.Dir(path.Clean(file)) == dir
+	}
+	// относительный DVR_PATH без рабочего каталога SRS: проверяется конец пути
+	return strings.HasSuffix(path.Dir(path.Clean(file)), "/"+dir)
+}
+
+func (s *srsMgmtService) GetRecordingFile(ctx context.Context, streamID uuid.UUID, recordingID uuid.UUID) (*RecordingFile, error) {
+	stream, err := s.repo.GetStream(streamID)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	recs, err := s.repo.GetRecordings(streamID)
+	if err != nil {
+		return nil, ErrInternalError
+	}
+	for _, rec := range *recs {
+		if rec.ID != recordingID || rec.Type != RecordingTypeDVR {
+			continue
+		}
+		if !s.inDVRDir(stream, rec.File, "") {
+			level.Error(s.logger).Log("dvr", "path", "id", rec.ID, "file", rec.File)
+			return nil, ErrNotFound
+		}
+		f, err := os.Open(rec.File)
+		if err != nil {
+			level.Error(s.logger).Log("dvr", "Open", "id", rec.ID, "file", rec.File, "err", err)
+			return nil, ErrNotFound
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, ErrInternalError
+		}
+		return &RecordingFile{
+			Name:        path.Base(rec.File),
+			ContentType: dvrContentTypes[rec.Format],
+			Size:        fi.Size(),
+			Body:        f,
+		}, nil
+	}
+	return nil, ErrNotFound
+}
+
+// deleteDVR удаляет файлы записей DVR удаляемого стрима. Без объектного
+// хранилища записи удаляются здесь, иначе - вместе с выгруженными файлами
+func (s *srsMgmtService) deleteDVR(stream *Stream) {
+	streamID := stream.StreamID
+	recs, err := s.repo.GetRecordings(streamID)
+	if err != nil {
+		level.Error(s.logger).Log("dvr", "GetRecordings", "id", streamID, "err", err)
+		return
+	}
+	for _, rec := range *recs {
+		if rec.Type != RecordingTypeDVR {
+			continue
+		}
+		if !s.inDVRDir(stream, rec.File, "") {
+			level.Error(s.logger).Log("dvr", "path", "id", rec.ID, "file", rec.File)
+			continue
+		}
+		if err := os.Remove(rec.File); err != nil && !os.IsNotExist(err) {
+			level.Error(s.logger).Log("dvr", "Remove", "id", rec.ID, "file", rec.File, "err", err)
+		}
+	}
+	if s.store == nil {
+		if err := s.repo.DeleteRecordings(streamID); err != nil {
+			level.Error(s.logger).Log("dvr", "DeleteRecordings", "id", streamID, "err", err)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package srsmgmt
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"srsmgmt/config"
+	"testing"
+)
+
+func TestDVRPath(t *testing.T) {
+	cwd := t.TempDir()
+	repo := newMemRepo()
+	s := newTestService(t, repo, config.Config{DVRPath: "./objs/dvr"})
+	stream := newTestStream(t, repo, "live")
+	id := stream.StreamID.String()
+
+	dir := path.Join(cwd, "objs/dvr/live", id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path.Join(dir, "rec.flv"), []byte("FLV"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	other := path.Join(cwd, "secret.flv")
+	os.WriteFile(other, []byte("secret"), 0644)
+
+	for _, tc := range []struct {
+		file string
+		want error
+	}{
+		{"./objs/dvr/live/" + id + "/rec.flv", nil},
+		{"./objs/dvr/live/" + id + "/../../../../secret.flv", ErrBadRequest},
+		{"../../etc/passwd", ErrBadRequest},
+		{"/etc/passwd", ErrBadRequest},
+		{other, ErrBadRequest},
+	} {
+		_, err := s.UpdateDvrSRS(context.Background(), SRSStream{Action: "on_dvr", App: "live", StreamID: id, Cwd: cwd, File: tc.file})
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%s: want %v, have %v", tc.file, tc.want, err)
+		}
+	}
+
+	recs, _ := repo.GetRecordings(stream.StreamID)
+	if len(*recs) != 1 {
+		t.Fatalf("want 1 recording, have %d", len(*recs))
+	}
+	f, err := s.GetRecordingFile(context.Background(), stream.StreamID, (*recs)[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Body.Close()
+
+	// записи с чужим путем в базе не отдаются и не удаляются
+	repo.CreateRecording(Recording{StreamID: stream.StreamID, Type: RecordingTypeDVR, File: other})
+	recs, _ = repo.GetRecordings(stream.StreamID)
+	if _, err := s.GetRecordingFile(context.Background(), stream.StreamID, (*recs)[1].ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("foreign file: want ErrNotFound, have %v", err)
+	}
+	s.deleteDVR(stream)
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("foreign file was removed: %v", err)
+	}
+	if _, err := os.Stat(path.Join(dir, "rec.flv")); !os.IsNotExist(err) {
+		t.Errorf("recording was not removed: %v", err)
+	}
+}
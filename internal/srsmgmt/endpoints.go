@@ -2,32 +2,88 @@ package srsmgmt
 
 import (
 	"context"
+	"srsmgmt/pkg/playlist"
+	"srsmgmt/pkg/srsconfig"
 
 	"github.com/go-kit/kit/endpoint"
 	"github.com/gofrs/uuid"
 )
 
 type Endpoints struct {
-	GetStreamEndpoint       endpoint.Endpoint
-	CreateStreamEndpoint    endpoint.Endpoint
-	DeleteStreamEndpoint    endpoint.Endpoint
-	StartStreamEndpoint     endpoint.Endpoint
-	StopStreamEndpoint      endpoint.Endpoint
-	MonStreamEndpoint       endpoint.Endpoint
-	UpdateSRSStreamEndpoint endpoint.Endpoint
-	UpdateHlsSRSEndpoint    endpoint.Endpoint
+	GetStreamEndpoint        endpoint.Endpoint
+	CreateStreamEndpoint     endpoint.Endpoint
+	DeleteStreamEndpoint     endpoint.Endpoint
+	StartStreamEndpoint      endpoint.Endpoint
+	StopStreamEndpoint       endpoint.Endpoint
+	MonStreamEndpoint        endpoint.Endpoint
+	UpdateSRSStreamEndpoint  endpoint.Endpoint
+	UpdateHlsSRSEndpoint     endpoint.Endpoint
+	UpdateDvrSRSEndpoint     endpoint.Endpoint
+	VerifyStreamEndpoint     endpoint.Endpoint
+	GetRecordingsEndpoint    endpoint.Endpoint
+	GetRecordingFileEndpoint endpoint.Endpoint
+	GetStreamKeyEndpoint     endpoint.Endpoint
+	PlaybackTokenEndpoint    endpoint.Endpoint
+	AuthPlaybackEndpoint     endpoint.Endpoint
+	GetSubtitlesEndpoint     endpoint.Endpoint
+	PutSubtitlesEndpoint     endpoint.Endpoint
+	AddSubtitleCuesEndpoint  endpoint.Endpoint
+	DeleteSubtitlesEndpoint  endpoint.Endpoint
+	CreateMarkerEndpoint     endpoint.Endpoint
+	GetHLSEndpoint           endpoint.Endpoint
+	GetMarkersEndpoint       endpoint.Endpoint
+	DeleteMarkerEndpoint     endpoint.Endpoint
+	GetSRSConfigEndpoint     endpoint.Endpoint
+	PutProfileEndpoint       endpoint.Endpoint
+	GetProfilesEndpoint      endpoint.Endpoint
+	GetProfileEndpoint       endpoint.Endpoint
+	DeleteProfileEndpoint    endpoint.Endpoint
+	ReloadSRSConfigEndpoint  endpoint.Endpoint
+	GetSRSDriftEndpoint      endpoint.Endpoint
+	GetSRSNodesEndpoint      endpoint.Endpoint
+	CreateForwardEndpoint    endpoint.Endpoint
+	GetForwardsEndpoint      endpoint.Endpoint
+	UpdateForwardEndpoint    endpoint.Endpoint
+	DeleteForwardEndpoint    endpoint.Endpoint
 }
 
 func MakeServerEndpoints(s Service) Endpoints {
 	return Endpoints{
-		GetStreamEndpoint:       MakeGetStreamEndpoint(s),
-		CreateStreamEndpoint:    MakeCreateStreamEndpoint(s),
-		DeleteStreamEndpoint:    MakeDeleteStreamEndpoint(s),
-		StartStreamEndpoint:     MakeStartStreamEndpoint(s),
-		StopStreamEndpoint:      MakeStopStreamEndpoint(s),
-		MonStreamEndpoint:       MakeMonStreamEndpoint(s),
-		UpdateSRSStreamEndpoint: MakeUpdateSRSStreamEndpoint(s),
-		UpdateHlsSRSEndpoint:    MakeUpdateHlsSRSEndpoint(s),
+		GetStreamEndpoint:        MakeGetStreamEndpoint(s),
+		CreateStreamEndpoint:     MakeCreateStreamEndpoint(s),
+		DeleteStreamEndpoint:     MakeDeleteStreamEndpoint(s),
+		StartStreamEndpoint:      MakeStartStreamEndpoint(s),
+		StopStreamEndpoint:       MakeStopStreamEndpoint(s),
+		MonStreamEndpoint:        MakeMonStreamEndpoint(s),
+		UpdateSRSStreamEndpoint:  MakeUpdateSRSStreamEndpoint(s),
+		UpdateHlsSRSEndpoint:     MakeUpdateHlsSRSEndpoint(s),
+		UpdateDvrSRSEndpoint:     MakeUpdateDvrSRSEndpoint(s),
+		VerifyStreamEndpoint:     MakeVerifyStreamEndpoint(s),
+		GetRecordingsEndpoint:    MakeGetRecordingsEndpoint(s),
+		GetRecordingFileEndpoint: MakeGetRecordingFileEndpoint(s),
+		GetStreamKeyEndpoint:     MakeGetStreamKeyEndpoint(s),
+		PlaybackTokenEndpoint:    MakePlaybackTokenEndpoint(s),
+		AuthPlaybackEndpoint:     MakeAuthPlaybackEndpoint(s),
+		GetSubtitlesEndpoint:     MakeGetSubtitlesEndpoint(s),
+		PutSubtitlesEndpoint:     MakePutSubtitlesEndpoint(s),
+		AddSubtitleCuesEndpoint:  MakeAddSubtitleCuesEndpoint(s),
+		DeleteSubtitlesEndpoint:  MakeDeleteSubtitlesEndpoint(s),
+		CreateMarkerEndpoint:     MakeCreateMarkerEndpoint(s),
+		GetHLSEndpoint:           MakeGetHLSEndpoint(s),
+		GetMarkersEndpoint:       MakeGetMarkersEndpoint(s),
+		DeleteMarkerEndpoint:     MakeDeleteMarkerEndpoint(s),
+		GetSRSConfigEndpoint:     MakeGetSRSConfigEndpoint(s),
+		PutProfileEndpoint:       MakePutProfileEndpoint(s),
+		GetProfilesEndpoint:      MakeGetProfilesEndpoint(s),
+		GetProfileEndpoint:       MakeGetProfileEndpoint(s),
+		DeleteProfileEndpoint:    MakeDeleteProfileEndpoint(s),
+		ReloadSRSConfigEndpoint:  MakeReloadSRSConfigEndpoint(s),
+		GetSRSDriftEndpoint:      MakeGetSRSDriftEndpoint(s),
+		GetSRSNodesEndpoint:      MakeGetSRSNodesEndpoint(s),
+		CreateForwardEndpoint:    MakeCreateForwardEndpoint(s),
+		GetForwardsEndpoint:      MakeGetForwardsEndpoint(s),
+		UpdateForwardEndpoint:    MakeUpdateForwardEndpoint(s),
+		DeleteForwardEndpoint:    MakeDeleteForwardEndpoint(s),
 	}
 }
 
@@ -98,6 +154,250 @@ func MakeUpdateHlsSRSEndpoint(s Service) endpoint.Endpoint {
 	}
 }
 
+func MakeUpdateDvrSRSEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(updateDvrSRSRequest)
+		code, e := s.UpdateDvrSRS(ctx, req.Stream)
+
+		return updateDvrSRSResponse{Code: code}, e
+	}
+}
+
+func MakeVerifyStreamEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(verifyStreamRequest)
+		report, e := s.VerifyStream(ctx, req.ID, req.Repair)
+
+		return verifyStreamResponse{Report: report}, e
+	}
+}
+
+func MakeGetRecordingsEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getRecordingsRequest)
+		recs, e := s.GetRecordings(ctx, req.ID)
+
+		return getRecordingsResponse{Recordings: recs}, e
+	}
+}
+
+func MakeGetRecordingFileEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getRecordingFileRequest)
+		file, e := s.GetRecordingFile(ctx, req.StreamID, req.ID)
+
+		return getRecordingFileResponse{File: file}, e
+	}
+}
+
+func MakeGetStreamKeyEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getStreamKeyRequest)
+		key, e := s.GetStreamKey(ctx, req.ID, req.Period, req.Viewer)
+
+		return getStreamKeyResponse{Key: key}, e
+	}
+}
+
+func MakePlaybackTokenEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(playbackTokenRequest)
+		token, e := s.CreatePlaybackToken(ctx, req.ID, req.Request)
+
+		return playbackTokenResponse{Token: token}, e
+	}
+}
+
+func MakeAuthPlaybackEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(authPlaybackRequest)
+		token, e := s.AuthPlayback(ctx, req.Request)
+
+		return authPlaybackResponse{Token: token, SetCookie: req.FromQuery, CookiePath: playbackCookiePath(req.Request.URI)}, e
+	}
+}
+
+func MakeGetHLSEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getHLSRequest)
+		file, e := s.GetHLS(ctx, req.Request)
+		if e != nil {
+			return getHLSResponse{}, e
+		}
+
+		return getHLSResponse{File: file, SetCookie: req.FromQuery, CookiePath: req.CookiePath, NotModified: req.IfNoneMatch == file.ETag}, nil
+	}
+}
+
+func MakeGetSubtitlesEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getSubtitlesRequest)
+		tracks, e := s.GetSubtitles(ctx, req.ID)
+
+		return getSubtitlesResponse{Tracks: tracks}, e
+	}
+}
+
+func MakePutSubtitlesEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(putSubtitlesRequest)
+		track, e := s.PutSubtitles(ctx, req.Track, req.VTT)
+
+		return subtitleTrackResponse{Track: track}, e
+	}
+}
+
+func MakeAddSubtitleCuesEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(addSubtitleCuesRequest)
+		track, e := s.AddSubtitleCues(ctx, req.ID, req.Language, req.Cues)
+
+		return subtitleTrackResponse{Track: track}, e
+	}
+}
+
+func MakeDeleteSubtitlesEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(deleteSubtitlesRequest)
+		e := s.DeleteSubtitles(ctx, req.ID, req.Language)
+
+		return deleteSubtitlesResponse{Language: req.Language}, e
+	}
+}
+
+func MakeCreateMarkerEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(createMarkerRequest)
+		marker, e := s.CreateMarker(ctx, req.Marker)
+
+		return markerResponse{Marker: marker}, e
+	}
+}
+
+func MakeGetMarkersEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getMarkersRequest)
+		markers, e := s.GetMarkers(ctx, req.ID)
+
+		return getMarkersResponse{Markers: markers}, e
+	}
+}
+
+func MakeDeleteMarkerEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(deleteMarkerRequest)
+		e := s.DeleteMarker(ctx, req.ID, req.MarkerID)
+
+		return deleteMarkerResponse{ID: req.MarkerID}, e
+	}
+}
+
+func MakeCreateForwardEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(forwardRequest)
+		fwd, e := s.CreateForward(ctx, req.Forward)
+
+		return forwardResponse{Forward: fwd}, e
+	}
+}
+
+func MakeGetForwardsEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getForwardsRequest)
+		forwards, e := s.GetForwards(ctx, req.ID)
+
+		return getForwardsResponse{Forwards: forwards}, e
+	}
+}
+
+func MakeUpdateForwardEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(forwardRequest)
+		fwd, e := s.UpdateForward(ctx, req.Forward)
+
+		return forwardResponse{Forward: fwd}, e
+	}
+}
+
+func MakeDeleteForwardEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(deleteForwardRequest)
+		e := s.DeleteForward(ctx, req.ID, req.ForwardID)
+
+		return deleteForwardResponse{ID: req.ForwardID}, e
+	}
+}
+
+func MakeGetSRSConfigEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getSRSConfigRequest)
+		cfg, e := s.GetSRSConfig(ctx, req.Node)
+
+		return getSRSConfigResponse{Config: cfg, Format: req.Format}, e
+	}
+}
+
+func MakeReloadSRSConfigEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(srsNodeRequest)
+		stats, e := s.ReloadSRSConfig(ctx, req.Node)
+
+		return reloadSRSConfigResponse{Stats: stats}, e
+	}
+}
+
+func MakeGetSRSDriftEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getSRSDriftRequest)
+		drift, e := s.GetSRSDrift(ctx, req.Node, req.Check)
+
+		return getSRSDriftResponse{Drift: drift}, e
+	}
+}
+
+func MakeGetSRSNodesEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		nodes, e := s.GetSRSNodes(ctx)
+
+		return getSRSNodesResponse{Nodes: nodes}, e
+	}
+}
+
+func MakePutProfileEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(putProfileRequest)
+		profile, e := s.PutProfile(ctx, req.Profile)
+
+		return profileResponse{Profile: profile}, e
+	}
+}
+
+func MakeGetProfilesEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		profiles, e := s.GetProfiles(ctx)
+
+		return getProfilesResponse{Profiles: profiles}, e
+	}
+}
+
+func MakeGetProfileEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(profileRequest)
+		profile, e := s.GetProfile(ctx, req.Name)
+
+		return profileResponse{Profile: profile}, e
+	}
+}
+
+func MakeDeleteProfileEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(profileRequest)
+		e := s.DeleteProfile(ctx, req.Name)
+
+		return deleteProfileResponse{Name: req.Name}, e
+	}
+}
+
 type getStreamRequest struct {
 	Stream Stream `json:"stream,omitempty"`
 }
@@ -130,6 +430,14 @@ type updateHlsSRSResponse struct {
 	Code int `json:"code"`
 }
 
+type updateDvrSRSRequest struct {
+	Stream SRSStream `json:"stream,omitempty"`
+}
+
+type updateDvrSRSResponse struct {
+	Code int `json:"code"`
+}
+
 type deleteStreamRequest struct {
 	ID uuid.UUID `json:"streamId"`
 }
@@ -169,3 +477,207 @@ type startStreamRequest struct {
 type startStreamResponse struct {
 	Stream *Stream `json:"stream,omitempty"`
 }
+
+type verifyStreamRequest struct {
+	ID     uuid.UUID `json:"streamId"`
+	Repair bool      `json:"repair"`
+}
+
+type verifyStreamResponse struct {
+	Report *playlist.VerifyReport `json:"report,omitempty"`
+}
+
+type getRecordingsRequest struct {
+	ID uuid.UUID `json:"streamId"`
+}
+
+type getRecordingsResponse struct {
+	Recordings *[]Recording `json:"recordings,omitempty"`
+}
+
+type getRecordingFileRequest struct {
+	StreamID uuid.UUID
+	ID       uuid.UUID
+}
+
+type getRecordingFileResponse struct {
+	File *RecordingFile
+}
+
+type getStreamKeyRequest struct {
+	ID     uuid.UUID
+	Period int
+	Viewer PlaybackRequest
+}
+
+type getStreamKeyResponse struct {
+	Key []byte
+}
+
+type playbackTokenRequest struct {
+	ID      uuid.UUID
+	Request PlaybackTokenRequest
+}
+
+type playbackTokenResponse struct {
+	Token *PlaybackToken `json:"playback,omitempty"`
+}
+
+type authPlaybackRequest struct {
+	Request   PlaybackRequest
+	FromQuery bool
+}
+
+type authPlaybackResponse struct {
+	Token      *PlaybackToken
+	SetCookie  bool
+	CookiePath string
+}
+
+type getHLSRequest struct {
+	Request     HLSRequest
+	FromQuery   bool
+	CookiePath  string
+	IfNoneMatch string
+}
+
+type getHLSResponse struct {
+	File        *HLSFile
+	SetCookie   bool
+	CookiePath  string
+	NotModified bool
+}
+
+type getSubtitlesRequest struct {
+	ID uuid.UUID
+}
+
+type getSubtitlesResponse struct {
+	Tracks *[]SubtitleTrack `json:"subtitles,omitempty"`
+}
+
+type putSubtitlesRequest struct {
+	Track SubtitleTrack
+	VTT   []byte
+}
+
+type addSubtitleCuesRequest struct {
+	ID       uuid.UUID
+	Language string
+	Cues     []playlist.Cue
+}
+
+type subtitleTrackResponse struct {
+	Track *SubtitleTrack `json:"subtitle,omitempty"`
+}
+
+type deleteSubtitlesRequest struct {
+	ID       uuid.UUID
+	Language string
+}
+
+type deleteSubtitlesResponse struct {
+	Language string `json:"language"`
+}
+
+type createMarkerRequest struct {
+	Marker Marker
+}
+
+type markerResponse struct {
+	Marker *Marker `json:"marker,omitempty"`
+}
+
+type getMarkersRequest struct {
+	ID uuid.UUID
+}
+
+type getMarkersResponse struct {
+	Markers *[]Marker `json:"markers,omitempty"`
+}
+
+type deleteMarkerRequest struct {
+	ID       uuid.UUID
+	MarkerID uuid.UUID
+}
+
+type deleteMarkerResponse struct {
+	ID uuid.UUID `json:"id"`
+}
+
+type forwardRequest struct {
+	Forward ForwardDestination
+}
+
+type forwardResponse struct {
+	Forward *ForwardDestination `json:"forward,omitempty"`
+}
+
+type getForwardsRequest struct {
+	ID uuid.UUID
+}
+
+type getForwardsResponse struct {
+	Forwards *[]ForwardDestination `json:"forwards,omitempty"`
+}
+
+type deleteForwardRequest struct {
+	ID        uuid.UUID
+	ForwardID uuid.UUID
+}
+
+type deleteForwardResponse struct {
+	ID uuid.UUID `json:"id"`
+}
+
+type putProfileRequest struct {
+	Profile TranscodeProfile
+}
+
+type profileRequest struct {
+	Name string
+}
+
+type profileResponse struct {
+	Profile *TranscodeProfile `json:"profile,omitempty"`
+}
+
+type getProfilesResponse struct {
+	Profiles *[]TranscodeProfile `json:"profiles,omitempty"`
+}
+
+type deleteProfileResponse struct {
+	Name string `json:"name"`
+}
+
+// srsNodeRequest - запрос к узлу пула SRS, пустой Node - первый узел
+type srsNodeRequest struct {
+	Node string
+}
+
+type getSRSConfigRequest struct {
+	Node   string
+	Format string
+}
+
+type getSRSConfigResponse struct {
+	Config *srsconfig.Config `json:"config"`
+	Format string            `json:"-"`
+}
+
+type reloadSRSConfigResponse struct {
+	Stats *srsconfig.ReloadStats `json:"stats"`
+}
+
+type getSRSDriftRequest struct {
+	Node  string
+	Check bool
+}
+
+type getSRSDriftResponse struct {
+	Drift *srsconfig.DriftReport `json:"drift"`
+}
+
+type getSRSNodesResponse struct {
+	Nodes *[]NodeStatus `json:"nodes"`
+}
@@ -0,0 +1,203 @@
+package srsmgmt
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"srsmgmt/pkg/relay"
+	"srsmgmt/pkg/srsconfig"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/gofrs/uuid"
+)
+
+// swagger:model ForwardDestination
+type ForwardDestination struct {
+	ID        uuid.UUID    `json:"id"`
+	StreamID  uuid.UUID    `json:"streamId"`
+	Name      string       `json:"name,omitempty"`
+	URL       string       `json:"url"`
+	Key       string       `json:"key,omitempty"`
+	Enabled   bool         `json:"enabled"`
+	CreatedAt time.Time    `json:"createdAt"`
+	UpdatedAt time.Time    `json:"updatedAt"`
+	Relay     *relay.Stats `json:"relay,omitempty"`
+}
+
+// target - адрес публикации на платформе: URL и ключ стрима
+func (f ForwardDestination) target() string {
+	if f.Key == "" {
+		return f.URL
+	}
+	return strings.TrimSuffix(f.URL, "/") + "/" + f.Key
+}
+
+func (f ForwardDestination) relayID() string {
+	return "forward/" + f.ID.String()
+}
+
+func validateForward(f ForwardDestination) error {
+	u, err := url.Parse(f.URL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("%w: invalid url", ErrBadRequest)
+	}
+	switch u.Scheme {
+	case "rtmp", "rtmps", "srt":
+	default:
+		return fmt.Errorf("%w: url scheme must be rtmp, rtmps or srt", ErrBadRequest)
+	}
+	return nil
+}
+
+// forwardView скрывает ключ и добавляет состояние ретранслятора
+func (s *srsMgmtService) forwardView(f ForwardDestination) ForwardDestination {
+	if len(f.Key) > 4 {
+		f.Key = strings.Repeat("*", len(f.Key)-4) + f.Key[len(f.Key)-4:]
+	} else if f.Key != "" {
+		f.Key = "****"
+	}
+	stats := s.relays.Stats(f.relayID())
+	f.Relay = &stats
+	return f
+}
+
+func (s *srsMgmtService) CreateForward(ctx context.Context, fwd ForwardDestination) (*ForwardDestination, error) {
+	stream, err := s.repo.GetStream(fwd.StreamID)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	if err := validateForward(fwd); err != nil {
+		return nil, err
+	}
+
+	fwd.ID, _ = uuid.NewV4()
+	fwd.CreatedAt = time.Now()
+	fwd.UpdatedAt = fwd.CreatedAt
+	if err := s.repo.CreateForward(fwd); err != nil {
+		return nil, ErrInternalError
+	}
+	s.syncForward(stream, fwd)
+
+	resp := s.forwardView(fwd)
+	return &resp, nil
+}
+
+func (s *srsMgmtService) GetForwards(ctx context.Context, streamID uuid.UUID) (*[]ForwardDestination, error) {
+	if _, err := s.repo.GetStream(streamID); err != nil {
+		return nil, ErrNotFound
+	}
+	forwards, err := s.repo.GetForwards(streamID)
+	if err != nil {
+		return nil, ErrInternalError
+	}
+	resp := []ForwardDestination{}
+	for _, f := range *forwards {
+		resp = append(resp, s.forwardView(f))
+	}
+	return &resp, nil
+}
+
+// UpdateForward заменяет назначение, пустой ключ оставляет прежний
+func (s *srsMgmtService) UpdateForward(ctx context.Context, fwd ForwardDestination) (*ForwardDestination, error) {
+	stream, err := s.repo.GetStream(fwd.StreamID)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	prev, err := s.getForward(fwd.StreamID, fwd.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateForward(fwd); err != nil {
+		return nil, err
+	}
+
+	if fwd.Key == "" {
+		fwd.Key = prev.Key
+	}
+	fwd.CreatedAt = prev.CreatedAt
+	fwd.UpdatedAt = time.Now()
+	if err := s.repo.UpdateForward(fwd); err != nil {
+		return nil, ErrInternalError
+	}
+	s.syncForward(stream, fwd)
+
+	resp := s.forwardView(fwd)
+	return &resp, nil
+}
+
+func (s *srsMgmtService) DeleteForward(ctx context.Context, streamID uuid.UUID, forwardID uuid.UUID) error {
+	if _, err := s.repo.GetStream(streamID); err != nil {
+		return ErrNotFound
+	}
+	fwd, err := s.getForward(streamID, forwardID)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.DeleteForward(streamID, forwardID); err != nil {
+		return ErrInternalError
+	}
+	s.relays.Stop(fwd.relayID())
+	return nil
+}
+
+func (s *srsMgmtService) getForward(streamID uuid.UUID, forwardID uuid.UUID) (*ForwardDestination, error) {
+	forwards, err := s.repo.GetForwards(streamID)
+	if err != nil {
+		return nil, ErrInternalError
+	}
+	for _, f := range *forwards {
+		if f.ID == forwardID {
+			return &f, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// syncForward запускает ретранслятор включенного назначения публикуемого стрима
+// и останавливает остальные
+func (s *srsMgmtService) syncForward(stream *Stream, fwd ForwardDestination) {
+	if !fwd.Enabled || (stream.Status != StreamStatusPublish && stream.Status != StreamStatusStalled) {
+		s.relays.Stop(fwd.relayID())
+		return
+	}
+	s.relays.Start(fwd.relayID(), s.forwardArgs(stream, fwd), fwd.Key)
+}
+
+// startForwards запускает ретрансляторы назначений при публикации стрима
+func (s *srsMgmtService) startForwards(stream *Stream) {
+	forwards, err := s.repo.GetForwards(stream.StreamID)
+	if err != nil {
+		level.Error(s.logger).Log("forward", "GetForwards", "stream", stream.StreamID, "err", err)
+		return
+	}
+	for _, f := range *forwards {
+		s.syncForward(stream, f)
+	}
+}
+
+func (s *srsMgmtService) stopForwards(streamID uuid.UUID) {
+	forwards, err := s.repo.GetForwards(streamID)
+	if err != nil {
+		level.Error(s.logger).Log("forward", "GetForwards", "stream", streamID, "err", err)
+		return
+	}
+	for _, f := range *forwards {
+		s.relays.Stop(f.relayID())
+	}
+}
+
+// forwardArgs - аргументы ffmpeg: стрим забирается из SRS без перекодирования
+func (s *srsMgmtService) forwardArgs(stream *Stream, fwd ForwardDestination) []string {
+	source := fmt.Sprintf("%s/%s/%s", s.node(stream).LocalRTMPAddr, stream.App, stream.StreamID.String())
+	if stream.Profile != "" {
+		source += "?vhost=" + srsconfig.ProfileVhost(stream.Profile)
+	}
+	format := "flv"
+	if strings.HasPrefix(fwd.URL, "srt:") {
+		format = "mpegts"
+	}
+	return []string{"-hide_banner", "-loglevel", "error", "-rw_timeout", "10000000",
+		"-i", source, "-c", "copy", "-f", format, fwd.target()}
+}
@@ -0,0 +1,188 @@
+package srsmgmt
+
+import (
+	"context"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/gofrs/uuid"
+)
+
+const (
+	HealthOK      = "ok"
+	HealthStalled = "stalled"
+)
+
+// ingestState - время последних сегментов вариантов публикуемого стрима
+type ingestState struct {
+	since      time.Time
+	renditions map[string]time.Time
+}
+
+// last возвращает время последнего сегмента любого варианта или начала публикации
+func (st *ingestState) last() time.Time {
+	last := st.since
+	for _, t := range st.renditions {
+		if t.After(last) {
+			last = t
+		}
+	}
+	return last
+}
+
+// ingestTracker отслеживает поступление сегментов от on_hls
+type ingestTracker struct {
+	sync.Mutex
+	streams map[string]*ingestState
+}
+
+// start начинает отслеживание стрима с момента публикации
+func (it *ingestTracker) start(streamID string, now time.Time) {
+	it.Lock()
+	defer it.Unlock()
+	if it.streams == nil {
+		it.streams = map[string]*ingestState{}
+	}
+	it.streams[streamID] = &ingestState{since: now, renditions: map[string]time.Time{}}
+}
+
+func (it *ingestTracker) segment(streamID, rendition string, now time.Time) {
+	it.Lock()
+	defer it.Unlock()
+	if it.streams == nil {
+		it.streams = map[string]*ingestState{}
+	}
+	st, ok := it.streams[streamID]
+	if !ok {
+		st = &ingestState{since: now, renditions: map[string]time.Time{}}
+		it.streams[streamID] = st
+	}
+	st.renditions[rendition] = now
+}
+
+func (it *ingestTracker) stop(streamID string) {
+	it.Lock()
+	defer it.Unlock()
+	delete(it.streams, streamID)
+}
+
+func (it *ingestTracker) segments(streamID string) map[string]time.Time {
+	it.Lock()
+	defer it.Unlock()
+	st, ok := it.streams[streamID]
+	if !ok {
+		return nil
+	}
+	resp := map[string]time.Time{}
+	for k, v := range st.renditions {
+		resp[k] = v
+	}
+	return resp
+}
+
+// stalled возвращает стримы, от которых не было сегментов дольше threshold
+func (it *ingestTracker) stalled(threshold time.Duration, now time.Time) []string {
+	it.Lock()
+	defer it.Unlock()
+	resp := []string{}
+	for id, st := range it.streams {
+		if now.Sub(st.last()) > threshold {
+			resp = append(resp, id)
+		}
+	}
+	return resp
+}
+
+func (s *srsMgmtService) stallThreshold() time.Duration {
+	return time.Duration(s.cfg.StallThreshold) * time.Second
+}
+
+// trackSegment отмечает сегмент варианта и возвращает зависший стрим к публикации
+func (s *srsMgmtService) trackSegment(stream *Stream, m3u8 string) {
+	s.ingest.segment(stream.StreamID.String(), strings.TrimSuffix(path.Base(m3u8), ".m3u8"), time.Now())
+	if stream.Status != StreamStatusStalled {
+		return
+	}
+	level.Info(s.logger).Log("ingest", "resumed", "stream", stream.StreamID)
+	stream.Status = StreamStatusPublish
+	if _, err := s.repo.UpdateStream(*stream); err != nil {
+		level.Error(s.logger).Log("ingest", "UpdateStream", "stream", stream.StreamID, "err", err)
+	}
+}
+
+// addHealth заполняет состояние поступления сегментов публикуемого стрима
+func (s *srsMgmtService) addHealth(stream *Stream) {
+	switch stream.Status {
+	case StreamStatusPublish:
+		stream.Health = HealthOK
+	case StreamStatusStalled:
+		stream.Health = HealthStalled
+	default:
+		return
+	}
+	if segments := s.ingest.segments(stream.StreamID.String()); len(segments) > 0 {
+		stream.LastSegments = segments
+	}
+}
+
+func (s *srsMgmtService) runStallMonitor() {
+	threshold := s.stallThreshold()
+	interval := threshold / 4
+	if interval < time.Second {
+		interval = time.Second
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for range t.C {
+		s.checkStalls(threshold, time.Now())
+	}
+}
+
+func (s *srsMgmtService) checkStalls(threshold time.Duration, now time.Time) {
+	for _, id := range s.ingest.stalled(threshold, now) {
+		s.markStalled(id)
+	}
+}
+
+// markStalled переводит публикуемый стрим в StreamStatusStalled и при
+// включенном STALL_KICK отключает зависший кодировщик
+func (s *srsMgmtService) markStalled(id string) {
+	streamID, err := uuid.FromString(id)
+	if err != nil {
+		s.ingest.stop(id)
+		return
+	}
+	stream, err := s.repo.GetStream(streamID)
+	if err != nil {
+		s.ingest.stop(id)
+		return
+	}
+
+	switch stream.Status {
+	case StreamStatusPublish:
+		level.Error(s.logger).Log("ingest", "stalled", "stream", id, "threshold", s.stallThreshold())
+		stream.Status = StreamStatusStalled
+		if _, err := s.repo.UpdateStream(*stream); err != nil {
+			level.Error(s.logger).Log("ingest", "UpdateStream", "stream", id, "err", err)
+			return
+		}
+	case StreamStatusStalled:
+	default:
+		s.ingest.stop(id)
+		return
+	}
+
+	if s.cfg.StallKick && stream.ClientId != "" {
+		level.Info(s.logger).Log("Kicking client ", stream.ClientId)
+		if err := s.node(stream).Client.KickSRSStream(context.Background(), stream.ClientId); err != nil {
+			level.Error(s.logger).Log("ingest", "KickSRSStream", "stream", id, "err", err)
+			return
+		}
+		// после отключения SRS пришлет on_unpublish
+		s.ingest.stop(id)
+	}
+}
@@ -0,0 +1,126 @@
+package srsmgmt
+
+import (
+	"context"
+	"srsmgmt/config"
+	"srsmgmt/pkg/srsclient"
+	"testing"
+	"time"
+)
+
+// kickClient запоминает отключенных клиентов, остальные методы SRS паникуют
+type kickClient struct {
+	srsclient.SrsClient
+	kicked []string
+}
+
+func (c *kickClient) KickSRSStream(_ context.Context, clientID string) error {
+	c.kicked = append(c.kicked, clientID)
+	return nil
+}
+
+func TestIngestTracker(t *testing.T) {
+	var it ingestTracker
+	start := time.Now()
+	threshold := 10 * time.Second
+
+	it.start("a", start)
+	it.start("b", start)
+	it.segment("a", "high", start.Add(5*time.Second))
+	it.segment("a", "low", start.Add(8*time.Second))
+	// сегмент стрима без on_publish тоже отслеживается
+	it.segment("c", "high", start.Add(9*time.Second))
+
+	for _, tc := range []struct {
+		at   time.Duration
+		want []string
+	}{
+		{10 * time.Second, nil},
+		{11 * time.Second, []string{"b"}},
+		{18 * time.Second, []string{"b"}},
+		{19 * time.Second, []string{"a", "b"}},
+		{20 * time.Second, []string{"a", "b", "c"}},
+	} {
+		have := map[string]bool{}
+		for _, id := range it.stalled(threshold, start.Add(tc.at)) {
+			have[id] = true
+		}
+		if len(have) != len(tc.want) {
+			t.Errorf("at %v: want %v, have %v", tc.at, tc.want, have)
+		}
+		for _, id := range tc.want {
+			if !have[id] {
+				t.Errorf("at %v: want %v, have %v", tc.at, tc.want, have)
+			}
+		}
+	}
+
+	if segments := it.segments("a"); len(segments) != 2 || !segments["low"].Equal(start.Add(8*time.Second)) {
+		t.Errorf("unexpected segments %v", segments)
+	}
+	it.stop("b")
+	if segments := it.segments("b"); segments != nil {
+		t.Errorf("stopped stream has segments %v", segments)
+	}
+}
+
+func TestStallMonitor(t *testing.T) {
+	for _, kick := range []bool{false, true} {
+		repo := newMemRepo()
+		s := newTestService(t, repo, config.Config{StallThreshold: 10, StallKick: kick})
+		client := &kickClient{}
+		s.nodes[0].Client = client
+
+		stream := newTestStream(t, repo, "live")
+		stream.Status, stream.ClientId = StreamStatusPublish, "client-1"
+		repo.UpdateStream(*stream)
+		id := stream.StreamID.String()
+		start := time.Now()
+		s.ingest.start(id, start)
+
+		status := func() int {
+			st, _ := repo.GetStream(stream.StreamID)
+			return st.Status
+		}
+
+		s.checkStalls(s.stallThreshold(), start.Add(10*time.Second))
+		if status() != StreamStatusPublish || len(client.kicked) != 0 {
+			t.Fatalf("kick=%v: stalled at the threshold", kick)
+		}
+
+		s.checkStalls(s.stallThreshold(), start.Add(11*time.Second))
+		if status() != StreamStatusStalled {
+			t.Fatalf("kick=%v: want status %d, have %d", kick, StreamStatusStalled, status())
+		}
+		if kick && (len(client.kicked) != 1 || client.kicked[0] != "client-1") {
+			t.Errorf("kick=%v: want client kicked, have %v", kick, client.kicked)
+		}
+		if !kick && len(client.kicked) != 0 {
+			t.Errorf("kick=%v: client kicked without STALL_KICK: %v", kick, client.kicked)
+		}
+		st, _ := repo.GetStream(stream.StreamID)
+		s.addHealth(st)
+		if st.Health != HealthStalled {
+			t.Errorf("kick=%v: want health %s, have %s", kick, HealthStalled, st.Health)
+		}
+
+		// после отключения стрим больше не отслеживается до новой публикации
+		if kick {
+			if stalled := s.ingest.stalled(s.stallThreshold(), start.Add(time.Minute)); len(stalled) != 0 {
+				t.Errorf("kicked stream is still tracked: %v", stalled)
+			}
+			continue
+		}
+
+		// новый сегмент возвращает стрим к публикации
+		s.trackSegment(st, "/live/"+id+"/high.m3u8")
+		if status() != StreamStatusPublish {
+			t.Errorf("want status %d after a segment, have %d", StreamStatusPublish, status())
+		}
+		st, _ = repo.GetStream(stream.StreamID)
+		s.addHealth(st)
+		if st.Health != HealthOK || st.LastSegments["high"].IsZero() {
+			t.Errorf("unexpected health %s, segments %v", st.Health, st.LastSegments)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package srsmgmt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"srsmgmt/pkg/playlist"
+	"sync"
+
+	"github.com/gofrs/uuid"
+)
+
+const (
+	hlsKeySize = 16
+)
+
+type StreamKey struct {
+	StreamID uuid.UUID
+	Period   int
+	Key      []byte
+	IV       []byte
+}
+
+// keyStore кэширует ключи шифрования и настройки ротации зашифрованных стримов
+type keyStore struct {
+	sync.Mutex
+	rotation map[string]int
+	keys     map[string]map[int]*StreamKey
+}
+
+func (k *keyStore) setRotation(streamID string, rotation int) {
+	k.Lock()
+	defer k.Unlock()
+	if k.rotation == nil {
+		k.rotation = map[string]int{}
+	}
+	k.rotation[streamID] = rotation
+}
+
+func (k *keyStore) getRotation(streamID string) (int, bool) {
+	k.Lock()
+	defer k.Unlock()
+	rotation, ok := k.rotation[streamID]
+	return rotation, ok
+}
+
+func (k *keyStore) remove(streamID string) {
+	k.Lock()
+	defer k.Unlock()
+	delete(k.rotation, streamID)
+	delete(k.keys, streamID)
+}
+
+// get возвращает ключ периода ротации, при create=true создает отсутствующий ключ
+func (k *keyStore) get(repo Repository, streamID uuid.UUID, period int, create bool) (*StreamKey, error) {
+	k.Lock()
+	defer k.Unlock()
+
+	// отсутствие ключа тоже кэшируется, чтобы не ходить в базу на каждом обновлении плейлиста
+	if key, ok := k.keys[streamID.String()][period]; ok && (key != nil || !create) {
+		if key == nil {
+			return nil, ErrNotFound
+		}
+		return key, nil
+	}
+
+	key, err := repo.GetStreamKey(streamID, period)
+	if err != nil && !create {
+		key = nil
+	} else if err != nil {
+		key = &StreamKey{
+			StreamID: streamID,
+			Period:   period,
+			Key:      make([]byte, hlsKeySize),
+			IV:       make([]byte, aes.BlockSize),
+		}
+		if _, err := rand.Read(key.Key); err != nil {
+			return nil, err
+		}
+		if _, err := rand.Read(key.IV); err != nil {
+			return nil, err
+		}
+		if err := repo.CreateStreamKey(*key); err != nil {
+			return nil, err
+		}
+	}
+
+	if k.keys == nil {
+		k.keys = map[string]map[int]*StreamKey{}
+	}
+	if k.keys[streamID.String()] == nil {
+		k.keys[streamID.String()] = map[int]*StreamKey{}
+	}
+	k.keys[streamID.String()][period] = key
+
+	if key == nil {
+		return nil, ErrNotFound
+	}
+	return key, nil
+}
+
+// trackKeys регистрирует зашифрованный стрим для добавления EXT-X-KEY в плейлисты
+func (s *srsMgmtService) trackKeys(stream *Stream) {
+	if stream.Encrypted {
+		s.keys.setRotation(stream.StreamID.String(), s.keyRotation(stream))
+	}
+}
+
+func (s *srsMgmtService) keyRotation(stream *Stream) int {
+	if stream.KeyRotation > 0 {
+		return stream.KeyRotation
+	}
+	if s.cfg.HLSKeyRotation > 0 {
+		return s.cfg.HLSKeyRotation
+	}
+	return 1
+}
+
+// encryptSegment шифрует сегмент на месте ключом его периода ротации
+func (s *srsMgmtService) encryptSegment(stream *Stream, segmentPath string) error {
+	seq, ok := playlist.SegmentSeq(segmentPath)
+	if !ok {
+		return ErrBadRequest
+	}
+	s.trackKeys(stream)
+
+	key, err := s.keys.get(s.repo, stream.StreamID, seq/s.keyRotation(stream), true)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(segmentPath)
+	if err != nil {
+		return err
+	}
+	encrypted, err := encryptAES128(data, key.Key, segmentIV(key, segmentPath))
+	if err != nil {
+		return err
+	}
+
+	tmp := segmentPath + ".tmp"
+	if err := os.WriteFile(tmp, encrypted, 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, segmentPath)
+}
+
+// keyHook добавляет EXT-X-KEY к сегментам зашифрованных стримов
+func (s *srsMgmtService) keyHook(livePath string, seg *playlist.Segment) {
+	id := path.Base(livePath)
+	rotation, ok := s.keys.getRotation(id)
+	if !ok {
+		return
+	}
+	seq, ok := playlist.SegmentSeq(seg.Name)
+	if !ok {
+		return
+	}
+	streamID, err := uuid.FromString(id)
+	if err != nil {
+		return
+	}
+	period := seq / rotation
+	key, err := s.keys.get(s.repo, streamID, period, false)
+	if err != nil {
+		return
+	}
+
+	seg.Key = fmt.Sprintf(`#EXT-X-KEY:METHOD=AES-128,URI="%s/api/v1/stream/%s/key/%d",IV=0x%s`, s.cfg.HLSKeyURL, id, period, hex.EncodeToString(segmentIV(key, seg.Name)))
+}
+
+// segmentIV возвращает IV сегмента. Ключ периода общий для всех сегментов и
+// вариантов, поэтому IV у каждого сегмента свой: он выводится из имени файла,
+// а сохраненный IV периода служит солью
+func segmentIV(key *StreamKey, name string) []byte {
+	sum := sha256.Sum256(append(append([]byte{}, key.IV...), path.Base(name)...))
+	return sum[:aes.BlockSize]
+}
+
+func encryptAES128(data, key, iv []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	padding := aes.BlockSize - len(data)%aes.BlockSize
+	padded := append(data, bytes.Repeat([]byte{byte(padding)}, padding)...)
+
+	encrypted := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, padded)
+	return encrypted, nil
+}
+
+func newViewerToken() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+func validViewerToken(stream *Stream, token string) bool {
+	return stream.ViewerToken != "" && subtle.ConstantTimeCompare([]byte(stream.ViewerToken), []byte(token)) == 1
+}
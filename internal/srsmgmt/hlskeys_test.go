@@ -0,0 +1,284 @@
+package srsmgmt
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"srsmgmt/config"
+	"srsmgmt/pkg/playauth"
+	"srsmgmt/pkg/playlist"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// decryptAES128 расшифровывает сегмент, как это делает плеер, и снимает PKCS#7
+func decryptAES128(t *testing.T, data, key, iv []byte) []byte {
+	t.Helper()
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		t.Fatalf("encrypted size %d is not a multiple of the block size", len(data))
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+	padding := int(plain[len(plain)-1])
+	if padding == 0 || padding > aes.BlockSize || !bytes.Equal(plain[len(plain)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		t.Fatalf("invalid padding % x", plain[len(plain)-aes.BlockSize:])
+	}
+	return plain[:len(plain)-padding]
+}
+
+func TestEncryptAES128(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, hlsKeySize)
+	iv := bytes.Repeat([]byte{2}, aes.BlockSize)
+	otherIV := bytes.Repeat([]byte{3}, aes.BlockSize)
+
+	for _, tc := range []struct {
+		size, encrypted int
+	}{
+		{0, 16},
+		{1, 16},
+		{15, 16},
+		{16, 32},
+		{17, 32},
+		{188 * 7, 1328},
+	} {
+		data := bytes.Repeat([]byte{0x47}, tc.size)
+		encrypted, err := encryptAES128(data, key, iv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(encrypted) != tc.encrypted {
+			t.Errorf("%d bytes: want %d encrypted, have %d", tc.size, tc.encrypted, len(encrypted))
+		}
+		if plain := decryptAES128(t, encrypted, key, iv); !bytes.Equal(plain, data) {
+			t.Errorf("%d bytes: decrypted data differs", tc.size)
+		}
+		// IV периода входит в шифротекст, с чужим IV сегмент не совпадает
+		if other, _ := encryptAES128(data, key, otherIV); bytes.Equal(other, encrypted) {
+			t.Errorf("%d bytes: IV is not used", tc.size)
+		}
+	}
+
+	if _, err := encryptAES128([]byte("data"), []byte("short"), iv); err == nil {
+		t.Error("want error for invalid key size")
+	}
+}
+
+// TestEncryptSegmentRotation: сегменты одного периода ротации шифруются
+// одним ключом, каждый период получает свой ключ, каждый сегмент - свой IV
+func TestEncryptSegmentRotation(t *testing.T) {
+	repo := newMemRepo()
+	s := newTestService(t, repo, config.Config{HLSKeyURL: "https://keys.example.com"})
+	stream := newTestStream(t, repo, "live")
+	stream.Encrypted, stream.KeyRotation = true, 3
+	repo.UpdateStream(*stream)
+	dir := s.livePath(stream)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	id := stream.StreamID.String()
+
+	ivs := map[string]string{}
+	for _, tc := range []struct {
+		rendition   string
+		seq, period int
+	}{
+		{"high", 0, 0}, {"low", 0, 0}, {"high", 1, 0}, {"high", 2, 0}, {"high", 3, 1},
+		{"low", 3, 1}, {"high", 5, 1}, {"high", 6, 2}, {"high", 10, 3},
+	} {
+		name := fmt.Sprintf("%s-2024-01-01-00-00-00-2000-%d.ts", tc.rendition, tc.seq)
+		data := bytes.Repeat([]byte{byte(tc.seq)}, 188*3)
+		if err := os.WriteFile(path.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.encryptSegment(stream, path.Join(dir, name)); err != nil {
+			t.Fatalf("seq %d: %v", tc.seq, err)
+		}
+
+		key, err := repo.GetStreamKey(stream.StreamID, tc.period)
+		if err != nil {
+			t.Fatalf("seq %d: no key for period %d", tc.seq, tc.period)
+		}
+		// плеер расшифровывает сегмент ключом и IV из EXT-X-KEY
+		seg := playlist.Segment{Name: name}
+		s.keyHook(dir, &seg)
+		prefix := fmt.Sprintf(`#EXT-X-KEY:METHOD=AES-128,URI="https://keys.example.com/api/v1/stream/%s/key/%d",IV=0x`, id, tc.period)
+		if !strings.HasPrefix(seg.Key, prefix) {
+			t.Fatalf("%s:\nwant %s...\nhave %s", name, prefix, seg.Key)
+		}
+		iv, err := hex.DecodeString(strings.TrimPrefix(seg.Key, prefix))
+		if err != nil || len(iv) != aes.BlockSize {
+			t.Fatalf("%s: invalid IV in %s", name, seg.Key)
+		}
+		encrypted, _ := os.ReadFile(path.Join(dir, name))
+		if plain := decryptAES128(t, encrypted, key.Key, iv); !bytes.Equal(plain, data) {
+			t.Errorf("%s: decrypted segment differs", name)
+		}
+		if other, ok := ivs[string(iv)]; ok {
+			t.Errorf("%s reuses the IV of %s", name, other)
+		}
+		ivs[string(iv)] = name
+	}
+
+	if n := len(repo.keys[stream.StreamID]); n != 4 {
+		t.Errorf("want 4 keys, have %d", n)
+	}
+	seen := map[string]bool{}
+	for period, k := range repo.keys[stream.StreamID] {
+		if seen[string(k.Key)] {
+			t.Errorf("period %d reuses a key", period)
+		}
+		seen[string(k.Key)] = true
+	}
+}
+
+// tsSegment собирает MPEG-TS из PAT, PMT и одного PES видео с заданным PTS
+func tsSegment(pts int64) []byte {
+	packet := func(pid uint16, payload []byte) []byte {
+		pkt := make([]byte, 188)
+		pkt[0], pkt[1], pkt[2], pkt[3] = 0x47, 0x40|byte(pid>>8), byte(pid), 0x10
+		for i := copy(pkt[4:], payload) + 4; i < len(pkt); i++ {
+			pkt[i] = 0xff
+		}
+		return pkt
+	}
+	pat := []byte{0x00, 0x00, 0xb0, 0x0d, 0x00, 0x01, 0xc1, 0x00, 0x00, 0x00, 0x01, 0xf0, 0x00, 0, 0, 0, 0}
+	pmt := []byte{0x00, 0x02, 0xb0, 0x12, 0x00, 0x01, 0xc1, 0x00, 0x00, 0xe1, 0x00, 0xf0, 0x00,
+		0x1b, 0xe1, 0x00, 0xf0, 0x00, 0, 0, 0, 0}
+	pes := []byte{0, 0, 1, 0xe0, 0, 0, 0x80, 0x80, 5,
+		byte(0x21 | (pts>>29)&0x0e), byte(pts >> 22), byte(0x01 | (pts>>14)&0xfe), byte(pts >> 7), byte(0x01 | (pts<<1)&0xfe)}
+	return append(append(packet(0, pat), packet(0x1000, pmt)...), packet(0x100, pes)...)
+}
+
+// TestEncryptedSessionPTS: PTS начала трансляции для субтитров берется
+// из сегмента до его шифрования
+func TestEncryptedSessionPTS(t *testing.T) {
+	repo := newMemRepo()
+	s := newTestService(t, repo, config.Config{HLSKeyURL: "https://keys.example.com"})
+	s.playlist = playlist.New()
+	stream := newTestStream(t, repo, "live")
+	started := time.Now().Add(-time.Minute)
+	stream.Encrypted, stream.Status, stream.StartedAt = true, StreamStatusPublish, &started
+	repo.UpdateStream(*stream)
+	dir := s.livePath(stream)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for seq, pts := range []int64{900000, 1080000} {
+		file := path.Join(dir, fmt.Sprintf("high-%s-2000-%d.ts", time.Now().Format("2006-01-02-15-04-05"), seq))
+		if err := os.WriteFile(file, tsSegment(pts), 0644); err != nil {
+			t.Fatal(err)
+		}
+		st := SRSStream{Action: "on_hls", App: "live", StreamID: stream.StreamID.String(), File: file, M3U8: path.Join(dir, "high.m3u8"), Seq_no: seq}
+		s.UpdateHlsSRS(context.Background(), st)
+		if _, err := playlist.SegmentStartPTS(file); err == nil {
+			t.Fatalf("segment %d is not encrypted", seq)
+		}
+	}
+
+	if pts, ok := s.subtitles.startPTS(stream.StreamID.String()); !ok || pts != 900000 {
+		t.Errorf("want session PTS 900000, have %d, %v", pts, ok)
+	}
+}
+
+func TestKeyStoreNegativeCache(t *testing.T) {
+	repo := newMemRepo()
+	var keys keyStore
+	id := uuid.Must(uuid.NewV4())
+
+	for i := 0; i < 3; i++ {
+		if _, err := keys.get(repo, id, 0, false); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("want %v, have %v", ErrNotFound, err)
+		}
+	}
+	if repo.keyReads != 1 {
+		t.Errorf("missing key: want 1 read, have %d", repo.keyReads)
+	}
+
+	// отсутствие в кэше не мешает создать ключ при шифровании
+	created, err := keys.get(repo, id, 0, true)
+	if err != nil || len(created.Key) != hlsKeySize || len(created.IV) != aes.BlockSize {
+		t.Fatalf("key is not created: %+v, %v", created, err)
+	}
+	if key, err := keys.get(repo, id, 0, false); err != nil || key != created {
+		t.Errorf("want cached key, have %+v, %v", key, err)
+	}
+	if repo.keyReads != 2 {
+		t.Errorf("want 2 reads, have %d", repo.keyReads)
+	}
+
+	// ключ, созданный другим процессом, читается из базы
+	repo.CreateStreamKey(StreamKey{StreamID: id, Period: 1, Key: make([]byte, hlsKeySize), IV: make([]byte, aes.BlockSize)})
+	if _, err := keys.get(repo, id, 1, false); err != nil {
+		t.Errorf("stored key: %v", err)
+	}
+
+	keys.remove(id.String())
+	keys.get(repo, id, 0, false)
+	if repo.keyReads != 4 {
+		t.Errorf("removed stream: want a new read, have %d reads", repo.keyReads)
+	}
+}
+
+func TestGetStreamKeyToken(t *testing.T) {
+	repo := newMemRepo()
+	s := newTestService(t, repo, config.Config{})
+	s.playAuth = playauth.New("secret")
+
+	stream := newTestStream(t, repo, "live")
+	stream.Encrypted, stream.ViewerToken = true, "viewer"
+	repo.UpdateStream(*stream)
+	key := bytes.Repeat([]byte{7}, hlsKeySize)
+	repo.CreateStreamKey(StreamKey{StreamID: stream.StreamID, Period: 0, Key: key, IV: make([]byte, aes.BlockSize)})
+	plain := newTestStream(t, repo, "live")
+
+	sign := func(streamID uuid.UUID, expires time.Time, ip string) string {
+		token, err := s.playAuth.Sign(playauth.Claims{StreamID: streamID.String(), Expires: expires.Unix(), IP: ip})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	hour := time.Now().Add(time.Hour)
+
+	for _, tc := range []struct {
+		name     string
+		streamID uuid.UUID
+		period   int
+		req      PlaybackRequest
+		want     error
+	}{
+		{"viewer token", stream.StreamID, 0, PlaybackRequest{Token: "viewer"}, nil},
+		{"playback token", stream.StreamID, 0, PlaybackRequest{Token: sign(stream.StreamID, hour, "")}, nil},
+		{"playback token for ip", stream.StreamID, 0, PlaybackRequest{Token: sign(stream.StreamID, hour, "10.0.0.1"), IP: "10.0.0.1"}, nil},
+		{"no token", stream.StreamID, 0, PlaybackRequest{}, ErrUnauthorized},
+		{"wrong viewer token", stream.StreamID, 0, PlaybackRequest{Token: "viewer2"}, ErrUnauthorized},
+		{"foreign playback token", stream.StreamID, 0, PlaybackRequest{Token: sign(plain.StreamID, hour, "")}, ErrUnauthorized},
+		{"expired playback token", stream.StreamID, 0, PlaybackRequest{Token: sign(stream.StreamID, time.Now().Add(-time.Minute), "")}, ErrUnauthorized},
+		{"playback token from other ip", stream.StreamID, 0, PlaybackRequest{Token: sign(stream.StreamID, hour, "10.0.0.1"), IP: "10.0.0.2"}, ErrUnauthorized},
+		{"missing period", stream.StreamID, 1, PlaybackRequest{Token: "viewer"}, ErrNotFound},
+		{"unencrypted stream", plain.StreamID, 0, PlaybackRequest{Token: "viewer"}, ErrNotFound},
+		{"unknown stream", uuid.Must(uuid.NewV4()), 0, PlaybackRequest{Token: "viewer"}, ErrNotFound},
+	} {
+		have, err := s.GetStreamKey(context.Background(), tc.streamID, tc.period, tc.req)
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%s: want %v, have %v", tc.name, tc.want, err)
+		}
+		if err == nil && !bytes.Equal(have, key) {
+			t.Errorf("%s: wrong key", tc.name)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package srsmgmt
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"path"
+	"regexp"
+	"sort"
+	"srsmgmt/pkg/playlist"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+var (
+	reMarkerAttribute = regexp.MustCompile(`^X-[A-Z0-9-]+$`)
+	reHexSequence     = regexp.MustCompile(`^0[xX][0-9a-fA-F]+$`)
+)
+
+// swagger:model Marker
+type Marker struct {
+	ID         uuid.UUID         `json:"id"`
+	StreamID   uuid.UUID         `json:"streamId"`
+	Class      string            `json:"class,omitempty"`
+	StartDate  time.Time         `json:"startDate"`
+	Duration   float64           `json:"duration,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	SCTE35Cmd  string            `json:"scte35Cmd,omitempty"`
+	SCTE35Out  string            `json:"scte35Out,omitempty"`
+	SCTE35In   string            `json:"scte35In,omitempty"`
+	CreatedAt  time.Time         `json:"createdAt"`
+}
+
+// markerStore кэширует метки стримов для записи в плейлисты при каждом on_hls
+type markerStore struct {
+	sync.Mutex
+	markers map[string][]Marker
+}
+
+func (ms *markerStore) get(repo Repository, streamID uuid.UUID) ([]Marker, error) {
+	ms.Lock()
+	defer ms.Unlock()
+
+	if markers, ok := ms.markers[streamID.String()]; ok {
+		return markers, nil
+	}
+	markers, err := repo.GetMarkers(streamID)
+	if err != nil {
+		return nil, err
+	}
+	if ms.markers == nil {
+		ms.markers = map[string][]Marker{}
+	}
+	ms.markers[streamID.String()] = *markers
+	return *markers, nil
+}
+
+func (ms *markerStore) set(streamID uuid.UUID, markers []Marker) {
+	ms.Lock()
+	defer ms.Unlock()
+	if ms.markers == nil {
+		ms.markers = map[string][]Marker{}
+	}
+	ms.markers[streamID.String()] = markers
+}
+
+func (ms *markerStore) remove(streamID string) {
+	ms.Lock()
+	defer ms.Unlock()
+	delete(ms.markers, streamID)
+}
+
+// CreateMarker добавляет метку, она попадет в плейлисты при следующем обновлении
+func (s *srsMgmtService) CreateMarker(ctx context.Context, marker Marker) (*Marker, error) {
+	if _, err := s.repo.GetStream(marker.StreamID); err != nil {
+		return nil, ErrNotFound
+	}
+	if err := normalizeMarker(&marker); err != nil {
+		return nil, err
+	}
+
+	markers, err := s.markers.get(s.repo, marker.StreamID)
+	if err != nil {
+		return nil, ErrInternalError
+	}
+
+	marker.ID, _ = uuid.NewV4()
+	marker.CreatedAt = time.Now()
+	if err := s.repo.CreateMarker(marker); err != nil {
+		return nil, ErrInternalError
+	}
+
+	updated := append(append([]Marker{}, markers...), marker)
+	sort.SliceStable(updated, func(i, j int) bool { return updated[i].StartDate.Before(updated[j].StartDate) })
+	s.markers.set(marker.StreamID, updated)
+
+	return &marker, nil
+}
+
+func (s *srsMgmtService) GetMarkers(ctx context.Context, streamID uuid.UUID) (*[]Marker, error) {
+	if _, err := s.repo.GetStream(streamID); err != nil {
+		return nil, ErrNotFound
+	}
+
+	markers, err := s.markers.get(s.repo, streamID)
+	if err != nil {
+		return nil, ErrInternalError
+	}
+	return &markers, nil
+}
+
+func (s *srsMgmtService) DeleteMarker(ctx context.Context, streamID uuid.UUID, markerID uuid.UUID) error {
+	if _, err := s.repo.GetStream(streamID); err != nil {
+		return ErrNotFound
+	}
+	markers, err := s.markers.get(s.repo, streamID)
+	if err != nil {
+		return ErrInternalError
+	}
+
+	rest := []Marker{}
+	for _, m := range markers {
+		if m.ID != markerID {
+			rest = append(rest, m)
+		}
+	}
+	if len(rest) == len(markers) {
+		return ErrNotFound
+	}
+
+	if err := s.repo.DeleteMarker(streamID, markerID); err != nil {
+		return ErrInternalError
+	}
+	s.markers.set(streamID, rest)
+
+	return nil
+}
+
+// normalizeMarker проверяет метку и приводит атрибуты к виду EXT-X-DATERANGE
+func normalizeMarker(m *Marker) error {
+	if m.StartDate.IsZero() {
+		m.StartDate = time.Now()
+	}
+	if m.Duration < 0 || !quotable(m.Class) {
+		return ErrBadRequest
+	}
+
+	attrs := map[string]string{}
+	for name, value := range m.Attributes {
+		name = strings.ToUpper(name)
+		if !reMarkerAttribute.MatchString(name) || !quotable(value) {
+			return ErrBadRequest
+		}
+		attrs[name] = value
+	}
+	m.Attributes = attrs
+
+	for _, scte := range []*string{&m.SCTE35Cmd, &m.SCTE35Out, &m.SCTE35In} {
+		value, err := scte35Hex(*scte)
+		if err != nil {
+			return ErrBadRequest
+		}
+		*scte = value
+	}
+	return nil
+}
+
+func quotable(value string) bool {
+	return !strings.ContainsAny(value, "\"\r\n")
+}
+
+// scte35Hex принимает splice_info_section в hex (0x...) или base64,
+// как его отдает большинство кодировщиков, и возвращает hex
+func scte35Hex(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	if reHexSequence.MatchString(value) {
+		return "0x" + strings.ToUpper(value[2:]), nil
+	}
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(data) == 0 {
+		return "", ErrBadRequest
+	}
+	return "0x" + strings.ToUpper(hex.EncodeToString(data)), nil
+}
+
+// markerSource отдает метки стрима для EXT-X-DATERANGE в медиа-плейлистах
+func (s *srsMgmtService) markerSource(livePath string) []playlist.DateRange {
+	streamID, err := uuid.FromString(path.Base(livePath))
+	if err != nil {
+		return nil
+	}
+	markers, err := s.markers.get(s.repo, streamID)
+	if err != nil {
+		return nil
+	}
+	resp := []playlist.DateRange{}
+	for _, m := range markers {
+		resp = append(resp, playlist.DateRange{
+			ID:         m.ID.String(),
+			Class:      m.Class,
+			StartDate:  m.StartDate,
+			Duration:   m.Duration,
+			Attributes: m.Attributes,
+			SCTE35Cmd:  m.SCTE35Cmd,
+			SCTE35Out:  m.SCTE35Out,
+			SCTE35In:   m.SCTE35In,
+		})
+	}
+	return resp
+}
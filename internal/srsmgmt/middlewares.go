@@ -3,6 +3,8 @@ package srsmgmt
 import (
 	"context"
 	"fmt"
+	"srsmgmt/pkg/playlist"
+	"srsmgmt/pkg/srsconfig"
 	"time"
 
 	"github.com/go-kit/kit/endpoint"
@@ -85,6 +87,167 @@ func (mw loggingMiddleware) UpdateHlsSRS(ctx context.Context, s SRSStream) (code
 	return mw.next.UpdateHlsSRS(ctx, s)
 }
 
+func (mw loggingMiddleware) VerifyStream(ctx context.Context, s uuid.UUID, repair bool) (r *playlist.VerifyReport, err error) {
+	defer func(begin time.Time) {
+		level.Info(mw.logger).Log("method", "VerifyStream", "id", s, "repair", repair, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.VerifyStream(ctx, s, repair)
+}
+
+func (mw loggingMiddleware) GetRecordings(ctx context.Context, s uuid.UUID) (r *[]Recording, err error) {
+	defer func(begin time.Time) {
+		level.Info(mw.logger).Log("method", "GetRecordings", "id", s, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetRecordings(ctx, s)
+}
+
+func (mw loggingMiddleware) GetRecordingFile(ctx context.Context, s uuid.UUID, id uuid.UUID) (f *RecordingFile, err error) {
+	defer func(begin time.Time) {
+		level.Info(mw.logger).Log("method", "GetRecordingFile", "id", s, "recording", id, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetRecordingFile(ctx, s, id)
+}
+
+func (mw loggingMiddleware) UpdateDvrSRS(ctx context.Context, s SRSStream) (code int, err error) {
+	defer func(begin time.Time) {
+		level.Info(mw.logger).Log("method", "UpdateDvrSRS", "data", fmt.Sprintf("%+v", s), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.UpdateDvrSRS(ctx, s)
+}
+
+func (mw loggingMiddleware) GetStreamKey(ctx context.Context, s uuid.UUID, period int, viewer PlaybackRequest) (key []byte, err error) {
+	defer func(begin time.Time) {
+		level.Info(mw.logger).Log("method", "GetStreamKey", "id", s, "period", period, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetStreamKey(ctx, s, period, viewer)
+}
+
+func (mw loggingMiddleware) CreatePlaybackToken(ctx context.Context, s uuid.UUID, req PlaybackTokenRequest) (t *PlaybackToken, err error) {
+	defer func(begin time.Time) {
+		level.Info(mw.logger).Log("method", "CreatePlaybackToken", "id", s, "ttl", req.TTL, "ip", req.IP, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.CreatePlaybackToken(ctx, s, req)
+}
+
+func (mw loggingMiddleware) AuthPlayback(ctx context.Context, req PlaybackRequest) (t *PlaybackToken, err error) {
+	defer func(begin time.Time) {
+		level.Debug(mw.logger).Log("method", "AuthPlayback", "uri", req.URI, "ip", req.IP, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.AuthPlayback(ctx, req)
+}
+
+func (mw loggingMiddleware) GetHLS(ctx context.Context, req HLSRequest) (f *HLSFile, err error) {
+	defer func(begin time.Time) {
+		level.Debug(mw.logger).Log("method", "GetHLS", "id", req.StreamID, "name", req.Name, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetHLS(ctx, req)
+}
+
+func (mw loggingMiddleware) GetSubtitles(ctx context.Context, s uuid.UUID) (t *[]SubtitleTrack, err error) {
+	defer func(begin time.Time) {
+		level.Info(mw.logger).Log("method", "GetSubtitles", "id", s, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetSubtitles(ctx, s)
+}
+
+func (mw loggingMiddleware) PutSubtitles(ctx context.Context, track SubtitleTrack, vtt []byte) (t *SubtitleTrack, err error) {
+	defer func(begin time.Time) {
+		level.Info(mw.logger).Log("method", "PutSubtitles", "id", track.StreamID, "language", track.Language, "size", len(vtt), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.PutSubtitles(ctx, track, vtt)
+}
+
+func (mw loggingMiddleware) AddSubtitleCues(ctx context.Context, s uuid.UUID, language string, cues []playlist.Cue) (t *SubtitleTrack, err error) {
+	defer func(begin time.Time) {
+		level.Info(mw.logger).Log("method", "AddSubtitleCues", "id", s, "language", language, "cues", len(cues), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.AddSubtitleCues(ctx, s, language, cues)
+}
+
+func (mw loggingMiddleware) DeleteSubtitles(ctx context.Context, s uuid.UUID, language string) (err error) {
+	defer func(begin time.Time) {
+		level.Info(mw.logger).Log("method", "DeleteSubtitles", "id", s, "language", language, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.DeleteSubtitles(ctx, s, language)
+}
+
+func (mw loggingMiddleware) CreateMarker(ctx context.Context, marker Marker) (m *Marker, err error) {
+	defer func(begin time.Time) {
+		level.Info(mw.logger).Log("method", "CreateMarker", "id", marker.StreamID, "class", marker.Class, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.CreateMarker(ctx, marker)
+}
+
+func (mw loggingMiddleware) GetMarkers(ctx context.Context, s uuid.UUID) (m *[]Marker, err error) {
+	defer func(begin time.Time) {
+		level.Info(mw.logger).Log("method", "GetMarkers", "id", s, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetMarkers(ctx, s)
+}
+
+func (mw loggingMiddleware) DeleteMarker(ctx context.Context, s uuid.UUID, marker uuid.UUID) (err error) {
+	defer func(begin time.Time) {
+		level.Info(mw.logger).Log("method", "DeleteMarker", "id", s, "marker", marker, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.DeleteMarker(ctx, s, marker)
+}
+
+func (mw loggingMiddleware) GetSRSConfig(ctx context.Context, node string) (c *srsconfig.Config, err error) {
+	defer func(begin time.Time) {
+		level.Info(mw.logger).Log("method", "GetSRSConfig", "node", node, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetSRSConfig(ctx, node)
+}
+
+func (mw loggingMiddleware) ReloadSRSConfig(ctx context.Context, node string) (stats *srsconfig.ReloadStats, err error) {
+	defer func(begin time.Time) {
+		level.Info(mw.logger).Log("method", "ReloadSRSConfig", "node", node, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.ReloadSRSConfig(ctx, node)
+}
+
+func (mw loggingMiddleware) GetSRSDrift(ctx context.Context, node string, check bool) (d *srsconfig.DriftReport, err error) {
+	defer func(begin time.Time) {
+		level.Info(mw.logger).Log("method", "GetSRSDrift", "node", node, "check", check, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetSRSDrift(ctx, node, check)
+}
+
+func (mw loggingMiddleware) GetSRSNodes(ctx context.Context) (nodes *[]NodeStatus, err error) {
+	defer func(begin time.Time) {
+		level.Info(mw.logger).Log("method", "GetSRSNodes", "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetSRSNodes(ctx)
+}
+
+func (mw loggingMiddleware) PutProfile(ctx context.Context, p TranscodeProfile) (resp *TranscodeProfile, err error) {
+	defer func(begin time.Time) {
+		level.Info(mw.logger).Log("method", "PutProfile", "profile", p.Name, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.PutProfile(ctx, p)
+}
+
+func (mw loggingMiddleware) GetProfiles(ctx context.Context) (p *[]TranscodeProfile, err error) {
+	defer func(begin time.Time) {
+		level.Info(mw.logger).Log("method", "GetProfiles", "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetProfiles(ctx)
+}
+
+func (mw loggingMiddleware) GetProfile(ctx context.Context, name string) (p *TranscodeProfile, err error) {
+	defer func(begin time.Time) {
+		level.Info(mw.logger).Log("method", "GetProfile", "profile", name, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetProfile(ctx, name)
+}
+
+func (mw loggingMiddleware) DeleteProfile(ctx context.Context, name string) (err error) {
+	defer func(begin time.Time) {
+		level.Info(mw.logger).Log("method", "DeleteProfile", "profile", name, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.DeleteProfile(ctx, name)
+}
+
 func AuthMiddlewareHTTP(requiredApiKey string) endpoint.Middleware {
 	return func(next endpoint.Endpoint) endpoint.Endpoint {
 		return func(ctx context.Context, request interface{}) (interface{}, error) {
@@ -109,3 +272,31 @@ func AuthMiddlewareGRPC(requiredApiKey string) endpoint.Middleware {
 		}
 	}
 }
+
+func (mw loggingMiddleware) CreateForward(ctx context.Context, fwd ForwardDestination) (f *ForwardDestination, err error) {
+	defer func(begin time.Time) {
+		level.Info(mw.logger).Log("method", "CreateForward", "id", fwd.StreamID, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.CreateForward(ctx, fwd)
+}
+
+func (mw loggingMiddleware) GetForwards(ctx context.Context, s uuid.UUID) (f *[]ForwardDestination, err error) {
+	defer func(begin time.Time) {
+		level.Info(mw.logger).Log("method", "GetForwards", "id", s, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetForwards(ctx, s)
+}
+
+func (mw loggingMiddleware) UpdateForward(ctx context.Context, fwd ForwardDestination) (f *ForwardDestination, err error) {
+	defer func(begin time.Time) {
+		level.Info(mw.logger).Log("method", "UpdateForward", "id", fwd.StreamID, "forward", fwd.ID, "enabled", fwd.Enabled, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.UpdateForward(ctx, fwd)
+}
+
+func (mw loggingMiddleware) DeleteForward(ctx context.Context, s uuid.UUID, forward uuid.UUID) (err error) {
+	defer func(begin time.Time) {
+		level.Info(mw.logger).Log("method", "DeleteForward", "id", s, "forward", forward, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.DeleteForward(ctx, s, forward)
+}
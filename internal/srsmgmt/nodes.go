@@ -0,0 +1,190 @@
+package srsmgmt
+
+import (
+	"context"
+	"errors"
+	"path"
+	"srsmgmt/config"
+	"srsmgmt/pkg/srsclient"
+	"srsmgmt/pkg/srsconfig"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/gofrs/uuid"
+)
+
+var (
+	ErrNodeNotFound = errors.New("SRS_NODE_NOT_FOUND")
+	ErrNoNode       = errors.New("SRS_NO_NODE_AVAILABLE")
+)
+
+// таймаут проверки узла для GET /srs/nodes
+const nodeCheckTimeout = 3 * time.Second
+
+// Node - узел пула SRS: адреса, клиент API и конфигурация узла
+type Node struct {
+	config.SRSNode
+	Client    srsclient.SrsClient
+	SRSConfig *srsconfig.SRSConfig
+}
+
+// NodeStatus - состояние узла пула
+type NodeStatus struct {
+	Name       string  `json:"name"`
+	APIAddr    string  `json:"apiAddr"`
+	Healthy    bool    `json:"healthy"`
+	Breaker    string  `json:"breaker"`
+	Version    string  `json:"version,omitempty"`
+	Streams    int64   `json:"streams"`
+	Capacity   int     `json:"capacity,omitempty"`
+	Publishing int     `json:"publishing"`
+	CPUPercent float64 `json:"cpuPercent"`
+	MemPercent float64 `json:"memPercent"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// node возвращает узел стрима. Стримы, созданные до пула или на узле,
+// которого больше нет в SRS_NODES, относятся к первому узлу
+func (s *srsMgmtService) node(stream *Stream) *Node {
+	if n, ok := s.nodeNamed(stream.Node); ok {
+		return n
+	}
+	return s.nodes[0]
+}
+
+func (s *srsMgmtService) nodeNamed(name string) (*Node, bool) {
+	for _, n := range s.nodes {
+		if n.Name == name {
+			return n, true
+		}
+	}
+	return nil, false
+}
+
+// nodeByName - узел для запросов API, пустое имя - первый узел
+func (s *srsMgmtService) nodeByName(name string) (*Node, error) {
+	if name == "" {
+		return s.nodes[0], nil
+	}
+	if n, ok := s.nodeNamed(name); ok {
+		return n, nil
+	}
+	return nil, ErrNodeNotFound
+}
+
+func (s *srsMgmtService) livePath(stream *Stream) string {
+	return path.Join(s.node(stream).LiveTSPath, stream.StreamID.String())
+}
+
+// livePathByID - каталог HLS стрима по идентификатору
+func (s *srsMgmtService) livePathByID(streamID uuid.UUID) string {
+	stream, err := s.repo.GetStream(streamID)
+	if err != nil {
+		stream = &Stream{StreamID: streamID}
+	}
+	return s.livePath(stream)
+}
+
+// nodeStreams - неостановленные стримы узла. Стримы без узла считаются
+// стримами первого узла
+func (s *srsMgmtService) nodeStreams(n *Node) (int64, error) {
+	count, err := s.repo.CountNodeStreams(n.Name)
+	if err != nil || n != s.nodes[0] {
+		return count, err
+	}
+	legacy, err := s.repo.CountNodeStreams("")
+	return count + legacy, err
+}
+
+// assignNode назначает новому стриму узел с наименьшей заполненностью:
+// отношением числа стримов к Capacity. Узлы без Capacity не ограничены и
+// считаются равными самому емкому узлу пула. Узлы с разомкнутым
+// размыкателем и заполненные узлы пропускаются. Стрим, у которого уже
+// есть узел из пула, остается на нем
+func (s *srsMgmtService) assignNode(stream *Stream) error {
+	if _, ok := s.nodeNamed(stream.Node); ok {
+		return nil
+	}
+	// единственному узлу без предела выбирать не из чего
+	if len(s.nodes) == 1 && s.nodes[0].Capacity == 0 {
+		stream.Node = s.nodes[0].Name
+		return nil
+	}
+
+	weight := 1
+	for _, n := range s.nodes {
+		if n.Capacity > weight {
+			weight = n.Capacity
+		}
+	}
+
+	var best *Node
+	var bestLoad float64
+	for _, n := range s.nodes {
+		if n.Client.BreakerState() == srsclient.BreakerOpen {
+			continue
+		}
+		count, err := s.nodeStreams(n)
+		if err != nil {
+			level.Error(s.logger).Log("node", n.Name, "CountNodeStreams", err)
+			continue
+		}
+		capacity := n.Capacity
+		if capacity == 0 {
+			capacity = weight
+		} else if count >= int64(capacity) {
+			continue
+		}
+		load := float64(count) / float64(capacity)
+		if best == nil || load < bestLoad {
+			best, bestLoad = n, load
+		}
+	}
+	if best == nil {
+		return ErrNoNode
+	}
+	stream.Node = best.Name
+	return nil
+}
+
+// GetSRSNodes проверяет узлы пула через API SRS
+func (s *srsMgmtService) GetSRSNodes(ctx context.Context) (*[]NodeStatus, error) {
+	statuses := make([]NodeStatus, len(s.nodes))
+	done := make(chan struct{})
+	for i, n := range s.nodes {
+		go func(i int, n *Node) {
+			defer func() { done <- struct{}{} }()
+			statuses[i] = s.nodeStatus(ctx, n)
+		}(i, n)
+	}
+	for range s.nodes {
+		<-done
+	}
+	return &statuses, nil
+}
+
+func (s *srsMgmtService) nodeStatus(ctx context.Context, n *Node) NodeStatus {
+	status := NodeStatus{Name: n.Name, APIAddr: n.APIAddr, Capacity: n.Capacity}
+	if count, err := s.nodeStreams(n); err == nil {
+		status.Streams = count
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, nodeCheckTimeout)
+	defer cancel()
+	summary, err := n.Client.Summaries(ctx)
+	if err == nil {
+		var publishing []string
+		publishing, err = n.Client.PublishingStreams(ctx)
+		status.Publishing = len(publishing)
+	}
+	status.Breaker = n.Client.BreakerState()
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	status.Healthy = true
+	status.Version = summary.Self.Version
+	status.CPUPercent = summary.Self.CPUPercent
+	status.MemPercent = summary.Self.MemPercent
+	return status
+}
@@ -0,0 +1,324 @@
+package srsmgmt
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"srsmgmt/pkg/playlist"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/gofrs/uuid"
+)
+
+const (
+	contentTypeTS       = "video/mp2t"
+	contentTypePlaylist = "application/vnd.apple.mpegurl"
+)
+
+// offloadIndex хранит адреса выгруженных в объектное хранилище файлов по стримам
+type offloadIndex struct {
+	sync.RWMutex
+	files map[string]map[string]string
+}
+
+func (o *offloadIndex) load(repo Repository) error {
+	segs, err := repo.GetOffloadedSegments()
+	if err != nil {
+		return err
+	}
+	for _, v := range *segs {
+		o.add(v.StreamID.String(), v.Name, v.URL)
+	}
+	return nil
+}
+
+func (o *offloadIndex) add(streamID, name, url string) {
+	o.Lock()
+	defer o.Unlock()
+	if o.files == nil {
+		o.files = map[string]map[string]string{}
+	}
+	if o.files[streamID] == nil {
+		o.files[streamID] = map[string]string{}
+	}
+	o.files[streamID][name] = url
+}
+
+func (o *offloadIndex) get(streamID, name string) (string, bool) {
+	o.RLock()
+	defer o.RUnlock()
+	url, ok := o.files[streamID][name]
+	return url, ok
+}
+
+func (o *offloadIndex) names(streamID string) []string {
+	o.RLock()
+	defer o.RUnlock()
+	names := []string{}
+	for name := range o.files[streamID] {
+		names = append(names, name)
+	}
+	return names
+}
+
+func (o *offloadIndex) remove(streamID string) {
+	o.Lock()
+	defer o.Unlock()
+	delete(o.files, streamID)
+}
+
+// segmentHook подменяет локальные сегменты адресами в объектном хранилище
+func (o *offloadIndex) segmentHook(livePath string, seg *playlist.Segment) {
+	if url, ok := o.get(path.Base(livePath), seg.Name); ok {
+		seg.URI = url
+	}
+}
+
+func (s *srsMgmtService) enqueueOffload(stream *Stream) {
+	streamTS := ""
+	if stream.StartedAt != nil && !stream.StartedAt.IsZero() {
+		streamTS = fmt.Sprintf("%d-", stream.StartedAt.Unix())
+	}
+
+	_, err := s.repo.CreateRecording(Recording{
+		StreamID:  stream.StreamID,
+		Type:      RecordingTypeHLS,
+		Status:    RecordingStatusPending,
+		Playlist:  fmt.Sprintf("%s%s%s", OutputPlaylistPrefix, streamTS, "index.m3u8"),
+		StartedAt: stream.StartedAt,
+		StopedAt:  stream.StopedAt,
+	})
+	if err != nil {
+		level.Error(s.logger).Log("offload", "CreateRecording", "id", stream.StreamID, "err", err)
+	}
+}
+
+func (s *srsMgmtService) runOffload() {
+	interval := time.Duration(s.cfg.OffloadInterval) * time.Second
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		s.offloadPending()
+		if s.cfg.OffloadAge > 0 {
+			s.offloadAged(time.Now().Add(-time.Duration(s.cfg.OffloadAge) * time.Second))
+		}
+		<-t.C
+	}
+}
+
+func (s *srsMgmtService) offloadPending() {
+	recs, err := s.repo.GetPendingRecordings()
+	if err != nil {
+		level.Error(s.logger).Log("offload", "GetPendingRecordings", "err", err)
+		return
+	}
+	for _, rec := range *recs {
+		s.offloadRecording(rec)
+	}
+}
+
+// offloadRecording выгружает сегменты и плейлисты остановленного стрима.
+// При ошибке запись остается в очереди и повторяется на следующем проходе
+func (s *srsMgmtService) offloadRecording(rec Recording) {
+	ctx := context.Background()
+	stream, err := s.repo.GetStream(rec.StreamID)
+	if err != nil {
+		stream = &Stream{StreamID: rec.StreamID}
+	}
+	// пока стрим снова публикуется, в каталоге идут сегменты новой сессии
+	if stream.Status == StreamStatusPublish || stream.Status == StreamStatusStalled {
+		return
+	}
+	livePath := s.livePath(stream)
+
+	if _, err := os.Stat(livePath); err != nil {
+		rec.Status = RecordingStatusFailed
+		rec.Error = err.Error()
+		s.repo.UpdateRecording(rec)
+		return
+	}
+
+	rec.Status = RecordingStatusUploading
+	s.repo.UpdateRecording(rec)
+
+	uploaded, err := s.offloadSegments(ctx, livePath, rec.StreamID, recordingFilter(rec))
+	if err == nil {
+		err = s.offloadPlaylists(ctx, livePath, rec.StreamID)
+	}
+	if err != nil {
+		level.Error(s.logger).Log("offload", "recording", "id", rec.ID, "err", err)
+		rec.Status = RecordingStatusPending
+		rec.Error = err.Error()
+		s.repo.UpdateRecording(rec)
+		return
+	}
+	removeFiles(uploaded)
+
+	rec.Status = RecordingStatusOffloaded
+	rec.Segments = len(uploaded)
+	rec.URL = s.store.URL(objectKey(rec.StreamID, rec.Playlist))
+	rec.Error = ""
+	if _, err := s.repo.UpdateRecording(rec); err != nil {
+		level.Error(s.logger).Log("offload", "UpdateRecording", "id", rec.ID, "err", err)
+	}
+}
+
+// recordingSlack - запас после остановки, за который SRS дописывает сегменты
+const recordingSlack = 30 * time.Second
+
+// recordingFilter отбирает сегменты сессии записи по времени их записи
+func recordingFilter(rec Recording) func(os.FileInfo) bool {
+	return func(fi os.FileInfo) bool {
+		if rec.StartedAt != nil && fi.ModTime().Before(*rec.StartedAt) {
+			return false
+		}
+		return rec.StopedAt == nil || fi.ModTime().Before(rec.StopedAt.Add(recordingSlack))
+	}
+}
+
+// offloadAged выгружает сегменты старше cutoff во всех каталогах стримов
+// всех узлов пула
+func (s *srsMgmtService) offloadAged(cutoff time.Time) {
+	seen := map[string]bool{}
+	for _, n := range s.nodes {
+		if seen[n.LiveTSPath] {
+			continue
+		}
+		seen[n.LiveTSPath] = true
+		s.offloadAgedPath(n.LiveTSPath, cutoff)
+	}
+}
+
+func (s *srsMgmtService) offloadAgedPath(liveTSPath string, cutoff time.Time) {
+	dirs, err := os.ReadDir(liveTSPath)
+	if err != nil {
+		level.Error(s.logger).Log("offload", "ReadDir", "path", liveTSPath, "err", err)
+		return
+	}
+
+	for _, dir := range dirs {
+		streamID, err := uuid.FromString(dir.Name())
+		if err != nil || !dir.IsDir() {
+			continue
+		}
+		livePath := path.Join(liveTSPath, dir.Name())
+
+		uploaded, err := s.offloadSegments(context.Background(), livePath, streamID, func(fi os.FileInfo) bool {
+			return fi.ModTime().Before(cutoff)
+		})
+		if err != nil {
+			level.Error(s.logger).Log("offload", "aged", "id", streamID, "err", err)
+		}
+		if len(uploaded) == 0 {
+			continue
+		}
+		if _, err := s.playlist.RewriteSegments(livePath); err != nil {
+			level.Error(s.logger).Log("offload", "RewriteSegments", "id", streamID, "err", err)
+			continue
+		}
+		removeFiles(uploaded)
+	}
+}
+
+// offloadSegments выгружает TS-файлы каталога и возвращает локальные пути выгруженных файлов
+func (s *srsMgmtService) offloadSegments(ctx context.Context, livePath string, streamID uuid.UUID, filter func(os.FileInfo) bool) ([]string, error) {
+	files, err := filepath.Glob(path.Join(livePath, "*.ts"))
+	if err != nil {
+		return nil, err
+	}
+
+	uploaded := []string{}
+	for _, file := range files {
+		fi, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		if filter != nil && !filter(fi) {
+			continue
+		}
+		if _, ok := s.offloaded.get(streamID.String(), path.Base(file)); ok {
+			uploaded = append(uploaded, file)
+			continue
+		}
+
+		if err := s.uploadFile(ctx, file, streamID, contentTypeTS); err != nil {
+			return uploaded, err
+		}
+		uploaded = append(uploaded, file)
+	}
+
+	return uploaded, nil
+}
+
+// offloadPlaylists переписывает плейлисты на адреса хранилища и выгружает их
+func (s *srsMgmtService) offloadPlaylists(ctx context.Context, livePath string, streamID uuid.UUID) error {
+	files, err := s.playlist.RewriteSegments(livePath)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := s.uploadFile(ctx, file, streamID, contentTypePlaylist); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *srsMgmtService) uploadFile(ctx context.Context, file string, streamID uuid.UUID, contentType string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	name := path.Base(file)
+	key := objectKey(streamID, name)
+	if err := s.store.Put(ctx, key, data, contentType); err != nil {
+		return err
+	}
+
+	url := s.store.URL(key)
+	if err := s.repo.AddOffloadedSegment(OffloadedSegment{StreamID: streamID, Name: name, URL: url}); err != nil {
+		return err
+	}
+	s.offloaded.add(streamID.String(), name, url)
+
+	return nil
+}
+
+// deleteOffloaded удаляет из хранилища все файлы стрима
+func (s *srsMgmtService) deleteOffloaded(streamID uuid.UUID) {
+	names := s.offloaded.names(streamID.String())
+	s.offloaded.remove(streamID.String())
+
+	go func() {
+		ctx := context.Background()
+		for _, name := range names {
+			if err := s.store.Delete(ctx, objectKey(streamID, name)); err != nil {
+				level.Error(s.logger).Log("offload", "Delete", "id", streamID, "name", name, "err", err)
+			}
+		}
+	}()
+
+	if err := s.repo.DeleteRecordings(streamID); err != nil {
+		level.Error(s.logger).Log("offload", "DeleteRecordings", "id", streamID, "err", err)
+	}
+}
+
+func objectKey(streamID uuid.UUID, name string) string {
+	return strings.Join([]string{streamID.String(), name}, "/")
+}
+
+func removeFiles(files []string) {
+	for _, file := range files {
+		os.Remove(file)
+	}
+}
@@ -0,0 +1,71 @@
+package srsmgmt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"srsmgmt/config"
+	"srsmgmt/pkg/objstore"
+	"srsmgmt/pkg/playlist"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOffloadRecordingSession(t *testing.T) {
+	var mu sync.Mutex
+	puts := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		puts = append(puts, path.Base(r.URL.Path))
+		mu.Unlock()
+	}))
+	defer srv.Close()
+	store, err := objstore.New(srv.URL, "us-east-1", "media", "key", "secret", true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := newMemRepo()
+	s := newTestService(t, repo, config.Config{})
+	s.store, s.playlist = store, playlist.New()
+	stream := newTestStream(t, repo, "live")
+	livePath := s.livePath(stream)
+	os.MkdirAll(livePath, 0755)
+
+	started := time.Now().Add(-time.Hour)
+	stopped := started.Add(10 * time.Minute)
+	// сегмент прошлой сессии и сегмент новой публикации
+	old, fresh := path.Join(livePath, "low-old-2000-1.ts"), path.Join(livePath, "low-new-2000-1.ts")
+	os.WriteFile(old, []byte("old"), 0644)
+	os.WriteFile(fresh, []byte("new"), 0644)
+	os.Chtimes(old, started.Add(time.Minute), started.Add(time.Minute))
+
+	rec, _ := repo.CreateRecording(Recording{StreamID: stream.StreamID, Type: RecordingTypeHLS, Status: RecordingStatusPending, StartedAt: &started, StopedAt: &stopped})
+
+	stream.Status = StreamStatusPublish
+	repo.UpdateStream(*stream)
+	s.offloadRecording(*rec)
+	if len(puts) != 0 {
+		t.Fatalf("recording offloaded while the stream publishes again: %v", puts)
+	}
+
+	stream.Status = StreamStatusStopPublish
+	repo.UpdateStream(*stream)
+	s.offloadRecording(*rec)
+	if strings.Join(puts, ",") != "low-old-2000-1.ts" {
+		t.Errorf("want only the recording's segment uploaded, have %v", puts)
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Errorf("segment of the new session was removed: %v", err)
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("uploaded segment was not removed: %v", err)
+	}
+	recs, _ := repo.GetRecordings(stream.StreamID)
+	if r := (*recs)[0]; r.Status != RecordingStatusOffloaded || r.Segments != 1 {
+		t.Errorf("unexpected recording %+v", r)
+	}
+}
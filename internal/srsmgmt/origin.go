@@ -0,0 +1,134 @@
+package srsmgmt
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"path"
+	"srsmgmt/pkg/playlist"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+const (
+	contentTypeVTT = "text/vtt"
+
+	originLiveCache    = "public, max-age=1"
+	originMasterCache  = "public, max-age=5"
+	originFinalCache   = "public, max-age=3600"
+	originSegmentCache = "public, max-age=86400"
+)
+
+type HLSRequest struct {
+	StreamID uuid.UUID
+	Name     string
+	Start    *time.Time
+	End      *time.Time
+	Query    string // параметры диапазона для URI вариантов в мастер-плейлисте
+	Token    string
+	IP       string
+	Referer  string
+}
+
+type HLSFile struct {
+	Body         []byte
+	ContentType  string
+	CacheControl string
+	ETag         string
+	Playback     *PlaybackToken
+}
+
+// GetHLS отдает плейлисты в режиме HLS origin: живые, DVR и диапазонные
+// плейлисты собираются из индекса сегментов на каждый запрос, остальные
+// файлы стрима (сегменты, субтитры) читаются с диска
+func (s *srsMgmtService) GetHLS(ctx context.Context, req HLSRequest) (*HLSFile, error) {
+	if !s.cfg.HLSOrigin {
+		return nil, ErrNotFound
+	}
+	if req.Name != path.Base(req.Name) || strings.HasPrefix(req.Name, ".") {
+		return nil, ErrBadRequest
+	}
+	stream, err := s.repo.GetStream(req.StreamID)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	resp := &HLSFile{}
+	if s.playAuth != nil {
+		token, err := s.AuthPlayback(ctx, PlaybackRequest{
+			URI:     fmt.Sprintf("/%s/%s/%s", stream.App, stream.StreamID, req.Name),
+			Token:   req.Token,
+			IP:      req.IP,
+			Referer: req.Referer,
+		})
+		if err != nil {
+			return nil, err
+		}
+		resp.Playback = token
+	}
+
+	livePath := s.livePath(stream)
+	ended := stream.Status == StreamStatusStopPublish
+	final := ended || req.End != nil && req.End.Before(time.Now())
+
+	out, ok := playlist.ParseOutputName(req.Name)
+	switch {
+	case ok && out.Prefix == OutputPlaylistPrefix && out.Variant == "index":
+		prefix := OutputPlaylistPrefix
+		if out.Since != nil {
+			prefix = fmt.Sprintf("%s%d-", prefix, out.Since.Unix())
+		}
+		resp.Body = s.playlist.MasterPlaylist(livePath, prefix, req.Query)
+		resp.ContentType = contentTypePlaylist
+		resp.CacheControl = originMasterCache
+		if final {
+			resp.CacheControl = originFinalCache
+		}
+
+	case ok && out.Prefix == OutputPlaylistPrefix:
+		opts := playlist.RenderOptions{Since: out.Since, Start: req.Start, End: req.End, Ended: ended}
+		variant := out.Variant + ".m3u8"
+		if out.IFrames {
+			resp.Body = s.playlist.IFramePlaylist(livePath, variant, opts)
+		} else {
+			resp.Body = s.playlist.MediaPlaylist(livePath, variant, opts)
+		}
+		resp.ContentType = contentTypePlaylist
+		resp.CacheControl = originLiveCache
+		if final {
+			resp.CacheControl = originFinalCache
+		}
+
+	default:
+		body, err := os.ReadFile(path.Join(livePath, req.Name))
+		if err != nil {
+			return nil, ErrNotFound
+		}
+		resp.Body = body
+		switch path.Ext(req.Name) {
+		case ".m3u8":
+			resp.ContentType, resp.CacheControl = contentTypePlaylist, originLiveCache
+		case ".ts":
+			resp.ContentType, resp.CacheControl = contentTypeTS, originSegmentCache
+		case ".vtt":
+			// сегменты субтитров перезаписываются при добавлении реплик
+			resp.ContentType, resp.CacheControl = contentTypeVTT, originLiveCache
+		default:
+			resp.ContentType, resp.CacheControl = "application/octet-stream", originSegmentCache
+		}
+	}
+
+	resp.ETag = fmt.Sprintf(`"%x"`, sha1.Sum(resp.Body))
+	return resp, nil
+}
+
+// indexSegments добавляет сегменты из on_hls в индекс origin-режима
+func (s *srsMgmtService) indexSegments(livePath, plName string, st SRSStream, segments []string) {
+	s.playlist.IndexSegment(livePath, plName, path.Base(st.File), float64(st.Duration))
+	if len(segments) > 1 {
+		s.playlist.IndexSegment(livePath, playlist.AudioPlaylist, path.Base(segments[1]), float64(st.Duration))
+	}
+}
@@ -0,0 +1,128 @@
+package srsmgmt
+
+import (
+	"context"
+	"net/url"
+	"srsmgmt/pkg/playauth"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/gofrs/uuid"
+)
+
+// PlaybackTokenRequest ограничения выдаваемого токена воспроизведения
+type PlaybackTokenRequest struct {
+	TTL     int      `json:"ttl"`
+	IP      string   `json:"ip"`
+	Domains []string `json:"domains"`
+}
+
+// swagger:model PlaybackToken
+type PlaybackToken struct {
+	Token   string    `json:"token"`
+	Expires time.Time `json:"expires"`
+	HLS     string    `json:"hls,omitempty"`
+}
+
+// PlaybackRequest запрос зрителя к манифесту или сегменту, проверяемый nginx auth_request
+type PlaybackRequest struct {
+	URI     string
+	Token   string
+	IP      string
+	Referer string
+}
+
+func (s *srsMgmtService) CreatePlaybackToken(ctx context.Context, streamID uuid.UUID, req PlaybackTokenRequest) (*PlaybackToken, error) {
+	if s.playAuth == nil {
+		return nil, ErrBadRequest
+	}
+	stream, err := s.repo.GetStream(streamID)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	ttl := req.TTL
+	if ttl <= 0 {
+		ttl = s.cfg.PlaybackTokenTTL
+	}
+	expires := time.Now().Add(time.Duration(ttl) * time.Second).Truncate(time.Second)
+
+	token, err := s.playAuth.Sign(playauth.Claims{
+		StreamID: streamID.String(),
+		Expires:  expires.Unix(),
+		IP:       req.IP,
+		Domains:  req.Domains,
+	})
+	if err != nil {
+		return nil, ErrInternalError
+	}
+
+	s.addSRSUrls(stream)
+	return &PlaybackToken{
+		Token:   token,
+		Expires: expires,
+		HLS:     stream.HLS + "?token=" + url.QueryEscape(token),
+	}, nil
+}
+
+// AuthPlayback проверяет токен зрителя для запрошенного URI.
+// Идентификатор стрима берется из пути, база данных не используется
+func (s *srsMgmtService) AuthPlayback(ctx context.Context, req PlaybackRequest) (*PlaybackToken, error) {
+	if s.playAuth == nil || req.Token == "" {
+		return nil, ErrUnauthorized
+	}
+	claims, err := s.playAuth.Parse(req.Token)
+	if err != nil {
+		return nil, ErrUnauthorized
+	}
+
+	if err := claims.Check(streamIDFromURI(req.URI), req.IP, req.Referer, time.Now()); err != nil {
+		level.Debug(s.logger).Log("AuthPlayback", req.URI, "ip", req.IP, "err", err)
+		return nil, ErrForbidden
+	}
+
+	return &PlaybackToken{Token: req.Token, Expires: time.Unix(claims.Expires, 0)}, nil
+}
+
+// PlaybackCookie - cookie с токеном воспроизведения. Имя отличается от
+// токена зрителя для ключей, путь ограничен каталогом стрима
+const PlaybackCookie = "playback_token"
+
+// validPlaybackToken проверяет токен воспроизведения при запросе ключа стрима
+func (s *srsMgmtService) validPlaybackToken(streamID uuid.UUID, req PlaybackRequest) bool {
+	if s.playAuth == nil || req.Token == "" {
+		return false
+	}
+	claims, err := s.playAuth.Parse(req.Token)
+	return err == nil && claims.Check(streamID.String(), req.IP, req.Referer, time.Now()) == nil
+}
+
+// playbackCookiePath - путь cookie воспроизведения: URI до идентификатора
+// стрима включительно, например /live/<id>/
+func playbackCookiePath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "/"
+	}
+	parts := strings.Split(u.Path, "/")
+	for i, part := range parts {
+		if _, err := uuid.FromString(part); err == nil {
+			return strings.Join(parts[:i+1], "/") + "/"
+		}
+	}
+	return "/"
+}
+
+func streamIDFromURI(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return ""
+	}
+	for _, part := range strings.Split(u.Path, "/") {
+		if id, err := uuid.FromString(part); err == nil {
+			return id.String()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,125 @@
+package srsmgmt
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"srsmgmt/config"
+	"srsmgmt/pkg/playauth"
+	"testing"
+
+	"github.com/go-kit/log"
+)
+
+// TestEncryptedPlaybackAuth: плеер зашифрованного стрима за авторизацией
+// воспроизведения получает ключи по cookie токена воспроизведения
+func TestEncryptedPlaybackAuth(t *testing.T) {
+	repo := newMemRepo()
+	s := newTestService(t, repo, config.Config{PlaybackTokenTTL: 60})
+	s.playAuth = playauth.New("secret")
+	srv := httptest.NewServer(MakeHTTPHandler(s, log.NewNopLogger()))
+	defer srv.Close()
+
+	key := bytes.Repeat([]byte{7}, 16)
+	streams := []*Stream{}
+	tokens := []string{}
+	for i := 0; i < 2; i++ {
+		stream := newTestStream(t, repo, "live")
+		stream.Encrypted, stream.ViewerToken = true, "viewer"
+		repo.UpdateStream(*stream)
+		repo.CreateStreamKey(StreamKey{StreamID: stream.StreamID, Period: 0, Key: key, IV: make([]byte, 16)})
+		token, err := s.CreatePlaybackToken(context.Background(), stream.StreamID, PlaybackTokenRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		streams, tokens = append(streams, stream), append(tokens, token.Token)
+	}
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+	get := func(path string, header http.Header) (int, []byte) {
+		req, _ := http.NewRequest("GET", srv.URL+path, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, body
+	}
+
+	keyPath := "/api/v1/stream/" + streams[0].StreamID.String() + "/key/0"
+	if code, _ := get(keyPath, nil); code != http.StatusUnauthorized {
+		t.Fatalf("key without token: want 401, have %d", code)
+	}
+
+	// вход по ссылке с токеном на оба стрима в одном браузере
+	for i, stream := range streams {
+		uri := "/live/" + stream.StreamID.String() + "/index.m3u8?token=" + url.QueryEscape(tokens[i])
+		if code, _ := get("/auth/hls", http.Header{"X-Original-Uri": {uri}}); code != http.StatusNoContent {
+			t.Fatalf("auth playback: want 204, have %d", code)
+		}
+	}
+
+	for i, stream := range streams {
+		u, _ := url.Parse(srv.URL + "/live/" + stream.StreamID.String() + "/")
+		cookies := jar.Cookies(u)
+		if len(cookies) != 1 || cookies[0].Name != PlaybackCookie || cookies[0].Value != tokens[i] {
+			t.Errorf("stream %d: want its own playback cookie, have %v", i, cookies)
+		}
+	}
+	if code, body := get(keyPath, nil); code != http.StatusOK || !bytes.Equal(body, key) {
+		t.Errorf("key by playback cookie: want 200, have %d", code)
+	}
+	// токен воспроизведения другого стрима ключ не открывает
+	if code, _ := get(keyPath+"?token="+url.QueryEscape(tokens[1]), nil); code != http.StatusUnauthorized {
+		t.Errorf("key by foreign playback token: want 401, have %d", code)
+	}
+	bearer := http.Header{"Authorization": {"Bearer " + tokens[1]}}
+	if code, _ := get("/api/v1/stream/"+streams[1].StreamID.String()+"/key/0", bearer); code != http.StatusOK {
+		t.Errorf("key by bearer playback token: want 200, have %d", code)
+	}
+	if code, _ := get(keyPath+"?token=viewer", nil); code != http.StatusOK {
+		t.Errorf("key by viewer token: want 200, have %d", code)
+	}
+}
+
+// TestClientIP: заголовки с адресом зрителя принимаются только от доверенных прокси
+func TestClientIP(t *testing.T) {
+	proxies := parseTrustedProxies("127.0.0.1, 10.0.0.0/8, ::1, bad")
+	if len(proxies) != 3 {
+		t.Fatalf("want 3 proxies, have %d", len(proxies))
+	}
+
+	for _, tc := range []struct {
+		name, remote, realIP, forwarded, want string
+	}{
+		{"direct", "203.0.113.7:5000", "", "", "203.0.113.7"},
+		{"spoofed real ip", "203.0.113.7:5000", "198.51.100.1", "", "203.0.113.7"},
+		{"spoofed forwarded", "203.0.113.7:5000", "", "198.51.100.1", "203.0.113.7"},
+		{"proxy real ip", "127.0.0.1:5000", "198.51.100.1", "", "198.51.100.1"},
+		{"proxy without headers", "[::1]:5000", "", "", "::1"},
+		{"proxy forwarded", "10.0.0.2:5000", "", "198.51.100.1", "198.51.100.1"},
+		{"proxy chain", "10.0.0.2:5000", "", "192.0.2.1, 198.51.100.1, 10.0.0.3", "198.51.100.1"},
+		{"only proxies", "10.0.0.2:5000", "", "10.0.0.4, 10.0.0.3", "10.0.0.4"},
+	} {
+		r := httptest.NewRequest("GET", "/auth/hls", nil)
+		r.RemoteAddr = tc.remote
+		if tc.realIP != "" {
+			r.Header.Set("X-Real-IP", tc.realIP)
+		}
+		if tc.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tc.forwarded)
+		}
+		if have := clientIP(r, proxies); have != tc.want {
+			t.Errorf("%s: want %s, have %s", tc.name, tc.want, have)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package srsmgmt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"srsmgmt/pkg/playlist"
+	"srsmgmt/pkg/srsconfig"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/gofrs/uuid"
+)
+
+// swagger:model TranscodeProfile
+type TranscodeProfile struct {
+	Name      string           `json:"name"`
+	Rungs     []srsconfig.Rung `json:"rungs"`
+	CreatedAt time.Time        `json:"createdAt"`
+	UpdatedAt time.Time        `json:"updatedAt"`
+}
+
+func (p TranscodeProfile) config() srsconfig.Profile {
+	return srsconfig.Profile{Name: p.Name, Rungs: p.Rungs}
+}
+
+// profileStore хранит профили и профили стримов в памяти: они нужны при каждой
+// генерации конфигурации SRS и при ожидании вариантов для мастер-плейлиста
+type profileStore struct {
+	sync.Mutex
+	profiles map[string]TranscodeProfile
+	streams  map[string]string
+}
+
+func (ps *profileStore) load(repo Repository) error {
+	profiles, err := repo.GetProfiles()
+	if err != nil {
+		return err
+	}
+	ps.Lock()
+	defer ps.Unlock()
+	ps.profiles = map[string]TranscodeProfile{}
+	for _, p := range *profiles {
+		ps.profiles[p.Name] = p
+	}
+	return nil
+}
+
+func (ps *profileStore) get(name string) (TranscodeProfile, bool) {
+	ps.Lock()
+	defer ps.Unlock()
+	p, ok := ps.profiles[name]
+	return p, ok
+}
+
+// list возвращает профили для конфигурации SRS, with добавляется или заменяет одноименный
+func (ps *profileStore) list(with *TranscodeProfile) []srsconfig.Profile {
+	ps.Lock()
+	defer ps.Unlock()
+	resp := []srsconfig.Profile{}
+	for name, p := range ps.profiles {
+		if with != nil && name == with.Name {
+			continue
+		}
+		resp = append(resp, p.config())
+	}
+	if with != nil {
+		resp = append(resp, with.config())
+	}
+	sort.Slice(resp, func(i, j int) bool { return resp[i].Name < resp[j].Name })
+	return resp
+}
+
+func (ps *profileStore) set(p TranscodeProfile) {
+	ps.Lock()
+	defer ps.Unlock()
+	if ps.profiles == nil {
+		ps.profiles = map[string]TranscodeProfile{}
+	}
+	ps.profiles[p.Name] = p
+}
+
+func (ps *profileStore) remove(name string) {
+	ps.Lock()
+	defer ps.Unlock()
+	delete(ps.profiles, name)
+}
+
+func (ps *profileStore) streamProfile(repo Repository, streamID uuid.UUID) string {
+	ps.Lock()
+	defer ps.Unlock()
+	if name, ok := ps.streams[streamID.String()]; ok {
+		return name
+	}
+	stream, err := repo.GetStream(streamID)
+	if err != nil {
+		return ""
+	}
+	if ps.streams == nil {
+		ps.streams = map[string]string{}
+	}
+	ps.streams[streamID.String()] = stream.Profile
+	return stream.Profile
+}
+
+func (ps *profileStore) setStream(streamID uuid.UUID, name string) {
+	ps.Lock()
+	defer ps.Unlock()
+	if ps.streams == nil {
+		ps.streams = map[string]string{}
+	}
+	ps.streams[streamID.String()] = name
+}
+
+func (ps *profileStore) removeStream(streamID uuid.UUID) {
+	ps.Lock()
+	defer ps.Unlock()
+	delete(ps.streams, streamID.String())
+}
+
+// PutProfile создает или заменяет профиль. Конфигурация SRS с новым профилем
+// применяется до сохранения, профиль, ломающий конфигурацию, не сохраняется
+func (s *srsMgmtService) PutProfile(ctx context.Context, profile TranscodeProfile) (*TranscodeProfile, error) {
+	if err := profile.config().Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadRequest, err)
+	}
+
+	now := time.Now()
+	profile.CreatedAt, profile.UpdatedAt = now, now
+	if prev, ok := s.profiles.get(profile.Name); ok {
+		profile.CreatedAt = prev.CreatedAt
+	}
+
+	if err := s.setProfiles(s.profiles.list(&profile)); err != nil {
+		level.Error(s.logger).Log("srsconfig", "SetProfiles", "profile", profile.Name, "err", err)
+		if errors.Is(err, srsconfig.ErrConfigApply) {
+			return nil, ErrSRSConfig
+		}
+		return nil, fmt.Errorf("%w: %v", ErrBadRequest, err)
+	}
+	if err := s.repo.SaveProfile(profile); err != nil {
+		s.setProfiles(s.profiles.list(nil))
+		return nil, ErrInternalError
+	}
+	s.profiles.set(profile)
+
+	return &profile, nil
+}
+
+func (s *srsMgmtService) GetProfiles(ctx context.Context) (*[]TranscodeProfile, error) {
+	profiles, err := s.repo.GetProfiles()
+	if err != nil {
+		return nil, ErrInternalError
+	}
+	return profiles, nil
+}
+
+func (s *srsMgmtService) GetProfile(ctx context.Context, name string) (*TranscodeProfile, error) {
+	profile, ok := s.profiles.get(name)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &profile, nil
+}
+
+// DeleteProfile удаляет профиль, если он не назначен активным стримам
+func (s *srsMgmtService) DeleteProfile(ctx context.Context, name string) error {
+	if _, ok := s.profiles.get(name); !ok {
+		return ErrNotFound
+	}
+	n, err := s.repo.CountProfileStreams(name)
+	if err != nil {
+		return ErrInternalError
+	}
+	if n > 0 {
+		return ErrBadStatus
+	}
+
+	if err := s.repo.DeleteProfile(name); err != nil {
+		return ErrInternalError
+	}
+	s.profiles.remove(name)
+	if err := s.setProfiles(s.profiles.list(nil)); err != nil {
+		level.Error(s.logger).Log("srsconfig", "SetProfiles", "err", err)
+	}
+	return nil
+}
+
+// setProfiles применяет профили на всех узлах пула. Если узел не принял
+// конфигурацию, на уже обновленных узлах восстанавливаются прежние профили
+func (s *srsMgmtService) setProfiles(list []srsconfig.Profile) error {
+	for i, n := range s.nodes {
+		if err := n.SRSConfig.SetProfiles(list); err != nil {
+			prev := s.profiles.list(nil)
+			for _, done := range s.nodes[:i] {
+				done.SRSConfig.SetProfiles(prev)
+			}
+			return fmt.Errorf("node %s: %w", n.Name, err)
+		}
+	}
+	return nil
+}
+
+// ladderSource отдает в мастер-плейлист лестницу профиля стрима
+func (s *srsMgmtService) ladderSource(livePath string) []playlist.Rendition {
+	streamID, err := uuid.FromString(path.Base(livePath))
+	if err != nil {
+		return nil
+	}
+	profile, ok := s.profiles.get(s.profiles.streamProfile(s.repo, streamID))
+	if !ok {
+		return nil
+	}
+
+	ladder := []playlist.Rendition{}
+	for _, r := range profile.Rungs {
+		w, h := r.Resolution()
+		ladder = append(ladder, playlist.Rendition{
+			Name:      r.Name,
+			Bandwidth: r.Bandwidth(),
+			Width:     w,
+			Height:    h,
+			FrameRate: float64(r.Engine().VFPS),
+			Codecs:    r.Codecs(),
+		})
+	}
+	return ladder
+}
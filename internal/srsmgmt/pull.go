@@ -0,0 +1,119 @@
+package srsmgmt
+
+import (
+	"fmt"
+	"net/url"
+	"srsmgmt/pkg/srsconfig"
+	"strings"
+
+	"github.com/go-kit/log/level"
+	"github.com/gofrs/uuid"
+)
+
+// Типы поступления стрима: по умолчанию кодировщик публикует в SRS сам,
+// для остальных сервис забирает стрим из источника и публикует его в SRS
+const (
+	IngestPush = ""
+	IngestRTSP = "rtsp"
+	IngestRTMP = "rtmp"
+	IngestHLS  = "hls"
+)
+
+var ingestSchemes = map[string][]string{
+	IngestRTSP: {"rtsp", "rtsps"},
+	IngestRTMP: {"rtmp", "rtmps"},
+	IngestHLS:  {"http", "https"},
+}
+
+func validateIngest(stream Stream) error {
+	if stream.IngestType == IngestPush {
+		return nil
+	}
+	schemes, ok := ingestSchemes[stream.IngestType]
+	if !ok {
+		return fmt.Errorf("%w: ingestType must be rtsp, rtmp or hls", ErrBadRequest)
+	}
+	u, err := url.Parse(stream.IngestURL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("%w: invalid ingestUrl", ErrBadRequest)
+	}
+	for _, scheme := range schemes {
+		if u.Scheme == scheme {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: ingestUrl scheme must be %v", ErrBadRequest, schemes)
+}
+
+func pullID(streamID uuid.UUID) string {
+	return "pull/" + streamID.String()
+}
+
+// startPull запускает забор стрима из источника. Публикация в SRS проходит
+// обычный on_publish, при обрыве ffmpeg перезапускается
+func (s *srsMgmtService) startPull(stream *Stream) {
+	if stream.IngestType == IngestPush {
+		s.relays.Stop(pullID(stream.StreamID))
+		return
+	}
+	s.relays.Start(pullID(stream.StreamID), s.pullArgs(stream), pullSecrets(stream)...)
+}
+
+func (s *srsMgmtService) stopPull(streamID uuid.UUID) {
+	s.relays.Stop(pullID(streamID))
+}
+
+// resumePulls возобновляет забор неостановленных стримов после перезапуска сервиса
+func (s *srsMgmtService) resumePulls() {
+	streams, err := s.repo.GetIngestStreams()
+	if err != nil {
+		level.Error(s.logger).Log("pull", "GetIngestStreams", "err", err)
+		return
+	}
+	for i := range *streams {
+		s.startPull(&(*streams)[i])
+	}
+}
+
+func (s *srsMgmtService) addPullStatus(stream *Stream) {
+	if stream.IngestType == IngestPush {
+		return
+	}
+	stats := s.relays.Stats(pullID(stream.StreamID))
+	stream.IngestRelay = &stats
+}
+
+// pullSecrets - пароли в адресах источника и публикации, в том числе
+// в экранированном виде, в котором ffmpeg печатает адрес источника
+func pullSecrets(stream *Stream) []string {
+	secrets := []string{stream.Password}
+	if stream.IngestPassword != "" {
+		escaped := strings.TrimPrefix(url.UserPassword("", stream.IngestPassword).String(), ":")
+		secrets = append(secrets, stream.IngestPassword, escaped)
+	}
+	return secrets
+}
+
+// pullArgs - аргументы ffmpeg: видео копируется, звук перекодируется в AAC,
+// так как камеры часто отдают PCM или G.711, которые не помещаются в FLV
+func (s *srsMgmtService) pullArgs(stream *Stream) []string {
+	source := stream.IngestURL
+	if u, err := url.Parse(source); err == nil && stream.IngestUser != "" {
+		u.User = url.UserPassword(stream.IngestUser, stream.IngestPassword)
+		source = u.String()
+	}
+
+	target := fmt.Sprintf("%s/%s/%s?password=%s", s.node(stream).LocalRTMPAddr, stream.App, stream.StreamID.String(), stream.Password)
+	if stream.Profile != "" {
+		target += "&vhost=" + srsconfig.ProfileVhost(stream.Profile)
+	}
+
+	args := []string{"-hide_banner", "-loglevel", "error"}
+	switch stream.IngestType {
+	case IngestRTSP:
+		args = append(args, "-rtsp_transport", "tcp")
+	default:
+		args = append(args, "-rw_timeout", "10000000")
+	}
+	return append(args, "-i", source, "-c:v", "copy", "-c:a", "aac", "-f", "flv", target)
+}
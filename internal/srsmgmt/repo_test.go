@@ -0,0 +1,141 @@
+package srsmgmt
+
+import (
+	"srsmgmt/config"
+	"sync"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/gofrs/uuid"
+)
+
+// memRepo - репозиторий в памяти для тестов сервиса. Методы, которые
+// тестам не нужны, остаются у встроенного nil Repository и паникуют
+type memRepo struct {
+	Repository
+
+	mu         sync.Mutex
+	streams    map[uuid.UUID]Stream
+	recordings []Recording
+	keys       map[uuid.UUID]map[int]StreamKey
+	keyReads   int
+	subtitles  map[uuid.UUID][]SubtitleTrack
+}
+
+func newMemRepo() *memRepo {
+	return &memRepo{streams: map[uuid.UUID]Stream{}, keys: map[uuid.UUID]map[int]StreamKey{}, subtitles: map[uuid.UUID][]SubtitleTrack{}}
+}
+
+func (r *memRepo) GetStream(id uuid.UUID) (*Stream, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st, ok := r.streams[id]
+	if !ok {
+		return &Stream{}, ErrNotFound
+	}
+	return &st, nil
+}
+
+func (r *memRepo) CreateStream(st Stream) (*Stream, error) {
+	return r.UpdateStream(st)
+}
+
+func (r *memRepo) UpdateStream(st Stream) (*Stream, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.streams[st.StreamID] = st
+	return &st, nil
+}
+
+func (r *memRepo) CreateRecording(rec Recording) (*Recording, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec.ID = uuid.Must(uuid.NewV4())
+	r.recordings = append(r.recordings, rec)
+	return &rec, nil
+}
+
+func (r *memRepo) UpdateRecording(rec Recording) (*Recording, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, v := range r.recordings {
+		if v.ID == rec.ID {
+			r.recordings[i] = rec
+		}
+	}
+	return &rec, nil
+}
+
+func (r *memRepo) GetRecordings(id uuid.UUID) (*[]Recording, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	recs := []Recording{}
+	for _, v := range r.recordings {
+		if v.StreamID == id {
+			recs = append(recs, v)
+		}
+	}
+	return &recs, nil
+}
+
+func (r *memRepo) DeleteRecordings(id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	recs := []Recording{}
+	for _, v := range r.recordings {
+		if v.StreamID != id {
+			recs = append(recs, v)
+		}
+	}
+	r.recordings = recs
+	return nil
+}
+
+func (r *memRepo) AddOffloadedSegment(OffloadedSegment) error {
+	return nil
+}
+
+func (r *memRepo) CreateStreamKey(k StreamKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.keys[k.StreamID] == nil {
+		r.keys[k.StreamID] = map[int]StreamKey{}
+	}
+	r.keys[k.StreamID][k.Period] = k
+	return nil
+}
+
+func (r *memRepo) GetStreamKey(id uuid.UUID, period int) (*StreamKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keyReads++
+	k, ok := r.keys[id][period]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &k, nil
+}
+
+func (r *memRepo) GetSubtitleTracks(id uuid.UUID) (*[]SubtitleTrack, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tracks := append([]SubtitleTrack{}, r.subtitles[id]...)
+	return &tracks, nil
+}
+
+// newTestService - сервис без SRS и фоновых задач с конфигурацией cfg
+func newTestService(t *testing.T, repo Repository, cfg config.Config) *srsMgmtService {
+	t.Helper()
+	return &srsMgmtService{
+		cfg:    cfg,
+		repo:   repo,
+		logger: log.NewNopLogger(),
+		nodes:  []*Node{{SRSNode: config.SRSNode{Name: config.DefaultNode, LiveTSPath: t.TempDir()}}},
+	}
+}
+
+func newTestStream(t *testing.T, repo *memRepo, app string) *Stream {
+	t.Helper()
+	st, _ := repo.CreateStream(Stream{StreamID: uuid.Must(uuid.NewV4()), App: app, Password: "123"})
+	return st
+}
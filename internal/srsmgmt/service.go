@@ -4,13 +4,16 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
 	"path"
 	"regexp"
 	"srsmgmt/config"
+	"srsmgmt/pkg/objstore"
+	"srsmgmt/pkg/playauth"
 	"srsmgmt/pkg/playlist"
+	"srsmgmt/pkg/relay"
 	"srsmgmt/pkg/srsclient"
 	"srsmgmt/pkg/srsconfig"
-	"strings"
 	"sync"
 	"time"
 
@@ -27,6 +30,12 @@ const (
 	StreamStatusStopPublish   = 4
 	StreamStatusError         = 5
 	StreamStatusStartRequired = 6
+	StreamStatusStalled       = 7
+	RecordingStatusPending    = 1
+	RecordingStatusUploading  = 2
+	RecordingStatusOffloaded  = 3
+	RecordingStatusFailed     = 4
+	RecordingStatusRecorded   = 5
 	SRSok                     = 0
 	SRSfail                   = 1
 	OutputPlaylistPrefix      = "master-"
@@ -40,6 +49,10 @@ var (
 	ErrBadStatus     = errors.New("BAD_STATUS")
 	ErrInternalError = errors.New("INTERNAL_ERROR")
 	ErrUnauthorized  = errors.New("UNAUTHORIZED")
+	ErrForbidden     = errors.New("FORBIDDEN")
+	ErrSRSConfig     = errors.New("SRS_CONFIG_APPLY_FAILED")
+	// SRS недоступен или отклонил запрос
+	ErrSRS = errors.New("SRS_REQUEST_FAILED")
 )
 
 type Service interface {
@@ -51,15 +64,72 @@ type Service interface {
 	MonStream(context.Context) (*[]monStream, error)
 	UpdateSRSStream(context.Context, SRSStream) (int, error)
 	UpdateHlsSRS(context.Context, SRSStream) (int, error)
+	VerifyStream(context.Context, uuid.UUID, bool) (*playlist.VerifyReport, error)
+	GetRecordings(context.Context, uuid.UUID) (*[]Recording, error)
+	GetRecordingFile(context.Context, uuid.UUID, uuid.UUID) (*RecordingFile, error)
+	UpdateDvrSRS(context.Context, SRSStream) (int, error)
+	GetStreamKey(context.Context, uuid.UUID, int, PlaybackRequest) ([]byte, error)
+	CreatePlaybackToken(context.Context, uuid.UUID, PlaybackTokenRequest) (*PlaybackToken, error)
+	AuthPlayback(context.Context, PlaybackRequest) (*PlaybackToken, error)
+	GetHLS(context.Context, HLSRequest) (*HLSFile, error)
+	GetSubtitles(context.Context, uuid.UUID) (*[]SubtitleTrack, error)
+	PutSubtitles(context.Context, SubtitleTrack, []byte) (*SubtitleTrack, error)
+	AddSubtitleCues(context.Context, uuid.UUID, string, []playlist.Cue) (*SubtitleTrack, error)
+	DeleteSubtitles(context.Context, uuid.UUID, string) error
+	CreateMarker(context.Context, Marker) (*Marker, error)
+	GetMarkers(context.Context, uuid.UUID) (*[]Marker, error)
+	DeleteMarker(context.Context, uuid.UUID, uuid.UUID) error
+	GetSRSConfig(context.Context, string) (*srsconfig.Config, error)
+	ReloadSRSConfig(context.Context, string) (*srsconfig.ReloadStats, error)
+	GetSRSDrift(context.Context, string, bool) (*srsconfig.DriftReport, error)
+	GetSRSNodes(context.Context) (*[]NodeStatus, error)
+	PutProfile(context.Context, TranscodeProfile) (*TranscodeProfile, error)
+	GetProfiles(context.Context) (*[]TranscodeProfile, error)
+	GetProfile(context.Context, string) (*TranscodeProfile, error)
+	DeleteProfile(context.Context, string) error
+	CreateForward(context.Context, ForwardDestination) (*ForwardDestination, error)
+	GetForwards(context.Context, uuid.UUID) (*[]ForwardDestination, error)
+	UpdateForward(context.Context, ForwardDestination) (*ForwardDestination, error)
+	DeleteForward(context.Context, uuid.UUID, uuid.UUID) error
 }
 
 type Repository interface {
 	GetMock() sqlmock.Sqlmock
 	GetStream(uuid.UUID) (*Stream, error)
 	GetRTCStreams() (*[]Stream, error)
+	GetIngestStreams() (*[]Stream, error)
 	CreateStream(Stream) (*Stream, error)
 	DeleteStream(uuid.UUID) (uuid.UUID, error)
 	UpdateStream(Stream) (*Stream, error)
+	CreateRecording(Recording) (*Recording, error)
+	UpdateRecording(Recording) (*Recording, error)
+	GetRecordings(uuid.UUID) (*[]Recording, error)
+	GetPendingRecordings() (*[]Recording, error)
+	DeleteRecordings(uuid.UUID) error
+	AddOffloadedSegment(OffloadedSegment) error
+	GetOffloadedSegments() (*[]OffloadedSegment, error)
+	CreateStreamKey(StreamKey) error
+	GetStreamKey(uuid.UUID, int) (*StreamKey, error)
+	DeleteStreamKeys(uuid.UUID) error
+	// SaveSubtitleTrack снимает Default с остальных дорожек стрима, если он задан у сохраняемой
+	SaveSubtitleTrack(SubtitleTrack) error
+	GetSubtitleTracks(uuid.UUID) (*[]SubtitleTrack, error)
+	DeleteSubtitleTrack(uuid.UUID, string) error
+	DeleteSubtitleTracks(uuid.UUID) error
+	CreateMarker(Marker) error
+	GetMarkers(uuid.UUID) (*[]Marker, error)
+	DeleteMarker(uuid.UUID, uuid.UUID) error
+	DeleteMarkers(uuid.UUID) error
+	SaveProfile(TranscodeProfile) error
+	GetProfiles() (*[]TranscodeProfile, error)
+	DeleteProfile(string) error
+	CountProfileStreams(string) (int64, error)
+	CountNodeStreams(string) (int64, error)
+	CreateForward(ForwardDestination) error
+	GetForwards(uuid.UUID) (*[]ForwardDestination, error)
+	UpdateForward(ForwardDestination) error
+	DeleteForward(uuid.UUID, uuid.UUID) error
+	DeleteForwards(uuid.UUID) error
 }
 
 // swagger:model Stream
@@ -71,12 +141,56 @@ type Stream struct {
 	HLS       string     `json:"hls"`
 	RTMPpush  string     `json:"rtmpPush"`
 	SRTpush   string     `json:"srtPush"`
+	WHIPpush  string     `json:"whipPush,omitempty"`
+	WHEPplay  string     `json:"whepPlay,omitempty"`
 	CreatedAt time.Time  `json:"createdAt"`
 	UpdatedAt time.Time  `json:"updatedAt"`
 	ClientId  string     `json:"clientId"`
 	StartedAt *time.Time `json:"startedAt"`
 	StopedAt  *time.Time `json:"stopedAt"`
-	RTC       bool       `json:"rtc"`
+	RTC       bool       `json:"-"` // стрим в конфигурации SRS узла, сбрасывается при остановке
+	DVR       bool       `json:"dvr"`
+
+	Encrypted   bool   `json:"encrypted"`
+	KeyRotation int    `json:"keyRotation,omitempty"`
+	ViewerToken string `json:"viewerToken,omitempty"`
+	Profile     string `json:"profile,omitempty"`
+	Node        string `json:"node,omitempty"`
+
+	IngestType     string       `json:"ingestType,omitempty"`
+	IngestURL      string       `json:"ingestUrl,omitempty"`
+	IngestUser     string       `json:"ingestUser,omitempty"`
+	IngestPassword string       `json:"-"` // принимается при создании, в ответах не возвращается
+	IngestRelay    *relay.Stats `json:"ingestRelay,omitempty"`
+
+	Health       string               `json:"health,omitempty"`
+	LastSegments map[string]time.Time `json:"lastSegments,omitempty"`
+}
+
+// swagger:model Recording
+type Recording struct {
+	ID        uuid.UUID  `json:"id"`
+	StreamID  uuid.UUID  `json:"streamId"`
+	Type      string     `json:"type"`
+	Status    int        `json:"status"`
+	Playlist  string     `json:"playlist,omitempty"`
+	URL       string     `json:"url"`
+	Segments  int        `json:"segments,omitempty"`
+	Format    string     `json:"format,omitempty"`
+	Duration  float64    `json:"duration,omitempty"`
+	Size      int64      `json:"size,omitempty"`
+	File      string     `json:"-"`
+	Error     string     `json:"error,omitempty"`
+	StartedAt *time.Time `json:"startedAt"`
+	StopedAt  *time.Time `json:"stopedAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+}
+
+type OffloadedSegment struct {
+	StreamID uuid.UUID
+	Name     string
+	URL      string
 }
 
 type SRSStream struct {
@@ -107,15 +221,24 @@ type srsMgmtService struct {
 	repo          Repository
 	logger        log.Logger
 	playlist      *playlist.Playlist
-	srsClient     srsclient.SrsClient
-	srsConfig     *srsconfig.SRSConfig
+	nodes         []*Node
 	cachedStreams cachedStreams
+	store         *objstore.Store
+	offloaded     offloadIndex
+	keys          keyStore
+	playAuth      *playauth.Signer
+	subtitles     subtitleStore
+	markers       markerStore
+	ingest        ingestTracker
+	relays        *relay.Supervisor
+	profiles      profileStore
 }
 
 type monStream struct {
 	Id    string `json:"id"`
 	Name  string `json:"name"`
 	App   string `json:"app"`
+	Node  string `json:"node"`
 	Video struct {
 		Width  int `json:"width"`
 		Height int `json:"height"`
@@ -128,25 +251,65 @@ type monStream struct {
 	}
 }
 
-func NewSrsMgmtService(repo Repository, logger log.Logger, plist *playlist.Playlist, client srsclient.SrsClient, srsconfigSvc *srsconfig.SRSConfig) Service {
+// NewSrsMgmtService создает сервис для пула узлов SRS, первый узел
+// получает стримы, созданные до появления пула
+func NewSrsMgmtService(repo Repository, logger log.Logger, plist *playlist.Playlist, nodes []*Node, store *objstore.Store) Service {
+	s := srsMgmtService{
+		cfg:      *config.GetConfig(),
+		repo:     repo,
+		logger:   logger,
+		playlist: plist,
+		nodes:    nodes,
+		store:    store,
+		relays:   relay.New(config.GetConfig().FFmpegPath),
+	}
+
+	if err := s.profiles.load(repo); err != nil {
+		level.Error(logger).Log("profiles", "GetProfiles", "err", err)
+	}
 	rtcStreamsRepo, _ := repo.GetRTCStreams()
-	rtcStreams := []srsconfig.SRSstream{}
-	for _, v := range *rtcStreamsRepo {
-		rtcStreams = append(rtcStreams, srsconfig.SRSstream{
-			ID:       v.StreamID.String(),
-			Password: v.Password,
-		})
+	rtcStreams := map[*Node][]srsconfig.SRSstream{}
+	for i := range *rtcStreamsRepo {
+		stream := &(*rtcStreamsRepo)[i]
+		n := s.node(stream)
+		rtcStreams[n] = append(rtcStreams[n], srsStream(stream))
+	}
+	for _, n := range nodes {
+		n.SRSConfig.Profiles = s.profiles.list(nil)
+		n.SRSConfig.Init(rtcStreams[n])
 	}
-	srsconfigSvc.Init(rtcStreams)
 
-	s := srsMgmtService{
-		cfg:       *config.GetConfig(),
-		repo:      repo,
-		logger:    logger,
-		playlist:  plist,
-		srsClient: client,
-		srsConfig: srsconfigSvc,
+	if s.cfg.PlaybackSecret != "" {
+		s.playAuth = playauth.New(s.cfg.PlaybackSecret)
 	}
+
+	if plist != nil {
+		plist.AddSegmentHook(s.keyHook)
+		plist.SetSubtitleSource(s.subtitleSource)
+		plist.SetMarkerSource(s.markerSource)
+		plist.SetLadderSource(s.ladderSource)
+	}
+
+	if s.cfg.StallThreshold > 0 {
+		go s.runStallMonitor()
+	}
+
+	s.resumePulls()
+
+	if s.cfg.SRSDriftInterval > 0 {
+		go s.runDriftMonitor()
+	}
+
+	if store != nil {
+		if err := s.offloaded.load(repo); err != nil {
+			level.Error(logger).Log("offload", "GetOffloadedSegments", "err", err)
+		}
+		if plist != nil {
+			plist.AddSegmentHook(s.offloaded.segmentHook)
+		}
+		go s.runOffload()
+	}
+
 	return &s
 }
 
@@ -156,17 +319,31 @@ func (s *srsMgmtService) GetStream(ctx context.Context, st Stream) (*Stream, err
 		return &Stream{}, ErrNotFound
 	}
 	s.addSRSUrls(stream)
+	s.addHealth(stream)
+	s.addPullStatus(stream)
 
 	return stream, err
 }
 
 func (s *srsMgmtService) CreateStream(ctx context.Context, newStream Stream) (*Stream, error) {
-	// временно все стримы становятся webrtc
+	// активный стрим входит в конфигурацию SRS своего узла
 	newStream.RTC = true
+	if newStream.Encrypted && newStream.ViewerToken == "" {
+		newStream.ViewerToken = newViewerToken()
+	}
+	if _, ok := s.profiles.get(newStream.Profile); newStream.Profile != "" && !ok {
+		return &Stream{}, ErrBadRequest
+	}
+	if err := validateIngest(newStream); err != nil {
+		return &Stream{}, err
+	}
 
 	stream, err := s.repo.GetStream(newStream.StreamID)
 	if err != nil || stream == nil {
-		// если стрима нет, то создаем
+		// если стрима нет, то создаем на наименее загруженном узле
+		if err := s.assignNode(&newStream); err != nil {
+			return &Stream{}, err
+		}
 		stream, err = s.repo.CreateStream(newStream)
 		if err != nil {
 			return &Stream{}, ErrInternalError
@@ -177,21 +354,37 @@ func (s *srsMgmtService) CreateStream(ctx context.Context, newStream Stream) (*S
 		stream.StopedAt = nil
 		stream.StartedAt = nil
 		stream.RTC = newStream.RTC
+		stream.DVR = newStream.DVR
 		stream.Password = newStream.Password
+		stream.Encrypted = newStream.Encrypted
+		stream.KeyRotation = newStream.KeyRotation
+		stream.Profile = newStream.Profile
+		stream.IngestType = newStream.IngestType
+		stream.IngestURL = newStream.IngestURL
+		stream.IngestUser = newStream.IngestUser
+		stream.IngestPassword = newStream.IngestPassword
+		if stream.Encrypted && stream.ViewerToken == "" {
+			stream.ViewerToken = newStream.ViewerToken
+		}
+		if err := s.assignNode(stream); err != nil {
+			return &Stream{}, err
+		}
 		stream, err = s.repo.UpdateStream(*stream)
 		if err != nil {
 			return nil, ErrInternalError
 		}
 	}
 	s.addSRSUrls(stream)
+	s.profiles.setStream(stream.StreamID, stream.Profile)
 
-	if stream.RTC {
-		s.srsConfig.AddRTC(stream.StreamID.String(), stream.Password)
-	} else {
-		s.srsConfig.RemoveRTC(stream.StreamID.String())
+	if err := s.node(stream).SRSConfig.AddStream(srsStream(stream)); err != nil {
+		level.Error(s.logger).Log("srsconfig", stream.StreamID, "err", err)
+		return stream, ErrSRSConfig
 	}
+	s.startPull(stream)
+	s.addPullStatus(stream)
 
-	return stream, err
+	return stream, nil
 }
 
 func (s *srsMgmtService) DeleteStream(ctx context.Context, streamID uuid.UUID) (uuid.UUID, error) {
@@ -201,20 +394,53 @@ func (s *srsMgmtService) DeleteStream(ctx context.Context, streamID uuid.UUID) (
 	}
 
 	s.logger.Log("Kicking client ", stream.ClientId)
-	if err := s.srsClient.KickSRSStream(stream.ClientId); err != nil {
+	if err := s.node(stream).Client.KickSRSStream(ctx, stream.ClientId); err != nil {
+		return uuid.UUID{}, fmt.Errorf("%w: %v", ErrSRS, err)
+	}
+
+	if err := s.playlist.Delete(s.livePath(stream)); err != nil {
+		return uuid.UUID{}, ErrInternalError
+	}
+
+	s.stopPull(stream.StreamID)
+	confErr := s.node(stream).SRSConfig.RemoveStream(stream.StreamID.String())
+
+	s.deleteDVR(stream)
+	if s.store != nil {
+		s.deleteOffloaded(stream.StreamID)
+	}
+
+	s.ingest.stop(stream.StreamID.String())
+
+	s.keys.remove(stream.StreamID.String())
+	if err := s.repo.DeleteStreamKeys(stream.StreamID); err != nil {
+		return uuid.UUID{}, ErrInternalError
+	}
+
+	s.subtitles.remove(stream.StreamID.String())
+	if err := s.repo.DeleteSubtitleTracks(stream.StreamID); err != nil {
 		return uuid.UUID{}, ErrInternalError
 	}
 
-	if err := s.playlist.Delete(path.Join(s.cfg.LiveTSPath, stream.StreamID.String())); err != nil {
+	s.markers.remove(stream.StreamID.String())
+	s.profiles.removeStream(stream.StreamID)
+	if err := s.repo.DeleteMarkers(stream.StreamID); err != nil {
 		return uuid.UUID{}, ErrInternalError
 	}
 
-	s.srsConfig.RemoveRTC(stream.StreamID.String())
+	s.stopForwards(stream.StreamID)
+	if err := s.repo.DeleteForwards(stream.StreamID); err != nil {
+		return uuid.UUID{}, ErrInternalError
+	}
 
 	_, err = s.repo.DeleteStream(stream.StreamID)
 	if err != nil {
 		return uuid.UUID{}, ErrInternalError
 	}
+	if confErr != nil {
+		level.Error(s.logger).Log("srsconfig", stream.StreamID, "err", confErr)
+		return streamID, ErrSRSConfig
+	}
 
 	return streamID, err
 }
@@ -241,15 +467,20 @@ func (s *srsMgmtService) StartStream(ctx context.Context, streamID uuid.UUID) (*
 		return stream, nil
 	}
 	stream.StartedAt = &n
-
-	level.Debug(s.logger).Log("before playlist.StartStream:Refresh")
-	if err := s.playlist.Refresh(path.Join(s.cfg.LiveTSPath, stream.StreamID.String()), playlist.AllPlaylists, stream.StartedAt, OutputPlaylistPrefix); err != nil {
-		level.Debug(s.logger).Log("playlist.StartStream:Refresh", err)
-		return nil, err
+	s.trackKeys(stream)
+	s.subtitles.reset(stream.StreamID.String())
+
+	// в режиме HLS origin плейлисты собираются по запросу
+	if !s.cfg.HLSOrigin {
+		level.Debug(s.logger).Log("before playlist.StartStream:Refresh")
+		if err := s.playlist.Refresh(s.livePath(stream), playlist.AllPlaylists, stream.StartedAt, OutputPlaylistPrefix); err != nil {
+			level.Debug(s.logger).Log("playlist.StartStream:Refresh", err)
+			return nil, err
+		}
 	}
 
 	level.Debug(s.logger).Log("before playlist.StartStream:Create", err)
-	if err := s.playlist.Create(path.Join(s.cfg.LiveTSPath, stream.StreamID.String()), OutputPlaylistPrefix, stream.StartedAt); err != nil {
+	if err := s.playlist.Create(s.livePath(stream), OutputPlaylistPrefix, stream.StartedAt); err != nil {
 		level.Debug(s.logger).Log("playlist.StartStream:Create", err)
 	}
 	stream, err = s.repo.UpdateStream(*stream)
@@ -271,12 +502,19 @@ func (s *srsMgmtService) StopStream(ctx context.Context, streamID uuid.UUID) (*S
 		return nil, ErrBadStatus
 	}
 
+	// без остановки забора ffmpeg опубликует стрим снова
+	s.stopPull(stream.StreamID)
 	level.Info(s.logger).Log("Kicking client ", stream.ClientId)
-	if err := s.srsClient.KickSRSStream(stream.ClientId); err != nil {
-		return nil, err
+	if err := s.node(stream).Client.KickSRSStream(ctx, stream.ClientId); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSRS, err)
 	}
 
-	if err := s.playlist.Stop(path.Join(s.cfg.LiveTSPath, stream.StreamID.String()), OutputPlaylistPrefix, stream.StartedAt); err != nil {
+	if s.cfg.HLSOrigin {
+		if err := s.playlist.Materialize(s.livePath(stream), OutputPlaylistPrefix, stream.StartedAt); err != nil {
+			return nil, ErrInternalError
+		}
+	}
+	if err := s.playlist.Stop(s.livePath(stream), OutputPlaylistPrefix, stream.StartedAt); err != nil {
 		return nil, ErrBadStatus
 	}
 
@@ -291,7 +529,22 @@ func (s *srsMgmtService) StopStream(ctx context.Context, streamID uuid.UUID) (*S
 	}
 	s.addSRSUrls(stream)
 
-	s.srsConfig.RemoveRTC(stream.StreamID.String())
+	confErr := s.node(stream).SRSConfig.RemoveStream(stream.StreamID.String())
+	s.ingest.stop(stream.StreamID.String())
+	s.stopForwards(stream.StreamID)
+
+	if tracks, err := s.subtitles.get(s.repo, stream.StreamID); err == nil {
+		s.writeSubtitles(stream, tracks, 0)
+	}
+
+	if s.store != nil {
+		s.enqueueOffload(stream)
+	}
+
+	if confErr != nil {
+		level.Error(s.logger).Log("srsconfig", stream.StreamID, "err", confErr)
+		return stream, ErrSRSConfig
+	}
 
 	return stream, err
 }
@@ -301,32 +554,43 @@ func (s *srsMgmtService) MonStream(ctx context.Context) (*[]monStream, error) {
 	defer s.cachedStreams.Unlock()
 
 	if s.cachedStreams.Add(time.Duration(s.cfg.CacheTTL) * time.Second).Before(time.Now()) {
-		streamStat, err := s.srsClient.GetSRSStream()
-		if err != nil || streamStat == nil {
-			return nil, err
+		// недоступный узел не скрывает стримы остальных
+		streams, failed := []monStream{}, 0
+		var err error
+		for _, n := range s.nodes {
+			var streamStat *[]srsclient.SRSStream
+			streamStat, err = n.Client.GetSRSStream(ctx)
+			if err != nil || streamStat == nil {
+				level.Error(s.logger).Log("node", n.Name, "GetSRSStream", err)
+				failed++
+				continue
+			}
+			for _, v := range *streamStat {
+				m := monStream{
+					Id:   v.Id,
+					Name: v.Name,
+					App:  v.App,
+					Node: n.Name,
+				}
+				m.Video.Width, m.Video.Height = v.Video.Width, v.Video.Height
+				m.Audio.Channel = v.Audio.Channel
+				m.Kbps.Recv_30s = v.Kbps.Recv_30s
+				streams = append(streams, m)
+			}
 		}
-
-		s.cachedStreams.streams = []monStream{}
-		for _, v := range *streamStat {
-			s.cachedStreams.streams = append(s.cachedStreams.streams, monStream{
-				Id:    v.Id,
-				Name:  v.Name,
-				App:   v.App,
-				Video: v.Video,
-				Audio: v.Audio,
-				Kbps:  v.Kbps,
-			})
+		if failed == len(s.nodes) {
+			return nil, err
 		}
+		s.cachedStreams.streams = streams
 		s.cachedStreams.Time = time.Now()
 	}
 
 	return &s.cachedStreams.streams, nil
 }
 
+// UpdateSRSStream обрабатывает on_publish и on_unpublish. Публикация по WHIP
+// (upstream=rtc) проверяется паролем так же, как RTMP и SRT
 func (s *srsMgmtService) UpdateSRSStream(ctx context.Context, st SRSStream) (int, error) {
-	if strings.Contains(st.Param, "upstream=rtc") {
-		return SRSok, nil
-	}
 	if st.App != "live" {
 		return SRSfail, ErrBadRequest
 	}
@@ -352,13 +616,13 @@ func (s *srsMgmtService) UpdateSRSStream(ctx context.Context, st SRSStream) (int
 		switch stream.Status {
 		case StreamStatusStartRequired:
 			go func(stream *Stream) {
-				if err := s.playlist.Create(path.Join(s.cfg.LiveTSPath, stream.StreamID.String()), OutputPlaylistPrefix, stream.StartedAt); err != nil {
+				if err := s.playlist.Create(s.livePath(stream), OutputPlaylistPrefix, stream.StartedAt); err != nil {
 					level.Debug(s.logger).Log("playlist.CreateDVR", err)
 					stream.Status = StreamStatusError
 					s.repo.UpdateStream(*stream)
 
 					level.Debug(s.logger).Log("Kicking client ", stream.ClientId)
-					s.srsClient.KickSRSStream(stream.ClientId)
+					s.node(stream).Client.KickSRSStream(context.Background(), stream.ClientId)
 				}
 			}(stream)
 			fallthrough
@@ -367,31 +631,37 @@ func (s *srsMgmtService) UpdateSRSStream(ctx context.Context, st SRSStream) (int
 			stream.Status = StreamStatusPublish
 			stream.ClientId = st.ClientID
 			s.repo.UpdateStream(*stream)
+			s.ingest.start(stream.StreamID.String(), time.Now())
+			s.startForwards(stream)
 			go func(stream *Stream) {
-				if err := s.playlist.Create(path.Join(s.cfg.LiveTSPath, stream.StreamID.String()), OutputPlaylistPrefix, nil); err != nil {
+				if err := s.playlist.Create(s.livePath(stream), OutputPlaylistPrefix, nil); err != nil {
 					level.Debug(s.logger).Log("playlist.Create", err)
 					stream.Status = StreamStatusError
 					s.repo.UpdateStream(*stream)
 
 					level.Debug(s.logger).Log("Kicking client ", stream.ClientId)
-					s.srsClient.KickSRSStream(stream.ClientId)
+					s.node(stream).Client.KickSRSStream(context.Background(), stream.ClientId)
 				}
 			}(stream)
 
 			return SRSok, nil
 
-		case StreamStatusPause, StreamStatusPublish:
+		case StreamStatusPause, StreamStatusPublish, StreamStatusStalled:
 			stream.Status = StreamStatusPublish
 			stream.ClientId = st.ClientID
+			s.ingest.start(stream.StreamID.String(), time.Now())
+			s.startForwards(stream)
 
 		default:
 			return SRSfail, ErrBadRequest
 		}
 	case "on_unpublish":
 		switch stream.Status {
-		case StreamStatusPublish:
+		case StreamStatusPublish, StreamStatusStalled:
 			stream.Status = StreamStatusPause
 			stream.ClientId = ""
+			s.ingest.stop(stream.StreamID.String())
+			s.stopForwards(stream.StreamID)
 		default:
 			return SRSok, nil
 		}
@@ -406,10 +676,6 @@ func (s *srsMgmtService) UpdateSRSStream(ctx context.Context, st SRSStream) (int
 }
 
 func (s *srsMgmtService) UpdateHlsSRS(ctx context.Context, st SRSStream) (int, error) {
-	if strings.Contains(st.Param, "upstream=rtc") {
-		return SRSok, nil
-	}
-
 	streamUuid, err := uuid.FromString(st.StreamID)
 	if err != nil {
 		return SRSfail, ErrNotFound
@@ -421,11 +687,48 @@ func (s *srsMgmtService) UpdateHlsSRS(ctx context.Context, st SRSStream) (int, e
 	}
 
 	plName := path.Base(st.M3U8)
+	livePath := s.livePath(stream)
+	segments := []string{path.Join(livePath, path.Base(st.File))}
+	audioCreated := false
+	if plName == playlist.AudioSource && stream.Status != StreamStatusStopPublish {
+		// звук извлекается до шифрования исходного сегмента
+		_, err := os.Stat(path.Join(livePath, playlist.AudioPlaylist))
+		audioCreated = os.IsNotExist(err)
+		audioFile, err := s.playlist.ExtractAudio(livePath, st.File)
+		if err != nil {
+			level.Debug(s.logger).Log("ExtractAudio", st.File, "err", err)
+			audioCreated = false
+		} else {
+			segments = append(segments, audioFile)
+		}
+	}
+	if stream.Encrypted && stream.Status != StreamStatusStopPublish {
+		s.rememberStartPTS(stream, segments[0])
+		for _, segment := range segments {
+			if err := s.encryptSegment(stream, segment); err != nil {
+				level.Error(s.logger).Log("encryptSegment", segment, "err", err)
+			}
+		}
+	}
 	if stream.Status != StreamStatusStopPublish {
-		if err := s.playlist.Refresh(path.Join(s.cfg.LiveTSPath, stream.StreamID.String()), plName, stream.StartedAt, OutputPlaylistPrefix); err != nil {
-			level.Debug(s.logger).Log("Refresh Playlist", fmt.Sprintf("[%s] %s", plName, stream.StartedAt))
-			return 0, err
+		s.trackSegment(stream, plName)
+		if s.cfg.HLSOrigin {
+			s.indexSegments(livePath, plName, st, segments)
+		} else {
+			if err := s.playlist.Refresh(livePath, plName, stream.StartedAt, OutputPlaylistPrefix); err != nil {
+				level.Debug(s.logger).Log("Refresh Playlist", fmt.Sprintf("[%s] %s", plName, stream.StartedAt))
+				return 0, err
+			}
+			if len(segments) > 1 {
+				if err := s.playlist.Refresh(livePath, playlist.AudioPlaylist, stream.StartedAt, OutputPlaylistPrefix); err != nil {
+					level.Debug(s.logger).Log("Refresh Playlist", fmt.Sprintf("[%s] %s", playlist.AudioPlaylist, stream.StartedAt))
+				}
+			}
+		}
+		if audioCreated {
+			s.refreshMasters(livePath)
 		}
+		s.updateLiveSubtitles(stream)
 	}
 
 	if stream.Status == StreamStatusStartRequired {
@@ -433,7 +736,7 @@ func (s *srsMgmtService) UpdateHlsSRS(ctx context.Context, st SRSStream) (int, e
 			stream.Status = StreamStatusPublish
 			s.repo.UpdateStream(*stream)
 
-			if err := s.playlist.Create(path.Join(s.cfg.LiveTSPath, stream.StreamID.String()), OutputPlaylistPrefix, stream.StartedAt); err != nil {
+			if err := s.playlist.Create(s.livePath(stream), OutputPlaylistPrefix, stream.StartedAt); err != nil {
 				level.Debug(s.logger).Log("playlist.CreateDVR", err)
 				stream.Status = StreamStatusError
 				s.repo.UpdateStream(*stream)
@@ -444,12 +747,90 @@ func (s *srsMgmtService) UpdateHlsSRS(ctx context.Context, st SRSStream) (int, e
 	return 0, nil
 }
 
+func (s *srsMgmtService) VerifyStream(ctx context.Context, streamID uuid.UUID, repair bool) (*playlist.VerifyReport, error) {
+	stream, err := s.repo.GetStream(streamID)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	// во время публикации SRS сам перезаписывает исходные плейлисты
+	if repair && (stream.Status == StreamStatusPublish || stream.Status == StreamStatusStalled) {
+		return nil, ErrBadStatus
+	}
+
+	s.trackKeys(stream)
+	report, err := s.playlist.Verify(s.livePath(stream), repair)
+	if err != nil {
+		if err == playlist.ErrNoMediaPlaylists {
+			return nil, ErrNoStreaming
+		}
+		return nil, ErrInternalError
+	}
+
+	return report, nil
+}
+
+func (s *srsMgmtService) GetRecordings(ctx context.Context, streamID uuid.UUID) (*[]Recording, error) {
+	if _, err := s.repo.GetStream(streamID); err != nil {
+		return nil, ErrNotFound
+	}
+
+	recs, err := s.repo.GetRecordings(streamID)
+	if err != nil {
+		return nil, ErrInternalError
+	}
+	for i := range *recs {
+		if rec := &(*recs)[i]; rec.Type == RecordingTypeDVR {
+			rec.URL = recordingFileURL(*rec)
+		}
+	}
+
+	return recs, nil
+}
+
+func (s *srsMgmtService) GetStreamKey(ctx context.Context, streamID uuid.UUID, period int, viewer PlaybackRequest) ([]byte, error) {
+	stream, err := s.repo.GetStream(streamID)
+	if err != nil || !stream.Encrypted {
+		return nil, ErrNotFound
+	}
+	// за авторизацией воспроизведения плеер предъявляет токен воспроизведения
+	if !validViewerToken(stream, viewer.Token) && !s.validPlaybackToken(streamID, viewer) {
+		return nil, ErrUnauthorized
+	}
+
+	key, err := s.keys.get(s.repo, streamID, period, false)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	return key.Key, nil
+}
+
+// addSRSUrls заполняет адреса публикации и просмотра на узле стрима
 func (s *srsMgmtService) addSRSUrls(stream *Stream) {
+	n := s.node(stream)
+	stream.Node = n.Name
 	streamTS := ""
 	if stream.StartedAt != nil && !stream.StartedAt.IsZero() {
 		streamTS = fmt.Sprintf("%d-", stream.StartedAt.Unix())
 	}
-	stream.HLS = fmt.Sprintf("%s/%s/%s/%s%s%s", s.cfg.HLSAddr, stream.App, stream.StreamID.String(), OutputPlaylistPrefix, streamTS, "index.m3u8")
-	stream.RTMPpush = fmt.Sprintf("%s/%s/%s?password=%s", s.cfg.RTMPAddr, stream.App, stream.StreamID.String(), stream.Password)
-	stream.SRTpush = fmt.Sprintf("%s?streamid=#!::r=%s/%s,m=publish,password=%s", s.cfg.SRTAddr, stream.App, stream.StreamID.String(), stream.Password)
+	stream.HLS = fmt.Sprintf("%s/%s/%s/%s%s%s", n.HLSAddr, stream.App, stream.StreamID.String(), OutputPlaylistPrefix, streamTS, "index.m3u8")
+	stream.RTMPpush = fmt.Sprintf("%s/%s/%s?password=%s", n.RTMPAddr, stream.App, stream.StreamID.String(), stream.Password)
+	stream.SRTpush = fmt.Sprintf("%s?streamid=#!::r=%s/%s,m=publish,password=%s", n.SRTAddr, stream.App, stream.StreamID.String(), stream.Password)
+	stream.WHIPpush, stream.WHEPplay = "", ""
+	// WHEP отдает SRS напрямую, токены воспроизведения при этом не проверяются
+	if stream.RTC && n.RTCAddr != "" {
+		stream.WHIPpush = fmt.Sprintf("%s/rtc/v1/whip/?app=%s&stream=%s&password=%s", n.RTCAddr, stream.App, stream.StreamID.String(), stream.Password)
+		stream.WHEPplay = fmt.Sprintf("%s/rtc/v1/whep/?app=%s&stream=%s", n.RTCAddr, stream.App, stream.StreamID.String())
+	}
+	if stream.Profile != "" {
+		// стримы с профилем транскодируются в vhost профиля
+		vhost := srsconfig.ProfileVhost(stream.Profile)
+		stream.RTMPpush += "&vhost=" + vhost
+		stream.SRTpush = fmt.Sprintf("%s?streamid=#!::h=%s,r=%s/%s,m=publish,password=%s", n.SRTAddr, vhost, stream.App, stream.StreamID.String(), stream.Password)
+		if stream.WHIPpush != "" {
+			stream.WHIPpush += "&vhost=" + vhost
+			stream.WHEPplay += "&vhost=" + vhost
+		}
+	}
 }
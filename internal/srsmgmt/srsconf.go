@@ -0,0 +1,102 @@
+package srsmgmt
+
+import (
+	"context"
+	"errors"
+	"srsmgmt/pkg/srsconfig"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log/level"
+)
+
+// srsStream - параметры стрима в конфигурации SRS
+func srsStream(stream *Stream) srsconfig.SRSstream {
+	return srsconfig.SRSstream{
+		ID:  stream.StreamID.String(),
+		App: stream.App,
+		DVR: stream.DVR,
+	}
+}
+
+// GetSRSConfig возвращает действующую конфигурацию SRS узла node
+func (s *srsMgmtService) GetSRSConfig(ctx context.Context, node string) (*srsconfig.Config, error) {
+	n, err := s.nodeByName(node)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := n.SRSConfig.Current()
+	if err != nil {
+		level.Error(s.logger).Log("srsconfig", "Current", "err", err)
+		return nil, ErrInternalError
+	}
+	return cfg, nil
+}
+
+// ReloadSRSConfig перерисовывает конфигурацию SRS и перезагружает SRS вручную,
+// например после изменения шаблонов или перезапуска SRS
+func (s *srsMgmtService) ReloadSRSConfig(ctx context.Context, node string) (*srsconfig.ReloadStats, error) {
+	n, err := s.nodeByName(node)
+	if err != nil {
+		return nil, err
+	}
+	if err := n.SRSConfig.Reload(); err != nil {
+		level.Error(s.logger).Log("srsconfig", "Reload", "err", err)
+		if errors.Is(err, srsconfig.ErrConfigApply) {
+			return nil, ErrSRSConfig
+		}
+		return nil, ErrInternalError
+	}
+	stats := n.SRSConfig.Stats()
+	return &stats, nil
+}
+
+// GetSRSDrift возвращает результат последней проверки расхождений
+// конфигурации SRS узла node, check - проверить сейчас
+func (s *srsMgmtService) GetSRSDrift(ctx context.Context, node string, check bool) (*srsconfig.DriftReport, error) {
+	n, err := s.nodeByName(node)
+	if err != nil {
+		return nil, err
+	}
+	if !check {
+		report := n.SRSConfig.Drift()
+		return &report, nil
+	}
+	report, err := n.SRSConfig.CheckDrift(s.driftPolicy())
+	if err != nil {
+		level.Error(s.logger).Log("srsconfig", "CheckDrift", "err", err)
+		if errors.Is(err, srsconfig.ErrConfigApply) {
+			return nil, ErrSRSConfig
+		}
+	}
+	return &report, nil
+}
+
+func (s *srsMgmtService) driftPolicy() srsconfig.DriftPolicy {
+	policy, err := srsconfig.ParseDriftPolicy(s.cfg.SRSDriftPolicy)
+	if err != nil {
+		return srsconfig.DriftAlert
+	}
+	return policy
+}
+
+func (s *srsMgmtService) runDriftMonitor() {
+	if _, err := srsconfig.ParseDriftPolicy(s.cfg.SRSDriftPolicy); err != nil {
+		level.Error(s.logger).Log("srsconfig", "drift", "err", err, "policy", srsconfig.DriftAlert)
+	}
+	t := time.NewTicker(time.Duration(s.cfg.SRSDriftInterval) * time.Second)
+	defer t.Stop()
+
+	for range t.C {
+		for _, n := range s.nodes {
+			report, err := n.SRSConfig.CheckDrift(s.driftPolicy())
+			if err != nil {
+				level.Error(s.logger).Log("srsconfig", "CheckDrift", "node", n.Name, "err", err)
+			}
+			if report.Drifted {
+				level.Error(s.logger).Log("srsconfig", "drift", "node", n.Name, "policy", report.Policy, "action", report.Action,
+					"disk", strings.Join(report.Disk, "; "), "live", strings.Join(report.Live, "; "))
+			}
+		}
+	}
+}
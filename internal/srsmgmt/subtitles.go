@@ -0,0 +1,336 @@
+package srsmgmt
+
+import (
+	"context"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"srsmgmt/pkg/playlist"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/gofrs/uuid"
+)
+
+var reLanguage = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+// swagger:model SubtitleTrack
+type SubtitleTrack struct {
+	StreamID uuid.UUID      `json:"streamId"`
+	Language string         `json:"language"`
+	Name     string         `json:"name"`
+	Default  bool           `json:"default"`
+	Cues     []playlist.Cue `json:"cues"`
+}
+
+// subtitleStore кэширует дорожки субтитров стримов и состояние их сегментации
+type subtitleStore struct {
+	sync.Mutex
+	tracks  map[string][]SubtitleTrack
+	pts     map[string]int64
+	written map[string]float64
+}
+
+func (st *subtitleStore) get(repo Repository, streamID uuid.UUID) ([]SubtitleTrack, error) {
+	st.Lock()
+	defer st.Unlock()
+
+	if tracks, ok := st.tracks[streamID.String()]; ok {
+		return tracks, nil
+	}
+	tracks, err := repo.GetSubtitleTracks(streamID)
+	if err != nil {
+		return nil, err
+	}
+	if st.tracks == nil {
+		st.tracks = map[string][]SubtitleTrack{}
+	}
+	st.tracks[streamID.String()] = *tracks
+	return *tracks, nil
+}
+
+func (st *subtitleStore) set(streamID uuid.UUID, tracks []SubtitleTrack) {
+	st.Lock()
+	defer st.Unlock()
+	if st.tracks == nil {
+		st.tracks = map[string][]SubtitleTrack{}
+	}
+	st.tracks[streamID.String()] = tracks
+}
+
+func (st *subtitleStore) startPTS(streamID string) (int64, bool) {
+	st.Lock()
+	defer st.Unlock()
+	pts, ok := st.pts[streamID]
+	return pts, ok
+}
+
+func (st *subtitleStore) setStartPTS(streamID string, pts int64) {
+	st.Lock()
+	defer st.Unlock()
+	if st.pts == nil {
+		st.pts = map[string]int64{}
+	}
+	st.pts[streamID] = pts
+}
+
+// reset сбрасывает привязку к видео при начале новой трансляции
+func (st *subtitleStore) reset(streamID string) {
+	st.Lock()
+	defer st.Unlock()
+	delete(st.pts, streamID)
+	delete(st.written, streamID)
+}
+
+func (st *subtitleStore) remove(streamID string) {
+	st.Lock()
+	defer st.Unlock()
+	delete(st.tracks, streamID)
+	delete(st.pts, streamID)
+	delete(st.written, streamID)
+}
+
+func (s *srsMgmtService) GetSubtitles(ctx context.Context, streamID uuid.UUID) (*[]SubtitleTrack, error) {
+	if _, err := s.repo.GetStream(streamID); err != nil {
+		return nil, ErrNotFound
+	}
+
+	tracks, err := s.subtitles.get(s.repo, streamID)
+	if err != nil {
+		return nil, ErrInternalError
+	}
+	return &tracks, nil
+}
+
+// PutSubtitles создает или заменяет дорожку субтитров содержимым WebVTT файла
+func (s *srsMgmtService) PutSubtitles(ctx context.Context, track SubtitleTrack, vtt []byte) (*SubtitleTrack, error) {
+	stream, err := s.repo.GetStream(track.StreamID)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	// название попадает в NAME="..." мастер-плейлиста, как атрибуты меток
+	if !reLanguage.MatchString(track.Language) || !quotable(track.Name) {
+		return nil, ErrBadRequest
+	}
+	cues, err := playlist.ParseWebVTT(vtt)
+	if err != nil {
+		return nil, ErrBadRequest
+	}
+	if track.Name == "" {
+		track.Name = track.Language
+	}
+	track.Cues = cues
+
+	return s.saveSubtitles(stream, track, 0)
+}
+
+// AddSubtitleCues дописывает живые реплики в дорожку, создавая ее при необходимости
+func (s *srsMgmtService) AddSubtitleCues(ctx context.Context, streamID uuid.UUID, language string, cues []playlist.Cue) (*SubtitleTrack, error) {
+	stream, err := s.repo.GetStream(streamID)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	if !reLanguage.MatchString(language) || len(cues) == 0 {
+		return nil, ErrBadRequest
+	}
+
+	tracks, err := s.subtitles.get(s.repo, streamID)
+	if err != nil {
+		return nil, ErrInternalError
+	}
+	track := SubtitleTrack{StreamID: streamID, Language: language, Name: language}
+	for _, t := range tracks {
+		if t.Language == language {
+			track = t
+		}
+	}
+
+	since := cues[0].Start
+	merged := append([]playlist.Cue{}, track.Cues...)
+	for _, c := range cues {
+		if c.Start < 0 || c.End <= c.Start {
+			return nil, ErrBadRequest
+		}
+		if c.Start < since {
+			since = c.Start
+		}
+		merged = append(merged, c)
+	}
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].Start < merged[j].Start })
+	track.Cues = merged
+
+	return s.saveSubtitles(stream, track, since)
+}
+
+func (s *srsMgmtService) DeleteSubtitles(ctx context.Context, streamID uuid.UUID, language string) error {
+	if _, err := s.repo.GetStream(streamID); err != nil {
+		return ErrNotFound
+	}
+	tracks, err := s.subtitles.get(s.repo, streamID)
+	if err != nil {
+		return ErrInternalError
+	}
+
+	rest := []SubtitleTrack{}
+	for _, t := range tracks {
+		if t.Language != language {
+			rest = append(rest, t)
+		}
+	}
+	if len(rest) == len(tracks) {
+		return ErrNotFound
+	}
+
+	if err := s.repo.DeleteSubtitleTrack(streamID, language); err != nil {
+		return ErrInternalError
+	}
+	s.subtitles.set(streamID, rest)
+
+	livePath := s.livePathByID(streamID)
+	if err := s.playlist.RemoveSubtitles(livePath, language); err != nil {
+		level.Error(s.logger).Log("RemoveSubtitles", streamID, "err", err)
+	}
+	s.refreshMasters(livePath)
+
+	return nil
+}
+
+func (s *srsMgmtService) saveSubtitles(stream *Stream, track SubtitleTrack, since float64) (*SubtitleTrack, error) {
+	tracks, err := s.subtitles.get(s.repo, stream.StreamID)
+	if err != nil {
+		return nil, ErrInternalError
+	}
+	if err := s.repo.SaveSubtitleTrack(track); err != nil {
+		return nil, ErrInternalError
+	}
+
+	updated, added := []SubtitleTrack{}, true
+	for _, t := range tracks {
+		if t.Language == track.Language {
+			t, added = track, false
+		}
+		if track.Default && t.Language != track.Language {
+			t.Default = false
+		}
+		updated = append(updated, t)
+	}
+	if added {
+		updated = append(updated, track)
+	}
+	s.subtitles.set(stream.StreamID, updated)
+
+	s.writeSubtitles(stream, []SubtitleTrack{track}, since)
+	s.refreshMasters(s.livePath(stream))
+
+	return &track, nil
+}
+
+// writeSubtitles сегментирует дорожки по временной шкале текущей трансляции.
+// Нулевое время реплик соответствует началу записи (StartedAt)
+func (s *srsMgmtService) writeSubtitles(stream *Stream, tracks []SubtitleTrack, since float64) {
+	if len(tracks) == 0 || stream.StartedAt == nil || stream.StartedAt.IsZero() {
+		return
+	}
+	id := stream.StreamID.String()
+	livePath := s.livePath(stream)
+
+	end := time.Now()
+	final := stream.Status == StreamStatusStopPublish
+	if final && stream.StopedAt != nil {
+		end = *stream.StopedAt
+	}
+	duration := end.Sub(*stream.StartedAt).Seconds()
+	if duration <= 0 {
+		return
+	}
+
+	pts, ok := s.subtitles.startPTS(id)
+	// зашифрованные сегменты не разобрать, их PTS запоминается до шифрования
+	if !ok && !stream.Encrypted {
+		var err error
+		pts, err = s.playlist.SessionStartPTS(livePath, stream.StartedAt)
+		if err != nil {
+			level.Error(s.logger).Log("SessionStartPTS", id, "err", err)
+		} else {
+			s.subtitles.setStartPTS(id, pts)
+		}
+	}
+
+	for _, t := range tracks {
+		track := playlist.SubtitleTrack{Language: t.Language, Name: t.Name, Default: t.Default}
+		if err := s.playlist.WriteSubtitles(livePath, track, t.Cues, duration, since, pts, final); err != nil {
+			level.Error(s.logger).Log("WriteSubtitles", id, "language", t.Language, "err", err)
+		}
+	}
+
+	s.subtitles.Lock()
+	if s.subtitles.written == nil {
+		s.subtitles.written = map[string]float64{}
+	}
+	s.subtitles.written[id] = duration
+	s.subtitles.Unlock()
+}
+
+// rememberStartPTS запоминает PTS первого сегмента трансляции, пока он не зашифрован
+func (s *srsMgmtService) rememberStartPTS(stream *Stream, segmentPath string) {
+	id := stream.StreamID.String()
+	if _, ok := s.subtitles.startPTS(id); ok {
+		return
+	}
+	pts, err := playlist.SegmentStartPTS(segmentPath)
+	if err != nil {
+		level.Error(s.logger).Log("SegmentStartPTS", segmentPath, "err", err)
+		return
+	}
+	s.subtitles.setStartPTS(id, pts)
+}
+
+// updateLiveSubtitles дописывает сегменты субтитров по мере роста трансляции,
+// только когда прошел очередной интервал сегментации
+func (s *srsMgmtService) updateLiveSubtitles(stream *Stream) {
+	if stream.StartedAt == nil || stream.StartedAt.IsZero() {
+		return
+	}
+	tracks, err := s.subtitles.get(s.repo, stream.StreamID)
+	if err != nil || len(tracks) == 0 {
+		return
+	}
+
+	s.subtitles.Lock()
+	written := s.subtitles.written[stream.StreamID.String()]
+	s.subtitles.Unlock()
+
+	duration := time.Since(*stream.StartedAt).Seconds()
+	if int(duration/playlist.SubtitleSegmentDuration) <= int(written/playlist.SubtitleSegmentDuration) {
+		return
+	}
+	s.writeSubtitles(stream, tracks, written)
+}
+
+// subtitleSource отдает дорожки стрима для EXT-X-MEDIA в мастер-плейлистах
+func (s *srsMgmtService) subtitleSource(livePath string) []playlist.SubtitleTrack {
+	streamID, err := uuid.FromString(path.Base(livePath))
+	if err != nil {
+		return nil
+	}
+	tracks, err := s.subtitles.get(s.repo, streamID)
+	if err != nil {
+		return nil
+	}
+	resp := []playlist.SubtitleTrack{}
+	for _, t := range tracks {
+		resp = append(resp, playlist.SubtitleTrack{Language: t.Language, Name: t.Name, Default: t.Default})
+	}
+	return resp
+}
+
+func (s *srsMgmtService) refreshMasters(livePath string) {
+	if _, err := os.Stat(livePath); err != nil {
+		return
+	}
+	if err := s.playlist.RefreshMasters(livePath); err != nil {
+		level.Error(s.logger).Log("RefreshMasters", livePath, "err", err)
+	}
+}
@@ -0,0 +1,31 @@
+package srsmgmt
+
+import (
+	"context"
+	"errors"
+	"srsmgmt/config"
+	"testing"
+)
+
+func TestPutSubtitlesAttributes(t *testing.T) {
+	repo := newMemRepo()
+	s := newTestService(t, repo, config.Config{})
+	stream := newTestStream(t, repo, "live")
+	vtt := []byte("WEBVTT\n\n00:00.000 --> 00:01.000\nhello\n")
+
+	for _, tc := range []struct {
+		language, name string
+	}{
+		{"en", "English\",DEFAULT=YES,URI=\"http://evil/x.m3u8"},
+		{"en", "English\n#EXT-X-ENDLIST"},
+		{"en", "English\r"},
+		{"en\"", "English"},
+		{"en,LANGUAGE=ru", "English"},
+		{"", "English"},
+	} {
+		track := SubtitleTrack{StreamID: stream.StreamID, Language: tc.language, Name: tc.name}
+		if _, err := s.PutSubtitles(context.Background(), track, vtt); !errors.Is(err, ErrBadRequest) {
+			t.Errorf("%q %q: want %v, have %v", tc.language, tc.name, ErrBadRequest, err)
+		}
+	}
+}
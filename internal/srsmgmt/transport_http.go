@@ -3,8 +3,16 @@ package srsmgmt
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/url"
 	"srsmgmt/config"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofrs/uuid"
 	"github.com/gorilla/mux"
@@ -21,6 +29,7 @@ func MakeHTTPHandler(s Service, logger log.Logger) http.Handler {
 		httptransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
 		httptransport.ServerErrorEncoder(encodeError),
 		httptransport.ServerBefore(httptransport.PopulateRequestContext),
+		httptransport.ServerBefore(clientIPToContext(parseTrustedProxies(config.GetConfig().TrustedProxies))),
 	}
 
 	cfgApikey := config.GetConfig().ApiKey
@@ -63,6 +72,151 @@ func MakeHTTPHandler(s Service, logger log.Logger) http.Handler {
 		encodeResponse,
 		options...,
 	))
+	r.Methods("GET", "PUT").Path("/stream/{id}/verify").Handler(httptransport.NewServer(
+		AuthMiddlewareHTTP(cfgApikey)(e.VerifyStreamEndpoint),
+		decodeVerifyStreamRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/stream/{id}/recordings").Handler(httptransport.NewServer(
+		AuthMiddlewareHTTP(cfgApikey)(e.GetRecordingsEndpoint),
+		decodeGetRecordingsRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/stream/{id}/recordings/{recording}/file").Handler(httptransport.NewServer(
+		AuthMiddlewareHTTP(cfgApikey)(e.GetRecordingFileEndpoint),
+		decodeGetRecordingFileRequest,
+		encodeRecordingFileResponse,
+		options...,
+	))
+	// ключи выдаются плееру по токену зрителя, а не по техническому токену API
+	r.Methods("GET").Path("/stream/{id}/key/{period:[0-9]+}").Handler(httptransport.NewServer(
+		e.GetStreamKeyEndpoint,
+		decodeGetStreamKeyRequest,
+		encodeStreamKeyResponse,
+		options...,
+	))
+	r.Methods("POST").Path("/stream/{id}/playback-token").Handler(httptransport.NewServer(
+		AuthMiddlewareHTTP(cfgApikey)(e.PlaybackTokenEndpoint),
+		decodePlaybackTokenRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/stream/{id}/subtitles").Handler(httptransport.NewServer(
+		AuthMiddlewareHTTP(cfgApikey)(e.GetSubtitlesEndpoint),
+		decodeGetSubtitlesRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("PUT").Path("/stream/{id}/subtitles/{lang}").Handler(httptransport.NewServer(
+		AuthMiddlewareHTTP(cfgApikey)(e.PutSubtitlesEndpoint),
+		decodePutSubtitlesRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("POST").Path("/stream/{id}/subtitles/{lang}/cues").Handler(httptransport.NewServer(
+		AuthMiddlewareHTTP(cfgApikey)(e.AddSubtitleCuesEndpoint),
+		decodeAddSubtitleCuesRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("DELETE").Path("/stream/{id}/subtitles/{lang}").Handler(httptransport.NewServer(
+		AuthMiddlewareHTTP(cfgApikey)(e.DeleteSubtitlesEndpoint),
+		decodeDeleteSubtitlesRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("POST").Path("/stream/{id}/markers").Handler(httptransport.NewServer(
+		AuthMiddlewareHTTP(cfgApikey)(e.CreateMarkerEndpoint),
+		decodeCreateMarkerRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/stream/{id}/markers").Handler(httptransport.NewServer(
+		AuthMiddlewareHTTP(cfgApikey)(e.GetMarkersEndpoint),
+		decodeGetMarkersRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("DELETE").Path("/stream/{id}/markers/{marker}").Handler(httptransport.NewServer(
+		AuthMiddlewareHTTP(cfgApikey)(e.DeleteMarkerEndpoint),
+		decodeDeleteMarkerRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("POST").Path("/stream/{id}/forwards").Handler(httptransport.NewServer(
+		AuthMiddlewareHTTP(cfgApikey)(e.CreateForwardEndpoint),
+		decodeCreateForwardRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/stream/{id}/forwards").Handler(httptransport.NewServer(
+		AuthMiddlewareHTTP(cfgApikey)(e.GetForwardsEndpoint),
+		decodeGetForwardsRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("PUT").Path("/stream/{id}/forwards/{forward}").Handler(httptransport.NewServer(
+		AuthMiddlewareHTTP(cfgApikey)(e.UpdateForwardEndpoint),
+		decodeUpdateForwardRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("DELETE").Path("/stream/{id}/forwards/{forward}").Handler(httptransport.NewServer(
+		AuthMiddlewareHTTP(cfgApikey)(e.DeleteForwardEndpoint),
+		decodeDeleteForwardRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("PUT").Path("/profiles/{name}").Handler(httptransport.NewServer(
+		AuthMiddlewareHTTP(cfgApikey)(e.PutProfileEndpoint),
+		decodePutProfileRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/profiles").Handler(httptransport.NewServer(
+		AuthMiddlewareHTTP(cfgApikey)(e.GetProfilesEndpoint),
+		decodeMonStreamRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/profiles/{name}").Handler(httptransport.NewServer(
+		AuthMiddlewareHTTP(cfgApikey)(e.GetProfileEndpoint),
+		decodeProfileRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("DELETE").Path("/profiles/{name}").Handler(httptransport.NewServer(
+		AuthMiddlewareHTTP(cfgApikey)(e.DeleteProfileEndpoint),
+		decodeProfileRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/srs/config").Handler(httptransport.NewServer(
+		AuthMiddlewareHTTP(cfgApikey)(e.GetSRSConfigEndpoint),
+		decodeGetSRSConfigRequest,
+		encodeSRSConfigResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/srs/drift").Handler(httptransport.NewServer(
+		AuthMiddlewareHTTP(cfgApikey)(e.GetSRSDriftEndpoint),
+		decodeGetSRSDriftRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("POST").Path("/srs/reload").Handler(httptransport.NewServer(
+		AuthMiddlewareHTTP(cfgApikey)(e.ReloadSRSConfigEndpoint),
+		decodeSRSNodeRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/srs/nodes").Handler(httptransport.NewServer(
+		AuthMiddlewareHTTP(cfgApikey)(e.GetSRSNodesEndpoint),
+		decodeMonStreamRequest,
+		encodeResponse,
+		options...,
+	))
 
 	r.Methods("POST").Path("/webhook/stream/live").Handler(httptransport.NewServer(
 		e.UpdateSRSStreamEndpoint,
@@ -76,8 +230,32 @@ func MakeHTTPHandler(s Service, logger log.Logger) http.Handler {
 		encodeResponse,
 		options...,
 	))
+	r.Methods("POST").Path("/webhook/stream/dvr").Handler(httptransport.NewServer(
+		e.UpdateDvrSRSEndpoint,
+		decodeUpdateDvrSRSRequest,
+		encodeResponse,
+		options...,
+	))
+
+	// проверка запросов зрителей для nginx auth_request
+	g.Methods("GET", "HEAD").Path("/auth/hls").Handler(httptransport.NewServer(
+		e.AuthPlaybackEndpoint,
+		decodeAuthPlaybackRequest,
+		encodeAuthPlaybackResponse,
+		options...,
+	))
 
-	return r
+	// режим HLS origin: плейлисты собираются по запросу из индекса сегментов
+	if config.GetConfig().HLSOrigin {
+		g.Methods("GET", "HEAD").Path("/hls/{app}/{id}/{name}").Handler(httptransport.NewServer(
+			e.GetHLSEndpoint,
+			decodeGetHLSRequest,
+			encodeHLSResponse,
+			options...,
+		))
+	}
+
+	return g
 }
 
 func decodeGetStreamRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
@@ -139,6 +317,432 @@ func decodeStopStreamRequest(_ context.Context, r *http.Request) (request interf
 	return req, nil
 }
 
+// GET только проверяет плейлисты, PUT дополнительно исправляет их
+func decodeVerifyStreamRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, ErrBadRequest
+	}
+	streamId, err := uuid.FromString(id)
+	if err != nil {
+		return nil, ErrBadRequest
+	}
+	var req verifyStreamRequest
+	req.ID = streamId
+	req.Repair = r.Method == http.MethodPut
+	return req, nil
+}
+
+func decodeGetRecordingsRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, ErrBadRequest
+	}
+	streamId, err := uuid.FromString(id)
+	if err != nil {
+		return nil, ErrBadRequest
+	}
+	var req getRecordingsRequest
+	req.ID = streamId
+	return req, nil
+}
+
+func decodeGetRecordingFileRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	streamId, err := uuid.FromString(vars["id"])
+	if err != nil {
+		return nil, ErrBadRequest
+	}
+	recordingId, err := uuid.FromString(vars["recording"])
+	if err != nil {
+		return nil, ErrBadRequest
+	}
+	return getRecordingFileRequest{StreamID: streamId, ID: recordingId}, nil
+}
+
+func decodeGetStreamKeyRequest(ctx context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	streamId, err := uuid.FromString(vars["id"])
+	if err != nil {
+		return nil, ErrBadRequest
+	}
+	period, err := strconv.Atoi(vars["period"])
+	if err != nil {
+		return nil, ErrBadRequest
+	}
+	var req getStreamKeyRequest
+	req.ID = streamId
+	req.Period = period
+	// ключ принимает и токен зрителя, и токен воспроизведения
+	req.Viewer = PlaybackRequest{
+		URI:     r.URL.RequestURI(),
+		Token:   tokenFrom(r, PlaybackCookie, "token"),
+		IP:      clientIPFrom(ctx),
+		Referer: r.Referer(),
+	}
+	return req, nil
+}
+
+// tokenFrom ищет токен в параметре token, заголовке Authorization или
+// первой найденной из cookies
+func tokenFrom(r *http.Request, cookies ...string) string {
+	if token := r.URL.Query().Get("token"); token != "" {
+		return token
+	}
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	for _, name := range cookies {
+		if c, err := r.Cookie(name); err == nil && c.Value != "" {
+			return c.Value
+		}
+	}
+	return ""
+}
+
+func decodePlaybackTokenRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	streamId, err := uuid.FromString(vars["id"])
+	if err != nil {
+		return nil, ErrBadRequest
+	}
+	var req playbackTokenRequest
+	req.ID = streamId
+	if e := json.NewDecoder(r.Body).Decode(&req.Request); e != nil && e != io.EOF {
+		return nil, ErrBadRequest
+	}
+	return req, nil
+}
+
+// decodeAuthPlaybackRequest разбирает подзапрос nginx: исходный URI передается
+// в заголовке X-Original-URI, адрес зрителя в X-Real-IP или X-Forwarded-For
+func decodeAuthPlaybackRequest(ctx context.Context, r *http.Request) (request interface{}, err error) {
+	var req authPlaybackRequest
+	req.Request.URI = r.Header.Get("X-Original-URI")
+	if req.Request.URI == "" {
+		req.Request.URI = r.URL.RequestURI()
+	}
+	req.Request.Referer = r.Referer()
+	req.Request.IP = clientIPFrom(ctx)
+
+	if u, err := url.Parse(req.Request.URI); err == nil {
+		req.Request.Token = u.Query().Get("token")
+		req.FromQuery = req.Request.Token != ""
+	}
+	if req.Request.Token == "" {
+		req.Request.Token = tokenFrom(r, PlaybackCookie)
+	}
+	return req, nil
+}
+
+// decodeGetHLSRequest принимает диапазон ?start=&end= в секундах unix или RFC3339
+func decodeGetHLSRequest(ctx context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	streamId, err := uuid.FromString(vars["id"])
+	if err != nil {
+		return nil, ErrBadRequest
+	}
+	var req getHLSRequest
+	req.Request.StreamID = streamId
+	req.Request.Name = vars["name"]
+
+	q := r.URL.Query()
+	rng := url.Values{}
+	for key, dst := range map[string]**time.Time{"start": &req.Request.Start, "end": &req.Request.End} {
+		value := q.Get(key)
+		if value == "" {
+			continue
+		}
+		t, err := parseRangeTime(value)
+		if err != nil {
+			return nil, ErrBadRequest
+		}
+		*dst = &t
+		rng.Set(key, value)
+	}
+	req.Request.Query = rng.Encode()
+	req.CookiePath = playbackCookiePath(r.URL.Path)
+
+	req.Request.Token = q.Get("token")
+	req.FromQuery = req.Request.Token != ""
+	if req.Request.Token == "" {
+		req.Request.Token = tokenFrom(r, PlaybackCookie)
+	}
+	req.Request.IP = clientIPFrom(ctx)
+	req.Request.Referer = r.Referer()
+	req.IfNoneMatch = r.Header.Get("If-None-Match")
+	return req, nil
+}
+
+func parseRangeTime(value string) (time.Time, error) {
+	if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(unix, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+type contextKey int
+
+const contextKeyClientIP contextKey = iota
+
+// trustedProxies - адреса прокси, которым доверяются X-Real-IP и X-Forwarded-For
+type trustedProxies []*net.IPNet
+
+// parseTrustedProxies разбирает список адресов и подсетей через запятую,
+// ошибочные элементы пропускаются
+func parseTrustedProxies(list string) trustedProxies {
+	var proxies trustedProxies
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			if ip := net.ParseIP(item); ip != nil && ip.To4() != nil {
+				item += "/32"
+			} else {
+				item += "/128"
+			}
+		}
+		if _, network, err := net.ParseCIDR(item); err == nil {
+			proxies = append(proxies, network)
+		}
+	}
+	return proxies
+}
+
+func (p trustedProxies) contains(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range p {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIPToContext сохраняет адрес клиента в контексте запроса
+func clientIPToContext(proxies trustedProxies) httptransport.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		return context.WithValue(ctx, contextKeyClientIP, clientIP(r, proxies))
+	}
+}
+
+func clientIPFrom(ctx context.Context) string {
+	ip, _ := ctx.Value(contextKeyClientIP).(string)
+	return ip
+}
+
+// clientIP берет адрес из X-Real-IP или X-Forwarded-For, только если запрос
+// пришел от доверенного прокси. В X-Forwarded-For клиентом считается
+// последний адрес, не принадлежащий доверенным прокси
+func clientIP(r *http.Request, proxies trustedProxies) string {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	if !proxies.contains(remote) {
+		return remote
+	}
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+		return ip
+	}
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		hops := strings.Split(fwd, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := strings.TrimSpace(hops[i])
+			if i == 0 || !proxies.contains(ip) {
+				return ip
+			}
+		}
+	}
+	return remote
+}
+
+func decodeGetSubtitlesRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	streamId, err := uuid.FromString(vars["id"])
+	if err != nil {
+		return nil, ErrBadRequest
+	}
+	return getSubtitlesRequest{ID: streamId}, nil
+}
+
+// decodePutSubtitlesRequest принимает WebVTT файл в теле запроса,
+// название дорожки и признак дорожки по умолчанию передаются параметрами name и default
+func decodePutSubtitlesRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	streamId, err := uuid.FromString(vars["id"])
+	if err != nil {
+		return nil, ErrBadRequest
+	}
+	vtt, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, ErrBadRequest
+	}
+	var req putSubtitlesRequest
+	req.Track.StreamID = streamId
+	req.Track.Language = vars["lang"]
+	req.Track.Name = r.URL.Query().Get("name")
+	req.Track.Default = r.URL.Query().Get("default") == "true"
+	req.VTT = vtt
+	return req, nil
+}
+
+func decodeAddSubtitleCuesRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	streamId, err := uuid.FromString(vars["id"])
+	if err != nil {
+		return nil, ErrBadRequest
+	}
+	var req addSubtitleCuesRequest
+	req.ID = streamId
+	req.Language = vars["lang"]
+	if e := json.NewDecoder(r.Body).Decode(&req.Cues); e != nil {
+		return nil, ErrBadRequest
+	}
+	return req, nil
+}
+
+func decodeDeleteSubtitlesRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	streamId, err := uuid.FromString(vars["id"])
+	if err != nil {
+		return nil, ErrBadRequest
+	}
+	return deleteSubtitlesRequest{ID: streamId, Language: vars["lang"]}, nil
+}
+
+func decodeCreateMarkerRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	streamId, err := uuid.FromString(vars["id"])
+	if err != nil {
+		return nil, ErrBadRequest
+	}
+	var req createMarkerRequest
+	if e := json.NewDecoder(r.Body).Decode(&req.Marker); e != nil {
+		return nil, ErrBadRequest
+	}
+	req.Marker.StreamID = streamId
+	return req, nil
+}
+
+func decodeGetMarkersRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	streamId, err := uuid.FromString(vars["id"])
+	if err != nil {
+		return nil, ErrBadRequest
+	}
+	return getMarkersRequest{ID: streamId}, nil
+}
+
+func decodeDeleteMarkerRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	streamId, err := uuid.FromString(vars["id"])
+	if err != nil {
+		return nil, ErrBadRequest
+	}
+	markerId, err := uuid.FromString(vars["marker"])
+	if err != nil {
+		return nil, ErrBadRequest
+	}
+	return deleteMarkerRequest{ID: streamId, MarkerID: markerId}, nil
+}
+
+// decodeCreateForwardRequest: назначение по умолчанию включено
+func decodeCreateForwardRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	streamId, err := uuid.FromString(vars["id"])
+	if err != nil {
+		return nil, ErrBadRequest
+	}
+	req := forwardRequest{Forward: ForwardDestination{Enabled: true}}
+	if e := json.NewDecoder(r.Body).Decode(&req.Forward); e != nil {
+		return nil, ErrBadRequest
+	}
+	req.Forward.StreamID = streamId
+	return req, nil
+}
+
+func decodeGetForwardsRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	streamId, err := uuid.FromString(vars["id"])
+	if err != nil {
+		return nil, ErrBadRequest
+	}
+	return getForwardsRequest{ID: streamId}, nil
+}
+
+func decodeUpdateForwardRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	streamId, err := uuid.FromString(vars["id"])
+	if err != nil {
+		return nil, ErrBadRequest
+	}
+	forwardId, err := uuid.FromString(vars["forward"])
+	if err != nil {
+		return nil, ErrBadRequest
+	}
+	var req forwardRequest
+	if e := json.NewDecoder(r.Body).Decode(&req.Forward); e != nil {
+		return nil, ErrBadRequest
+	}
+	req.Forward.StreamID = streamId
+	req.Forward.ID = forwardId
+	return req, nil
+}
+
+func decodeDeleteForwardRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	streamId, err := uuid.FromString(vars["id"])
+	if err != nil {
+		return nil, ErrBadRequest
+	}
+	forwardId, err := uuid.FromString(vars["forward"])
+	if err != nil {
+		return nil, ErrBadRequest
+	}
+	return deleteForwardRequest{ID: streamId, ForwardID: forwardId}, nil
+}
+
+func decodePutProfileRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	var req putProfileRequest
+	if e := json.NewDecoder(r.Body).Decode(&req.Profile); e != nil {
+		return nil, ErrBadRequest
+	}
+	req.Profile.Name = mux.Vars(r)["name"]
+	return req, nil
+}
+
+func decodeProfileRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	return profileRequest{Name: mux.Vars(r)["name"]}, nil
+}
+
+// decodeSRSNodeRequest: ?node= выбирает узел пула SRS
+func decodeSRSNodeRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	return srsNodeRequest{Node: r.URL.Query().Get("node")}, nil
+}
+
+// decodeGetSRSDriftRequest: ?check=true запускает проверку расхождений
+func decodeGetSRSDriftRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	q := r.URL.Query()
+	return getSRSDriftRequest{Node: q.Get("node"), Check: q.Get("check") == "true"}, nil
+}
+
+// decodeGetSRSConfigRequest: ?format=json отдает модель конфигурации, по умолчанию - текст SRS
+func decodeGetSRSConfigRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "text" {
+		return nil, ErrBadRequest
+	}
+	return getSRSConfigRequest{Node: r.URL.Query().Get("node"), Format: format}, nil
+}
+
 func decodeMonStreamRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
 	return
 }
@@ -159,6 +763,14 @@ func decodeUpdateHlsSRSRequest(_ context.Context, r *http.Request) (request inte
 	return req, nil
 }
 
+func decodeUpdateDvrSRSRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	var req updateDvrSRSRequest
+	if e := json.NewDecoder(r.Body).Decode(&req.Stream); e != nil {
+		return nil, ErrBadRequest
+	}
+	return req, nil
+}
+
 func decodeCreateStreamRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
 	vars := mux.Vars(r)
 	id, ok := vars["id"]
@@ -169,10 +781,15 @@ func decodeCreateStreamRequest(_ context.Context, r *http.Request) (request inte
 	if err != nil {
 		return nil, ErrBadRequest
 	}
-	var req createStreamRequest
-	if e := json.NewDecoder(r.Body).Decode(&req.Stream); e != nil {
+	var body struct {
+		Stream
+		IngestPassword string `json:"ingestPassword"`
+	}
+	if e := json.NewDecoder(r.Body).Decode(&body); e != nil {
 		return nil, e
 	}
+	req := createStreamRequest{Stream: body.Stream}
+	req.Stream.IngestPassword = body.IngestPassword
 	req.Stream.StreamID = streamId
 	return req, nil
 }
@@ -190,6 +807,83 @@ func encodeResponse(ctx context.Context, w http.ResponseWriter, response interfa
 	return json.NewEncoder(w).Encode(response)
 }
 
+func encodeStreamKeyResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(getStreamKeyResponse)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Cache-Control", "private, no-store")
+	_, err := w.Write(resp.Key)
+	return err
+}
+
+func encodeRecordingFileResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(getRecordingFileResponse)
+	defer resp.File.Body.Close()
+	contentType := resp.File.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(resp.File.Size, 10))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", resp.File.Name))
+	_, err := io.Copy(w, resp.File.Body)
+	return err
+}
+
+// encodeAuthPlaybackResponse при входе по ссылке с токеном выставляет cookie,
+// чтобы последующие запросы плеера к сегментам проходили проверку без параметра
+func encodeAuthPlaybackResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(authPlaybackResponse)
+	if resp.SetCookie && resp.Token != nil {
+		setPlaybackCookies(w, resp.Token, resp.CookiePath)
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// setPlaybackCookies выставляет cookie воспроизведения на каталог стрима
+// и на адрес его ключей, чтобы плеер получал ключи зашифрованного стрима
+func setPlaybackCookies(w http.ResponseWriter, token *PlaybackToken, cookiePath string) {
+	paths := []string{cookiePath}
+	if id := streamIDFromURI(cookiePath); id != "" {
+		paths = append(paths, "/api/v1/stream/"+id+"/key/")
+	}
+	for _, p := range paths {
+		http.SetCookie(w, &http.Cookie{
+			Name:     PlaybackCookie,
+			Value:    token.Token,
+			Path:     p,
+			Expires:  token.Expires,
+			HttpOnly: true,
+		})
+	}
+}
+
+func encodeSRSConfigResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(getSRSConfigResponse)
+	if resp.Format == "json" {
+		return encodeResponse(ctx, w, resp)
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, err := w.Write(resp.Config.Bytes())
+	return err
+}
+
+func encodeHLSResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(getHLSResponse)
+	if resp.SetCookie && resp.File.Playback != nil {
+		setPlaybackCookies(w, resp.File.Playback, resp.CookiePath)
+	}
+	w.Header().Set("Content-Type", resp.File.ContentType)
+	w.Header().Set("Cache-Control", resp.File.CacheControl)
+	w.Header().Set("ETag", resp.File.ETag)
+	if resp.NotModified {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	_, err := w.Write(resp.File.Body)
+	return err
+}
+
 func encodeError(_ context.Context, err error, w http.ResponseWriter) {
 	if err == nil {
 		panic("encodeError with nil error")
@@ -203,7 +897,7 @@ func encodeError(_ context.Context, err error, w http.ResponseWriter) {
 
 func codeFrom(err error) int {
 	switch err {
-	case ErrNotFound:
+	case ErrNotFound, ErrNodeNotFound:
 		return http.StatusNotFound
 	case ErrAlreadyExists:
 		return http.StatusUnprocessableEntity
@@ -211,7 +905,19 @@ func codeFrom(err error) int {
 		return http.StatusBadRequest
 	case ErrUnauthorized:
 		return http.StatusUnauthorized
+	case ErrForbidden:
+		return http.StatusForbidden
+	case ErrSRSConfig:
+		return http.StatusBadGateway
+	case ErrNoNode:
+		return http.StatusServiceUnavailable
 	default:
+		if errors.Is(err, ErrBadRequest) {
+			return http.StatusBadRequest
+		}
+		if errors.Is(err, ErrSRS) {
+			return http.StatusBadGateway
+		}
 		return http.StatusInternalServerError
 	}
 }
@@ -0,0 +1,77 @@
+package srsmgmtrepo
+
+import (
+	"srsmgmt/internal/srsmgmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+type ForwardDestination struct {
+	ID        uuid.UUID `gorm:"primaryKey"`
+	StreamID  uuid.UUID `gorm:"index"`
+	Name      string
+	URL       string
+	Key       string
+	Enabled   bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func forwardFrom(f srsmgmt.ForwardDestination) ForwardDestination {
+	return ForwardDestination{
+		ID:        f.ID,
+		StreamID:  f.StreamID,
+		Name:      f.Name,
+		URL:       f.URL,
+		Key:       f.Key,
+		Enabled:   f.Enabled,
+		CreatedAt: f.CreatedAt,
+		UpdatedAt: f.UpdatedAt,
+	}
+}
+
+func (repo Repo) CreateForward(f srsmgmt.ForwardDestination) error {
+	fwd := forwardFrom(f)
+	result := repo.Db.Create(&fwd)
+	return result.Error
+}
+
+func (repo Repo) GetForwards(streamID uuid.UUID) (*[]srsmgmt.ForwardDestination, error) {
+	forwards := []ForwardDestination{}
+	result := repo.Db.Where("stream_id = ?", streamID).Order("created_at").Find(&forwards)
+	if result.Error != nil {
+		return &([]srsmgmt.ForwardDestination{}), result.Error
+	}
+
+	resp := []srsmgmt.ForwardDestination{}
+	for _, v := range forwards {
+		resp = append(resp, srsmgmt.ForwardDestination{
+			ID:        v.ID,
+			StreamID:  v.StreamID,
+			Name:      v.Name,
+			URL:       v.URL,
+			Key:       v.Key,
+			Enabled:   v.Enabled,
+			CreatedAt: v.CreatedAt,
+			UpdatedAt: v.UpdatedAt,
+		})
+	}
+	return &resp, nil
+}
+
+func (repo Repo) UpdateForward(f srsmgmt.ForwardDestination) error {
+	fwd := forwardFrom(f)
+	result := repo.Db.Save(&fwd)
+	return result.Error
+}
+
+func (repo Repo) DeleteForward(streamID uuid.UUID, forwardID uuid.UUID) error {
+	result := repo.Db.Where("stream_id = ? AND id = ?", streamID, forwardID).Delete(&ForwardDestination{})
+	return result.Error
+}
+
+func (repo Repo) DeleteForwards(streamID uuid.UUID) error {
+	result := repo.Db.Where("stream_id = ?", streamID).Delete(&ForwardDestination{})
+	return result.Error
+}
@@ -0,0 +1,47 @@
+package srsmgmtrepo
+
+import (
+	"srsmgmt/internal/srsmgmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+type StreamKey struct {
+	StreamID  uuid.UUID `gorm:"primaryKey"`
+	Period    int       `gorm:"primaryKey"`
+	Key       []byte
+	IV        []byte
+	CreatedAt time.Time
+}
+
+func (repo Repo) CreateStreamKey(k srsmgmt.StreamKey) error {
+	key := StreamKey{
+		StreamID: k.StreamID,
+		Period:   k.Period,
+		Key:      k.Key,
+		IV:       k.IV,
+	}
+	result := repo.Db.Create(&key)
+	return result.Error
+}
+
+func (repo Repo) GetStreamKey(streamID uuid.UUID, period int) (*srsmgmt.StreamKey, error) {
+	key := StreamKey{}
+	result := repo.Db.Where("stream_id = ? AND period = ?", streamID, period).First(&key)
+	if result.Error != nil {
+		return nil, srsmgmt.ErrNotFound
+	}
+
+	return &srsmgmt.StreamKey{
+		StreamID: key.StreamID,
+		Period:   key.Period,
+		Key:      key.Key,
+		IV:       key.IV,
+	}, nil
+}
+
+func (repo Repo) DeleteStreamKeys(streamID uuid.UUID) error {
+	result := repo.Db.Where("stream_id = ?", streamID).Delete(&StreamKey{})
+	return result.Error
+}
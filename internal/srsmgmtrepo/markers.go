@@ -0,0 +1,84 @@
+package srsmgmtrepo
+
+import (
+	"encoding/json"
+	"srsmgmt/internal/srsmgmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+type Marker struct {
+	ID         uuid.UUID `gorm:"primaryKey"`
+	StreamID   uuid.UUID `gorm:"index"`
+	Class      string
+	StartDate  time.Time
+	Duration   float64
+	Attributes string `gorm:"type:text"`
+	SCTE35Cmd  string `gorm:"column:scte35_cmd"`
+	SCTE35Out  string `gorm:"column:scte35_out"`
+	SCTE35In   string `gorm:"column:scte35_in"`
+	CreatedAt  time.Time
+}
+
+func (repo Repo) CreateMarker(m srsmgmt.Marker) error {
+	attrs, err := json.Marshal(m.Attributes)
+	if err != nil {
+		return err
+	}
+	marker := Marker{
+		ID:         m.ID,
+		StreamID:   m.StreamID,
+		Class:      m.Class,
+		StartDate:  m.StartDate,
+		Duration:   m.Duration,
+		Attributes: string(attrs),
+		SCTE35Cmd:  m.SCTE35Cmd,
+		SCTE35Out:  m.SCTE35Out,
+		SCTE35In:   m.SCTE35In,
+		CreatedAt:  m.CreatedAt,
+	}
+	result := repo.Db.Create(&marker)
+	return result.Error
+}
+
+func (repo Repo) GetMarkers(streamID uuid.UUID) (*[]srsmgmt.Marker, error) {
+	markers := []Marker{}
+	result := repo.Db.Where("stream_id = ?", streamID).Order("start_date").Find(&markers)
+	if result.Error != nil {
+		return &([]srsmgmt.Marker{}), result.Error
+	}
+
+	resp := []srsmgmt.Marker{}
+	for _, v := range markers {
+		attrs := map[string]string{}
+		if v.Attributes != "" {
+			if err := json.Unmarshal([]byte(v.Attributes), &attrs); err != nil {
+				return &([]srsmgmt.Marker{}), err
+			}
+		}
+		resp = append(resp, srsmgmt.Marker{
+			ID:         v.ID,
+			StreamID:   v.StreamID,
+			Class:      v.Class,
+			StartDate:  v.StartDate,
+			Duration:   v.Duration,
+			Attributes: attrs,
+			SCTE35Cmd:  v.SCTE35Cmd,
+			SCTE35Out:  v.SCTE35Out,
+			SCTE35In:   v.SCTE35In,
+			CreatedAt:  v.CreatedAt,
+		})
+	}
+	return &resp, nil
+}
+
+func (repo Repo) DeleteMarker(streamID uuid.UUID, markerID uuid.UUID) error {
+	result := repo.Db.Where("stream_id = ? AND id = ?", streamID, markerID).Delete(&Marker{})
+	return result.Error
+}
+
+func (repo Repo) DeleteMarkers(streamID uuid.UUID) error {
+	result := repo.Db.Where("stream_id = ?", streamID).Delete(&Marker{})
+	return result.Error
+}
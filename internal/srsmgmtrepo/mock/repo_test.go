@@ -2,10 +2,15 @@ package mock
 
 import (
 	"context"
+	"path"
 	"regexp"
 	"srsmgmt/config"
 	"srsmgmt/internal/srsmgmt"
 	"srsmgmt/internal/srsmgmtrepo"
+	"srsmgmt/pkg/playlist"
+	"srsmgmt/pkg/srsclient"
+	"srsmgmt/pkg/srsconfig"
+	"srsmgmt/pkg/srstest"
 
 	"github.com/go-kit/log"
 	"github.com/gofrs/uuid"
@@ -51,9 +56,22 @@ func NewMock(logger log.Logger, cfg *config.Config) srsmgmt.Repository {
 func TestMockDB(t *testing.T) {
 	logger := log.NewNopLogger()
 
-	repo := NewMock(logger, config.GetConfig())
-
-	s := srsmgmt.NewSrsMgmtService(repo, logger, nil, nil)
+	cfg := config.GetConfig()
+	repo := NewMock(logger, cfg)
+
+	srs := srstest.NewServer(t.TempDir())
+	defer srs.Close()
+	srs.ConfigPath = path.Join(t.TempDir(), "srs.conf")
+	client := srsclient.New(srs.URL, srsclient.DefaultOptions(), logger)
+	srsConfig := srsconfig.New(srs.ConfigPath, srsconfig.Templates("", cfg.TplStorage), client)
+	srsConfig.TemplateData = cfg
+	nodes := []*srsmgmt.Node{{
+		SRSNode:   config.SRSNode{Name: config.DefaultNode, LiveTSPath: srs.LiveTSPath, ConfPath: srs.ConfigPath},
+		Client:    client,
+		SRSConfig: srsConfig,
+	}}
+
+	s := srsmgmt.NewSrsMgmtService(repo, logger, playlist.New(), nodes, nil)
 	if s == nil {
 		t.Error("init service failed")
 	}
@@ -93,3 +111,37 @@ func TestMockDB(t *testing.T) {
 		t.Errorf("Failed to meet expectations, got error: %v", err)
 	}
 }
+
+// TestSaveDefaultSubtitleTrack: признак Default снимается с остальных дорожек
+// в одной транзакции с сохранением новой дорожки по умолчанию
+func TestSaveDefaultSubtitleTrack(t *testing.T) {
+	repo := NewMock(log.NewNopLogger(), config.GetConfig())
+	mock := repo.GetMock()
+	streamID := uuid.FromStringOrNil("00000000-3333-0000-0000-000000000000")
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "subtitle_tracks" SET "is_default"=$1,"updated_at"=$2 WHERE stream_id = $3 AND language <> $4 AND is_default`)).
+		WithArgs(false, sqlmock.AnyArg(), streamID, "ru").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "subtitle_tracks" `)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := repo.SaveSubtitleTrack(srsmgmt.SubtitleTrack{StreamID: streamID, Language: "ru", Name: "Русский", Default: true}); err != nil {
+		t.Errorf("Failed to SaveSubtitleTrack, got error: %v", err)
+	}
+
+	// дорожка не по умолчанию остальные не трогает
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "subtitle_tracks" `)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := repo.SaveSubtitleTrack(srsmgmt.SubtitleTrack{StreamID: streamID, Language: "en", Name: "English"}); err != nil {
+		t.Errorf("Failed to SaveSubtitleTrack, got error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Failed to meet expectations, got error: %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package srsmgmtrepo
+
+import (
+	"encoding/json"
+	"srsmgmt/internal/srsmgmt"
+	"time"
+)
+
+type TranscodeProfile struct {
+	Name      string `gorm:"primaryKey"`
+	Rungs     string `gorm:"type:text"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (repo Repo) SaveProfile(p srsmgmt.TranscodeProfile) error {
+	rungs, err := json.Marshal(p.Rungs)
+	if err != nil {
+		return err
+	}
+	profile := TranscodeProfile{
+		Name:      p.Name,
+		Rungs:     string(rungs),
+		CreatedAt: p.CreatedAt,
+		UpdatedAt: p.UpdatedAt,
+	}
+	result := repo.Db.Save(&profile)
+	return result.Error
+}
+
+func (repo Repo) GetProfiles() (*[]srsmgmt.TranscodeProfile, error) {
+	profiles := []TranscodeProfile{}
+	result := repo.Db.Order("name").Find(&profiles)
+	if result.Error != nil {
+		return &([]srsmgmt.TranscodeProfile{}), result.Error
+	}
+
+	resp := []srsmgmt.TranscodeProfile{}
+	for _, v := range profiles {
+		p := srsmgmt.TranscodeProfile{
+			Name:      v.Name,
+			CreatedAt: v.CreatedAt,
+			UpdatedAt: v.UpdatedAt,
+		}
+		if err := json.Unmarshal([]byte(v.Rungs), &p.Rungs); err != nil {
+			return &([]srsmgmt.TranscodeProfile{}), err
+		}
+		resp = append(resp, p)
+	}
+	return &resp, nil
+}
+
+func (repo Repo) DeleteProfile(name string) error {
+	result := repo.Db.Where("name = ?", name).Delete(&TranscodeProfile{})
+	return result.Error
+}
+
+func (repo Repo) CountProfileStreams(name string) (int64, error) {
+	var count int64
+	result := repo.Db.Model(&Stream{}).Where("profile = ? AND status <> ?", name, srsmgmt.StreamStatusStopPublish).Count(&count)
+	return count, result.Error
+}
@@ -0,0 +1,189 @@
+package srsmgmtrepo
+
+import (
+	"database/sql"
+	"srsmgmt/internal/srsmgmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"gorm.io/gorm/clause"
+)
+
+type Recording struct {
+	ID        uuid.UUID `gorm:"primaryKey"`
+	StreamID  uuid.UUID `gorm:"index"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Type      string
+	Status    int
+	Playlist  string
+	URL       string
+	Segments  int
+	Format    string
+	Duration  float64
+	Size      int64
+	File      string
+	Error     string
+	StartedAt *sql.NullTime
+	StopedAt  *sql.NullTime
+}
+
+type OffloadedSegment struct {
+	StreamID  uuid.UUID `gorm:"primaryKey"`
+	Name      string    `gorm:"primaryKey"`
+	URL       string
+	CreatedAt time.Time
+}
+
+func (repo Repo) CreateRecording(r srsmgmt.Recording) (*srsmgmt.Recording, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+
+	rec := Recording{
+		ID:        id,
+		StreamID:  r.StreamID,
+		Type:      r.Type,
+		Status:    r.Status,
+		Playlist:  r.Playlist,
+		URL:       r.URL,
+		Format:    r.Format,
+		Duration:  r.Duration,
+		Size:      r.Size,
+		File:      r.File,
+		StartedAt: nullTime(r.StartedAt),
+		StopedAt:  nullTime(r.StopedAt),
+	}
+	result := repo.Db.Create(&rec)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	resp := recordingFromDB(rec)
+	return &resp, nil
+}
+
+func (repo Repo) UpdateRecording(r srsmgmt.Recording) (*srsmgmt.Recording, error) {
+	rec := map[string]interface{}{
+		"Status":   r.Status,
+		"Playlist": r.Playlist,
+		"URL":      r.URL,
+		"Segments": r.Segments,
+		"Error":    r.Error,
+	}
+
+	updated := Recording{}
+	result := repo.Db.Model(&updated).Clauses(clause.Returning{}).Where("id = ?", r.ID).Updates(rec)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	resp := recordingFromDB(updated)
+	return &resp, nil
+}
+
+func (repo Repo) GetRecordings(streamID uuid.UUID) (*[]srsmgmt.Recording, error) {
+	recs := []Recording{}
+	result := repo.Db.Where("stream_id = ?", streamID).Order("created_at").Find(&recs)
+	if result.Error != nil {
+		return &([]srsmgmt.Recording{}), result.Error
+	}
+
+	resp := []srsmgmt.Recording{}
+	for _, v := range recs {
+		resp = append(resp, recordingFromDB(v))
+	}
+	return &resp, nil
+}
+
+func (repo Repo) GetPendingRecordings() (*[]srsmgmt.Recording, error) {
+	recs := []Recording{}
+	result := repo.Db.Where("status IN ?", []int{srsmgmt.RecordingStatusPending, srsmgmt.RecordingStatusUploading}).Order("created_at").Find(&recs)
+	if result.Error != nil {
+		return &([]srsmgmt.Recording{}), result.Error
+	}
+
+	resp := []srsmgmt.Recording{}
+	for _, v := range recs {
+		resp = append(resp, recordingFromDB(v))
+	}
+	return &resp, nil
+}
+
+func (repo Repo) DeleteRecordings(streamID uuid.UUID) error {
+	if result := repo.Db.Where("stream_id = ?", streamID).Delete(&Recording{}); result.Error != nil {
+		return result.Error
+	}
+	if result := repo.Db.Where("stream_id = ?", streamID).Delete(&OffloadedSegment{}); result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+func (repo Repo) AddOffloadedSegment(s srsmgmt.OffloadedSegment) error {
+	seg := OffloadedSegment{
+		StreamID: s.StreamID,
+		Name:     s.Name,
+		URL:      s.URL,
+	}
+	result := repo.Db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&seg)
+	return result.Error
+}
+
+func (repo Repo) GetOffloadedSegments() (*[]srsmgmt.OffloadedSegment, error) {
+	segs := []OffloadedSegment{}
+	result := repo.Db.Find(&segs)
+	if result.Error != nil {
+		return &([]srsmgmt.OffloadedSegment{}), result.Error
+	}
+
+	resp := []srsmgmt.OffloadedSegment{}
+	for _, v := range segs {
+		resp = append(resp, srsmgmt.OffloadedSegment{
+			StreamID: v.StreamID,
+			Name:     v.Name,
+			URL:      v.URL,
+		})
+	}
+	return &resp, nil
+}
+
+func recordingFromDB(r Recording) srsmgmt.Recording {
+	// записи до появления DVR - выгрузки HLS
+	if r.Type == "" {
+		r.Type = srsmgmt.RecordingTypeHLS
+	}
+	return srsmgmt.Recording{
+		ID:        r.ID,
+		StreamID:  r.StreamID,
+		Type:      r.Type,
+		Status:    r.Status,
+		Playlist:  r.Playlist,
+		URL:       r.URL,
+		Segments:  r.Segments,
+		Format:    r.Format,
+		Duration:  r.Duration,
+		Size:      r.Size,
+		File:      r.File,
+		Error:     r.Error,
+		StartedAt: timeFromNull(r.StartedAt),
+		StopedAt:  timeFromNull(r.StopedAt),
+		CreatedAt: r.CreatedAt,
+		UpdatedAt: r.UpdatedAt,
+	}
+}
+
+func nullTime(t *time.Time) *sql.NullTime {
+	if t == nil {
+		return nil
+	}
+	return &sql.NullTime{Time: *t, Valid: !t.IsZero()}
+}
+
+func timeFromNull(t *sql.NullTime) *time.Time {
+	if t == nil || !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
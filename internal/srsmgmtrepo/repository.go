@@ -60,7 +60,7 @@ func DbInit(logger log.Logger, db *gorm.DB) {
 		level.Error(logger).Log("DB", "failed to connect database: ", err)
 	}
 
-	db.AutoMigrate(&Stream{})
+	db.AutoMigrate(&Stream{}, &Recording{}, &OffloadedSegment{}, &StreamKey{}, &SubtitleTrack{}, &Marker{}, &TranscodeProfile{}, &ForwardDestination{})
 
 	sqlDB.SetMaxIdleConns(1)
 	sqlDB.SetMaxOpenConns(10)
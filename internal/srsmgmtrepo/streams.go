@@ -11,26 +11,48 @@ import (
 )
 
 type Stream struct {
-	StreamID  uuid.UUID `gorm:"primaryKey"`
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	DeletedAt gorm.DeletedAt `gorm:"index"`
-	App       string
-	Password  string
-	Status    int
-	ClientId  string
-	StartedAt *sql.NullTime
-	StopedAt  *sql.NullTime
-	RTC       bool
+	StreamID    uuid.UUID `gorm:"primaryKey"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	DeletedAt   gorm.DeletedAt `gorm:"index"`
+	App         string
+	Password    string
+	Status      int
+	ClientId    string
+	StartedAt   *sql.NullTime
+	StopedAt    *sql.NullTime
+	RTC         bool
+	DVR         bool
+	Encrypted   bool
+	KeyRotation int
+	ViewerToken string
+	Profile     string
+	Node        string `gorm:"index"`
+
+	IngestType     string
+	IngestURL      string
+	IngestUser     string
+	IngestPassword string
 }
 
 func (repo Repo) CreateStream(s srsmgmt.Stream) (*srsmgmt.Stream, error) {
 	stream := Stream{
-		StreamID: s.StreamID,
-		App:      s.App,
-		Password: s.Password,
-		Status:   srsmgmt.StreamStatusWaitPublish,
-		RTC:      s.RTC,
+		StreamID:    s.StreamID,
+		App:         s.App,
+		Password:    s.Password,
+		Status:      srsmgmt.StreamStatusWaitPublish,
+		RTC:         s.RTC,
+		DVR:         s.DVR,
+		Encrypted:   s.Encrypted,
+		KeyRotation: s.KeyRotation,
+		ViewerToken: s.ViewerToken,
+		Profile:     s.Profile,
+		Node:        s.Node,
+
+		IngestType:     s.IngestType,
+		IngestURL:      s.IngestURL,
+		IngestUser:     s.IngestUser,
+		IngestPassword: s.IngestPassword,
 	}
 	result := repo.Db.Create(&stream)
 	if result == nil || result.Error != nil {
@@ -39,17 +61,7 @@ func (repo Repo) CreateStream(s srsmgmt.Stream) (*srsmgmt.Stream, error) {
 
 	repo.Db.First(&stream, stream.StreamID)
 
-	resp := srsmgmt.Stream{
-		StreamID:  stream.StreamID,
-		App:       stream.App,
-		Password:  stream.Password,
-		Status:    stream.Status,
-		CreatedAt: stream.CreatedAt,
-		UpdatedAt: stream.UpdatedAt,
-		ClientId:  stream.ClientId,
-		RTC:       stream.RTC,
-	}
-
+	resp := streamFromDB(stream)
 	return &resp, nil
 }
 
@@ -61,29 +73,7 @@ func (repo Repo) GetStream(streamID uuid.UUID) (*srsmgmt.Stream, error) {
 		return &srsmgmt.Stream{}, srsmgmt.ErrNotFound
 	}
 
-	var startedT *time.Time
-	if stream.StartedAt != nil && stream.StartedAt.Valid {
-		startedT = &stream.StartedAt.Time
-	}
-
-	var stopedT *time.Time
-	if stream.StopedAt != nil && stream.StopedAt.Valid {
-		stopedT = &stream.StopedAt.Time
-	}
-
-	resp := srsmgmt.Stream{
-		StreamID:  stream.StreamID,
-		App:       stream.App,
-		Password:  stream.Password,
-		Status:    stream.Status,
-		CreatedAt: stream.CreatedAt,
-		UpdatedAt: stream.UpdatedAt,
-		ClientId:  stream.ClientId,
-		StartedAt: startedT,
-		StopedAt:  stopedT,
-		RTC:       stream.RTC,
-	}
-
+	resp := streamFromDB(stream)
 	return &resp, nil
 }
 
@@ -97,33 +87,34 @@ func (repo Repo) GetRTCStreams() (*[]srsmgmt.Stream, error) {
 
 	resp := []srsmgmt.Stream{}
 	for _, v := range streams {
-		var startedT *time.Time
-		if v.StartedAt != nil && v.StartedAt.Valid {
-			startedT = &v.StartedAt.Time
-		}
-
-		var stopedT *time.Time
-		if v.StopedAt != nil && v.StopedAt.Valid {
-			stopedT = &v.StopedAt.Time
-		}
-
-		resp = append(resp, srsmgmt.Stream{
-			StreamID:  v.StreamID,
-			App:       v.App,
-			Password:  v.Password,
-			Status:    v.Status,
-			CreatedAt: v.CreatedAt,
-			UpdatedAt: v.UpdatedAt,
-			ClientId:  v.ClientId,
-			StartedAt: startedT,
-			StopedAt:  stopedT,
-			RTC:       v.RTC,
-		})
+		resp = append(resp, streamFromDB(v))
 	}
 
 	return &resp, nil
 }
 
+// CountNodeStreams возвращает число неостановленных стримов узла node
+func (repo Repo) CountNodeStreams(node string) (int64, error) {
+	var count int64
+	result := repo.Db.Model(&Stream{}).Where("node = ? AND status <> ?", node, srsmgmt.StreamStatusStopPublish).Count(&count)
+	return count, result.Error
+}
+
+// GetIngestStreams возвращает неостановленные стримы, которые сервис забирает из источника
+func (repo Repo) GetIngestStreams() (*[]srsmgmt.Stream, error) {
+	streams := []Stream{}
+	result := repo.Db.Where("ingest_type <> '' AND status <> ?", srsmgmt.StreamStatusStopPublish).Find(&streams)
+	if result.Error != nil {
+		return &([]srsmgmt.Stream{}), result.Error
+	}
+
+	resp := []srsmgmt.Stream{}
+	for _, v := range streams {
+		resp = append(resp, streamFromDB(v))
+	}
+	return &resp, nil
+}
+
 func (repo Repo) DeleteStream(streamID uuid.UUID) (uuid.UUID, error) {
 	result := repo.Db.Unscoped().Delete(&Stream{}, streamID)
 	if result.Error != nil {
@@ -135,16 +126,27 @@ func (repo Repo) DeleteStream(streamID uuid.UUID) (uuid.UUID, error) {
 
 func (repo Repo) UpdateStream(s srsmgmt.Stream) (*srsmgmt.Stream, error) {
 	stream := map[string]interface{}{
-		"StreamID":  s.StreamID,
-		"App":       s.App,
-		"Password":  s.Password,
-		"Status":    s.Status,
-		"CreatedAt": s.CreatedAt,
-		"UpdatedAt": s.UpdatedAt,
-		"ClientId":  s.ClientId,
-		"StartedAt": s.StartedAt,
-		"StopedAt":  s.StopedAt,
-		"RTC":       s.RTC,
+		"StreamID":    s.StreamID,
+		"App":         s.App,
+		"Password":    s.Password,
+		"Status":      s.Status,
+		"CreatedAt":   s.CreatedAt,
+		"UpdatedAt":   s.UpdatedAt,
+		"ClientId":    s.ClientId,
+		"StartedAt":   s.StartedAt,
+		"StopedAt":    s.StopedAt,
+		"RTC":         s.RTC,
+		"DVR":         s.DVR,
+		"Encrypted":   s.Encrypted,
+		"KeyRotation": s.KeyRotation,
+		"ViewerToken": s.ViewerToken,
+		"Profile":     s.Profile,
+		"Node":        s.Node,
+
+		"IngestType":     s.IngestType,
+		"IngestURL":      s.IngestURL,
+		"IngestUser":     s.IngestUser,
+		"IngestPassword": s.IngestPassword,
 	}
 
 	result := repo.Db.Model(&Stream{}).Clauses(clause.Returning{}).Where("stream_id = ?", s.StreamID).Updates(&stream)
@@ -155,28 +157,32 @@ func (repo Repo) UpdateStream(s srsmgmt.Stream) (*srsmgmt.Stream, error) {
 	updated := Stream{}
 	result.Scan(&updated)
 
-	var startedT *time.Time
-	if updated.StartedAt != nil && updated.StartedAt.Valid {
-		startedT = &updated.StartedAt.Time
-	}
-
-	var stopedT *time.Time
-	if updated.StopedAt != nil && updated.StopedAt.Valid {
-		stopedT = &updated.StopedAt.Time
-	}
+	resp := streamFromDB(updated)
+	return &resp, nil
+}
 
-	resp := srsmgmt.Stream{
-		StreamID:  updated.StreamID,
-		App:       updated.App,
-		Password:  updated.Password,
-		Status:    updated.Status,
-		CreatedAt: updated.CreatedAt,
-		UpdatedAt: updated.UpdatedAt,
-		ClientId:  updated.ClientId,
-		StartedAt: startedT,
-		StopedAt:  stopedT,
-		RTC:       updated.RTC,
+func streamFromDB(s Stream) srsmgmt.Stream {
+	return srsmgmt.Stream{
+		StreamID:    s.StreamID,
+		App:         s.App,
+		Password:    s.Password,
+		Status:      s.Status,
+		CreatedAt:   s.CreatedAt,
+		UpdatedAt:   s.UpdatedAt,
+		ClientId:    s.ClientId,
+		StartedAt:   timeFromNull(s.StartedAt),
+		StopedAt:    timeFromNull(s.StopedAt),
+		RTC:         s.RTC,
+		DVR:         s.DVR,
+		Encrypted:   s.Encrypted,
+		KeyRotation: s.KeyRotation,
+		ViewerToken: s.ViewerToken,
+		Profile:     s.Profile,
+		Node:        s.Node,
+
+		IngestType:     s.IngestType,
+		IngestURL:      s.IngestURL,
+		IngestUser:     s.IngestUser,
+		IngestPassword: s.IngestPassword,
 	}
-
-	return &resp, nil
 }
@@ -0,0 +1,88 @@
+package srsmgmtrepo
+
+import (
+	"encoding/json"
+	"srsmgmt/internal/srsmgmt"
+	"srsmgmt/pkg/playlist"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SubtitleTrack struct {
+	StreamID  uuid.UUID `gorm:"primaryKey"`
+	Language  string    `gorm:"primaryKey"`
+	Name      string
+	Default   bool   `gorm:"column:is_default"`
+	Cues      string `gorm:"type:text"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (repo Repo) SaveSubtitleTrack(t srsmgmt.SubtitleTrack) error {
+	cues, err := json.Marshal(t.Cues)
+	if err != nil {
+		return err
+	}
+	track := SubtitleTrack{
+		StreamID: t.StreamID,
+		Language: t.Language,
+		Name:     t.Name,
+		Default:  t.Default,
+		Cues:     string(cues),
+	}
+	// дорожка по умолчанию у стрима одна, признак у остальных снимается в той же транзакции
+	return repo.Db.Transaction(func(tx *gorm.DB) error {
+		if t.Default {
+			result := tx.Model(&SubtitleTrack{}).
+				Where("stream_id = ? AND language <> ? AND is_default", t.StreamID, t.Language).
+				Update("is_default", false)
+			if result.Error != nil {
+				return result.Error
+			}
+		}
+		result := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "stream_id"}, {Name: "language"}},
+			DoUpdates: clause.AssignmentColumns([]string{"name", "is_default", "cues", "updated_at"}),
+		}).Create(&track)
+		return result.Error
+	})
+}
+
+func (repo Repo) GetSubtitleTracks(streamID uuid.UUID) (*[]srsmgmt.SubtitleTrack, error) {
+	tracks := []SubtitleTrack{}
+	result := repo.Db.Where("stream_id = ?", streamID).Order("created_at").Find(&tracks)
+	if result.Error != nil {
+		return &([]srsmgmt.SubtitleTrack{}), result.Error
+	}
+
+	resp := []srsmgmt.SubtitleTrack{}
+	for _, v := range tracks {
+		cues := []playlist.Cue{}
+		if v.Cues != "" {
+			if err := json.Unmarshal([]byte(v.Cues), &cues); err != nil {
+				return &([]srsmgmt.SubtitleTrack{}), err
+			}
+		}
+		resp = append(resp, srsmgmt.SubtitleTrack{
+			StreamID: v.StreamID,
+			Language: v.Language,
+			Name:     v.Name,
+			Default:  v.Default,
+			Cues:     cues,
+		})
+	}
+	return &resp, nil
+}
+
+func (repo Repo) DeleteSubtitleTrack(streamID uuid.UUID, language string) error {
+	result := repo.Db.Where("stream_id = ? AND language = ?", streamID, language).Delete(&SubtitleTrack{})
+	return result.Error
+}
+
+func (repo Repo) DeleteSubtitleTracks(streamID uuid.UUID) error {
+	result := repo.Db.Where("stream_id = ?", streamID).Delete(&SubtitleTrack{})
+	return result.Error
+}
@@ -0,0 +1,154 @@
+// Package media читает длительность файлов записи SRS (FLV и MP4)
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ErrUnsupported = errors.New("MEDIA_FORMAT_UNSUPPORTED")
+
+// Duration возвращает длительность записи по расширению файла
+func Duration(file string) (time.Duration, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".flv":
+		return flvDuration(f)
+	case ".mp4":
+		return mp4Duration(f)
+	}
+	return 0, fmt.Errorf("%w: %s", ErrUnsupported, filepath.Ext(file))
+}
+
+// flvDuration - разница меток времени первого и последнего тега.
+// Обрезанный последний тег не учитывается
+func flvDuration(r io.ReadSeeker) (time.Duration, error) {
+	header := make([]byte, 9)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, err
+	}
+	if string(header[:3]) != "FLV" {
+		return 0, fmt.Errorf("%w: not an flv file", ErrUnsupported)
+	}
+	// заголовок и PreviousTagSize0
+	if _, err := r.Seek(int64(binary.BigEndian.Uint32(header[5:]))+4, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	var first, last uint32
+	seen := false
+	tag := make([]byte, 11)
+	for {
+		if _, err := io.ReadFull(r, tag); err != nil {
+			break
+		}
+		size := int64(tag[1])<<16 | int64(tag[2])<<8 | int64(tag[3])
+		ts := uint32(tag[7])<<24 | uint32(tag[4])<<16 | uint32(tag[5])<<8 | uint32(tag[6])
+		// данные тега и PreviousTagSize
+		if _, err := r.Seek(size+4, io.SeekCurrent); err != nil {
+			break
+		}
+		if !seen {
+			first, seen = ts, true
+		}
+		if ts > last {
+			last = ts
+		}
+	}
+	if !seen {
+		return 0, fmt.Errorf("%w: no flv tags", ErrUnsupported)
+	}
+	return time.Duration(last-first) * time.Millisecond, nil
+}
+
+// mp4Duration читает длительность из moov > mvhd
+func mp4Duration(r io.ReadSeeker) (time.Duration, error) {
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	moov, err := findBox(r, 0, end, "moov")
+	if err != nil {
+		return 0, err
+	}
+	mvhd, err := findBox(r, moov.data, moov.end, "mvhd")
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := r.Seek(mvhd.data, io.SeekStart); err != nil {
+		return 0, err
+	}
+	buf := make([]byte, 32)
+	if _, err := io.ReadFull(r, buf[:4]); err != nil {
+		return 0, err
+	}
+	var timescale, duration uint64
+	if buf[0] == 1 {
+		// creation_time и modification_time по 8 байт
+		if _, err := io.ReadFull(r, buf[:28]); err != nil {
+			return 0, err
+		}
+		timescale = uint64(binary.BigEndian.Uint32(buf[16:]))
+		duration = binary.BigEndian.Uint64(buf[20:])
+	} else {
+		if _, err := io.ReadFull(r, buf[:16]); err != nil {
+			return 0, err
+		}
+		timescale = uint64(binary.BigEndian.Uint32(buf[8:]))
+		duration = uint64(binary.BigEndian.Uint32(buf[12:]))
+	}
+	if timescale == 0 {
+		return 0, fmt.Errorf("%w: zero timescale", ErrUnsupported)
+	}
+	return time.Duration(duration * uint64(time.Second) / timescale), nil
+}
+
+type box struct {
+	data int64 // начало содержимого
+	end  int64
+}
+
+// findBox ищет box с именем name среди соседних box в [start, end)
+func findBox(r io.ReadSeeker, start, end int64, name string) (box, error) {
+	header := make([]byte, 16)
+	for pos := start; pos+8 <= end; {
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			return box{}, err
+		}
+		if _, err := io.ReadFull(r, header[:8]); err != nil {
+			return box{}, err
+		}
+		size := int64(binary.BigEndian.Uint32(header))
+		data := pos + 8
+		switch size {
+		case 0:
+			size = end - pos
+		case 1:
+			if _, err := io.ReadFull(r, header[8:]); err != nil {
+				return box{}, err
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:]))
+			data += 8
+		}
+		if size < data-pos {
+			break
+		}
+		if string(header[4:8]) == name {
+			return box{data: data, end: pos + size}, nil
+		}
+		pos += size
+	}
+	return box{}, fmt.Errorf("%w: box %s not found", ErrUnsupported, name)
+}
@@ -0,0 +1,78 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+// makeFLV собирает FLV из видеотегов с заданными метками времени
+func makeFLV(timestamps ...uint32) []byte {
+	data := []byte{'F', 'L', 'V', 1, 1, 0, 0, 0, 9, 0, 0, 0, 0}
+	for _, ts := range timestamps {
+		payload := []byte{0x17, 1, 0, 0, 0}
+		tag := []byte{9, 0, 0, byte(len(payload)), byte(ts >> 16), byte(ts >> 8), byte(ts), byte(ts >> 24), 0, 0, 0}
+		data = append(append(data, tag...), payload...)
+		data = appendUint32(data, uint32(len(tag)+len(payload)))
+	}
+	return data
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func mp4Box(name string, payload ...[]byte) []byte {
+	size := 8
+	for _, p := range payload {
+		size += len(p)
+	}
+	b := appendUint32(nil, uint32(size))
+	b = append(b, name...)
+	for _, p := range payload {
+		b = append(b, p...)
+	}
+	return b
+}
+
+// makeMP4 собирает MP4 с mvhd версии 0 после mdat, как пишет SRS
+func makeMP4(timescale, duration uint32) []byte {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:], timescale)
+	binary.BigEndian.PutUint32(mvhd[16:], duration)
+	return append(append(mp4Box("ftyp", []byte("isom")), mp4Box("mdat", make([]byte, 64))...),
+		mp4Box("moov", mp4Box("mvhd", mvhd))...)
+}
+
+func TestDuration(t *testing.T) {
+	dir := t.TempDir()
+	for _, tc := range []struct {
+		name string
+		data []byte
+		want time.Duration
+	}{
+		{"session.flv", makeFLV(0, 40, 80, 12500), 12500 * time.Millisecond},
+		{"offset.flv", makeFLV(1000, 2000, 3000), 2 * time.Second},
+		// обрезанный последний тег пропускается
+		{"truncated.flv", append(makeFLV(0, 40, 5000), 9, 0, 0), 5 * time.Second},
+		{"session.mp4", makeMP4(1000, 61500), 61500 * time.Millisecond},
+	} {
+		file := path.Join(dir, tc.name)
+		if err := os.WriteFile(file, tc.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		d, err := Duration(file)
+		if err != nil || d != tc.want {
+			t.Errorf("%s: want %v, have %v, %v", tc.name, tc.want, d, err)
+		}
+	}
+
+	file := path.Join(dir, "session.ts")
+	os.WriteFile(file, []byte{0x47}, 0644)
+	if _, err := Duration(file); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("want %v, have %v", ErrUnsupported, err)
+	}
+}
@@ -0,0 +1,199 @@
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	amzDateFormat  = "20060102T150405Z"
+	amzShortFormat = "20060102"
+	signAlgorithm  = "AWS4-HMAC-SHA256"
+	requestTimeout = 60 * time.Second
+)
+
+var (
+	ErrRequestFailed = errors.New("OBJSTORE_REQUEST_FAILED")
+)
+
+// Store - минимальный клиент S3-совместимого хранилища (AWS S3, MinIO) с подписью SigV4
+type Store struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	pathStyle bool
+	publicURL string
+	client    *http.Client
+}
+
+func New(endpoint, region, bucket, accessKey, secretKey string, pathStyle bool, publicURL string) (*Store, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid object storage endpoint %q", endpoint)
+	}
+	if bucket == "" {
+		return nil, fmt.Errorf("object storage bucket is not set")
+	}
+
+	s := &Store{
+		endpoint:  u,
+		region:    region,
+		bucket:    bucket,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		pathStyle: pathStyle,
+		publicURL: strings.TrimSuffix(publicURL, "/"),
+		client:    &http.Client{Timeout: requestTimeout},
+	}
+	if s.publicURL == "" {
+		s.publicURL = strings.TrimSuffix(s.objectURL("").String(), "/")
+	}
+
+	return s, nil
+}
+
+// URL возвращает публичный адрес объекта для использования в плейлистах
+func (s *Store) URL(key string) string {
+	return s.publicURL + "/" + escapePath(key)
+}
+
+func (s *Store) Put(ctx context.Context, key string, body []byte, contentType string) error {
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	_, err := s.do(ctx, http.MethodPut, key, body, header)
+	return err
+}
+
+func (s *Store) Get(ctx context.Context, key string) ([]byte, error) {
+	return s.do(ctx, http.MethodGet, key, nil, http.Header{})
+}
+
+func (s *Store) Delete(ctx context.Context, key string) error {
+	_, err := s.do(ctx, http.MethodDelete, key, nil, http.Header{})
+	return err
+}
+
+func (s *Store) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	if s.pathStyle {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.bucket + "/" + key
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + key
+	}
+	return &u
+}
+
+func (s *Store) do(ctx context.Context, method, key string, body []byte, header http.Header) ([]byte, error) {
+	u := s.objectURL(key)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.ContentLength = int64(len(body))
+	s.sign(req, body, time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("%w: %s %s: %d %s", ErrRequestFailed, method, key, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	return data, nil
+}
+
+// sign добавляет к запросу заголовок Authorization по схеме AWS Signature Version 4
+func (s *Store) sign(req *http.Request, body []byte, now time.Time) {
+	payloadHash := sha256Hex(body)
+	amzDate := now.Format(amzDateFormat)
+	shortDate := now.Format(amzShortFormat)
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signed := []string{}
+	canonicalHeaders := ""
+	for k := range req.Header {
+		signed = append(signed, strings.ToLower(k))
+	}
+	sort.Strings(signed)
+	for _, k := range signed {
+		value := req.Header.Get(k)
+		if k == "host" {
+			value = req.URL.Host
+		}
+		canonicalHeaders += k + ":" + strings.TrimSpace(value) + "\n"
+	}
+	signedHeaders := strings.Join(signed, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		escapePath(req.URL.Path),
+		req.URL.Query().Encode(),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{shortDate, s.region, "s3", "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{signAlgorithm, amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), shortDate)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Del("Host")
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		signAlgorithm, s.accessKey, scope, signedHeaders, signature))
+}
+
+func escapePath(p string) string {
+	parts := strings.Split(p, "/")
+	for i, part := range parts {
+		parts[i] = strings.ReplaceAll(url.PathEscape(part), "+", "%2B")
+	}
+	return strings.Join(parts, "/")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
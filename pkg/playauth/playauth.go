@@ -0,0 +1,129 @@
+// Package playauth подписывает и проверяет токены воспроизведения HLS
+package playauth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	ErrTokenMalformed = errors.New("TOKEN_MALFORMED")
+	ErrTokenSignature = errors.New("TOKEN_SIGNATURE")
+	ErrTokenExpired   = errors.New("TOKEN_EXPIRED")
+	ErrTokenStream    = errors.New("TOKEN_STREAM_MISMATCH")
+	ErrTokenIP        = errors.New("TOKEN_IP_MISMATCH")
+	ErrTokenReferer   = errors.New("TOKEN_REFERER_NOT_ALLOWED")
+)
+
+var b64 = base64.RawURLEncoding
+
+// Claims содержимое токена: стрим, срок действия и необязательные ограничения
+type Claims struct {
+	StreamID string   `json:"sid"`
+	Expires  int64    `json:"exp"`
+	IP       string   `json:"ip,omitempty"`
+	Domains  []string `json:"dom,omitempty"`
+}
+
+type Signer struct {
+	secret []byte
+}
+
+func New(secret string) *Signer {
+	return &Signer{secret: []byte(secret)}
+}
+
+// Sign возвращает токен вида base64(claims).base64(hmac-sha256)
+func (s *Signer) Sign(c Claims) (string, error) {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	body := b64.EncodeToString(payload)
+	return body + "." + b64.EncodeToString(s.mac(body)), nil
+}
+
+// Parse проверяет подпись токена и возвращает его содержимое
+func (s *Signer) Parse(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, ErrTokenMalformed
+	}
+	body, sig := parts[0], parts[1]
+	mac, err := b64.DecodeString(sig)
+	if err != nil {
+		return nil, ErrTokenMalformed
+	}
+	if !hmac.Equal(mac, s.mac(body)) {
+		return nil, ErrTokenSignature
+	}
+
+	payload, err := b64.DecodeString(body)
+	if err != nil {
+		return nil, ErrTokenMalformed
+	}
+	c := &Claims{}
+	if err := json.Unmarshal(payload, c); err != nil {
+		return nil, ErrTokenMalformed
+	}
+	return c, nil
+}
+
+func (s *Signer) mac(body string) []byte {
+	h := hmac.New(sha256.New, s.secret)
+	h.Write([]byte(body))
+	return h.Sum(nil)
+}
+
+// Check проверяет ограничения токена для запроса зрителя
+func (c *Claims) Check(streamID, ip, referer string, now time.Time) error {
+	if now.Unix() >= c.Expires {
+		return ErrTokenExpired
+	}
+	if c.StreamID != streamID {
+		return ErrTokenStream
+	}
+	if c.IP != "" && !sameIP(c.IP, ip) {
+		return ErrTokenIP
+	}
+	if len(c.Domains) > 0 && !allowedReferer(c.Domains, referer) {
+		return ErrTokenReferer
+	}
+	return nil
+}
+
+func sameIP(a, b string) bool {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	return ipA != nil && ipB != nil && ipA.Equal(ipB)
+}
+
+// allowedReferer сравнивает хост referer со списком доменов,
+// домен вида *.example.com разрешает также все поддомены
+func allowedReferer(domains []string, referer string) bool {
+	u, err := url.Parse(referer)
+	if err != nil || u.Hostname() == "" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+
+	for _, d := range domains {
+		d = strings.ToLower(d)
+		if base := strings.TrimPrefix(d, "*."); base != d {
+			if host == base || strings.HasSuffix(host, "."+base) {
+				return true
+			}
+			continue
+		}
+		if host == d {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package playauth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignParse(t *testing.T) {
+	s := New("secret")
+	token, err := s.Sign(Claims{StreamID: "a", Expires: 100, IP: "10.0.0.1", Domains: []string{"*.example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := s.Parse(token)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if c.StreamID != "a" || c.Expires != 100 || c.IP != "10.0.0.1" || len(c.Domains) != 1 {
+		t.Errorf("unexpected claims %+v", c)
+	}
+
+	if _, err := New("other").Parse(token); err != ErrTokenSignature {
+		t.Errorf("want %v, have %v", ErrTokenSignature, err)
+	}
+	parts := strings.Split(token, ".")
+	if _, err := s.Parse(parts[0] + "x." + parts[1]); err != ErrTokenSignature {
+		t.Errorf("tampered body: want %v, have %v", ErrTokenSignature, err)
+	}
+	if _, err := s.Parse("garbage"); err != ErrTokenMalformed {
+		t.Errorf("want %v, have %v", ErrTokenMalformed, err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	now := time.Unix(50, 0)
+	c := Claims{StreamID: "a", Expires: 100, IP: "10.0.0.1", Domains: []string{"*.example.com", "player.test"}}
+
+	for _, tc := range []struct {
+		name, stream, ip, referer string
+		now                       time.Time
+		want                      error
+	}{
+		{"ok", "a", "10.0.0.1", "https://www.example.com/page", now, nil},
+		{"base domain", "a", "10.0.0.1", "https://example.com/", now, nil},
+		{"exact domain", "a", "10.0.0.1", "http://player.test:8080/", now, nil},
+		{"expired", "a", "10.0.0.1", "https://example.com/", time.Unix(100, 0), ErrTokenExpired},
+		{"stream", "b", "10.0.0.1", "https://example.com/", now, ErrTokenStream},
+		{"ip", "a", "10.0.0.2", "https://example.com/", now, ErrTokenIP},
+		{"referer", "a", "10.0.0.1", "https://evil-example.com/", now, ErrTokenReferer},
+		{"no referer", "a", "10.0.0.1", "", now, ErrTokenReferer},
+		{"subdomain of exact", "a", "10.0.0.1", "https://x.player.test/", now, ErrTokenReferer},
+	} {
+		if err := c.Check(tc.stream, tc.ip, tc.referer, tc.now); err != tc.want {
+			t.Errorf("%s: want %v, have %v", tc.name, tc.want, err)
+		}
+	}
+}
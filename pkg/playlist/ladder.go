@@ -0,0 +1,82 @@
+package playlist
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Rendition - видео-вариант лестницы стрима для мастер-плейлиста
+type Rendition struct {
+	Name            string // вариант SRS: low, mid или high
+	Bandwidth       int
+	IFrameBandwidth int // 0 - Bandwidth/8
+	Width           int
+	Height          int
+	FrameRate       float64
+	Codecs          string
+}
+
+// LadderSource возвращает лестницу стрима, nil - лестница по умолчанию
+type LadderSource func(livePath string) []Rendition
+
+var defaultLadder = []Rendition{
+	{Name: "low", Bandwidth: 1100000, IFrameBandwidth: 140000, Width: 852, Height: 480, FrameRate: 25, Codecs: "avc1.4d0028,mp4a.40.2"},
+	{Name: "mid", Bandwidth: 2200000, IFrameBandwidth: 280000, Width: 1280, Height: 720, FrameRate: 25, Codecs: "avc1.4d0028,mp4a.40.2"},
+	{Name: "high", Bandwidth: 6500000, IFrameBandwidth: 820000, Width: 1920, Height: 1080, FrameRate: 25, Codecs: "avc1.4d0028,mp4a.40.2"},
+}
+
+func (p *Playlist) SetLadderSource(src LadderSource) {
+	p.ladders = src
+}
+
+func (p *Playlist) ladder(livePath string) []Rendition {
+	if p.ladders != nil {
+		if ladder := p.ladders(livePath); len(ladder) > 0 {
+			return ladder
+		}
+	}
+	return defaultLadder
+}
+
+// ladderPlaylists возвращает плейлисты SRS вариантов лестницы стрима
+func (p *Playlist) ladderPlaylists(livePath string) []string {
+	items := []string{}
+	for _, r := range p.ladder(livePath) {
+		items = append(items, r.Name+".m3u8")
+	}
+	return items
+}
+
+// rendition находит вариант лестницы по имени плейлиста, в том числе с префиксом
+func rendition(ladder []Rendition, name string) (Rendition, bool) {
+	for _, r := range ladder {
+		if strings.HasSuffix(name, r.Name+".m3u8") {
+			return r, true
+		}
+	}
+	return Rendition{}, false
+}
+
+func (r Rendition) resolution() string {
+	if r.Width > 0 && r.Height > 0 {
+		return fmt.Sprintf(",RESOLUTION=%dx%d", r.Width, r.Height)
+	}
+	return ""
+}
+
+func (r Rendition) streamInf(subsAttr string) string {
+	frameRate := ""
+	if r.FrameRate > 0 {
+		frameRate = fmt.Sprintf(",FRAME-RATE=%.3f", r.FrameRate)
+	}
+	return fmt.Sprintf(`#EXT-X-STREAM-INF:BANDWIDTH=%d%s%s,CODECS="%s",CLOSED-CAPTIONS=NONE%s`, r.Bandwidth, r.resolution(), frameRate, r.Codecs, subsAttr)
+}
+
+func (r Rendition) iframeStreamInf(uri string) string {
+	bandwidth := r.IFrameBandwidth
+	if bandwidth == 0 {
+		bandwidth = r.Bandwidth / 8
+	}
+	video := strings.Split(r.Codecs, ",")[0]
+	return fmt.Sprintf(`#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=%d%s,CODECS="%s",URI="%s"`, bandwidth, r.resolution(), video, uri)
+}
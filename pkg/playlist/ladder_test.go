@@ -0,0 +1,81 @@
+package playlist
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+// writeSourcePlaylists пишет плейлисты SRS вариантов с одним сегментом
+func writeSourcePlaylists(t *testing.T, dir string, names ...string) {
+	for _, name := range names {
+		writeRendition(t, dir, name+".m3u8")
+		if err := os.WriteFile(path.Join(dir, name+"-1600000000-0.ts"), makeAVTS(50, 25), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMasterPlaylistLadder(t *testing.T) {
+	p := &Playlist{}
+	info := []string{"master-low.m3u8", "master-high.m3u8", "master-audio.m3u8"}
+	dir := t.TempDir()
+	writeSourcePlaylists(t, dir, "low", "mid", "high")
+
+	master := string(p.masterPlaylist(info, dir))
+	for _, want := range []string{
+		`#EXT-X-STREAM-INF:BANDWIDTH=1100000,RESOLUTION=852x480,FRAME-RATE=25.000,CODECS="avc1.4d0028,mp4a.40.2",CLOSED-CAPTIONS=NONE` + "\nmaster-low.m3u8\n",
+		`#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=820000,RESOLUTION=1920x1080,CODECS="avc1.4d0028",URI="master-high-iframes.m3u8"`,
+	} {
+		if !strings.Contains(master, want) {
+			t.Errorf("default ladder: missing %q in\n%s", want, master)
+		}
+	}
+
+	p.SetLadderSource(func(livePath string) []Rendition {
+		return []Rendition{
+			{Name: "low", Bandwidth: 840000, Width: 640, Height: 360, Codecs: "avc1.42e01e,mp4a.40.2"},
+			{Name: "mid", Bandwidth: 3000000, Codecs: "avc1.4d0028,mp4a.40.2"},
+		}
+	})
+	master = string(p.masterPlaylist(info, dir))
+	if strings.Contains(master, "master-high.m3u8") {
+		t.Errorf("variant outside of the ladder in\n%s", master)
+	}
+	for _, want := range []string{
+		`#EXT-X-STREAM-INF:BANDWIDTH=840000,RESOLUTION=640x360,CODECS="avc1.42e01e,mp4a.40.2",CLOSED-CAPTIONS=NONE` + "\nmaster-low.m3u8\n",
+		`#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=105000,RESOLUTION=640x360,CODECS="avc1.42e01e",URI="master-low-iframes.m3u8"`,
+		"master-audio.m3u8",
+	} {
+		if !strings.Contains(master, want) {
+			t.Errorf("profile ladder: missing %q in\n%s", want, master)
+		}
+	}
+}
+
+// TestMasterPlaylistNoIFrames: без разбираемых сегментов (зашифрованных или
+// еще не записанных) I-frame плейлист варианта в мастер не попадает
+func TestMasterPlaylistNoIFrames(t *testing.T) {
+	p := &Playlist{}
+	dir := t.TempDir()
+	writeSourcePlaylists(t, dir, "low", "high")
+	p.AddSegmentHook(func(livePath string, seg *Segment) {
+		if strings.HasPrefix(seg.Name, "high-") {
+			seg.Key = `#EXT-X-KEY:METHOD=AES-128,URI="key/0"`
+		}
+	})
+
+	master := string(p.masterPlaylist([]string{"master-low.m3u8", "master-mid.m3u8", "master-high.m3u8"}, dir))
+	if !strings.Contains(master, `URI="master-low-iframes.m3u8"`) {
+		t.Errorf("missing I-frame playlist of low in\n%s", master)
+	}
+	for _, name := range []string{"master-mid-iframes.m3u8", "master-high-iframes.m3u8"} {
+		if strings.Contains(master, name) {
+			t.Errorf("unexpected %s in\n%s", name, master)
+		}
+	}
+	if !strings.Contains(master, "master-high.m3u8\n") {
+		t.Errorf("encrypted variant is missing in\n%s", master)
+	}
+}
@@ -0,0 +1,82 @@
+package playlist
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DateRange - метка EXT-X-DATERANGE: рекламная пауза, гол, начало главы
+type DateRange struct {
+	ID         string
+	Class      string
+	StartDate  time.Time
+	Duration   float64           // 0 - метка без длительности
+	Attributes map[string]string // клиентские атрибуты X-<NAME>
+	SCTE35Cmd  string            // шестнадцатеричные SCTE-35 splice_info_section
+	SCTE35Out  string
+	SCTE35In   string
+}
+
+// MarkerSource возвращает метки стрима для медиа-плейлистов
+type MarkerSource func(livePath string) []DateRange
+
+func (p *Playlist) SetMarkerSource(src MarkerSource) {
+	p.markers = src
+}
+
+func (p *Playlist) markerRanges(livePath string) []DateRange {
+	if p.markers == nil {
+		return nil
+	}
+	return p.markers(livePath)
+}
+
+func (d DateRange) end() time.Time {
+	return d.StartDate.Add(time.Duration(d.Duration * float64(time.Second)))
+}
+
+// Tag форматирует метку по RFC 8216, 4.3.2.7
+func (d DateRange) Tag() string {
+	attrs := []string{fmt.Sprintf(`ID="%s"`, d.ID)}
+	if d.Class != "" {
+		attrs = append(attrs, fmt.Sprintf(`CLASS="%s"`, d.Class))
+	}
+	attrs = append(attrs, fmt.Sprintf(`START-DATE="%s"`, d.StartDate.UTC().Format("2006-01-02T15:04:05.000Z")))
+	if d.Duration > 0 {
+		attrs = append(attrs, fmt.Sprintf("DURATION=%.3f", d.Duration))
+	}
+
+	names := []string{}
+	for name := range d.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		attrs = append(attrs, fmt.Sprintf(`%s="%s"`, strings.ToUpper(name), d.Attributes[name]))
+	}
+
+	for _, scte := range []struct{ name, value string }{{"SCTE35-CMD", d.SCTE35Cmd}, {"SCTE35-OUT", d.SCTE35Out}, {"SCTE35-IN", d.SCTE35In}} {
+		if scte.value != "" {
+			attrs = append(attrs, fmt.Sprintf("%s=%s", scte.name, scte.value))
+		}
+	}
+
+	return "#EXT-X-DATERANGE:" + strings.Join(attrs, ",")
+}
+
+// dateRangeTags возвращает метки, пересекающиеся с плейлистом, который начинается с since
+func dateRangeTags(ranges []DateRange, since *time.Time) []string {
+	if since == nil {
+		return nil
+	}
+	tags := []string{}
+	for _, d := range ranges {
+		if d.end().Before(*since) {
+			continue
+		}
+		tags = append(tags, d.Tag())
+	}
+	return tags
+}
@@ -0,0 +1,27 @@
+package playlist
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDateRangeTag(t *testing.T) {
+	start := time.Date(2024, 5, 1, 18, 30, 0, 0, time.UTC)
+	d := DateRange{
+		ID:         "ad-1",
+		Class:      "com.example.ad",
+		StartDate:  start,
+		Duration:   30,
+		Attributes: map[string]string{"X-B": "2", "X-A": "1"},
+		SCTE35Out:  "0xFC30",
+	}
+	want := `#EXT-X-DATERANGE:ID="ad-1",CLASS="com.example.ad",START-DATE="2024-05-01T18:30:00.000Z",DURATION=30.000,X-A="1",X-B="2",SCTE35-OUT=0xFC30`
+	if have := d.Tag(); want != have {
+		t.Errorf("want %s, have %s", want, have)
+	}
+
+	since := start.Add(time.Minute)
+	if tags := dateRangeTags([]DateRange{d, {ID: "goal", StartDate: since}}, &since); len(tags) != 1 {
+		t.Errorf("ended markers must be skipped, have %v", tags)
+	}
+}
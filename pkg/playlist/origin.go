@@ -0,0 +1,337 @@
+package playlist
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	reSegmentInfo = regexp.MustCompile(`-(\d+)-(\d+)\.ts$`)
+	reOutputName  = regexp.MustCompile(`^(.+?)(?:(\d{9,})-)?(index|low|mid|high|audio)(-iframes)?\.m3u8$`)
+)
+
+// indexSegment - сегмент варианта в индексе origin-режима
+type indexSegment struct {
+	Name          string
+	Duration      float64
+	Time          time.Time
+	Seq           int
+	Discontinuity bool
+}
+
+// segmentIndex хранит сегменты вариантов стримов в памяти, чтобы отдавать
+// плейлисты по запросу, не переписывая файлы на каждый on_hls
+type segmentIndex struct {
+	sync.RWMutex
+	renditions map[string][]indexSegment
+	names      map[string]map[string]bool
+}
+
+// RenderOptions задает выборку сегментов для плейлиста, собираемого по запросу
+type RenderOptions struct {
+	Since *time.Time // начало DVR-сессии, nil - живой плейлист
+	Start *time.Time // диапазон ?start=
+	End   *time.Time // диапазон ?end=
+	Ended bool       // трансляция остановлена
+}
+
+// OutputName описывает имя выходного плейлиста: master-[<unix>-]<variant>[-iframes].m3u8
+type OutputName struct {
+	Prefix  string
+	Since   *time.Time
+	Variant string // index для мастер-плейлиста
+	IFrames bool
+}
+
+func ParseOutputName(name string) (*OutputName, bool) {
+	m := reOutputName.FindStringSubmatch(name)
+	if m == nil || m[3] == "index" && m[4] != "" {
+		return nil, false
+	}
+	out := &OutputName{Prefix: m[1], Variant: m[3], IFrames: m[4] != ""}
+	if m[2] != "" {
+		unix, err := strconv.ParseInt(m[2], 10, 64)
+		if err != nil {
+			return nil, false
+		}
+		since := time.Unix(unix, 0)
+		out.Since = &since
+	}
+	return out, true
+}
+
+func indexKey(livePath, variant string) string {
+	return path.Join(livePath, variant)
+}
+
+// parseSegmentName разбирает имя сегмента SRS вида
+// low-[2006]-[01]-[02]-[15]-[04]-[05]-[duration]-[seq].ts
+func (p *Playlist) parseSegmentName(name string) (indexSegment, bool) {
+	m := reSegmentInfo.FindStringSubmatch(name)
+	if m == nil {
+		return indexSegment{}, false
+	}
+	ms, _ := strconv.Atoi(m[1])
+	seq, _ := strconv.Atoi(m[2])
+	seg := indexSegment{Name: name, Duration: float64(ms) / 1000, Seq: seq}
+	if t, err := p.timeFromTS(name); err == nil {
+		seg.Time = *t
+	}
+	return seg, true
+}
+
+// loadIndex заполняет индекс варианта сегментами с диска, например после перезапуска
+func (p *Playlist) loadIndex(livePath, variant string) {
+	key := indexKey(livePath, variant)
+
+	p.origin.Lock()
+	defer p.origin.Unlock()
+	if _, ok := p.origin.renditions[key]; ok {
+		return
+	}
+	if p.origin.renditions == nil {
+		p.origin.renditions = map[string][]indexSegment{}
+		p.origin.names = map[string]map[string]bool{}
+	}
+
+	prefix := strings.TrimSuffix(variant, ".m3u8") + "-"
+	if variant == AudioPlaylist {
+		prefix = audioPrefix
+	}
+	files, _ := filepath.Glob(path.Join(livePath, prefix+"*.ts"))
+	segments := []indexSegment{}
+	for _, file := range files {
+		if seg, ok := p.parseSegmentName(path.Base(file)); ok {
+			segments = append(segments, seg)
+		}
+	}
+	sort.SliceStable(segments, func(i, j int) bool {
+		if !segments[i].Time.Equal(segments[j].Time) {
+			return segments[i].Time.Before(segments[j].Time)
+		}
+		return segments[i].Seq < segments[j].Seq
+	})
+
+	names := map[string]bool{}
+	for i := range segments {
+		if i > 0 && segments[i].Seq != segments[i-1].Seq+1 {
+			segments[i].Discontinuity = true
+		}
+		names[segments[i].Name] = true
+	}
+	p.origin.renditions[key] = segments
+	p.origin.names[key] = names
+}
+
+// IndexSegment добавляет сегмент варианта из on_hls. duration в секундах,
+// если 0 - берется из имени сегмента
+func (p *Playlist) IndexSegment(livePath, variant, name string, duration float64) {
+	p.loadIndex(livePath, variant)
+	seg, ok := p.parseSegmentName(name)
+	if !ok {
+		seg = indexSegment{Name: name, Time: time.Now()}
+	}
+	if duration > 0 {
+		seg.Duration = duration
+	}
+
+	key := indexKey(livePath, variant)
+	p.origin.Lock()
+	defer p.origin.Unlock()
+	if p.origin.names[key][name] {
+		return
+	}
+	segments := p.origin.renditions[key]
+	if n := len(segments); n > 0 && segments[n-1].Seq+1 != seg.Seq {
+		seg.Discontinuity = true
+	}
+	p.origin.renditions[key] = p.pruneIndex(livePath, key, append(segments, seg))
+	p.origin.names[key][name] = true
+}
+
+// SetIndexWindow задает, сколько сегментов по времени хранит индекс origin-режима
+func (p *Playlist) SetIndexWindow(window time.Duration) {
+	p.indexWindow = window
+}
+
+// pruneIndex удаляет из начала индекса сегменты старше окна и сегменты,
+// файлов которых больше нет, если хуки не отдают их из другого места,
+// например из объектного хранилища. Вызывается под блокировкой индекса
+func (p *Playlist) pruneIndex(livePath, key string, segments []indexSegment) []indexSegment {
+	newest := segments[len(segments)-1].Time
+	drop := 0
+	for ; drop < len(segments)-1; drop++ {
+		seg := segments[drop]
+		if p.indexWindow > 0 && !seg.Time.IsZero() && !newest.IsZero() && newest.Sub(seg.Time) > p.indexWindow {
+			continue
+		}
+		if _, err := os.Stat(path.Join(livePath, seg.Name)); err == nil || p.applyHooks(livePath, seg.Name).URI != seg.Name {
+			break
+		}
+	}
+	if drop == 0 {
+		return segments
+	}
+	for _, seg := range segments[:drop] {
+		delete(p.origin.names[key], seg.Name)
+	}
+	// копия, чтобы не удерживать в памяти начало массива
+	return append([]indexSegment{}, segments[drop:]...)
+}
+
+func (p *Playlist) indexedSegments(livePath, variant string) []indexSegment {
+	p.loadIndex(livePath, variant)
+	p.origin.RLock()
+	defer p.origin.RUnlock()
+	return p.origin.renditions[indexKey(livePath, variant)]
+}
+
+func (x *segmentIndex) remove(livePath string) {
+	x.Lock()
+	defer x.Unlock()
+	for key := range x.renditions {
+		if path.Dir(key) == path.Clean(livePath) {
+			delete(x.renditions, key)
+			delete(x.names, key)
+		}
+	}
+}
+
+// renderMedia собирает медиа-плейлист варианта из индекса
+func (p *Playlist) renderMedia(livePath, variant string, opts RenderOptions) *mediaPlaylist {
+	all := p.indexedSegments(livePath, variant)
+
+	first, last := 0, len(all)
+	for first < last && opts.Since != nil && !all[first].Time.After(*opts.Since) {
+		first++
+	}
+	for first < last && opts.Start != nil && all[first].Time.Add(time.Duration(all[first].Duration*float64(time.Second))).Before(*opts.Start) {
+		first++
+	}
+	closed := false
+	if opts.End != nil {
+		for last > first && !all[last-1].Time.Before(*opts.End) {
+			last--
+			closed = true
+		}
+	}
+	live := opts.Since == nil && opts.Start == nil && opts.End == nil
+	if live && last-first > LiveNumChunks {
+		first = last - LiveNumChunks
+	}
+	segments := all[first:last]
+
+	pl := &mediaPlaylist{Header: []string{"#EXTM3U", "#EXT-X-VERSION:3"}}
+	maxDuration := 0.0
+	for _, seg := range segments {
+		maxDuration = math.Max(maxDuration, seg.Duration)
+	}
+	pl.Header = append(pl.Header, fmt.Sprintf("#EXT-X-TARGETDURATION:%d", int(math.Max(math.Ceil(maxDuration), 1))))
+	if live && len(segments) > 0 {
+		// номер сегмента SRS не зависит от содержимого индекса после перезапуска
+		pl.Header = append(pl.Header, fmt.Sprintf("#EXT-X-MEDIA-SEQUENCE:%d", segments[0].Seq))
+	} else {
+		pl.Header = append(pl.Header, "#EXT-X-MEDIA-SEQUENCE:0")
+	}
+	switch {
+	case closed || (opts.Ended && !live):
+		pl.Header = append(pl.Header, "#EXT-X-PLAYLIST-TYPE:VOD")
+	case !live:
+		pl.Header = append(pl.Header, "#EXT-X-PLAYLIST-TYPE:EVENT")
+	}
+	if len(segments) > 0 && !segments[0].Time.IsZero() {
+		pl.Header = append(pl.Header, "#EXT-X-PROGRAM-DATE-TIME:"+segments[0].Time.UTC().Format("2006-01-02T15:04:05.000Z"))
+	}
+
+	lastKey := ""
+	for i, seg := range segments {
+		tags := []string{}
+		if seg.Discontinuity && i > 0 {
+			tags = append(tags, "#EXT-X-DISCONTINUITY")
+		}
+		tags = append(tags, formatExtInf("", seg.Duration))
+		hooked := p.applyHooks(livePath, seg.Name)
+		tags = append(tags, hooked.Tags...)
+		if hooked.Key != lastKey {
+			if hooked.Key == "" {
+				tags = append(tags, "#EXT-X-KEY:METHOD=NONE")
+			} else {
+				tags = append(tags, hooked.Key)
+			}
+			lastKey = hooked.Key
+		}
+		pl.Segments = append(pl.Segments, mediaSegment{Tags: tags, Duration: seg.Duration, URI: hooked.URI})
+	}
+
+	if len(segments) > 0 && !segments[0].Time.IsZero() {
+		pl.Trailer = append(pl.Trailer, dateRangeTags(p.markerRanges(livePath), &segments[0].Time)...)
+	}
+	if closed || opts.Ended {
+		pl.Trailer = append(pl.Trailer, "#EXT-X-ENDLIST")
+	}
+	return pl
+}
+
+// MediaPlaylist отдает медиа-плейлист варианта, собранный из индекса сегментов
+func (p *Playlist) MediaPlaylist(livePath, variant string, opts RenderOptions) []byte {
+	return p.renderMedia(livePath, variant, opts).bytes()
+}
+
+// IFramePlaylist отдает I-frame плейлист варианта, собранный из индекса сегментов
+func (p *Playlist) IFramePlaylist(livePath, variant string, opts RenderOptions) []byte {
+	return p.iframePlaylist(livePath, p.renderMedia(livePath, variant, opts)).bytes()
+}
+
+// MasterPlaylist отдает мастер-плейлист; query добавляется к URI вариантов,
+// чтобы диапазон ?start=&end= распространялся на медиа-плейлисты
+func (p *Playlist) MasterPlaylist(livePath, prefix, query string) []byte {
+	info := []string{}
+	for _, item := range p.variants(livePath) {
+		info = append(info, prefix+item)
+	}
+	pl := p.masterPlaylist(info, livePath)
+	if query == "" {
+		return pl
+	}
+
+	lines := strings.Split(string(pl), "\n")
+	for i, line := range lines {
+		if strings.HasSuffix(line, ".m3u8") && !strings.HasPrefix(line, "#") {
+			lines[i] = line + "?" + query
+		} else if strings.HasPrefix(line, "#EXT-X-I-FRAME-STREAM-INF") {
+			lines[i] = strings.Replace(line, `.m3u8"`, `.m3u8?`+query+`"`, 1)
+		}
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// Materialize записывает живой и DVR плейлисты из индекса на диск, чтобы
+// остановленная трансляция обслуживалась как обычно: выгрузка, проверка, ENDLIST
+func (p *Playlist) Materialize(livePath, outputPlaylistPrefix string, startTs *time.Time) error {
+	for _, variant := range p.variants(livePath) {
+		pl := p.renderMedia(livePath, variant, RenderOptions{})
+		if len(pl.Segments) == 0 {
+			continue
+		}
+		if err := writeFileAtomic(path.Join(livePath, outputPlaylistPrefix+variant), pl.bytes()); err != nil {
+			return err
+		}
+		if startTs == nil || startTs.IsZero() {
+			continue
+		}
+		dvr := p.renderMedia(livePath, variant, RenderOptions{Since: startTs})
+		if err := writeFileAtomic(path.Join(livePath, fmt.Sprintf("%s%d-%s", outputPlaylistPrefix, startTs.Unix(), variant)), dvr.bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package playlist
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOriginRender(t *testing.T) {
+	dir := t.TempDir()
+	name := func(sec, seq int) string {
+		return fmt.Sprintf("low-2024-05-01-18-30-%02d-2000-%d.ts", sec, seq)
+	}
+	// сегменты на диске до запуска и из on_hls после
+	for i := 0; i < 4; i++ {
+		os.WriteFile(path.Join(dir, name(i*2, i)), nil, 0666)
+	}
+	p := New()
+	for i := 4; i < 10; i++ {
+		p.IndexSegment(dir, "low.m3u8", name(i*2, i), 0)
+	}
+	p.IndexSegment(dir, "low.m3u8", name(18, 9), 0)
+
+	live := string(p.MediaPlaylist(dir, "low.m3u8", RenderOptions{}))
+	if strings.Count(live, "#EXTINF:2.000,") != LiveNumChunks || !strings.Contains(live, "#EXT-X-MEDIA-SEQUENCE:4\n") ||
+		strings.Contains(live, "#EXT-X-ENDLIST") {
+		t.Errorf("unexpected live playlist:\n%s", live)
+	}
+
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	since := time.Date(2024, 5, 1, 18, 30, 5, 0, loc)
+	dvr := string(p.MediaPlaylist(dir, "low.m3u8", RenderOptions{Since: &since, Ended: true}))
+	if strings.Count(dvr, "#EXTINF") != 7 || !strings.Contains(dvr, "#EXT-X-PLAYLIST-TYPE:VOD") || !strings.HasSuffix(dvr, "#EXT-X-ENDLIST\n") {
+		t.Errorf("unexpected DVR playlist:\n%s", dvr)
+	}
+
+	start, end := since.Add(-time.Second), since.Add(5*time.Second)
+	ranged := string(p.MediaPlaylist(dir, "low.m3u8", RenderOptions{Start: &start, End: &end}))
+	if !strings.Contains(ranged, name(4, 2)+"\n") || !strings.Contains(ranged, name(8, 4)+"\n") ||
+		strings.Contains(ranged, name(10, 5)) || !strings.HasSuffix(ranged, "#EXT-X-ENDLIST\n") {
+		t.Errorf("unexpected ranged playlist:\n%s", ranged)
+	}
+}
+
+func TestParseOutputName(t *testing.T) {
+	out, ok := ParseOutputName("master-1714577400-mid-iframes.m3u8")
+	if !ok || out.Prefix != "master-" || out.Variant != "mid" || !out.IFrames || out.Since == nil || out.Since.Unix() != 1714577400 {
+		t.Errorf("unexpected %+v", out)
+	}
+	if _, ok := ParseOutputName("subs-en.m3u8"); ok {
+		t.Error("subtitle playlist must not be parsed as output")
+	}
+}
+
+func TestOriginSequenceAndPrune(t *testing.T) {
+	dir := t.TempDir()
+	name := func(sec, seq int) string {
+		return fmt.Sprintf("low-2024-05-01-18-%02d-%02d-2000-%d.ts", sec/60, sec%60, seq)
+	}
+	// после перезапуска на диске остались сегменты 100-109
+	for i := 100; i < 110; i++ {
+		os.WriteFile(path.Join(dir, name(i*2, i)), nil, 0666)
+	}
+	p := New()
+	live := string(p.MediaPlaylist(dir, "low.m3u8", RenderOptions{}))
+	if !strings.Contains(live, "#EXT-X-MEDIA-SEQUENCE:104\n") {
+		t.Errorf("want SRS sequence of the first served segment:\n%s", live)
+	}
+
+	// удаленные файлы уходят из индекса, выгруженные остаются
+	p.AddSegmentHook(func(livePath string, seg *Segment) {
+		if seg.Name == name(204, 102) {
+			seg.URI = "https://s3/" + seg.Name
+		}
+	})
+	for i := 100; i < 103; i++ {
+		os.Remove(path.Join(dir, name(i*2, i)))
+	}
+	os.WriteFile(path.Join(dir, name(220, 110)), nil, 0666)
+	p.IndexSegment(dir, "low.m3u8", name(220, 110), 0)
+	segments := p.indexedSegments(dir, "low.m3u8")
+	if len(segments) != 9 || segments[0].Seq != 102 {
+		t.Errorf("want 9 segments from 102, have %d from %d", len(segments), segments[0].Seq)
+	}
+
+	// сегменты старше окна удаляются
+	p.SetIndexWindow(10 * time.Second)
+	os.WriteFile(path.Join(dir, name(222, 111)), nil, 0666)
+	p.IndexSegment(dir, "low.m3u8", name(222, 111), 0)
+	segments = p.indexedSegments(dir, "low.m3u8")
+	if len(segments) != 6 || segments[0].Seq != 106 {
+		t.Errorf("want 6 segments from 106, have %d from %d", len(segments), segments[0].Seq)
+	}
+}
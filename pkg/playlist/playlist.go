@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
@@ -20,10 +21,13 @@ import (
 )
 
 const (
-	AllPlaylists  = ""
-	LiveNumChunks = 6
-	PL_WaitTime   = 12 * time.Second
-	PL_RetryTime  = 1 * time.Second
+	AllPlaylists    = ""
+	LiveNumChunks   = 6
+	PL_WaitTime     = 12 * time.Second
+	PL_LateWaitTime = 60 * time.Second
+	PL_RetryTime    = 1 * time.Second
+	// окно индекса origin-режима, как hls_window в srs_base.tpl
+	PL_IndexWindow = 36000 * time.Second
 )
 
 var (
@@ -31,7 +35,9 @@ var (
 	ErrInternalError     = errors.New("INTERNAL_ERROR")
 	ErrIvalidStartTime   = errors.New("INVALID_START_TIME")
 	playlistTypes        = []string{"low.m3u8", "mid.m3u8", "high.m3u8"}
+	reSegmentSeq         = regexp.MustCompile(`-(\d+)\.ts$`)
 	once                 sync.Once
+	defaultLogger        log.Logger
 )
 
 type mediaInfo struct {
@@ -44,9 +50,30 @@ type mediaInfo struct {
 }
 
 type Playlist struct {
-	logger log.Logger
+	logger    log.Logger
+	hooks     []SegmentHook
+	subtitles SubtitleSource
+	markers   MarkerSource
+	ladders   LadderSource
+	iframes   iframeIndex
+	origin    segmentIndex
+
+	waitTime     time.Duration
+	lateWaitTime time.Duration
+	indexWindow  time.Duration
 }
 
+// Segment - запись сегмента в выходном плейлисте
+type Segment struct {
+	Name string   // имя файла сегмента в плейлисте SRS
+	URI  string   // URI, который попадет в выходной плейлист
+	Tags []string // дополнительные теги перед URI
+	Key  string   // тег EXT-X-KEY, действующий для сегмента
+}
+
+// SegmentHook позволяет изменить запись сегмента перед записью в плейлист
+type SegmentHook func(livePath string, seg *Segment)
+
 type PLline struct {
 	Num  int
 	Line string
@@ -58,22 +85,93 @@ type PLstruct struct {
 }
 
 func New() *Playlist {
-	var newlogger log.Logger
 	once.Do(func() {
-		newlogger = log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr))
-		newlogger = log.With(newlogger, "ts", log.TimestampFormat(time.Now, time.RFC3339))
-		newlogger = log.With(newlogger, "caller", log.Caller(5))
-		newlogger = level.NewFilter(newlogger, level.AllowDebug())
+		defaultLogger = log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr))
+		defaultLogger = log.With(defaultLogger, "ts", log.TimestampFormat(time.Now, time.RFC3339))
+		defaultLogger = log.With(defaultLogger, "caller", log.Caller(5))
+		defaultLogger = level.NewFilter(defaultLogger, level.AllowDebug())
 	})
 	return &Playlist{
-		logger: newlogger,
+		logger:       defaultLogger,
+		waitTime:     PL_WaitTime,
+		lateWaitTime: PL_LateWaitTime,
+		indexWindow:  PL_IndexWindow,
+	}
+}
+
+func (p *Playlist) AddSegmentHook(h SegmentHook) {
+	p.hooks = append(p.hooks, h)
+}
+
+func (p *Playlist) applyHooks(livePath, name string) *Segment {
+	seg := &Segment{Name: name, URI: name}
+	for _, h := range p.hooks {
+		h(livePath, seg)
+	}
+	return seg
+}
+
+// lines возвращает строки плейлиста для сегмента. EXT-X-KEY пишется только
+// при смене ключа относительно предыдущего сегмента того же плейлиста
+func (s *Segment) lines(lastKey *string) string {
+	lines := append([]string{}, s.Tags...)
+	if s.Key != *lastKey {
+		if s.Key == "" {
+			lines = append(lines, "#EXT-X-KEY:METHOD=NONE")
+		} else {
+			lines = append(lines, s.Key)
+		}
+		*lastKey = s.Key
 	}
+	return strings.Join(append(lines, s.URI), "\n")
+}
+
+// SegmentSeq возвращает порядковый номер сегмента из имени файла SRS ([seq] в hls_ts_file)
+func SegmentSeq(name string) (int, bool) {
+	m := reSegmentSeq.FindStringSubmatch(path.Base(name))
+	if m == nil {
+		return 0, false
+	}
+	seq, err := strconv.Atoi(m[1])
+	return seq, err == nil
+}
+
+// RewriteSegments подменяет URI сегментов в уже записанных медиа-плейлистах каталога
+// и возвращает список всех плейлистов каталога
+func (p *Playlist) RewriteSegments(livePath string) ([]string, error) {
+	files, err := filepath.Glob(path.Join(livePath, "*.m3u8"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		pl, err := readMediaPlaylist(file)
+		if err != nil {
+			continue
+		}
+		changed := false
+		for i, seg := range pl.Segments {
+			uri := p.applyHooks(livePath, seg.URI).URI
+			if uri != seg.URI {
+				pl.Segments[i].URI = uri
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+		if err := writeMediaPlaylist(file, pl); err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
 }
 
 func (p *Playlist) Refresh(livePath, plType string, startTs *time.Time, outputPlaylistPrefix string) error {
 	re, _ := regexp.Compile(plType)
 	plsToParse := []string{}
-	for _, pl := range playlistTypes {
+	for _, pl := range p.variants(livePath) {
 		if re.MatchString(pl) {
 			plsToParse = append(plsToParse, pl)
 		}
@@ -81,6 +179,8 @@ func (p *Playlist) Refresh(livePath, plType string, startTs *time.Time, outputPl
 	wg := sync.WaitGroup{}
 	errC := make(chan error, len(plsToParse))
 
+	ranges := p.markerRanges(livePath)
+
 	re_h1, _ := regexp.Compile(`EXT-X-MEDIA-SEQUENCE.+?(\d+)`)
 	re_h2, _ := regexp.Compile(`#EXT-X-DISCONTINUITY`)
 
@@ -88,8 +188,9 @@ func (p *Playlist) Refresh(livePath, plType string, startTs *time.Time, outputPl
 		wg.Add(1)
 		go func(wg *sync.WaitGroup, pl string) {
 			defer wg.Done()
-			start := time.Now()
-			defer level.Info(p.logger).Log(fmt.Sprintf("RefreshPlaylistFrom_for_[%s/%s]_took", livePath, pl), time.Since(start))
+			defer func(start time.Time) {
+				level.Info(p.logger).Log(fmt.Sprintf("RefreshPlaylistFrom_for_[%s/%s]_took", livePath, pl), time.Since(start))
+			}(time.Now())
 			// level.Info(p.logger).Log("Looking for " + livePath + pl)
 			plLines, err := getTSName(path.Join(livePath, pl))
 			if err != nil {
@@ -158,6 +259,11 @@ func (p *Playlist) Refresh(livePath, plType string, startTs *time.Time, outputPl
 
 			startPlaylist := false
 			prevLine := ""
+			liveKey, dvrKey := "", ""
+			var liveSince, dvrSince *time.Time
+			// при записи DVR живой плейлист пишется без EXT-X-PROGRAM-DATE-TIME,
+			// а метки без него недопустимы
+			livePDT := startTs == nil || startTs.IsZero()
 			for i, tss := range plLines.TS {
 				if tss.TS && !startPlaylist {
 					tsTime, err := p.timeFromTS(tss.Line)
@@ -187,8 +293,24 @@ func (p *Playlist) Refresh(livePath, plType string, startTs *time.Time, outputPl
 				if !startPlaylist {
 					continue
 				}
+				var seg *Segment
+				if tss.TS {
+					seg = p.applyHooks(livePath, tss.Line)
+					if tsTime, err := p.timeFromTS(tss.Line); err == nil {
+						if dvrSince == nil {
+							dvrSince = tsTime
+						}
+						if liveSince == nil && len(plLines.TS)-i <= LiveNumChunks*2 {
+							liveSince = tsTime
+						}
+					}
+				}
 				if startTs != nil && !startTs.IsZero() {
-					_, err = fmt.Fprintln(f_dvr, tss.Line)
+					line := tss.Line
+					if seg != nil {
+						line = seg.lines(&dvrKey)
+					}
+					_, err = fmt.Fprintln(f_dvr, line)
 					if err != nil {
 						errC <- err
 						return
@@ -196,7 +318,15 @@ func (p *Playlist) Refresh(livePath, plType string, startTs *time.Time, outputPl
 				}
 
 				if len(plLines.TS)-i <= LiveNumChunks*2 {
-					_, err = fmt.Fprintln(f_live, tss.Line)
+					line := tss.Line
+					if seg != nil {
+						line = seg.lines(&liveKey)
+						if !livePDT && liveSince != nil && len(ranges) > 0 {
+							line = "#EXT-X-PROGRAM-DATE-TIME:" + liveSince.UTC().Format("2006-01-02T15:04:05.000Z") + "\n" + line
+							livePDT = true
+						}
+					}
+					_, err = fmt.Fprintln(f_live, line)
 					if err != nil {
 						errC <- err
 						return
@@ -204,12 +334,33 @@ func (p *Playlist) Refresh(livePath, plType string, startTs *time.Time, outputPl
 				}
 
 			}
+
+			// EXT-X-DATERANGE допустим в любом месте плейлиста с EXT-X-PROGRAM-DATE-TIME
+			for _, tag := range dateRangeTags(ranges, liveSince) {
+				fmt.Fprintln(f_live, tag)
+			}
+			if startTs != nil && !startTs.IsZero() {
+				for _, tag := range dateRangeTags(ranges, dvrSince) {
+					fmt.Fprintln(f_dvr, tag)
+				}
+			}
 		}(&wg, pl)
 	}
 
 	wg.Wait()
 	close(errC)
 
+	outputs := []string{}
+	for _, pl := range plsToParse {
+		outputs = append(outputs, outputPlaylistPrefix+pl)
+		if startTs != nil && !startTs.IsZero() {
+			outputs = append(outputs, fmt.Sprintf("%s%d-%s", outputPlaylistPrefix, startTs.Unix(), pl))
+		}
+	}
+	if err := p.updateIFrames(livePath, outputs); err != nil {
+		level.Error(p.logger).Log("updateIFrames", livePath, "err", err)
+	}
+
 	select {
 	case err, ok := <-errC:
 		if ok {
@@ -239,7 +390,16 @@ func (p *Playlist) timeFromTS(TSfilename string) (*time.Time, error) {
 }
 
 func (p *Playlist) Stop(livePath string, outputPlaylistPrefix string, startTs *time.Time) error {
-	for _, pl := range playlistTypes {
+	outputs := []string{}
+	for _, pl := range p.variants(livePath) {
+		// вариант мог так и не появиться, тогда его выходного плейлиста нет
+		if _, err := os.Stat(path.Join(livePath, outputPlaylistPrefix+pl)); err != nil {
+			continue
+		}
+		outputs = append(outputs, outputPlaylistPrefix+pl)
+		if startTs != nil && !startTs.IsZero() {
+			outputs = append(outputs, fmt.Sprintf("%s%d-%s", outputPlaylistPrefix, startTs.Unix(), pl))
+		}
 		appendStr := []byte("#EXT-X-ENDLIST\n")
 		f, err := os.OpenFile(path.Join(livePath, outputPlaylistPrefix+pl), os.O_APPEND|os.O_WRONLY, 0666)
 		if err != nil {
@@ -266,77 +426,57 @@ func (p *Playlist) Stop(livePath string, outputPlaylistPrefix string, startTs *t
 		}
 
 	}
-	return nil
+	return p.updateIFrames(livePath, outputs)
 }
 
+// Create ждет появления сегментов вариантов и пишет мастер-плейлист. Если за
+// waitTime готовы не все варианты, мастер пишется из готовых и переписывается
+// по мере появления отставших в течение lateWaitTime
 func (p *Playlist) Create(livePath string, outputPlaylistPrefix string, startTs *time.Time) error {
-	plInfoC := make(chan map[string]*mediaInfo)
-	plInfo := make(map[string]*mediaInfo)
-
-	tcanel := time.After(PL_WaitTime)
-	done := make(chan bool)
-
 	if startTs != nil && !startTs.IsZero() {
 		outputPlaylistPrefix = fmt.Sprintf("%s%d-", outputPlaylistPrefix, startTs.Unix())
 	}
 
-	for _, item := range playlistTypes {
-		go func(item string) {
-			t := time.NewTicker(PL_RetryTime)
-			defer func() {
-				t.Stop()
-			}()
-
-			plInfo := make(map[string]*mediaInfo)
-			for {
-				plLines, err := getTSName(path.Join(livePath, item))
-				if err == nil {
-					for _, ts := range plLines.TS {
-						if !ts.TS {
-							continue
-						}
-						// if _, err := os.Stat(path.Join(livePath, ts.Line)); err == nil {
-						plInfo[outputPlaylistPrefix+item] = &mediaInfo{} // данные временно не нужны
-						plInfoC <- plInfo
-						return
-						// }
-					}
+	ready := p.waitRenditions(livePath, p.waitTime, nil)
+	if len(ready) == 0 {
+		level.Debug(p.logger).Log("waitRenditions", livePath, "err", ErrOperationTimedout)
+		return ErrOperationTimedout
+	}
+
+	if err := p.writeMaster(livePath, outputPlaylistPrefix); err != nil {
+		level.Error(p.logger).Log("ERROR gen master playlist %s", err)
+		return err
+	}
+
+	if expected := len(p.ladderPlaylists(livePath)); len(ready) < expected {
+		level.Info(p.logger).Log("partialMaster", livePath, "ready", strings.Join(ready, ","))
+		go func() {
+			written := len(ready)
+			late := p.waitRenditions(livePath, p.lateWaitTime, func(now []string) {
+				if len(now) <= written {
+					return
 				}
-				select {
-				case _, ok := <-done:
-					if !ok {
-						return
-					}
-				case <-t.C:
-					continue
+				written = len(now)
+				if err := p.writeMaster(livePath, outputPlaylistPrefix); err != nil {
+					level.Error(p.logger).Log("ERROR gen master playlist %s", err)
 				}
+			})
+			if len(late) < expected {
+				level.Error(p.logger).Log("partialMaster", livePath, "missing", expected-len(late))
 			}
-		}(item)
+		}()
 	}
 
-	for _, item := range playlistTypes {
-		select {
-		case <-tcanel:
-			level.Debug(p.logger).Log("getmediaInfo", item)
-			return ErrOperationTimedout
-		case inf := <-plInfoC:
-			for k, v := range inf {
-				plInfo[k] = v
-			}
-		}
-	}
+	return nil
+}
 
+func (p *Playlist) writeMaster(livePath, outputPlaylistPrefix string) error {
 	plsToParse := []string{}
-	for _, item := range playlistTypes {
+	for _, item := range p.variants(livePath) {
 		plsToParse = append(plsToParse, outputPlaylistPrefix+item)
 	}
 	level.Debug(p.logger).Log("genMasterPlaylistfor", fmt.Sprintf("%+v", plsToParse))
-	if err := p.genMasterPlaylist(outputPlaylistPrefix+"index", plsToParse, livePath); err != nil {
-		level.Error(p.logger).Log("ERROR gen master playlist %s", err)
-		return err
-	}
-
-	return nil
+	return p.genMasterPlaylist(outputPlaylistPrefix+"index", plsToParse, livePath)
 }
 
 func getMediaInfo(filePath string) (*mediaInfo, error) {
@@ -404,18 +544,6 @@ func getTSName(filePath string) (pl *PLstruct, err error) {
 }
 
 func (p *Playlist) genMasterPlaylist(key string, info []string, pl string) error {
-	buf := bytes.NewBufferString("#EXTM3U\n") //#EXT-X-VERSION:3\n")
-	for _, v := range info {
-		if strings.Contains(v, "low") {
-			buf.WriteString(`#EXT-X-STREAM-INF:BANDWIDTH=1100000,RESOLUTION=852x480,FRAME-RATE=25.000,CODECS="avc1.4d0028,mp4a.40.2",CLOSED-CAPTIONS=NONE` + "\n")
-		} else if strings.Contains(v, "mid") {
-			buf.WriteString(`#EXT-X-STREAM-INF:BANDWIDTH=2200000,RESOLUTION=1280x720,FRAME-RATE=25.000,CODECS="avc1.4d0028,mp4a.40.2",CLOSED-CAPTIONS=NONE` + "\n")
-		} else if strings.Contains(v, "high") {
-			buf.WriteString(`#EXT-X-STREAM-INF:BANDWIDTH=6500000,RESOLUTION=1920x1080,FRAME-RATE=25.000,CODECS="avc1.4d0028,mp4a.40.2",CLOSED-CAPTIONS=NONE` + "\n")
-		}
-		buf.WriteString(fmt.Sprintf("%s\n", v))
-	}
-
 	masterPlaylistName := fmt.Sprintf("%s.m3u8", key)
 
 	f, err := os.OpenFile(path.Join(pl, masterPlaylistName), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
@@ -425,7 +553,7 @@ func (p *Playlist) genMasterPlaylist(key string, info []string, pl string) error
 
 	defer f.Close()
 
-	_, err = f.Write(buf.Bytes())
+	_, err = f.Write(p.masterPlaylist(info, pl))
 	if err != nil {
 		return err
 	}
@@ -433,6 +561,30 @@ func (p *Playlist) genMasterPlaylist(key string, info []string, pl string) error
 	return err
 }
 
+func (p *Playlist) masterPlaylist(info []string, pl string) []byte {
+	buf := bytes.NewBufferString("#EXTM3U\n") //#EXT-X-VERSION:3\n")
+	subsMedia, subsAttr := p.subtitleMedia(pl)
+	buf.WriteString(subsMedia)
+	ladder := p.ladder(pl)
+	for _, v := range info {
+		if r, ok := rendition(ladder, v); ok {
+			buf.WriteString(r.streamInf(subsAttr) + "\n")
+		} else if strings.HasSuffix(v, AudioPlaylist) {
+			buf.WriteString(`#EXT-X-STREAM-INF:BANDWIDTH=96000,CODECS="mp4a.40.2"` + subsAttr + "\n")
+		} else {
+			continue
+		}
+		buf.WriteString(fmt.Sprintf("%s\n", v))
+	}
+	for _, v := range info {
+		if r, ok := rendition(ladder, v); ok && p.hasIFrames(pl, r) {
+			buf.WriteString(r.iframeStreamInf(IFramePlaylistName(v)) + "\n")
+		}
+	}
+
+	return buf.Bytes()
+}
+
 func (p *Playlist) Delete(filePath string) error {
 	re := regexp.MustCompile(`[a-fA-F0-9]{8}-[a-fA-F0-9]{4}-[a-fA-F0-9]{4}-[a-fA-F0-9]{4}-[a-fA-F0-9]{12}`)
 	if !re.Match([]byte(filePath)) {
@@ -442,5 +594,7 @@ func (p *Playlist) Delete(filePath string) error {
 	if err := os.RemoveAll(filePath); err != nil {
 		return err
 	}
+	p.iframes.remove(filePath)
+	p.origin.remove(filePath)
 	return nil
 }
@@ -0,0 +1,458 @@
+package playlist
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+const (
+	AudioSource   = "low.m3u8"   // плейлист SRS, из сегментов которого извлекается звук
+	AudioPlaylist = "audio.m3u8" // производный плейлист только со звуком
+	audioPrefix   = "audio-"
+	iframesSuffix = "-iframes.m3u8"
+)
+
+// iframe - положение ключевого кадра внутри TS сегмента
+type iframe struct {
+	Offset int64
+	Length int64
+	PTS    int64
+}
+
+type segmentIFrames struct {
+	frames   []iframe
+	startPTS int64
+}
+
+// iframeIndex кэширует найденные ключевые кадры сегментов, чтобы не разбирать
+// TS при каждом обновлении плейлистов
+type iframeIndex struct {
+	sync.Mutex
+	segments map[string]*segmentIFrames
+}
+
+func (x *iframeIndex) get(livePath, uri string) (*segmentIFrames, bool) {
+	key := path.Join(livePath, path.Base(uri))
+
+	x.Lock()
+	defer x.Unlock()
+	if seg, ok := x.segments[key]; ok {
+		return seg, seg != nil
+	}
+	if x.segments == nil {
+		x.segments = map[string]*segmentIFrames{}
+	}
+
+	var seg *segmentIFrames
+	if !strings.Contains(uri, "://") {
+		if data, err := os.ReadFile(key); err == nil {
+			if frames, start, err := probeIFrames(data); err == nil && len(frames) > 0 {
+				seg = &segmentIFrames{frames: frames, startPTS: start}
+			}
+		} else if os.IsNotExist(err) {
+			// файл может появиться позже, отсутствие не кэшируем
+			return nil, false
+		}
+	}
+	x.segments[key] = seg
+	return seg, seg != nil
+}
+
+func (x *iframeIndex) remove(livePath string) {
+	x.Lock()
+	defer x.Unlock()
+	for key := range x.segments {
+		if strings.HasPrefix(key, livePath+"/") {
+			delete(x.segments, key)
+		}
+	}
+}
+
+func audioSegmentName(name string) string {
+	return audioPrefix + strings.TrimPrefix(name, strings.TrimSuffix(AudioSource, ".m3u8")+"-")
+}
+
+func IFramePlaylistName(name string) string {
+	return strings.TrimSuffix(name, ".m3u8") + iframesSuffix
+}
+
+// variants возвращает уже созданные исходные плейлисты стрима: видео-варианты
+// SRS и производный звуковой
+func (p *Playlist) variants(livePath string) []string {
+	variants := []string{}
+	for _, item := range append(p.ladderPlaylists(livePath), AudioPlaylist) {
+		if _, err := os.Stat(path.Join(livePath, item)); err == nil {
+			variants = append(variants, item)
+		}
+	}
+	return variants
+}
+
+// ExtractAudio сохраняет звуковую дорожку нового сегмента AudioSource в отдельный
+// TS и обновляет AudioPlaylist. Вызывается до шифрования сегмента.
+// Возвращает путь созданного сегмента
+func (p *Playlist) ExtractAudio(livePath, segment string) (string, error) {
+	name := path.Base(segment)
+	data, err := os.ReadFile(path.Join(livePath, name))
+	if err != nil {
+		return "", err
+	}
+	audio, err := audioOnlyTS(data)
+	if err != nil {
+		return "", err
+	}
+
+	audioPath := path.Join(livePath, audioSegmentName(name))
+	if err := writeFileAtomic(audioPath, audio); err != nil {
+		return "", err
+	}
+
+	return audioPath, p.mirrorAudioPlaylist(livePath)
+}
+
+// mirrorAudioPlaylist повторяет AudioSource с заменой сегментов на звуковые.
+// Сегменты без звуковой копии пропускаются с пометкой разрыва
+func (p *Playlist) mirrorAudioPlaylist(livePath string) error {
+	src, err := getTSName(path.Join(livePath, AudioSource))
+	if err != nil {
+		return err
+	}
+
+	buf := bytes.NewBuffer(nil)
+	for _, line := range src.Header {
+		buf.WriteString(line.Line + "\n")
+	}
+	pending := []string{}
+	gap, written := false, 0
+	for _, line := range src.TS {
+		if !line.TS {
+			pending = append(pending, line.Line)
+			continue
+		}
+		audioName := audioSegmentName(line.Line)
+		if _, err := os.Stat(path.Join(livePath, audioName)); err != nil {
+			pending = pending[:0]
+			gap = true
+			continue
+		}
+		if gap && written > 0 {
+			buf.WriteString("#EXT-X-DISCONTINUITY\n")
+		}
+		for _, l := range pending {
+			buf.WriteString(l + "\n")
+		}
+		buf.WriteString(audioName + "\n")
+		pending = pending[:0]
+		gap = false
+		written++
+	}
+	for _, l := range pending {
+		buf.WriteString(l + "\n")
+	}
+
+	return writeFileAtomic(path.Join(livePath, AudioPlaylist), buf.Bytes())
+}
+
+// updateIFrames перестраивает I-frame плейлисты для выходных видео-плейлистов
+func (p *Playlist) updateIFrames(livePath string, outputs []string) error {
+	for _, out := range outputs {
+		if strings.HasSuffix(out, AudioPlaylist) {
+			continue
+		}
+		if err := p.writeIFramePlaylist(livePath, path.Join(livePath, out)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeIFramePlaylist строит EXT-X-I-FRAMES-ONLY плейлист по медиа-плейлисту:
+// каждому ключевому кадру соответствует EXT-X-BYTERANGE внутри сегмента.
+// Зашифрованные целиком сегменты не поддерживают выборку по диапазону и пропускаются
+func (p *Playlist) writeIFramePlaylist(livePath, file string) error {
+	pl, err := readMediaPlaylist(file)
+	if err != nil {
+		return err
+	}
+	return writeMediaPlaylist(IFramePlaylistName(file), p.iframePlaylist(livePath, pl))
+}
+
+// hasIFrames сообщает, найдутся ли для I-frame плейлиста варианта сегменты.
+// Зашифрованные сегменты не разбираются, как и в iframePlaylist
+func (p *Playlist) hasIFrames(livePath string, r Rendition) bool {
+	pl, err := readMediaPlaylist(path.Join(livePath, r.Name+".m3u8"))
+	if err != nil {
+		return false
+	}
+	for _, seg := range pl.Segments {
+		if p.applyHooks(livePath, seg.URI).Key != "" {
+			continue
+		}
+		if _, ok := p.iframes.get(livePath, seg.URI); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// iframePlaylist строит I-frame плейлист по медиа-плейлисту варианта
+func (p *Playlist) iframePlaylist(livePath string, pl *mediaPlaylist) *mediaPlaylist {
+	out := &mediaPlaylist{Header: []string{"#EXTM3U", "#EXT-X-VERSION:4"}, Trailer: pl.Trailer}
+	for _, line := range pl.Header {
+		for _, tag := range []string{"#EXT-X-MEDIA-SEQUENCE", "#EXT-X-DISCONTINUITY-SEQUENCE", "#EXT-X-PLAYLIST-TYPE", "#EXT-X-PROGRAM-DATE-TIME"} {
+			if strings.HasPrefix(line, tag) {
+				out.Header = append(out.Header, line)
+			}
+		}
+	}
+
+	encrypted, gap := false, false
+	maxDuration := 0.0
+	for _, seg := range pl.Segments {
+		discontinuity := false
+		for _, tag := range seg.Tags {
+			if strings.HasPrefix(tag, "#EXT-X-KEY:") {
+				encrypted = !strings.Contains(tag, "METHOD=NONE")
+			}
+			if strings.HasPrefix(tag, "#EXT-X-DISCONTINUITY") {
+				discontinuity = true
+			}
+		}
+		if encrypted {
+			gap = true
+			continue
+		}
+		index, ok := p.iframes.get(livePath, seg.URI)
+		if !ok {
+			gap = true
+			continue
+		}
+
+		for i, f := range index.frames {
+			start := float64(f.PTS-index.startPTS) / tsPtsClock
+			end := seg.Duration
+			if i+1 < len(index.frames) {
+				end = float64(index.frames[i+1].PTS-index.startPTS) / tsPtsClock
+			}
+			duration := math.Max(end-start, 0.001)
+			if duration > maxDuration {
+				maxDuration = duration
+			}
+
+			tags := []string{}
+			if i == 0 && (discontinuity || gap) && len(out.Segments) > 0 {
+				tags = append(tags, "#EXT-X-DISCONTINUITY")
+			}
+			tags = append(tags, formatExtInf("", duration), fmt.Sprintf("#EXT-X-BYTERANGE:%d@%d", f.Length, f.Offset))
+			out.Segments = append(out.Segments, mediaSegment{Tags: tags, Duration: duration, URI: seg.URI})
+		}
+		gap = false
+	}
+
+	target := int(math.Ceil(maxDuration))
+	if target < 1 {
+		target = 1
+	}
+	out.Header = append(out.Header, fmt.Sprintf("#EXT-X-TARGETDURATION:%d", target), "#EXT-X-I-FRAMES-ONLY")
+
+	return out
+}
+
+// audioOnlyTS оставляет в TS только PAT, звуковую дорожку и PMT без видео
+func audioOnlyTS(data []byte) ([]byte, error) {
+	if len(data) == 0 || len(data)%tsPacketSize != 0 {
+		return nil, ErrTSTruncated
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)/4))
+	pmtPID := -1
+	var audioPID uint16
+	var pmt []byte
+	cc := byte(0)
+
+	for off := 0; off < len(data); off += tsPacketSize {
+		pkt := data[off : off+tsPacketSize]
+		if pkt[0] != tsSyncByte {
+			return nil, ErrTSNoSync
+		}
+		pid, pusi, payload := tsPayload(pkt)
+
+		switch {
+		case pid == 0:
+			out.Write(pkt)
+			if pusi && payload != nil {
+				if p := parsePAT(payload); p > 0 {
+					pmtPID = p
+				}
+			}
+		case int(pid) == pmtPID:
+			if !pusi || payload == nil {
+				continue
+			}
+			if section, audio := audioPMT(payload); section != nil {
+				pmt, audioPID = section, audio
+			}
+			if pmt != nil {
+				out.Write(psiPacket(pid, pmt, cc))
+				cc = (cc + 1) & 0x0f
+			}
+		case audioPID != 0 && pid == audioPID:
+			out.Write(pkt)
+		}
+	}
+
+	if audioPID == 0 {
+		return nil, ErrTSNoProgram
+	}
+	return out.Bytes(), nil
+}
+
+// audioPMT пересобирает PMT с единственной звуковой дорожкой, PCR переносится на нее
+func audioPMT(payload []byte) ([]byte, uint16) {
+	section := psiSection(payload)
+	if section == nil || section[0] != 0x02 || len(section) < 12 {
+		return nil, 0
+	}
+	infoLen := int(section[10]&0x0f)<<8 | int(section[11])
+	for i := 12 + infoLen; i+5 <= len(section); {
+		streamType := section[i]
+		pid := uint16(section[i+1]&0x1f)<<8 | uint16(section[i+2])
+		esLen := int(section[i+3]&0x0f)<<8 | int(section[i+4])
+		if i+5+esLen > len(section) {
+			return nil, 0
+		}
+		switch streamType {
+		case 0x03, 0x04, 0x0f, 0x11, 0x81:
+			pmt := []byte{0x02, 0, 0, section[3], section[4], section[5], 0x00, 0x00,
+				0xe0 | byte(pid>>8), byte(pid), 0xf0, 0x00}
+			pmt = append(pmt, section[i:i+5+esLen]...)
+			length := len(pmt) - 3 + 4
+			pmt[1] = 0xb0 | byte(length>>8)&0x0f
+			pmt[2] = byte(length)
+			crc := crc32MPEG(pmt)
+			return append(pmt, byte(crc>>24), byte(crc>>16), byte(crc>>8), byte(crc)), pid
+		}
+		i += 5 + esLen
+	}
+	return nil, 0
+}
+
+func psiPacket(pid uint16, section []byte, cc byte) []byte {
+	pkt := bytes.Repeat([]byte{0xff}, tsPacketSize)
+	pkt[0] = tsSyncByte
+	pkt[1] = 0x40 | byte(pid>>8)&0x1f
+	pkt[2] = byte(pid)
+	pkt[3] = 0x10 | cc
+	pkt[4] = 0
+	copy(pkt[5:], section)
+	return pkt
+}
+
+func crc32MPEG(data []byte) uint32 {
+	crc := uint32(0xffffffff)
+	for _, b := range data {
+		crc ^= uint32(b) << 24
+		for i := 0; i < 8; i++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// probeIFrames находит ключевые кадры видео: PES с random_access_indicator
+// или с IDR NAL-блоком H.264. Первый кадр захватывает PAT/PMT в начале сегмента
+func probeIFrames(data []byte) ([]iframe, int64, error) {
+	if len(data) == 0 || len(data)%tsPacketSize != 0 {
+		return nil, 0, ErrTSTruncated
+	}
+
+	frames := []iframe{}
+	pmtPID := -1
+	var videoPID uint16
+	startPTS := int64(-1)
+	current := -1
+
+	closeFrame := func(end int) {
+		if current >= 0 {
+			frames[current].Length = int64(end) - frames[current].Offset
+			current = -1
+		}
+	}
+
+	for off := 0; off < len(data); off += tsPacketSize {
+		pkt := data[off : off+tsPacketSize]
+		if pkt[0] != tsSyncByte {
+			return nil, 0, ErrTSNoSync
+		}
+		pid, pusi, payload := tsPayload(pkt)
+		if payload == nil || !pusi {
+			continue
+		}
+
+		switch {
+		case pid == 0:
+			if p := parsePAT(payload); p > 0 {
+				pmtPID = p
+			}
+		case int(pid) == pmtPID:
+			if video, _ := parsePMT(payload); video > 0 && videoPID == 0 {
+				videoPID = video
+			}
+		case videoPID != 0 && pid == videoPID:
+			closeFrame(off)
+			pts, ok := parsePESPTS(payload)
+			if !ok {
+				continue
+			}
+			if startPTS < 0 {
+				startPTS = pts
+			}
+			if !randomAccess(pkt) && !containsIDR(payload) {
+				continue
+			}
+			offset := int64(off)
+			if len(frames) == 0 && pts == startPTS {
+				offset = 0
+			}
+			frames = append(frames, iframe{Offset: offset, PTS: pts})
+			current = len(frames) - 1
+		}
+	}
+	closeFrame(len(data))
+
+	if videoPID == 0 {
+		return nil, 0, ErrTSNoProgram
+	}
+	return frames, startPTS, nil
+}
+
+func randomAccess(pkt []byte) bool {
+	return pkt[3]&0x20 != 0 && pkt[4] > 0 && pkt[5]&0x40 != 0
+}
+
+func containsIDR(pes []byte) bool {
+	if len(pes) < 9 {
+		return false
+	}
+	es := pes[9:]
+	if hdr := int(pes[8]); hdr < len(es) {
+		es = es[hdr:]
+	} else {
+		return false
+	}
+	for i := 0; i+3 < len(es); i++ {
+		if es[i] == 0 && es[i+1] == 0 && es[i+2] == 1 && es[i+3]&0x1f == 5 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package playlist
+
+import (
+	"testing"
+)
+
+// makeAVTS собирает TS с видео и звуком: на каждый кадр по PES-пакету видео
+// и звука, IDR каждые gop кадров
+func makeAVTS(frames, gop int) []byte {
+	packet := func(pid uint16, payload []byte) []byte {
+		pkt := make([]byte, tsPacketSize)
+		pkt[0] = tsSyncByte
+		pkt[1] = 0x40 | byte(pid>>8)
+		pkt[2] = byte(pid)
+		pkt[3] = 0x10
+		for i := copy(pkt[4:], payload) + 4; i < tsPacketSize; i++ {
+			pkt[i] = 0xff
+		}
+		return pkt
+	}
+	pes := func(streamID byte, pts int64, es ...byte) []byte {
+		return append([]byte{0, 0, 1, streamID, 0, 0, 0x80, 0x80, 5,
+			byte(0x21 | (pts>>29)&0x0e), byte(pts >> 22), byte(0x01 | (pts>>14)&0xfe), byte(pts >> 7), byte(0x01 | (pts<<1)&0xfe)}, es...)
+	}
+
+	data := makeTS(0)
+	for i := 0; i < frames; i++ {
+		pts := int64(i) * 3600
+		nal := byte(0x41)
+		if i%gop == 0 {
+			nal = 0x65
+		}
+		data = append(data, packet(0x100, pes(0xe0, pts, 0, 0, 0, 1, 0x09, 0xf0, 0, 0, 0, 1, nal))...)
+		data = append(data, packet(0x101, pes(0xc0, pts))...)
+	}
+	return data
+}
+
+func TestAudioOnlyTS(t *testing.T) {
+	audio, err := audioOnlyTS(makeAVTS(50, 25))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := 2+50, len(audio)/tsPacketSize; want != have {
+		t.Errorf("want %d packets, have %d", want, have)
+	}
+
+	info, err := probeTS(audio)
+	if err != nil {
+		t.Fatalf("probeTS: %v", err)
+	}
+	if info.VideoPID != 0 || info.AudioPID != 0x101 {
+		t.Errorf("wrong pids: video %#x audio %#x", info.VideoPID, info.AudioPID)
+	}
+	if info.Duration < 1.99 || info.Duration > 2.01 {
+		t.Errorf("want duration 2s, have %f", info.Duration)
+	}
+
+	pmt := audio[tsPacketSize+5:]
+	length := int(pmt[1]&0x0f)<<8 | int(pmt[2])
+	if crc32MPEG(pmt[:3+length]) != 0 {
+		t.Error("PMT CRC mismatch")
+	}
+}
+
+func TestProbeIFrames(t *testing.T) {
+	data := makeAVTS(50, 25)
+	frames, start, err := probeIFrames(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 2 || start != 0 {
+		t.Fatalf("want 2 I-frames from pts 0, have %+v start %d", frames, start)
+	}
+
+	// PAT, PMT, затем пары видео/звук
+	first, second := frames[0], frames[1]
+	if first.Offset != 0 || first.Length != 4*tsPacketSize {
+		t.Errorf("unexpected first I-frame %+v", first)
+	}
+	if second.Offset != int64(2+25*2)*tsPacketSize || second.Length != 2*tsPacketSize || second.PTS != 25*3600 {
+		t.Errorf("unexpected second I-frame %+v", second)
+	}
+}
@@ -0,0 +1,290 @@
+package playlist
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SubtitleSegmentDuration = 10
+	subtitleGroup           = "subs"
+)
+
+var (
+	ErrVTTMalformed = errors.New("VTT_MALFORMED")
+)
+
+// SubtitleTrack описывает дорожку субтитров для EXT-X-MEDIA в мастер-плейлисте
+type SubtitleTrack struct {
+	Language string
+	Name     string
+	Default  bool
+}
+
+// Cue - реплика субтитров, время в секундах от начала трансляции
+type Cue struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Text  string  `json:"text"`
+}
+
+// SubtitleSource возвращает дорожки субтитров стрима для мастер-плейлиста
+type SubtitleSource func(livePath string) []SubtitleTrack
+
+func (p *Playlist) SetSubtitleSource(src SubtitleSource) {
+	p.subtitles = src
+}
+
+func (p *Playlist) subtitleTracks(livePath string) []SubtitleTrack {
+	if p.subtitles == nil {
+		return nil
+	}
+	return p.subtitles(livePath)
+}
+
+func SubtitlePlaylistName(language string) string {
+	return fmt.Sprintf("subs-%s.m3u8", language)
+}
+
+func subtitleSegmentName(language string, n int) string {
+	return fmt.Sprintf("subs-%s-%d.vtt", language, n)
+}
+
+// ParseWebVTT разбирает реплики WebVTT файла. Блоки NOTE, STYLE и REGION
+// и настройки отображения реплик отбрасываются
+func ParseWebVTT(data []byte) ([]Cue, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	if !sc.Scan() || !strings.HasPrefix(sc.Text(), "WEBVTT") {
+		return nil, ErrVTTMalformed
+	}
+
+	cues := []Cue{}
+	block := []string{}
+	flush := func() error {
+		defer func() { block = block[:0] }()
+		if len(block) == 0 {
+			return nil
+		}
+		i := 0
+		if !strings.Contains(block[0], "-->") {
+			i = 1
+		}
+		if i >= len(block) || !strings.Contains(block[i], "-->") {
+			// NOTE, STYLE, REGION или заголовок
+			return nil
+		}
+		timing := strings.Fields(block[i])
+		if len(timing) < 3 || timing[1] != "-->" {
+			return ErrVTTMalformed
+		}
+		start, err := parseVTTTime(timing[0])
+		if err != nil {
+			return err
+		}
+		end, err := parseVTTTime(timing[2])
+		if err != nil {
+			return err
+		}
+		if end < start {
+			return ErrVTTMalformed
+		}
+		cues = append(cues, Cue{Start: start, End: end, Text: strings.Join(block[i+1:], "\n")})
+		return nil
+	}
+
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if line == "" {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		block = append(block, line)
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	return cues, nil
+}
+
+// parseVTTTime разбирает метку времени вида [hh:]mm:ss.ttt
+func parseVTTTime(ts string) (float64, error) {
+	parts := strings.Split(ts, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, ErrVTTMalformed
+	}
+	secs, err := strconv.ParseFloat(parts[len(parts)-1], 64)
+	if err != nil {
+		return 0, ErrVTTMalformed
+	}
+	mult := 60.0
+	for i := len(parts) - 2; i >= 0; i-- {
+		v, err := strconv.Atoi(parts[i])
+		if err != nil {
+			return 0, ErrVTTMalformed
+		}
+		secs += float64(v) * mult
+		mult *= 60
+	}
+	return secs, nil
+}
+
+func formatVTTTime(secs float64) string {
+	ms := int64(math.Round(secs * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// WriteSubtitles режет реплики на WebVTT сегменты по SubtitleSegmentDuration секунд
+// и пишет медиа-плейлист дорожки. Сегменты, закончившиеся раньше since, не
+// перезаписываются, если уже есть на диске. До final в плейлист попадают только
+// полностью прошедшие сегменты, после final добавляется EXT-X-ENDLIST.
+// startPTS связывает нулевое время реплик с PTS видео через X-TIMESTAMP-MAP
+func (p *Playlist) WriteSubtitles(livePath string, track SubtitleTrack, cues []Cue, duration, since float64, startPTS int64, final bool) error {
+	segCount := int(duration / SubtitleSegmentDuration)
+	if final {
+		segCount = int(math.Ceil(duration / SubtitleSegmentDuration))
+	}
+
+	pl := bytes.NewBufferString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	fmt.Fprintf(pl, "#EXT-X-TARGETDURATION:%d\n#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:EVENT\n", SubtitleSegmentDuration)
+
+	for n := 0; n < segCount; n++ {
+		segStart := float64(n * SubtitleSegmentDuration)
+		segEnd := math.Min(segStart+SubtitleSegmentDuration, duration)
+		name := subtitleSegmentName(track.Language, n)
+
+		if _, err := os.Stat(path.Join(livePath, name)); err != nil || segEnd > since {
+			if err := writeFileAtomic(path.Join(livePath, name), vttSegment(cues, segStart, segEnd, startPTS)); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(pl, "%s\n%s\n", formatExtInf("", segEnd-segStart), name)
+	}
+	if final {
+		pl.WriteString("#EXT-X-ENDLIST\n")
+	}
+
+	return writeFileAtomic(path.Join(livePath, SubtitlePlaylistName(track.Language)), pl.Bytes())
+}
+
+// vttSegment собирает сегмент из реплик, пересекающих интервал [start, end)
+func vttSegment(cues []Cue, start, end float64, startPTS int64) []byte {
+	buf := bytes.NewBufferString("WEBVTT\n")
+	fmt.Fprintf(buf, "X-TIMESTAMP-MAP=MPEGTS:%d,LOCAL:00:00:00.000\n", startPTS)
+	for _, c := range cues {
+		if c.End <= start || c.Start >= end {
+			continue
+		}
+		fmt.Fprintf(buf, "\n%s --> %s\n%s\n", formatVTTTime(c.Start), formatVTTTime(c.End), c.Text)
+	}
+	return buf.Bytes()
+}
+
+// RemoveSubtitles удаляет плейлист и сегменты дорожки
+func (p *Playlist) RemoveSubtitles(livePath, language string) error {
+	files, err := filepath.Glob(path.Join(livePath, fmt.Sprintf("subs-%s-*.vtt", language)))
+	if err != nil {
+		return err
+	}
+	files = append(files, path.Join(livePath, SubtitlePlaylistName(language)))
+	for _, file := range files {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// SessionStartPTS возвращает PTS первого сегмента трансляции, начатой в startTs
+func (p *Playlist) SessionStartPTS(livePath string, startTs *time.Time) (int64, error) {
+	plLines, err := getTSName(path.Join(livePath, playlistTypes[0]))
+	if err != nil {
+		return 0, err
+	}
+	for _, tss := range plLines.TS {
+		if !tss.TS {
+			continue
+		}
+		if startTs != nil && !startTs.IsZero() {
+			tsTime, err := p.timeFromTS(tss.Line)
+			if err != nil || !tsTime.After(*startTs) {
+				continue
+			}
+		}
+		info, err := probeTSFile(path.Join(livePath, tss.Line))
+		if err != nil {
+			return 0, err
+		}
+		return info.StartPTS, nil
+	}
+	return 0, ErrTSNoPTS
+}
+
+// SegmentStartPTS возвращает PTS первого кадра сегмента
+func SegmentStartPTS(file string) (int64, error) {
+	info, err := probeTSFile(file)
+	if err != nil {
+		return 0, err
+	}
+	return info.StartPTS, nil
+}
+
+// RefreshMasters перегенерирует мастер-плейлисты каталога, например после
+// изменения набора дорожек субтитров
+func (p *Playlist) RefreshMasters(livePath string) error {
+	files, err := filepath.Glob(path.Join(livePath, "*index.m3u8"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		key := strings.TrimSuffix(path.Base(file), ".m3u8")
+		prefix := strings.TrimSuffix(key, "index")
+		info := []string{}
+		for _, item := range p.variants(livePath) {
+			info = append(info, prefix+item)
+		}
+		if err := p.genMasterPlaylist(key, info, livePath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Playlist) subtitleMedia(livePath string) (string, string) {
+	tracks := p.subtitleTracks(livePath)
+	if len(tracks) == 0 {
+		return "", ""
+	}
+	media := ""
+	for _, t := range tracks {
+		// дорожка без своего плейлиста (стрим еще не начат) в мастер не попадает
+		if _, err := os.Stat(path.Join(livePath, SubtitlePlaylistName(t.Language))); err != nil {
+			continue
+		}
+		def := "NO"
+		if t.Default {
+			def = "YES"
+		}
+		media += fmt.Sprintf("#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID=\"%s\",NAME=\"%s\",LANGUAGE=\"%s\",DEFAULT=%s,AUTOSELECT=YES,URI=\"%s\"\n",
+			subtitleGroup, t.Name, t.Language, def, SubtitlePlaylistName(t.Language))
+	}
+	if media == "" {
+		return "", ""
+	}
+	return media, fmt.Sprintf(`,SUBTITLES="%s"`, subtitleGroup)
+}
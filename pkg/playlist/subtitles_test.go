@@ -0,0 +1,81 @@
+package playlist
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+const testVTT = "WEBVTT - test\n\nNOTE comment\n\n1\n00:00:01.000 --> 00:00:04.500 line:0\nHello\nworld\n\n00:09.000 --> 00:12.000\nAcross segments\n"
+
+func TestParseWebVTT(t *testing.T) {
+	cues, err := ParseWebVTT([]byte(testVTT))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Cue{{1, 4.5, "Hello\nworld"}, {9, 12, "Across segments"}}
+	if len(cues) != len(want) {
+		t.Fatalf("want %d cues, have %d", len(want), len(cues))
+	}
+	for i := range want {
+		if cues[i] != want[i] {
+			t.Errorf("cue %d: want %+v, have %+v", i, want[i], cues[i])
+		}
+	}
+
+	if _, err := ParseWebVTT([]byte("1\n00:01.000 --> 00:02.000\nx\n")); err != ErrVTTMalformed {
+		t.Errorf("want %v, have %v", ErrVTTMalformed, err)
+	}
+}
+
+func TestWriteSubtitles(t *testing.T) {
+	dir := t.TempDir()
+	cues, _ := ParseWebVTT([]byte(testVTT))
+	track := SubtitleTrack{Language: "en", Name: "English"}
+
+	if err := New().WriteSubtitles(dir, track, cues, 15, 0, 900000, false); err != nil {
+		t.Fatal(err)
+	}
+	pl, _ := os.ReadFile(path.Join(dir, SubtitlePlaylistName("en")))
+	if strings.Count(string(pl), "#EXTINF") != 1 || strings.Contains(string(pl), "#EXT-X-ENDLIST") {
+		t.Errorf("live playlist must contain only complete segments:\n%s", pl)
+	}
+
+	if err := New().WriteSubtitles(dir, track, cues, 15, 10, 900000, true); err != nil {
+		t.Fatal(err)
+	}
+	pl, _ = os.ReadFile(path.Join(dir, SubtitlePlaylistName("en")))
+	if !strings.Contains(string(pl), "#EXTINF:5.000,\nsubs-en-1.vtt\n#EXT-X-ENDLIST") {
+		t.Errorf("unexpected final playlist:\n%s", pl)
+	}
+
+	seg, _ := os.ReadFile(path.Join(dir, "subs-en-1.vtt"))
+	if !strings.Contains(string(seg), "X-TIMESTAMP-MAP=MPEGTS:900000,LOCAL:00:00:00.000") ||
+		!strings.Contains(string(seg), "00:00:09.000 --> 00:00:12.000\nAcross segments") ||
+		strings.Contains(string(seg), "Hello") {
+		t.Errorf("unexpected segment:\n%s", seg)
+	}
+}
+
+// TestSubtitleMediaWritten: мастер ссылается только на записанные плейлисты субтитров
+func TestSubtitleMediaWritten(t *testing.T) {
+	dir := t.TempDir()
+	p := New()
+	p.SetSubtitleSource(func(string) []SubtitleTrack {
+		return []SubtitleTrack{{Language: "en", Name: "English", Default: true}, {Language: "ru", Name: "Русский"}}
+	})
+
+	if media, attr := p.subtitleMedia(dir); media != "" || attr != "" {
+		t.Errorf("want no subtitles before segmentation, have %q %q", media, attr)
+	}
+
+	cues, _ := ParseWebVTT([]byte(testVTT))
+	if err := p.WriteSubtitles(dir, SubtitleTrack{Language: "en", Name: "English"}, cues, 15, 0, 900000, false); err != nil {
+		t.Fatal(err)
+	}
+	media, attr := p.subtitleMedia(dir)
+	if !strings.Contains(media, `URI="subs-en.m3u8"`) || strings.Contains(media, "subs-ru") || attr != `,SUBTITLES="subs"` {
+		t.Errorf("want only the written track, have %q %q", media, attr)
+	}
+}
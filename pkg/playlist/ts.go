@@ -0,0 +1,222 @@
+package playlist
+
+import (
+	"errors"
+	"os"
+)
+
+const (
+	tsPacketSize = 188
+	tsSyncByte   = 0x47
+	tsPtsClock   = 90000
+	tsPtsWrap    = int64(1) << 33
+)
+
+var (
+	ErrTSTruncated = errors.New("TS_TRUNCATED")
+	ErrTSNoSync    = errors.New("TS_NO_SYNC")
+	ErrTSNoProgram = errors.New("TS_NO_PROGRAM")
+	ErrTSNoPTS     = errors.New("TS_NO_PTS")
+)
+
+// tsInfo описывает содержимое MPEG-TS сегмента
+type tsInfo struct {
+	Packets  int
+	VideoPID uint16
+	AudioPID uint16
+	Duration float64
+	StartPTS int64
+}
+
+type ptsTrack struct {
+	last, min, max int64
+	count          int
+	wrapped        bool
+}
+
+func (t *ptsTrack) add(pts int64) {
+	if t.count > 0 && pts < t.last && t.last-pts > tsPtsWrap/2 {
+		t.wrapped = true
+	}
+	if t.wrapped && pts < tsPtsWrap/2 {
+		pts += tsPtsWrap
+	}
+	if t.count == 0 || pts < t.min {
+		t.min = pts
+	}
+	if t.count == 0 || pts > t.max {
+		t.max = pts
+	}
+	t.last = pts
+	t.count++
+}
+
+// duration возвращает длительность по PTS с учетом длительности последнего кадра
+func (t *ptsTrack) duration() float64 {
+	if t.count < 2 {
+		return 0
+	}
+	span := t.max - t.min
+	return float64(span+span/int64(t.count-1)) / tsPtsClock
+}
+
+func probeTSFile(filePath string) (*tsInfo, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return probeTS(data)
+}
+
+// probeTS разбирает PAT/PMT и PES заголовки и считает длительность сегмента
+func probeTS(data []byte) (*tsInfo, error) {
+	if len(data) == 0 || len(data)%tsPacketSize != 0 {
+		return nil, ErrTSTruncated
+	}
+
+	info := &tsInfo{}
+	pmtPID := -1
+	tracks := map[uint16]*ptsTrack{}
+
+	for off := 0; off < len(data); off += tsPacketSize {
+		pkt := data[off : off+tsPacketSize]
+		if pkt[0] != tsSyncByte {
+			return nil, ErrTSNoSync
+		}
+		info.Packets++
+
+		pid, pusi, payload := tsPayload(pkt)
+		if payload == nil || !pusi {
+			continue
+		}
+
+		switch {
+		case pid == 0:
+			if p := parsePAT(payload); p > 0 {
+				pmtPID = p
+			}
+		case int(pid) == pmtPID:
+			video, audio := parsePMT(payload)
+			if video > 0 && info.VideoPID == 0 {
+				info.VideoPID = video
+			}
+			if audio > 0 && info.AudioPID == 0 {
+				info.AudioPID = audio
+			}
+		case pid == info.VideoPID || pid == info.AudioPID:
+			pts, ok := parsePESPTS(payload)
+			if !ok {
+				continue
+			}
+			if _, ok := tracks[pid]; !ok {
+				tracks[pid] = &ptsTrack{}
+			}
+			tracks[pid].add(pts)
+		}
+	}
+
+	if pmtPID < 0 || (info.VideoPID == 0 && info.AudioPID == 0) {
+		return nil, ErrTSNoProgram
+	}
+
+	track, ok := tracks[info.VideoPID]
+	if !ok || info.VideoPID == 0 {
+		track, ok = tracks[info.AudioPID]
+	}
+	if !ok {
+		return nil, ErrTSNoPTS
+	}
+	info.Duration = track.duration()
+	info.StartPTS = track.min % tsPtsWrap
+
+	return info, nil
+}
+
+// tsPayload возвращает PID, флаг payload_unit_start и полезную нагрузку пакета
+func tsPayload(pkt []byte) (uint16, bool, []byte) {
+	pid := uint16(pkt[1]&0x1f)<<8 | uint16(pkt[2])
+	pusi := pkt[1]&0x40 != 0
+	afc := (pkt[3] >> 4) & 0x3
+
+	start := 4
+	if afc&0x2 != 0 {
+		start += 1 + int(pkt[4])
+	}
+	if afc&0x1 == 0 || start >= len(pkt) {
+		return pid, pusi, nil
+	}
+	return pid, pusi, pkt[start:]
+}
+
+// psiSection пропускает pointer_field и возвращает секцию без CRC
+func psiSection(payload []byte) []byte {
+	if len(payload) < 1 {
+		return nil
+	}
+	start := 1 + int(payload[0])
+	if start+3 > len(payload) {
+		return nil
+	}
+	section := payload[start:]
+	length := int(section[1]&0x0f)<<8 | int(section[2])
+	if length < 9 || 3+length > len(section) {
+		return nil
+	}
+	return section[:3+length-4]
+}
+
+func parsePAT(payload []byte) int {
+	section := psiSection(payload)
+	if section == nil || section[0] != 0x00 {
+		return -1
+	}
+	for i := 8; i+4 <= len(section); i += 4 {
+		program := int(section[i])<<8 | int(section[i+1])
+		if program == 0 {
+			continue
+		}
+		return int(section[i+2]&0x1f)<<8 | int(section[i+3])
+	}
+	return -1
+}
+
+func parsePMT(payload []byte) (video, audio uint16) {
+	section := psiSection(payload)
+	if section == nil || section[0] != 0x02 || len(section) < 12 {
+		return 0, 0
+	}
+	infoLen := int(section[10]&0x0f)<<8 | int(section[11])
+	for i := 12 + infoLen; i+5 <= len(section); {
+		streamType := section[i]
+		pid := uint16(section[i+1]&0x1f)<<8 | uint16(section[i+2])
+		esLen := int(section[i+3]&0x0f)<<8 | int(section[i+4])
+		switch streamType {
+		case 0x01, 0x02, 0x10, 0x1b, 0x24:
+			if video == 0 {
+				video = pid
+			}
+		case 0x03, 0x04, 0x0f, 0x11, 0x81:
+			if audio == 0 {
+				audio = pid
+			}
+		}
+		i += 5 + esLen
+	}
+	return video, audio
+}
+
+func parsePESPTS(payload []byte) (int64, bool) {
+	if len(payload) < 14 || payload[0] != 0 || payload[1] != 0 || payload[2] != 1 {
+		return 0, false
+	}
+	if payload[7]&0x80 == 0 {
+		return 0, false
+	}
+	p := payload[9:14]
+	pts := int64(p[0]>>1&0x07)<<30 |
+		int64(p[1])<<22 |
+		int64(p[2]>>1)<<15 |
+		int64(p[3])<<7 |
+		int64(p[4]>>1)
+	return pts, true
+}
@@ -0,0 +1,372 @@
+package playlist
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// допустимое расхождение EXTINF и фактической длительности сегмента, сек
+	VerifyDurationTolerance = 0.5
+)
+
+var (
+	ErrSegmentMissing    = errors.New("SEGMENT_MISSING")
+	ErrSegmentEmpty      = errors.New("SEGMENT_EMPTY")
+	ErrSegmentDuration   = errors.New("SEGMENT_DURATION_MISMATCH")
+	ErrSegmentCipher     = errors.New("SEGMENT_CIPHER_SIZE")
+	ErrNoMediaPlaylists  = errors.New("NO_MEDIA_PLAYLISTS")
+	ErrPlaylistMalformed = errors.New("PLAYLIST_MALFORMED")
+)
+
+type mediaSegment struct {
+	Tags     []string
+	Duration float64
+	URI      string
+}
+
+type mediaPlaylist struct {
+	Header   []string
+	Segments []mediaSegment
+	Trailer  []string
+}
+
+type SegmentReport struct {
+	URI      string  `json:"uri"`
+	Duration float64 `json:"duration"`
+	Actual   float64 `json:"actual,omitempty"`
+	Problem  string  `json:"problem"`
+}
+
+type PlaylistReport struct {
+	Name     string          `json:"name"`
+	Segments int             `json:"segments"`
+	Broken   []SegmentReport `json:"broken,omitempty"`
+	Repaired bool            `json:"repaired"`
+	Error    string          `json:"error,omitempty"`
+}
+
+type VerifyReport struct {
+	Path      string           `json:"path"`
+	Segments  int              `json:"segments"`
+	Broken    int              `json:"broken"`
+	Playlists []PlaylistReport `json:"playlists"`
+}
+
+// Verify проверяет все медиа-плейлисты в каталоге стрима: наличие сегментов,
+// их размер, корректность MPEG-TS и соответствие длительности EXTINF.
+// При repair=true плейлисты перезаписываются без битых сегментов,
+// а на месте разрывов ставится #EXT-X-DISCONTINUITY
+func (p *Playlist) Verify(livePath string, repair bool) (*VerifyReport, error) {
+	files, err := filepath.Glob(path.Join(livePath, "*.m3u8"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	report := &VerifyReport{Path: livePath}
+	probed := map[string]segmentCheck{}
+
+	for _, file := range files {
+		pl, err := readMediaPlaylist(file)
+		if err != nil {
+			if err != ErrPlaylistMalformed {
+				report.Playlists = append(report.Playlists, PlaylistReport{Name: path.Base(file), Error: err.Error()})
+			}
+			continue
+		}
+
+		// в I-frame плейлистах EXTINF описывает кадр, а не сегмент целиком
+		iframesOnly := false
+		for _, line := range pl.Header {
+			if strings.HasPrefix(line, "#EXT-X-I-FRAMES-ONLY") {
+				iframesOnly = true
+			}
+		}
+
+		plReport := PlaylistReport{Name: path.Base(file), Segments: len(pl.Segments)}
+		checks := make([]segmentCheck, len(pl.Segments))
+		encrypted := false
+		for i, seg := range pl.Segments {
+			for _, tag := range seg.Tags {
+				if strings.HasPrefix(tag, "#EXT-X-KEY:") {
+					encrypted = !strings.Contains(tag, "METHOD=NONE")
+				}
+			}
+			check, ok := probed[seg.URI]
+			if !ok {
+				check = checkSegment(livePath, seg.URI, encrypted || p.applyHooks(livePath, seg.URI).Key != "")
+				probed[seg.URI] = check
+			}
+			if iframesOnly {
+				check.duration = -1
+			}
+			checks[i] = check
+			if check.err == nil && check.duration >= 0 && math.Abs(check.duration-seg.Duration) > VerifyDurationTolerance {
+				checks[i].mismatch = true
+			}
+			if checks[i].err != nil || checks[i].mismatch {
+				sr := SegmentReport{URI: seg.URI, Duration: seg.Duration, Actual: check.duration}
+				if checks[i].err != nil {
+					sr.Problem = checks[i].err.Error()
+				} else {
+					sr.Problem = ErrSegmentDuration.Error()
+				}
+				plReport.Broken = append(plReport.Broken, sr)
+			}
+		}
+
+		if repair && len(plReport.Broken) > 0 {
+			if err := writeMediaPlaylist(file, repairMediaPlaylist(pl, checks)); err != nil {
+				plReport.Error = err.Error()
+			} else {
+				plReport.Repaired = true
+			}
+		}
+
+		report.Segments += plReport.Segments
+		report.Broken += len(plReport.Broken)
+		report.Playlists = append(report.Playlists, plReport)
+	}
+
+	if len(report.Playlists) == 0 {
+		return report, ErrNoMediaPlaylists
+	}
+
+	return report, nil
+}
+
+type segmentCheck struct {
+	err      error
+	duration float64
+	mismatch bool
+}
+
+func checkSegment(livePath, uri string, encrypted bool) segmentCheck {
+	if strings.Contains(uri, "://") {
+		// сегменты вне локального диска не проверяем
+		return segmentCheck{duration: -1}
+	}
+
+	st, err := os.Stat(path.Join(livePath, uri))
+	if err != nil {
+		return segmentCheck{err: ErrSegmentMissing}
+	}
+	if st.Size() == 0 {
+		return segmentCheck{err: ErrSegmentEmpty}
+	}
+	if encrypted || !strings.HasSuffix(uri, ".ts") {
+		// содержимое зашифрованного сегмента и субтитров не разбираем, проверяем только размер блоков AES
+		if encrypted && st.Size()%16 != 0 {
+			return segmentCheck{err: ErrSegmentCipher}
+		}
+		return segmentCheck{duration: -1}
+	}
+
+	info, err := probeTSFile(path.Join(livePath, uri))
+	if err != nil {
+		return segmentCheck{err: err}
+	}
+	return segmentCheck{duration: info.Duration}
+}
+
+// repairMediaPlaylist убирает битые сегменты и исправляет EXTINF по фактической длительности
+func repairMediaPlaylist(pl *mediaPlaylist, checks []segmentCheck) *mediaPlaylist {
+	fixed := &mediaPlaylist{Header: pl.Header, Trailer: pl.Trailer}
+	gap := false
+	maxDuration := 0.0
+
+	// теги выброшенного сегмента (ключ, DATERANGE и т.п.) действуют и на
+	// следующие, поэтому переносятся на ближайший оставленный сегмент
+	var carried []string
+
+	for i, seg := range pl.Segments {
+		if checks[i].err != nil {
+			gap = true
+			for _, tag := range seg.Tags {
+				// разрыв на месте сегмента ставится ниже по gap
+				if !segmentOnlyTag(tag) && !strings.HasPrefix(tag, "#EXT-X-DISCONTINUITY") {
+					carried = append(carried, tag)
+				}
+			}
+			continue
+		}
+
+		tags := []string{}
+		hasDiscontinuity := false
+		for _, tag := range append(carried, seg.Tags...) {
+			if strings.HasPrefix(tag, "#EXT-X-DISCONTINUITY") {
+				hasDiscontinuity = true
+			}
+			if checks[i].mismatch && checks[i].duration > 0 && strings.HasPrefix(tag, "#EXTINF:") {
+				seg.Duration = checks[i].duration
+				tag = formatExtInf(tag, seg.Duration)
+			}
+			tags = append(tags, tag)
+		}
+		if gap && !hasDiscontinuity && len(fixed.Segments) > 0 {
+			tags = append([]string{"#EXT-X-DISCONTINUITY"}, tags...)
+		}
+		gap = false
+		carried = nil
+
+		if seg.Duration > maxDuration {
+			maxDuration = seg.Duration
+		}
+		seg.Tags = tags
+		fixed.Segments = append(fixed.Segments, seg)
+	}
+
+	target := int(math.Ceil(maxDuration))
+	header := make([]string, 0, len(fixed.Header))
+	for _, line := range fixed.Header {
+		if strings.HasPrefix(line, "#EXT-X-TARGETDURATION:") {
+			current, _ := strconv.Atoi(strings.TrimPrefix(line, "#EXT-X-TARGETDURATION:"))
+			if target > current {
+				line = fmt.Sprintf("#EXT-X-TARGETDURATION:%d", target)
+			}
+		}
+		header = append(header, line)
+	}
+	fixed.Header = header
+
+	return fixed
+}
+
+// segmentOnlyTag - теги, которые относятся только к своему сегменту
+func segmentOnlyTag(tag string) bool {
+	for _, prefix := range []string{"#EXTINF:", "#EXT-X-BYTERANGE:", "#EXT-X-PROGRAM-DATE-TIME:", "#EXT-X-GAP"} {
+		if strings.HasPrefix(tag, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func formatExtInf(tag string, duration float64) string {
+	title := ""
+	if i := strings.Index(tag, ","); i >= 0 {
+		title = tag[i+1:]
+	}
+	return fmt.Sprintf("#EXTINF:%.3f,%s", duration, title)
+}
+
+func readMediaPlaylist(filePath string) (*mediaPlaylist, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parseMediaPlaylist(f)
+}
+
+// parseMediaPlaylist разбирает медиа-плейлист на заголовок, сегменты и завершающие теги.
+// Мастер-плейлисты и файлы без EXTINF возвращают ErrPlaylistMalformed
+func parseMediaPlaylist(r io.Reader) (*mediaPlaylist, error) {
+	pl := &mediaPlaylist{}
+	scanner := bufio.NewScanner(r)
+
+	first := true
+	inSegments := false
+	tags := []string{}
+	duration := 0.0
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if first {
+			if line != "#EXTM3U" {
+				return nil, ErrPlaylistMalformed
+			}
+			first = false
+		}
+		if strings.HasPrefix(line, "#EXT-X-STREAM-INF") {
+			return nil, ErrPlaylistMalformed
+		}
+
+		switch {
+		case strings.HasPrefix(line, "#EXTINF:"):
+			inSegments = true
+			tags = append(tags, line)
+			value := strings.TrimPrefix(line, "#EXTINF:")
+			if i := strings.Index(value, ","); i >= 0 {
+				value = value[:i]
+			}
+			duration, _ = strconv.ParseFloat(value, 64)
+		case strings.HasPrefix(line, "#EXT-X-ENDLIST"):
+			pl.Trailer = append(pl.Trailer, line)
+		case strings.HasPrefix(line, "#"):
+			if !inSegments && !isSegmentTag(line) {
+				pl.Header = append(pl.Header, line)
+			} else {
+				tags = append(tags, line)
+			}
+		default:
+			pl.Segments = append(pl.Segments, mediaSegment{Tags: tags, Duration: duration, URI: line})
+			tags = []string{}
+			duration = 0
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	// теги после последнего сегмента, например EXT-X-DATERANGE
+	pl.Trailer = append(tags, pl.Trailer...)
+	if first || len(pl.Segments) == 0 && !inSegments {
+		return nil, ErrPlaylistMalformed
+	}
+
+	return pl, nil
+}
+
+func isSegmentTag(line string) bool {
+	for _, tag := range []string{"#EXT-X-DISCONTINUITY", "#EXT-X-KEY", "#EXT-X-BYTERANGE", "#EXT-X-DATERANGE"} {
+		if strings.HasPrefix(line, tag) && !strings.HasPrefix(line, "#EXT-X-DISCONTINUITY-SEQUENCE") {
+			return true
+		}
+	}
+	return false
+}
+
+func (pl *mediaPlaylist) bytes() []byte {
+	buf := bytes.NewBuffer(nil)
+	for _, line := range pl.Header {
+		buf.WriteString(line + "\n")
+	}
+	for _, seg := range pl.Segments {
+		for _, tag := range seg.Tags {
+			buf.WriteString(tag + "\n")
+		}
+		buf.WriteString(seg.URI + "\n")
+	}
+	for _, line := range pl.Trailer {
+		buf.WriteString(line + "\n")
+	}
+	return buf.Bytes()
+}
+
+// writeMediaPlaylist записывает плейлист через временный файл, чтобы плеер не увидел его частично
+func writeMediaPlaylist(filePath string, pl *mediaPlaylist) error {
+	return writeFileAtomic(filePath, pl.bytes())
+}
+
+func writeFileAtomic(filePath string, data []byte) error {
+	tmp := filePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filePath)
+}
@@ -0,0 +1,154 @@
+package playlist
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+// makeTS собирает минимальный MPEG-TS: PAT, PMT и по одному PES-пакету на кадр
+func makeTS(frames int) []byte {
+	packet := func(pid uint16, payload []byte) []byte {
+		pkt := make([]byte, tsPacketSize)
+		pkt[0] = tsSyncByte
+		pkt[1] = 0x40 | byte(pid>>8)
+		pkt[2] = byte(pid)
+		pkt[3] = 0x10
+		for i := copy(pkt[4:], payload) + 4; i < tsPacketSize; i++ {
+			pkt[i] = 0xff
+		}
+		return pkt
+	}
+
+	pat := []byte{0x00, 0x00, 0xb0, 0x0d, 0x00, 0x01, 0xc1, 0x00, 0x00, 0x00, 0x01, 0xf0, 0x00, 0, 0, 0, 0}
+	pmt := []byte{0x00, 0x02, 0xb0, 0x17, 0x00, 0x01, 0xc1, 0x00, 0x00, 0xe1, 0x00, 0xf0, 0x00,
+		0x1b, 0xe1, 0x00, 0xf0, 0x00,
+		0x0f, 0xe1, 0x01, 0xf0, 0x00,
+		0, 0, 0, 0}
+
+	data := append(packet(0, pat), packet(0x1000, pmt)...)
+	for i := 0; i < frames; i++ {
+		pts := int64(i) * 3600
+		pes := []byte{0, 0, 1, 0xe0, 0, 0, 0x80, 0x80, 5,
+			byte(0x21 | (pts>>29)&0x0e), byte(pts >> 22), byte(0x01 | (pts>>14)&0xfe), byte(pts >> 7), byte(0x01 | (pts<<1)&0xfe)}
+		data = append(data, packet(0x100, pes)...)
+	}
+	return data
+}
+
+func TestProbeTS(t *testing.T) {
+	info, err := probeTS(makeTS(50))
+	if err != nil {
+		t.Fatalf("probeTS: %v", err)
+	}
+	if info.VideoPID != 0x100 || info.AudioPID != 0x101 {
+		t.Errorf("wrong pids: video %#x audio %#x", info.VideoPID, info.AudioPID)
+	}
+	if info.Duration < 1.99 || info.Duration > 2.01 {
+		t.Errorf("want duration 2s, have %f", info.Duration)
+	}
+
+	if _, err := probeTS(makeTS(50)[:500]); err != ErrTSTruncated {
+		t.Errorf("want %v, have %v", ErrTSTruncated, err)
+	}
+}
+
+func TestVerifyRepair(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(path.Join(dir, "low-1.ts"), makeTS(50), 0666)
+	os.WriteFile(path.Join(dir, "low-2.ts"), []byte{}, 0666)
+	os.WriteFile(path.Join(dir, "low-4.ts"), makeTS(100), 0666)
+	os.WriteFile(path.Join(dir, "low.m3u8"), []byte(`#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-TARGETDURATION:2
+#EXTINF:2.000, no desc
+low-1.ts
+#EXTINF:2.000, no desc
+low-2.ts
+#EXTINF:2.000, no desc
+low-3.ts
+#EXTINF:2.000, no desc
+low-4.ts
+`), 0666)
+
+	p := New()
+	report, err := p.Verify(dir, true)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if report.Segments != 4 || report.Broken != 3 {
+		t.Fatalf("want 4 segments and 3 broken, have %+v", report)
+	}
+
+	problems := []string{}
+	for _, seg := range report.Playlists[0].Broken {
+		problems = append(problems, seg.Problem)
+	}
+	if want, have := "SEGMENT_EMPTY SEGMENT_MISSING SEGMENT_DURATION_MISMATCH", strings.Join(problems, " "); want != have {
+		t.Errorf("want problems %q, have %q", want, have)
+	}
+
+	data, _ := os.ReadFile(path.Join(dir, "low.m3u8"))
+	want := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-TARGETDURATION:4
+#EXTINF:2.000, no desc
+low-1.ts
+#EXT-X-DISCONTINUITY
+#EXTINF:4.000, no desc
+low-4.ts
+`
+	if string(data) != want {
+		t.Errorf("\nwant playlist\n%s\nhave\n%s", want, data)
+	}
+}
+
+// TestRepairKeepsTags: ключ и DATERANGE выброшенного сегмента переходят
+// к следующему, иначе он расшифровывается чужим ключом
+func TestRepairKeepsTags(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(path.Join(dir, "low-1.ts"), makeTS(50), 0666)
+	os.WriteFile(path.Join(dir, "low-3.ts"), make([]byte, 32), 0666)
+	os.WriteFile(path.Join(dir, "low.m3u8"), []byte(`#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-TARGETDURATION:2
+#EXTINF:2.000, no desc
+low-1.ts
+#EXT-X-KEY:METHOD=AES-128,URI="key/1"
+#EXT-X-DATERANGE:ID="ad",START-DATE="2024-01-01T00:00:02Z"
+#EXT-X-PROGRAM-DATE-TIME:2024-01-01T00:00:02Z
+#EXTINF:2.000, no desc
+low-2.ts
+#EXTINF:2.000, no desc
+low-3.ts
+`), 0666)
+
+	report, err := New().Verify(dir, true)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if report.Broken != 1 || !report.Playlists[0].Repaired {
+		t.Fatalf("want 1 broken segment repaired, have %+v", report)
+	}
+
+	data, _ := os.ReadFile(path.Join(dir, "low.m3u8"))
+	want := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-TARGETDURATION:2
+#EXTINF:2.000, no desc
+low-1.ts
+#EXT-X-DISCONTINUITY
+#EXT-X-KEY:METHOD=AES-128,URI="key/1"
+#EXT-X-DATERANGE:ID="ad",START-DATE="2024-01-01T00:00:02Z"
+#EXTINF:2.000, no desc
+low-3.ts
+`
+	if string(data) != want {
+		t.Errorf("\nwant playlist\n%s\nhave\n%s", want, data)
+	}
+}
@@ -0,0 +1,108 @@
+package playlist
+
+import (
+	"path"
+	"time"
+
+	"github.com/go-kit/log/level"
+)
+
+// dirWatcher сообщает об изменениях в каталоге стрима. События не несут
+// подробностей: получатель сам перечитывает нужные плейлисты
+type dirWatcher struct {
+	events chan struct{}
+	close  func() error
+}
+
+func (w *dirWatcher) Events() <-chan struct{} {
+	return w.events
+}
+
+func (w *dirWatcher) Close() error {
+	return w.close()
+}
+
+func (w *dirWatcher) notify() {
+	select {
+	case w.events <- struct{}{}:
+	default:
+	}
+}
+
+// pollWatcher - запасной вариант на случай, если события файловой системы недоступны
+func pollWatcher(interval time.Duration) *dirWatcher {
+	t := time.NewTicker(interval)
+	done := make(chan struct{})
+	w := &dirWatcher{events: make(chan struct{}, 1)}
+	w.close = func() error {
+		t.Stop()
+		close(done)
+		return nil
+	}
+	go func() {
+		for {
+			select {
+			case <-t.C:
+				w.notify()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return w
+}
+
+// SetWaitTimes задает, сколько Create ждет появления сегментов всех вариантов
+// до записи мастер-плейлиста, и сколько затем ждет отставшие варианты
+func (p *Playlist) SetWaitTimes(wait, lateWait time.Duration) {
+	p.waitTime = wait
+	p.lateWaitTime = lateWait
+}
+
+// readyRenditions возвращает варианты SRS, в плейлистах которых уже есть сегменты
+func (p *Playlist) readyRenditions(livePath string) []string {
+	ready := []string{}
+	for _, item := range p.ladderPlaylists(livePath) {
+		plLines, err := getTSName(path.Join(livePath, item))
+		if err != nil {
+			continue
+		}
+		for _, ts := range plLines.TS {
+			if ts.TS {
+				ready = append(ready, item)
+				break
+			}
+		}
+	}
+	return ready
+}
+
+// waitRenditions ждет сегменты всех вариантов не дольше budget и возвращает готовые.
+// grown, если задан, получает готовые варианты после каждого изменения каталога
+func (p *Playlist) waitRenditions(livePath string, budget time.Duration, grown func(ready []string)) []string {
+	deadline := time.NewTimer(budget)
+	defer deadline.Stop()
+
+	w, err := watchDir(livePath)
+	if err != nil {
+		level.Error(p.logger).Log("watchDir", livePath, "err", err)
+		w = pollWatcher(PL_RetryTime)
+	}
+	defer w.Close()
+
+	expected := len(p.ladderPlaylists(livePath))
+	for {
+		ready := p.readyRenditions(livePath)
+		if grown != nil {
+			grown(ready)
+		}
+		if len(ready) == expected {
+			return ready
+		}
+		select {
+		case <-deadline.C:
+			return ready
+		case <-w.Events():
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package playlist
+
+import (
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_CREATE
+
+// watchDir подписывается на inotify события каталога. Если каталога еще нет
+// (SRS создает его с первым сегментом), наблюдение начинается с родителя
+func watchDir(dir string) (*dirWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_NONBLOCK | syscall.IN_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	// неблокирующий дескриптор обслуживается поллером рантайма, Close прерывает Read
+	f := os.NewFile(uintptr(fd), "inotify")
+
+	var mu sync.Mutex
+	dirWd, parentWd := -1, -1
+	addDir := func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		if dirWd >= 0 {
+			return nil
+		}
+		wd, err := syscall.InotifyAddWatch(fd, dir, inotifyMask)
+		if err == nil {
+			dirWd = wd
+		}
+		return err
+	}
+
+	rescan := false
+	if err := addDir(); err != nil {
+		if err != syscall.ENOENT {
+			f.Close()
+			return nil, err
+		}
+		if parentWd, err = syscall.InotifyAddWatch(fd, path.Dir(dir), syscall.IN_CREATE|syscall.IN_MOVED_TO); err != nil {
+			f.Close()
+			return nil, err
+		}
+		// каталог мог появиться до подписки на родителя, тогда события о нем не будет
+		rescan = addDir() == nil
+	}
+
+	w := &dirWatcher{events: make(chan struct{}, 1), close: f.Close}
+	if rescan {
+		w.notify()
+	}
+	go func() {
+		buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+		for {
+			n, err := f.Read(buf)
+			if err != nil {
+				return
+			}
+			for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+				ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+				nameBytes := buf[off+syscall.SizeofInotifyEvent : off+syscall.SizeofInotifyEvent+int(ev.Len)]
+				off += syscall.SizeofInotifyEvent + int(ev.Len)
+
+				if int(ev.Wd) == parentWd {
+					name := strings.TrimRight(string(nameBytes), "\x00")
+					if name != path.Base(dir) || addDir() != nil {
+						continue
+					}
+				}
+				w.notify()
+			}
+		}
+	}()
+
+	return w, nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package playlist
+
+// watchDir вне Linux опрашивает каталог с интервалом PL_RetryTime
+func watchDir(dir string) (*dirWatcher, error) {
+	return pollWatcher(PL_RetryTime), nil
+}
@@ -0,0 +1,122 @@
+package playlist
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeRendition(t *testing.T, dir, name string) {
+	pl := "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:2\n#EXTINF:2.000,\n" + strings.TrimSuffix(name, ".m3u8") + "-1600000000-0.ts\n"
+	if err := os.WriteFile(path.Join(dir, name), []byte(pl), 0666); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCreatePartialMaster(t *testing.T) {
+	dir := t.TempDir()
+	writeRendition(t, dir, "low.m3u8")
+
+	p := New()
+	p.SetWaitTimes(200*time.Millisecond, 5*time.Second)
+	if err := p.Create(dir, "out-", nil); err != nil {
+		t.Fatal(err)
+	}
+	master, _ := os.ReadFile(path.Join(dir, "out-index.m3u8"))
+	if !strings.Contains(string(master), "out-low.m3u8") || strings.Contains(string(master), "out-mid.m3u8") {
+		t.Fatalf("want partial master with low only:\n%s", master)
+	}
+
+	// отставшие варианты добавляются по событию каталога
+	writeRendition(t, dir, "mid.m3u8")
+	writeRendition(t, dir, "high.m3u8")
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		master, _ = os.ReadFile(path.Join(dir, "out-index.m3u8"))
+		if strings.Contains(string(master), "out-mid.m3u8") && strings.Contains(string(master), "out-high.m3u8") {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Errorf("late renditions not added to master:\n%s", master)
+}
+
+// waitMaster ждет, пока мастер-плейлист не будет ссылаться на все варианты names
+func waitMaster(t *testing.T, dir string, within time.Duration, names ...string) bool {
+	t.Helper()
+	deadline := time.Now().Add(within)
+	for time.Now().Before(deadline) {
+		master, _ := os.ReadFile(path.Join(dir, "out-index.m3u8"))
+		found := 0
+		for _, name := range names {
+			if strings.Contains(string(master), name) {
+				found++
+			}
+		}
+		if found == len(names) {
+			return true
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return false
+}
+
+// TestCreateRemasterEachRendition: каждый отставший вариант попадает в мастер
+// сразу, не дожидаясь остальных вариантов или конца lateWaitTime
+func TestCreateRemasterEachRendition(t *testing.T) {
+	dir := t.TempDir()
+	writeRendition(t, dir, "low.m3u8")
+
+	p := New()
+	p.SetWaitTimes(100*time.Millisecond, 10*time.Second)
+	if err := p.Create(dir, "out-", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	writeRendition(t, dir, "mid.m3u8")
+	if !waitMaster(t, dir, 2*time.Second, "out-low.m3u8", "out-mid.m3u8") {
+		t.Fatal("mid is not added to master while high is missing")
+	}
+	writeRendition(t, dir, "high.m3u8")
+	if !waitMaster(t, dir, 2*time.Second, "out-low.m3u8", "out-mid.m3u8", "out-high.m3u8") {
+		t.Fatal("high is not added to master")
+	}
+}
+
+func TestCreateTimeout(t *testing.T) {
+	p := New()
+	p.SetWaitTimes(100*time.Millisecond, time.Second)
+	if err := p.Create(path.Join(t.TempDir(), "missing"), "out-", nil); err != ErrOperationTimedout {
+		t.Errorf("want %v, have %v", ErrOperationTimedout, err)
+	}
+}
+
+// TestWatchCreatedDir: каталог стрима, созданный после начала ожидания,
+// отслеживается так же, как существующий
+func TestWatchCreatedDir(t *testing.T) {
+	dir := path.Join(t.TempDir(), "stream")
+	w, err := watchDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeRendition(t, dir, "low.m3u8")
+
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case <-w.Events():
+			if _, err := os.Stat(path.Join(dir, "low.m3u8")); err == nil {
+				return
+			}
+		case <-deadline:
+			t.Fatal("no event for the created directory")
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Package relay запускает долгоживущие процессы (ffmpeg) и перезапускает их
+// с нарастающей задержкой, пока они не остановлены явно
+package relay
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	StatusIdle         = "idle"
+	StatusRunning      = "running"
+	StatusReconnecting = "reconnecting"
+)
+
+// Stats - состояние процесса и статистика перезапусков
+type Stats struct {
+	Status     string     `json:"status"`
+	Restarts   int        `json:"restarts"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	LastExitAt *time.Time `json:"lastExitAt,omitempty"`
+	LastError  string     `json:"lastError,omitempty"`
+}
+
+type Supervisor struct {
+	Command     string
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+	StableAfter time.Duration // после такой работы задержка перезапуска сбрасывается
+
+	mu    sync.Mutex
+	procs map[string]*process
+}
+
+type process struct {
+	args    []string
+	secrets []string
+	cancel  context.CancelFunc
+	done    chan struct{}
+	stats   Stats
+}
+
+func New(command string) *Supervisor {
+	return &Supervisor{
+		Command:     command,
+		MinBackoff:  time.Second,
+		MaxBackoff:  time.Minute,
+		StableAfter: 30 * time.Second,
+		procs:       map[string]*process{},
+	}
+}
+
+// Start запускает процесс id. Уже запущенный с теми же аргументами процесс
+// не перезапускается, с другими - заменяется. Значения secrets (ключи,
+// пароли) вырезаются из сохраненной причины завершения
+func (s *Supervisor) Start(id string, args []string, secrets ...string) {
+	s.mu.Lock()
+	prev, ok := s.procs[id]
+	if ok && reflect.DeepEqual(prev.args, args) {
+		s.mu.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &process{args: args, secrets: secrets, cancel: cancel, done: make(chan struct{}), stats: Stats{Status: StatusReconnecting}}
+	s.procs[id] = p
+	s.mu.Unlock()
+
+	// прежний процесс останавливается вне блокировки, новый стартует после него
+	if ok {
+		prev.cancel()
+		<-prev.done
+	}
+	go s.run(ctx, p)
+}
+
+// Stop останавливает процесс id и ждет его завершения
+func (s *Supervisor) Stop(id string) {
+	s.mu.Lock()
+	p, ok := s.procs[id]
+	delete(s.procs, id)
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+	p.cancel()
+	<-p.done
+}
+
+// Stats возвращает состояние процесса id, не запущенный - StatusIdle
+func (s *Supervisor) Stats(id string) Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p, ok := s.procs[id]; ok {
+		return p.stats
+	}
+	return Stats{Status: StatusIdle}
+}
+
+func (s *Supervisor) run(ctx context.Context, p *process) {
+	defer close(p.done)
+	backoff := s.MinBackoff
+	for {
+		cmd := exec.CommandContext(ctx, s.Command, p.args...)
+		stderr := &tail{}
+		cmd.Stderr = stderr
+
+		started := time.Now()
+		err := cmd.Start()
+		if err == nil {
+			s.update(p, func(st *Stats) {
+				st.Status = StatusRunning
+				st.StartedAt = &started
+			})
+			err = cmd.Wait()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		exited := time.Now()
+		if exited.Sub(started) >= s.StableAfter {
+			backoff = s.MinBackoff
+		}
+		s.update(p, func(st *Stats) {
+			st.Status = StatusReconnecting
+			st.Restarts++
+			st.LastExitAt = &exited
+			st.LastError = stderr.lastLine()
+			if st.LastError == "" && err != nil {
+				st.LastError = err.Error()
+			}
+			st.LastError = p.scrub(st.LastError)
+		})
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > s.MaxBackoff {
+			backoff = s.MaxBackoff
+		}
+	}
+}
+
+// scrub заменяет секреты в выводе процесса, ffmpeg печатает адреса целиком
+func (p *process) scrub(line string) string {
+	for _, secret := range p.secrets {
+		if secret != "" {
+			line = strings.ReplaceAll(line, secret, "****")
+		}
+	}
+	return line
+}
+
+func (s *Supervisor) update(p *process, fn func(*Stats)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(&p.stats)
+}
+
+const tailSize = 4096
+
+// tail хранит конец вывода процесса для причины завершения
+type tail struct {
+	buf []byte
+}
+
+func (t *tail) Write(b []byte) (int, error) {
+	t.buf = append(t.buf, b...)
+	if len(t.buf) > tailSize {
+		t.buf = t.buf[len(t.buf)-tailSize:]
+	}
+	return len(b), nil
+}
+
+func (t *tail) lastLine() string {
+	lines := strings.Split(string(bytes.TrimSpace(t.buf)), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
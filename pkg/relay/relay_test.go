@@ -0,0 +1,112 @@
+package relay
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func waitStats(t *testing.T, s *Supervisor, id string, ok func(Stats) bool) Stats {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		st := s.Stats(id)
+		if ok(st) {
+			return st
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected stats %+v", st)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRestart(t *testing.T) {
+	s := New("sh")
+	s.MinBackoff, s.MaxBackoff = time.Millisecond, 5*time.Millisecond
+
+	s.Start("fail", []string{"-c", "echo connection refused >&2; exit 1"})
+	st := waitStats(t, s, "fail", func(st Stats) bool { return st.Restarts >= 3 })
+	if st.LastError != "connection refused" || st.LastExitAt == nil {
+		t.Errorf("unexpected stats %+v", st)
+	}
+	s.Stop("fail")
+	if st := s.Stats("fail"); st.Status != StatusIdle {
+		t.Errorf("want %s, have %+v", StatusIdle, st)
+	}
+}
+
+func TestStartStop(t *testing.T) {
+	s := New("sleep")
+	s.Start("a", []string{"10"})
+	st := waitStats(t, s, "a", func(st Stats) bool { return st.Status == StatusRunning })
+	if st.Restarts != 0 || st.StartedAt == nil {
+		t.Errorf("unexpected stats %+v", st)
+	}
+
+	// повторный запуск с теми же аргументами не перезапускает процесс
+	s.Start("a", []string{"10"})
+	if again := s.Stats("a"); again.StartedAt != st.StartedAt {
+		t.Errorf("process is restarted: %+v", again)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.Stop("a")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop does not kill the process")
+	}
+}
+
+func TestScrubSecrets(t *testing.T) {
+	s := New("sh")
+	s.MinBackoff, s.MaxBackoff = time.Millisecond, 5*time.Millisecond
+
+	s.Start("fwd", []string{"-c", "echo rtmp://a.rtmp.example.com/live2/abcd-1234-key: Input/output error >&2; exit 1"}, "abcd-1234-key", "")
+	st := waitStats(t, s, "fwd", func(st Stats) bool { return st.Restarts >= 1 })
+	s.Stop("fwd")
+	if want := "rtmp://a.rtmp.example.com/live2/****: Input/output error"; st.LastError != want {
+		t.Errorf("want %q, have %q", want, st.LastError)
+	}
+}
+
+// TestConcurrentStart: при одновременных запусках с разными аргументами
+// после Stop не остается работающих процессов
+func TestConcurrentStart(t *testing.T) {
+	dir := t.TempDir()
+	s := New("sh")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s.Start("a", []string{"-c", fmt.Sprintf("echo $$ > %s/%d; exec sleep 10", dir, i)})
+		}(i)
+	}
+	wg.Wait()
+	waitStats(t, s, "a", func(st Stats) bool { return st.Status == StatusRunning })
+	s.Stop("a")
+
+	files, _ := os.ReadDir(dir)
+	for _, f := range files {
+		b, _ := os.ReadFile(filepath.Join(dir, f.Name()))
+		pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+		if err != nil {
+			continue
+		}
+		if syscall.Kill(pid, 0) == nil {
+			syscall.Kill(pid, syscall.SIGKILL)
+			t.Errorf("process %s is still running", f.Name())
+		}
+	}
+}
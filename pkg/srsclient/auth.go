@@ -0,0 +1,77 @@
+package srsclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+)
+
+var ErrTLSConfig = errors.New("SRS_TLS_CONFIG_INVALID")
+
+// Auth - учетные данные SRS API: Basic при User, иначе Bearer при Token
+type Auth struct {
+	User     string
+	Password string
+	Token    string
+}
+
+func (a Auth) apply(req *http.Request) {
+	switch {
+	case a.User != "":
+		req.SetBasicAuth(a.User, a.Password)
+	case a.Token != "":
+		req.Header.Set("Authorization", "Bearer "+a.Token)
+	}
+}
+
+// TLSOptions - проверка сертификата SRS API и клиентский сертификат.
+// Без CAFile сертификат проверяется по системным корневым сертификатам
+type TLSOptions struct {
+	CAFile   string
+	CertFile string
+	KeyFile  string
+	// Insecure отключает проверку сертификата SRS
+	Insecure bool
+}
+
+// Config собирает tls.Config из файлов сертификатов
+func (o TLSOptions) Config() (*tls.Config, error) {
+	cfg := &tls.Config{InsecureSkipVerify: o.Insecure}
+	if o.CAFile != "" {
+		pem, err := ioutil.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrTLSConfig, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%w: no certificates in %s", ErrTLSConfig, o.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if o.CertFile != "" || o.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrTLSConfig, err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// httpClient - общий для всех endpoints клиент с таймаутами соединения
+func (o Options) httpClient() *http.Client {
+	dialer := &net.Dialer{Timeout: o.DialTimeout, KeepAlive: 30 * time.Second}
+	return &http.Client{Transport: &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         dialer.DialContext,
+		TLSClientConfig:     o.TLSConfig,
+		TLSHandshakeTimeout: o.TLSHandshakeTimeout,
+		MaxIdleConnsPerHost: 4,
+		IdleConnTimeout:     90 * time.Second,
+	}}
+}
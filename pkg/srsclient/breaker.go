@@ -0,0 +1,163 @@
+package srsclient
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// Options - таймауты, повторы, размыкатель и доступ к SRS API
+type Options struct {
+	Timeout          time.Duration // на одну попытку
+	Retries          int           // повторы после первой попытки при ErrUnreachable
+	RetryBackoff     time.Duration // пауза перед первым повтором, далее удваивается
+	BreakerThreshold int           // ошибок подряд до размыкания, 0 - без размыкателя
+	BreakerCooldown  time.Duration
+
+	DialTimeout         time.Duration // 0 - без отдельного таймаута соединения
+	TLSHandshakeTimeout time.Duration
+	// TLSConfig - настройки TLS для https, nil - проверка по системным сертификатам
+	TLSConfig *tls.Config
+	Auth      Auth
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Timeout:             5 * time.Second,
+		Retries:             2,
+		RetryBackoff:        200 * time.Millisecond,
+		BreakerThreshold:    5,
+		BreakerCooldown:     30 * time.Second,
+		DialTimeout:         3 * time.Second,
+		TLSHandshakeTimeout: 3 * time.Second,
+	}
+}
+
+// Breaker размыкается после Threshold недоступностей SRS подряд и
+// отклоняет запросы Cooldown, затем пропускает пробный запрос
+type Breaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	trial    bool
+	now      func() time.Time
+}
+
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{Threshold: threshold, Cooldown: cooldown, state: BreakerClosed, now: time.Now}
+}
+
+// Allow разрешает запрос или возвращает ErrCircuitOpen
+func (b *Breaker) Allow() error {
+	if b.Threshold <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.Cooldown {
+			return ErrCircuitOpen
+		}
+		b.state = BreakerHalfOpen
+		b.trial = true
+	case BreakerHalfOpen:
+		// пока идет пробный запрос, остальные отклоняются
+		if b.trial {
+			return ErrCircuitOpen
+		}
+		b.trial = true
+	}
+	return nil
+}
+
+// Record учитывает результат запроса. Любой ответ SRS, в том числе с
+// ошибкой, замыкает размыкатель
+func (b *Breaker) Record(err error) {
+	if b.Threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+	if !errors.Is(err, ErrUnreachable) {
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.Threshold {
+		b.state = BreakerOpen
+		b.openedAt = b.now()
+	}
+}
+
+// release завершает пробный запрос без результата
+func (b *Breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
+
+func (b *Breaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// middleware выполняет запрос с таймаутом попытки, повторяет его при
+// недоступности SRS и учитывает результат в размыкателе
+func (o Options) middleware(b *Breaker) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			backoff := o.RetryBackoff
+			for attempt := 0; ; attempt++ {
+				response, err := o.attempt(ctx, b, next, request)
+				if err == nil || !errors.Is(err, ErrUnreachable) || attempt >= o.Retries {
+					return response, err
+				}
+				select {
+				case <-ctx.Done():
+					return nil, err
+				case <-time.After(backoff):
+				}
+				backoff *= 2
+			}
+		}
+	}
+}
+
+func (o Options) attempt(ctx context.Context, b *Breaker, next endpoint.Endpoint, request interface{}) (interface{}, error) {
+	if err := b.Allow(); err != nil {
+		return nil, err
+	}
+	actx := ctx
+	if o.Timeout > 0 {
+		var cancel context.CancelFunc
+		actx, cancel = context.WithTimeout(ctx, o.Timeout)
+		defer cancel()
+	}
+	response, err := next(actx, request)
+	err = classify(err)
+	// отмена вызывающим не говорит о состоянии SRS
+	if ctx.Err() != nil {
+		b.release()
+		return nil, ctx.Err()
+	}
+	b.Record(err)
+	return response, err
+}
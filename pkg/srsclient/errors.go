@@ -0,0 +1,81 @@
+package srsclient
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+var (
+	ErrInternalError = errors.New("INTERNAL_ERROR")
+	// SRS не ответил: сетевая ошибка, таймаут или ответ 5xx. Такие запросы повторяются
+	ErrUnreachable = errors.New("SRS_UNREACHABLE")
+	// SRS отклонил запрос ответом 4xx
+	ErrRejected = errors.New("SRS_REQUEST_REJECTED")
+	// SRS ответил ненулевым code
+	ErrSRSCode = errors.New("SRS_ERROR_CODE")
+	// после серии ошибок запросы к SRS не выполняются до конца паузы
+	ErrCircuitOpen = errors.New("SRS_CIRCUIT_OPEN")
+)
+
+// Коды ошибок SRS, которые клиент обрабатывает особо
+const (
+	CodeStreamNotFound = 2048
+	CodeClientNotFound = 2049
+)
+
+// StatusError - ответ SRS с HTTP статусом, отличным от 200
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("srs http status %d", e.StatusCode)
+}
+
+func (e *StatusError) Is(target error) bool {
+	switch target {
+	case ErrRejected:
+		return e.StatusCode >= 400 && e.StatusCode < 500
+	case ErrUnreachable:
+		return e.StatusCode >= 500
+	}
+	return false
+}
+
+// CodeError - ответ SRS с ненулевым code
+type CodeError struct {
+	Op   string
+	Code int
+}
+
+func (e *CodeError) Error() string {
+	return fmt.Sprintf("%s: srs code %d", e.Op, e.Code)
+}
+
+func (e *CodeError) Unwrap() error {
+	return ErrSRSCode
+}
+
+// IsCode проверяет, что err - ответ SRS с кодом code
+func IsCode(err error, code int) bool {
+	var ce *CodeError
+	return errors.As(err, &ce) && ce.Code == code
+}
+
+func checkStatus(resp *http.Response) error {
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+// classify помечает ошибки транспорта как ErrUnreachable
+func classify(err error) error {
+	var ue *url.Error
+	if err != nil && errors.As(err, &ue) {
+		return fmt.Errorf("%w: %v", ErrUnreachable, err)
+	}
+	return err
+}
@@ -7,31 +7,55 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
-	"time"
 
 	"github.com/go-kit/kit/endpoint"
 )
 
-const STREAMS_COUNT = 100 // лимит стримов для мониторинга
+const STREAMS_COUNT = 100 // размер страницы списков стримов и клиентов
 type SrsClientEndpoint interface {
-	GetSRSStreams() (*GetSRSStreamsResponse, error)
-	KickSRSStream(string) error
-	ConfigReload() error
+	GetSRSStreams(ctx context.Context, start, count int) (*GetSRSStreamsResponse, error)
+	GetSRSStreamDetail(context.Context, string) (*GetSRSStreamResponse, error)
+	KickSRSStream(context.Context, string) error
+	ConfigReload(context.Context) error
+	GetSRSVhosts(context.Context) (*GetSRSVhostsResponse, error)
+	GetSRSRawConfig(context.Context) (*GetSRSRawConfigResponse, error)
+	GetSRSRawQuery(ctx context.Context, scope, vhost string) (*GetSRSRawQueryResponse, error)
+	GetSRSClients(ctx context.Context, start, count int) (*GetSRSClientsResponse, error)
+	GetSRSClient(context.Context, string) (*GetSRSClientResponse, error)
+	GetSRSVersions(context.Context) (*GetSRSVersionsResponse, error)
+	GetSRSSummaries(context.Context) (*GetSRSSummariesResponse, error)
 }
 type SrsClientSet struct {
-	GetSRSStreamEndpoint  endpoint.Endpoint
-	KickSRSStreamEndpoint endpoint.Endpoint
-	ConfigReloadEndPoint  endpoint.Endpoint
+	GetSRSStreamEndpoint       endpoint.Endpoint
+	GetSRSStreamDetailEndpoint endpoint.Endpoint
+	KickSRSStreamEndpoint      endpoint.Endpoint
+	ConfigReloadEndPoint       endpoint.Endpoint
+	GetSRSVhostsEndpoint       endpoint.Endpoint
+	GetRawConfigEndpoint       endpoint.Endpoint
+	GetRawQueryEndpoint        endpoint.Endpoint
+	GetSRSClientsEndpoint      endpoint.Endpoint
+	GetSRSClientEndpoint       endpoint.Endpoint
+	GetSRSVersionsEndpoint     endpoint.Endpoint
+	GetSRSSummariesEndpoint    endpoint.Endpoint
 }
 
-func NewEndpoints(serverAddr string) SrsClientSet {
+// NewEndpoints создает endpoints SRS API. Все запросы проходят через
+// таймаут, повторы и общий размыкатель breaker
+func NewEndpoints(serverAddr string, opts Options, breaker *Breaker) SrsClientSet {
 	setSRSStreamTransport := HttpRequest{
 		Addr:    serverAddr,
 		Method:  "GET",
-		Encoder: encodeGetSRSStreamRequest,
+		Encoder: encodePageRequest,
 		Decoder: decodeGetSRSStreamsResponse,
 	}
 
+	setSRSStreamDetailTransport := HttpRequest{
+		Addr:    serverAddr,
+		Method:  "GET",
+		Encoder: encodeIDRequest,
+		Decoder: decodeGetSRSStreamResponse,
+	}
+
 	setSRSKickTransport := HttpRequest{
 		Addr:    serverAddr,
 		Method:  "DELETE",
@@ -46,20 +70,91 @@ func NewEndpoints(serverAddr string) SrsClientSet {
 		Decoder: decodeConfigReloadResponse,
 	}
 
+	setVhostsTransport := HttpRequest{
+		Addr:    serverAddr,
+		Method:  "GET",
+		Encoder: encodeGetSRSVhostsRequest,
+		Decoder: decodeGetSRSVhostsResponse,
+	}
+
+	setRawConfigTransport := HttpRequest{
+		Addr:    serverAddr,
+		Method:  "GET",
+		Encoder: encodeGetSRSRawConfigRequest,
+		Decoder: decodeGetSRSRawConfigResponse,
+	}
+
+	setRawQueryTransport := HttpRequest{
+		Addr:    serverAddr,
+		Method:  "GET",
+		Encoder: encodeGetSRSRawQueryRequest,
+		Decoder: decodeGetSRSRawQueryResponse,
+	}
+
+	setClientsTransport := HttpRequest{
+		Addr:    serverAddr,
+		Method:  "GET",
+		Encoder: encodePageRequest,
+		Decoder: decodeGetSRSClientsResponse,
+	}
+
+	setClientTransport := HttpRequest{
+		Addr:    serverAddr,
+		Method:  "GET",
+		Encoder: encodeIDRequest,
+		Decoder: decodeGetSRSClientResponse,
+	}
+
+	setVersionsTransport := HttpRequest{
+		Addr:    serverAddr,
+		Method:  "GET",
+		Encoder: encodeGetSRSVhostsRequest,
+		Decoder: decodeGetSRSVersionsResponse,
+	}
+
+	setSummariesTransport := HttpRequest{
+		Addr:    serverAddr,
+		Method:  "GET",
+		Encoder: encodeGetSRSVhostsRequest,
+		Decoder: decodeGetSRSSummariesResponse,
+	}
+
+	mw := opts.middleware(breaker)
+	client := opts.httpClient()
+	// все endpoints используют общий клиент и учетные данные SRS API
+	request := func(t HttpRequest, path string) endpoint.Endpoint {
+		t.Client, t.Auth = client, opts.Auth
+		return mw(t.MakeRequest(path))
+	}
 	return SrsClientSet{
-		GetSRSStreamEndpoint:  setSRSStreamTransport.MakeRequest("/api/v1/streams"),
-		KickSRSStreamEndpoint: setSRSKickTransport.MakeRequest("/api/v1/clients/"),
-		ConfigReloadEndPoint:  setConfigReloadTransport.MakeRequest("/api/v1/raw"),
+		GetSRSStreamEndpoint:       request(setSRSStreamTransport, "/api/v1/streams"),
+		GetSRSStreamDetailEndpoint: request(setSRSStreamDetailTransport, "/api/v1/streams/"),
+		KickSRSStreamEndpoint:      request(setSRSKickTransport, "/api/v1/clients/"),
+		ConfigReloadEndPoint:       request(setConfigReloadTransport, "/api/v1/raw"),
+		GetSRSVhostsEndpoint:       request(setVhostsTransport, "/api/v1/vhosts"),
+		GetRawConfigEndpoint:       request(setRawConfigTransport, "/api/v1/raw"),
+		GetRawQueryEndpoint:        request(setRawQueryTransport, "/api/v1/raw"),
+		GetSRSClientsEndpoint:      request(setClientsTransport, "/api/v1/clients"),
+		GetSRSClientEndpoint:       request(setClientTransport, "/api/v1/clients/"),
+		GetSRSVersionsEndpoint:     request(setVersionsTransport, "/api/v1/versions"),
+		GetSRSSummariesEndpoint:    request(setSummariesTransport, "/api/v1/summaries"),
 	}
 }
 
-type GetSRSStreamsRequest struct {
+// PageRequest - страница списка: start - смещение, count - размер
+type PageRequest struct {
+	Start int
+	Count int
+}
+
+// IDRequest - запрос объекта по id SRS
+type IDRequest struct {
+	ID string
 }
 
-type GetSRSStreamsResponse struct {
-	Code    int          `json:"code"`
-	Streams *[]SRSStream `json:"streams"`
-	Error   string       `json:"error"`
+type RawQueryRequest struct {
+	Scope string
+	Vhost string
 }
 
 type KickSRSStreamRequest struct {
@@ -70,61 +165,229 @@ type GetConfigReloadRequest struct {
 }
 
 type GetConfigReloadResponse struct {
+	Code int `json:"code"`
 }
 
-func (s SrsClientSet) GetSRSStreams() (*GetSRSStreamsResponse, error) {
-	requestData := GetSRSStreamsRequest{}
+// SRSRawGlobal - глобальная часть конфигурации из raw API. Директивы
+// отдаются строкой или массивом, vhosts - именами или объектами
+type SRSRawGlobal struct {
+	Listen json.RawMessage `json:"listen"`
+	Vhosts json.RawMessage `json:"vhosts"`
+}
+
+type GetSRSRawConfigResponse struct {
+	Code   int           `json:"code"`
+	Global *SRSRawGlobal `json:"global"`
+	Data   struct {
+		Global *SRSRawGlobal `json:"global"`
+	} `json:"data"`
+}
 
-	ctx, _ := context.WithTimeout(context.Background(), 5*time.Second)
-	response, err := s.GetSRSStreamEndpoint(ctx, requestData)
+func (s SrsClientSet) GetSRSStreams(ctx context.Context, start, count int) (*GetSRSStreamsResponse, error) {
+	response, err := s.GetSRSStreamEndpoint(ctx, PageRequest{Start: start, Count: count})
 	if err != nil {
 		return nil, err
 	}
 
-	if response == nil {
-		return nil, errors.New(response.(GetSRSStreamsResponse).Error)
+	resp, ok := response.(GetSRSStreamsResponse)
+	if !ok {
+		return nil, ErrInternalError
+	}
+	if resp.Code != 0 {
+		return nil, &CodeError{Op: "streams", Code: resp.Code}
 	}
+	return &resp, nil
+}
 
-	resp, ok := response.(GetSRSStreamsResponse)
+func (s SrsClientSet) GetSRSStreamDetail(ctx context.Context, id string) (*GetSRSStreamResponse, error) {
+	response, err := s.GetSRSStreamDetailEndpoint(ctx, IDRequest{ID: id})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, ok := response.(GetSRSStreamResponse)
+	if !ok {
+		return nil, ErrInternalError
+	}
+	if resp.Code != 0 {
+		return nil, &CodeError{Op: "stream " + id, Code: resp.Code}
+	}
+	if resp.Stream == nil {
+		return nil, ErrInternalError
+	}
+	return &resp, nil
+}
+
+func (s SrsClientSet) GetSRSClients(ctx context.Context, start, count int) (*GetSRSClientsResponse, error) {
+	response, err := s.GetSRSClientsEndpoint(ctx, PageRequest{Start: start, Count: count})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, ok := response.(GetSRSClientsResponse)
+	if !ok {
+		return nil, ErrInternalError
+	}
+	if resp.Code != 0 {
+		return nil, &CodeError{Op: "clients", Code: resp.Code}
+	}
+	return &resp, nil
+}
+
+func (s SrsClientSet) GetSRSClient(ctx context.Context, id string) (*GetSRSClientResponse, error) {
+	response, err := s.GetSRSClientEndpoint(ctx, IDRequest{ID: id})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, ok := response.(GetSRSClientResponse)
 	if !ok {
-		return nil, errors.New(response.(GetSRSStreamsResponse).Error)
+		return nil, ErrInternalError
+	}
+	if resp.Code != 0 {
+		return nil, &CodeError{Op: "client " + id, Code: resp.Code}
+	}
+	if resp.Client == nil {
+		return nil, ErrInternalError
+	}
+	return &resp, nil
+}
+
+func (s SrsClientSet) GetSRSVersions(ctx context.Context) (*GetSRSVersionsResponse, error) {
+	response, err := s.GetSRSVersionsEndpoint(ctx, struct{}{})
+	if err != nil {
+		return nil, err
 	}
 
+	resp, ok := response.(GetSRSVersionsResponse)
+	if !ok {
+		return nil, ErrInternalError
+	}
+	if resp.Code != 0 {
+		return nil, &CodeError{Op: "versions", Code: resp.Code}
+	}
+	if resp.Data == nil {
+		return nil, ErrInternalError
+	}
 	return &resp, nil
 }
 
-func (s SrsClientSet) ConfigReload() error {
-	requestData := GetConfigReloadRequest{}
-	ctx, _ := context.WithTimeout(context.Background(), 5*time.Second)
-	response, err := s.ConfigReloadEndPoint(ctx, requestData)
-	fmt.Printf("ConfigReload err:%v response:%v\n", err, response)
+func (s SrsClientSet) GetSRSSummaries(ctx context.Context) (*GetSRSSummariesResponse, error) {
+	response, err := s.GetSRSSummariesEndpoint(ctx, struct{}{})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, ok := response.(GetSRSSummariesResponse)
+	if !ok {
+		return nil, ErrInternalError
+	}
+	if resp.Code != 0 {
+		return nil, &CodeError{Op: "summaries", Code: resp.Code}
+	}
+	if resp.Data == nil {
+		return nil, ErrInternalError
+	}
+	return &resp, nil
+}
+
+func (s SrsClientSet) GetSRSRawQuery(ctx context.Context, scope, vhost string) (*GetSRSRawQueryResponse, error) {
+	response, err := s.GetRawQueryEndpoint(ctx, RawQueryRequest{Scope: scope, Vhost: vhost})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, ok := response.(GetSRSRawQueryResponse)
+	if !ok {
+		return nil, ErrInternalError
+	}
+	if resp.Code != 0 {
+		return nil, &CodeError{Op: "raw query " + scope, Code: resp.Code}
+	}
+	return &resp, nil
+}
+
+func (s SrsClientSet) ConfigReload(ctx context.Context) error {
+	response, err := s.ConfigReloadEndPoint(ctx, GetConfigReloadRequest{})
 	if err != nil {
 		return err
 	}
 
-	if response == nil {
-		return errors.New(response.(GetSRSStreamsResponse).Error)
+	resp, ok := response.(GetConfigReloadResponse)
+	if !ok {
+		return ErrInternalError
+	}
+	if resp.Code != 0 {
+		return &CodeError{Op: "reload", Code: resp.Code}
 	}
 	return nil
 }
 
-func (s SrsClientSet) KickSRSStream(cid string) error {
-	requestData := KickSRSStreamRequest{Cid: cid}
-	ctx, _ := context.WithTimeout(context.Background(), 5*time.Second)
-	response, err := s.KickSRSStreamEndpoint(ctx, requestData)
+func (s SrsClientSet) GetSRSVhosts(ctx context.Context) (*GetSRSVhostsResponse, error) {
+	response, err := s.GetSRSVhostsEndpoint(ctx, struct{}{})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, ok := response.(GetSRSVhostsResponse)
+	if !ok {
+		return nil, ErrInternalError
+	}
+	if resp.Code != 0 {
+		return nil, &CodeError{Op: "vhosts", Code: resp.Code}
+	}
+	if resp.Vhosts == nil {
+		return nil, ErrInternalError
+	}
+	return &resp, nil
+}
+
+func (s SrsClientSet) GetSRSRawConfig(ctx context.Context) (*GetSRSRawConfigResponse, error) {
+	response, err := s.GetRawConfigEndpoint(ctx, struct{}{})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, ok := response.(GetSRSRawConfigResponse)
+	if !ok {
+		return nil, ErrInternalError
+	}
+	if resp.Code != 0 {
+		return nil, &CodeError{Op: "raw query", Code: resp.Code}
+	}
+	if resp.Global == nil {
+		resp.Global = resp.Data.Global
+	}
+	if resp.Global == nil {
+		return nil, ErrInternalError
+	}
+	return &resp, nil
+}
+
+// KickSRSStream отключает клиента SRS. Уже отключенный клиент - не ошибка
+func (s SrsClientSet) KickSRSStream(ctx context.Context, cid string) error {
+	response, err := s.KickSRSStreamEndpoint(ctx, KickSRSStreamRequest{Cid: cid})
+	var se *StatusError
+	if errors.As(err, &se) && se.StatusCode == http.StatusNotFound {
+		return nil
+	}
 	if err != nil {
 		return err
 	}
 
-	if response == nil {
-		return errors.New(response.(GetSRSStreamsResponse).Error)
+	resp, ok := response.(GetSRSStreamsResponse)
+	if !ok {
+		return ErrInternalError
+	}
+	if resp.Code != 0 && resp.Code != CodeClientNotFound {
+		return &CodeError{Op: "kick " + cid, Code: resp.Code}
 	}
 	return nil
 }
 
 func decodeGetSRSStreamsResponse(_ context.Context, resp *http.Response) (interface{}, error) {
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("%d", resp.StatusCode)
+	if err := checkStatus(resp); err != nil {
+		return nil, err
 	}
 	var response GetSRSStreamsResponse
 	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
@@ -134,13 +397,76 @@ func decodeGetSRSStreamsResponse(_ context.Context, resp *http.Response) (interf
 	return response, nil
 }
 
-func encodeGetSRSStreamRequest(ctx context.Context, req *http.Request, request interface{}) error {
+func encodePageRequest(ctx context.Context, req *http.Request, request interface{}) error {
+	r := request.(PageRequest)
 	q := req.URL.Query()
-	q.Add("count", fmt.Sprintf("%d", STREAMS_COUNT))
+	q.Add("start", fmt.Sprintf("%d", r.Start))
+	q.Add("count", fmt.Sprintf("%d", r.Count))
 	req.URL.RawQuery = q.Encode()
 	return nil
 }
 
+func encodeIDRequest(ctx context.Context, req *http.Request, request interface{}) error {
+	r := request.(IDRequest)
+	req.URL.Path = fmt.Sprintf("%s%s", req.URL.Path, url.PathEscape(r.ID))
+	return nil
+}
+
+func decodeGetSRSStreamResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	if err := checkStatus(resp); err != nil {
+		return nil, err
+	}
+	var response GetSRSStreamResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func decodeGetSRSClientsResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	if err := checkStatus(resp); err != nil {
+		return nil, err
+	}
+	var response GetSRSClientsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func decodeGetSRSClientResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	if err := checkStatus(resp); err != nil {
+		return nil, err
+	}
+	var response GetSRSClientResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func decodeGetSRSVersionsResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	if err := checkStatus(resp); err != nil {
+		return nil, err
+	}
+	var response GetSRSVersionsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func decodeGetSRSSummariesResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	if err := checkStatus(resp); err != nil {
+		return nil, err
+	}
+	var response GetSRSSummariesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
 func encodeConfigReloadRequest(ctx context.Context, req *http.Request, request interface{}) error {
 	q := req.URL.Query()
 	q.Add("rpc", "reload")
@@ -149,7 +475,71 @@ func encodeConfigReloadRequest(ctx context.Context, req *http.Request, request i
 }
 
 func decodeConfigReloadResponse(_ context.Context, resp *http.Response) (interface{}, error) {
-	return resp, nil
+	if err := checkStatus(resp); err != nil {
+		return nil, err
+	}
+	var response GetConfigReloadResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func encodeGetSRSVhostsRequest(ctx context.Context, req *http.Request, request interface{}) error {
+	return nil
+}
+
+func decodeGetSRSVhostsResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	if err := checkStatus(resp); err != nil {
+		return nil, err
+	}
+	var response GetSRSVhostsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func encodeGetSRSRawConfigRequest(ctx context.Context, req *http.Request, request interface{}) error {
+	q := req.URL.Query()
+	q.Add("rpc", "query")
+	q.Add("scope", "global")
+	req.URL.RawQuery = q.Encode()
+	return nil
+}
+
+func encodeGetSRSRawQueryRequest(ctx context.Context, req *http.Request, request interface{}) error {
+	r := request.(RawQueryRequest)
+	q := req.URL.Query()
+	q.Add("rpc", "query")
+	q.Add("scope", r.Scope)
+	if r.Vhost != "" {
+		q.Add("vhost", r.Vhost)
+	}
+	req.URL.RawQuery = q.Encode()
+	return nil
+}
+
+func decodeGetSRSRawQueryResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	if err := checkStatus(resp); err != nil {
+		return nil, err
+	}
+	var response GetSRSRawQueryResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func decodeGetSRSRawConfigResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	if err := checkStatus(resp); err != nil {
+		return nil, err
+	}
+	var response GetSRSRawConfigResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	return response, nil
 }
 
 func encodeKickSRSStreamRequest(ctx context.Context, req *http.Request, request interface{}) error {
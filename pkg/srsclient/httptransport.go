@@ -2,7 +2,6 @@ package srsclient
 
 import (
 	"context"
-	"crypto/tls"
 	"net/http"
 	"net/url"
 	"strings"
@@ -16,6 +15,9 @@ type HttpRequest struct {
 	Method  string
 	Encoder httptransport.EncodeRequestFunc
 	Decoder httptransport.DecodeResponseFunc
+	// Client - клиент с TLS и таймаутами соединения, nil - http.DefaultClient
+	Client *http.Client
+	Auth   Auth
 }
 
 func (sr *HttpRequest) MakeRequest(path string) endpoint.Endpoint {
@@ -30,10 +32,10 @@ func (sr *HttpRequest) MakeRequest(path string) endpoint.Endpoint {
 		u.Path = strings.TrimSuffix(u.Path, "/") + path
 	}
 
-	transport := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	client := sr.Client
+	if client == nil {
+		client = http.DefaultClient
 	}
-	client := &http.Client{Transport: transport}
 
 	c := httptransport.NewClient(
 		sr.Method,
@@ -43,6 +45,7 @@ func (sr *HttpRequest) MakeRequest(path string) endpoint.Endpoint {
 		httptransport.SetClient(client),
 		httptransport.ClientBefore(func(ctx context.Context, req *http.Request) context.Context {
 			req.Header.Set("Content-type", "application/json")
+			sr.Auth.apply(req)
 			return ctx
 		}),
 	).Endpoint()
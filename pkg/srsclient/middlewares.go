@@ -1,6 +1,8 @@
 package srsclient
 
 import (
+	"context"
+	"encoding/json"
 	"time"
 
 	"github.com/go-kit/log"
@@ -23,23 +25,104 @@ type loggingMiddleware struct {
 	logger log.Logger
 }
 
-func (mw loggingMiddleware) GetSRSStream() (p *[]SRSStream, err error) {
+func (mw loggingMiddleware) GetSRSStream(ctx context.Context) (p *[]SRSStream, err error) {
 	defer func(begin time.Time) {
 		level.Info(mw.logger).Log("method", "Client GetSRSStreams", "took", time.Since(begin), "err", err)
 	}(time.Now())
-	return mw.next.GetSRSStream()
+	return mw.next.GetSRSStream(ctx)
 }
 
-func (mw loggingMiddleware) KickSRSStream(s string) (err error) {
+func (mw loggingMiddleware) KickSRSStream(ctx context.Context, s string) (err error) {
 	defer func(begin time.Time) {
 		level.Info(mw.logger).Log("method", "Client KickSRSStream", "id", s, "took", time.Since(begin), "err", err)
 	}(time.Now())
-	return mw.next.KickSRSStream(s)
+	return mw.next.KickSRSStream(ctx, s)
 }
 
-func (mw loggingMiddleware) ConfigReload() (err error) {
+func (mw loggingMiddleware) ConfigReload(ctx context.Context) (err error) {
 	defer func(begin time.Time) {
 		level.Info(mw.logger).Log("method", "Client ConfigReload", "took", time.Since(begin), "err", err)
 	}(time.Now())
-	return mw.next.ConfigReload()
+	return mw.next.ConfigReload(ctx)
+}
+
+func (mw loggingMiddleware) ActiveVhosts(ctx context.Context) (v []string, err error) {
+	defer func(begin time.Time) {
+		level.Info(mw.logger).Log("method", "Client ActiveVhosts", "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.ActiveVhosts(ctx)
+}
+
+func (mw loggingMiddleware) PublishingStreams(ctx context.Context) (p []string, err error) {
+	defer func(begin time.Time) {
+		level.Info(mw.logger).Log("method", "Client PublishingStreams", "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.PublishingStreams(ctx)
+}
+
+func (mw loggingMiddleware) LiveConfig(ctx context.Context) (l []string, v []string, err error) {
+	defer func(begin time.Time) {
+		level.Info(mw.logger).Log("method", "Client LiveConfig", "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.LiveConfig(ctx)
+}
+
+func (mw loggingMiddleware) Versions(ctx context.Context) (v *SRSVersion, err error) {
+	defer func(begin time.Time) {
+		level.Info(mw.logger).Log("method", "Client Versions", "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.Versions(ctx)
+}
+
+func (mw loggingMiddleware) Summaries(ctx context.Context) (v *SRSSummary, err error) {
+	defer func(begin time.Time) {
+		level.Info(mw.logger).Log("method", "Client Summaries", "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.Summaries(ctx)
+}
+
+func (mw loggingMiddleware) Vhosts(ctx context.Context) (v []SRSVhost, err error) {
+	defer func(begin time.Time) {
+		level.Info(mw.logger).Log("method", "Client Vhosts", "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.Vhosts(ctx)
+}
+
+func (mw loggingMiddleware) Clients(ctx context.Context) (c []SRSClientInfo, err error) {
+	defer func(begin time.Time) {
+		level.Info(mw.logger).Log("method", "Client Clients", "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.Clients(ctx)
+}
+
+func (mw loggingMiddleware) Client(ctx context.Context, id string) (c *SRSClientInfo, err error) {
+	defer func(begin time.Time) {
+		level.Info(mw.logger).Log("method", "Client Client", "id", id, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.Client(ctx, id)
+}
+
+func (mw loggingMiddleware) Streams(ctx context.Context) (p []SRSStream, err error) {
+	defer func(begin time.Time) {
+		level.Info(mw.logger).Log("method", "Client Streams", "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.Streams(ctx)
+}
+
+func (mw loggingMiddleware) Stream(ctx context.Context, id string) (p *SRSStream, err error) {
+	defer func(begin time.Time) {
+		level.Info(mw.logger).Log("method", "Client Stream", "id", id, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.Stream(ctx, id)
+}
+
+func (mw loggingMiddleware) RawQuery(ctx context.Context, scope, vhost string) (data json.RawMessage, err error) {
+	defer func(begin time.Time) {
+		level.Info(mw.logger).Log("method", "Client RawQuery", "scope", scope, "vhost", vhost, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.RawQuery(ctx, scope, vhost)
+}
+
+func (mw loggingMiddleware) BreakerState() string {
+	return mw.next.BreakerState()
 }
@@ -0,0 +1,167 @@
+package srsclient
+
+import "encoding/json"
+
+// Модели ответов HTTP API SRS (/api/v1). Поля, которых нет в старых
+// версиях SRS, остаются нулевыми
+
+type SRSKbps struct {
+	Recv_30s int `json:"recv_30s"`
+	Send_30s int `json:"send_30s"`
+}
+
+type SRSVideo struct {
+	Codec   string `json:"codec"`
+	Profile string `json:"profile"`
+	Level   string `json:"level"`
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+}
+
+type SRSAudio struct {
+	Codec      string `json:"codec"`
+	SampleRate int    `json:"sample_rate"`
+	Channel    int    `json:"channel"`
+	Profile    string `json:"profile"`
+}
+
+type SRSPublish struct {
+	Active bool   `json:"active"`
+	Cid    string `json:"cid"`
+}
+
+type SRSStream struct {
+	Id        string      `json:"id"`
+	Name      string      `json:"name"`
+	Vhost     string      `json:"vhost"`
+	App       string      `json:"app"`
+	TcUrl     string      `json:"tcUrl"`
+	URL       string      `json:"url"`
+	LiveMs    int64       `json:"live_ms"`
+	Clients   int         `json:"clients"`
+	Frames    int64       `json:"frames"`
+	SendBytes int64       `json:"send_bytes"`
+	RecvBytes int64       `json:"recv_bytes"`
+	Kbps      SRSKbps     `json:"kbps"`
+	Publish   *SRSPublish `json:"publish"`
+	Video     SRSVideo    `json:"video"`
+	Audio     SRSAudio    `json:"audio"`
+}
+
+type SRSVhost struct {
+	Id        string  `json:"id"`
+	Name      string  `json:"name"`
+	Enabled   bool    `json:"enabled"`
+	Clients   int     `json:"clients"`
+	Streams   int     `json:"streams"`
+	SendBytes int64   `json:"send_bytes"`
+	RecvBytes int64   `json:"recv_bytes"`
+	Kbps      SRSKbps `json:"kbps"`
+	HLS       struct {
+		Enabled  bool    `json:"enabled"`
+		Fragment float64 `json:"fragment"`
+	} `json:"hls"`
+}
+
+// SRSClientInfo - подключение к SRS: публикатор или зритель
+type SRSClientInfo struct {
+	Id        string  `json:"id"`
+	Vhost     string  `json:"vhost"`
+	Stream    string  `json:"stream"`
+	IP        string  `json:"ip"`
+	PageUrl   string  `json:"pageUrl"`
+	SwfUrl    string  `json:"swfUrl"`
+	TcUrl     string  `json:"tcUrl"`
+	URL       string  `json:"url"`
+	Name      string  `json:"name"`
+	Type      string  `json:"type"`
+	Publish   bool    `json:"publish"`
+	Alive     float64 `json:"alive"`
+	SendBytes int64   `json:"send_bytes"`
+	RecvBytes int64   `json:"recv_bytes"`
+	Kbps      SRSKbps `json:"kbps"`
+}
+
+type SRSVersion struct {
+	Major    int    `json:"major"`
+	Minor    int    `json:"minor"`
+	Revision int    `json:"revision"`
+	Version  string `json:"version"`
+}
+
+type SRSSummary struct {
+	OK    bool  `json:"ok"`
+	NowMs int64 `json:"now_ms"`
+	Self  struct {
+		Version    string  `json:"version"`
+		Pid        int     `json:"pid"`
+		Ppid       int     `json:"ppid"`
+		Argv       string  `json:"argv"`
+		Cwd        string  `json:"cwd"`
+		MemKbyte   int64   `json:"mem_kbyte"`
+		MemPercent float64 `json:"mem_percent"`
+		CPUPercent float64 `json:"cpu_percent"`
+		SrsUptime  int64   `json:"srs_uptime"`
+	} `json:"self"`
+	System struct {
+		CPUPercent    float64 `json:"cpu_percent"`
+		DiskReadKBps  int64   `json:"disk_read_KBps"`
+		DiskWriteKBps int64   `json:"disk_write_KBps"`
+		MemRAMKbyte   int64   `json:"mem_ram_kbyte"`
+		MemRAMPercent float64 `json:"mem_ram_percent"`
+		CPUs          int     `json:"cpus"`
+		CPUsOnline    int     `json:"cpus_online"`
+		Uptime        float64 `json:"uptime"`
+		Load1m        float64 `json:"load_1m"`
+		Load5m        float64 `json:"load_5m"`
+		Load15m       float64 `json:"load_15m"`
+		NetRecvBytes  int64   `json:"net_recv_bytes"`
+		NetSendBytes  int64   `json:"net_send_bytes"`
+		SrsRecvBytes  int64   `json:"srs_recv_bytes"`
+		SrsSendBytes  int64   `json:"srs_send_bytes"`
+		ConnSys       int     `json:"conn_sys"`
+		ConnSrs       int     `json:"conn_srs"`
+	} `json:"system"`
+}
+
+type GetSRSStreamsResponse struct {
+	Code    int          `json:"code"`
+	Streams *[]SRSStream `json:"streams"`
+	Error   string       `json:"error"`
+}
+
+type GetSRSStreamResponse struct {
+	Code   int        `json:"code"`
+	Stream *SRSStream `json:"stream"`
+}
+
+type GetSRSVhostsResponse struct {
+	Code   int         `json:"code"`
+	Vhosts *[]SRSVhost `json:"vhosts"`
+}
+
+type GetSRSClientsResponse struct {
+	Code    int              `json:"code"`
+	Clients *[]SRSClientInfo `json:"clients"`
+}
+
+type GetSRSClientResponse struct {
+	Code   int            `json:"code"`
+	Client *SRSClientInfo `json:"client"`
+}
+
+type GetSRSVersionsResponse struct {
+	Code int         `json:"code"`
+	Data *SRSVersion `json:"data"`
+}
+
+type GetSRSSummariesResponse struct {
+	Code int         `json:"code"`
+	Data *SRSSummary `json:"data"`
+}
+
+// GetSRSRawQueryResponse - ответ raw API rpc=query, data зависит от scope
+type GetSRSRawQueryResponse struct {
+	Code int             `json:"code"`
+	Data json.RawMessage `json:"data"`
+}
@@ -1,91 +1,254 @@
 package srsclient
 
 import (
-	"errors"
+	"context"
+	"encoding/json"
+	"strings"
 
 	"github.com/go-kit/log"
 )
 
-var (
-	ErrInternalError = errors.New("INTERNAL_ERROR")
-)
-
 type SrsClient interface {
-	GetSRSStream() (*[]SRSStream, error)
-	KickSRSStream(string) error
-	ConfigReload() error
+	GetSRSStream(context.Context) (*[]SRSStream, error)
+	KickSRSStream(context.Context, string) error
+	ConfigReload(context.Context) error
+	ActiveVhosts(context.Context) ([]string, error)
+	PublishingStreams(context.Context) ([]string, error)
+	LiveConfig(context.Context) ([]string, []string, error)
+
+	Versions(context.Context) (*SRSVersion, error)
+	Summaries(context.Context) (*SRSSummary, error)
+	Vhosts(context.Context) ([]SRSVhost, error)
+	Clients(context.Context) ([]SRSClientInfo, error)
+	Client(context.Context, string) (*SRSClientInfo, error)
+	Streams(context.Context) ([]SRSStream, error)
+	Stream(context.Context, string) (*SRSStream, error)
+	RawQuery(ctx context.Context, scope, vhost string) (json.RawMessage, error)
+	// BreakerState - состояние размыкателя запросов к SRS
+	BreakerState() string
 }
 
 type srsClientService struct {
 	logger   log.Logger
 	clntSrvc SrsClientEndpoint
+	breaker  *Breaker
 }
 
-type SRSPublish struct {
-	Active bool   `json:"active"`
-	Cid    string `json:"cid"`
+func New(serverURL string, opts Options, logger log.Logger) SrsClient {
+	return NewBasicService(serverURL, opts, logger)
 }
 
-type SRSStream struct {
-	Id      string      `json:"id"`
-	Name    string      `json:"name"`
-	App     string      `json:"app"`
-	Publish *SRSPublish `json:"publish"`
-	Video   struct {
-		Width  int `json:"width"`
-		Height int `json:"height"`
-	} `json:"video"`
-	Audio struct {
-		Channel int `json:"channel"`
-	} `json:"audio"`
-	Kbps struct {
-		Recv_30s int `json:"recv_30s"`
-	}
+func NewBasicService(serverURL string, opts Options, logger log.Logger) *srsClientService {
+	breaker := NewBreaker(opts.BreakerThreshold, opts.BreakerCooldown)
+	client := NewEndpoints(serverURL, opts, breaker)
+	return &srsClientService{logger, client, breaker}
 }
 
-func New(serverURL string, logger log.Logger) SrsClient {
-	return NewBasicService(serverURL, logger)
+func (sc *srsClientService) BreakerState() string {
+	return sc.breaker.State()
 }
 
-func NewBasicService(serverURL string, logger log.Logger) *srsClientService {
-	client := NewEndpoints(serverURL)
-	return &srsClientService{logger, client}
+func (sc *srsClientService) ConfigReload(ctx context.Context) error {
+	return sc.clntSrvc.ConfigReload(ctx)
 }
 
-func (sc *srsClientService) ConfigReload() error {
-	err := sc.clntSrvc.ConfigReload()
+// ActiveVhosts возвращает имена включенных vhost SRS
+func (sc *srsClientService) ActiveVhosts(ctx context.Context) ([]string, error) {
+	resp, err := sc.clntSrvc.GetSRSVhosts(ctx)
 	if err != nil {
-		return nil
+		return nil, err
+	}
+	vhosts := []string{}
+	for _, v := range *resp.Vhosts {
+		if v.Enabled {
+			vhosts = append(vhosts, v.Name)
+		}
+	}
+	return vhosts, nil
+}
+
+// PublishingStreams возвращает имена стримов, в которые идет публикация
+func (sc *srsClientService) PublishingStreams(ctx context.Context) ([]string, error) {
+	all, err := sc.Streams(ctx)
+	if err != nil {
+		return nil, err
+	}
+	streams := []string{}
+	for _, v := range all {
+		if v.Publish != nil && v.Publish.Active {
+			streams = append(streams, v.Name)
+		}
+	}
+	return streams, nil
+}
+
+// LiveConfig возвращает порты и vhost конфигурации, загруженной в SRS
+func (sc *srsClientService) LiveConfig(ctx context.Context) ([]string, []string, error) {
+	resp, err := sc.clntSrvc.GetSRSRawConfig(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	listen := rawNames(resp.Global.Listen)
+	vhosts := rawNames(resp.Global.Vhosts)
+	if vhosts == nil {
+		// raw API без vhosts: включенные vhost берутся из /api/v1/vhosts
+		if vhosts, err = sc.ActiveVhosts(ctx); err != nil {
+			return nil, nil, err
+		}
+	}
+	return listen, vhosts, nil
+}
+
+// rawNames разбирает значение raw API: строку, массив строк или объектов с name
+func rawNames(raw json.RawMessage) []string {
+	var one string
+	if err := json.Unmarshal(raw, &one); err == nil {
+		return strings.Fields(one)
+	}
+	var many []string
+	if err := json.Unmarshal(raw, &many); err == nil {
+		return many
+	}
+	var objects []struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(raw, &objects); err == nil {
+		names := []string{}
+		for _, o := range objects {
+			names = append(names, o.Name)
+		}
+		return names
 	}
 	return nil
 }
 
-func (sc *srsClientService) GetSRSStream() (*[]SRSStream, error) {
-	resp, err := sc.clntSrvc.GetSRSStreams()
+func (sc *srsClientService) GetSRSStream(ctx context.Context) (*[]SRSStream, error) {
+	streams, err := sc.Streams(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	liveStreams := []SRSStream{}
-	for i, v := range *resp.Streams {
-		if v.App == "live" && v.Publish.Active && indexOf(v, liveStreams) == -1 {
-			(*resp.Streams)[i].Kbps.Recv_30s = (*resp.Streams)[i].Kbps.Recv_30s << 4
+	for i, v := range streams {
+		if v.App == "live" && v.Publish != nil && v.Publish.Active && indexOf(v, liveStreams) == -1 {
+			streams[i].Kbps.Recv_30s = streams[i].Kbps.Recv_30s << 4
 			liveStreams = append(liveStreams, v)
 		}
 	}
 	return &liveStreams, nil
 }
 
-func (sc *srsClientService) KickSRSStream(cid string) error {
-	if cid == "" {
-		return nil
+// Streams возвращает все стримы SRS, запрашивая список страницами по STREAMS_COUNT
+func (sc *srsClientService) Streams(ctx context.Context) ([]SRSStream, error) {
+	streams := []SRSStream{}
+	seen := map[string]bool{}
+	for start := 0; ; start += STREAMS_COUNT {
+		resp, err := sc.clntSrvc.GetSRSStreams(ctx, start, STREAMS_COUNT)
+		if err != nil {
+			return nil, err
+		}
+		page := []SRSStream{}
+		if resp.Streams != nil {
+			page = *resp.Streams
+		}
+		added := 0
+		for _, v := range page {
+			if !seen[v.Id] {
+				seen[v.Id] = true
+				streams = append(streams, v)
+				added++
+			}
+		}
+		// SRS без поддержки start отдает одну и ту же страницу
+		if len(page) < STREAMS_COUNT || added == 0 {
+			return streams, nil
+		}
+	}
+}
+
+func (sc *srsClientService) Stream(ctx context.Context, id string) (*SRSStream, error) {
+	resp, err := sc.clntSrvc.GetSRSStreamDetail(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Stream, nil
+}
+
+// Clients возвращает все подключения к SRS, запрашивая список страницами
+func (sc *srsClientService) Clients(ctx context.Context) ([]SRSClientInfo, error) {
+	clients := []SRSClientInfo{}
+	seen := map[string]bool{}
+	for start := 0; ; start += STREAMS_COUNT {
+		resp, err := sc.clntSrvc.GetSRSClients(ctx, start, STREAMS_COUNT)
+		if err != nil {
+			return nil, err
+		}
+		page := []SRSClientInfo{}
+		if resp.Clients != nil {
+			page = *resp.Clients
+		}
+		added := 0
+		for _, v := range page {
+			if !seen[v.Id] {
+				seen[v.Id] = true
+				clients = append(clients, v)
+				added++
+			}
+		}
+		if len(page) < STREAMS_COUNT || added == 0 {
+			return clients, nil
+		}
 	}
+}
 
-	err := sc.clntSrvc.KickSRSStream(cid)
+func (sc *srsClientService) Client(ctx context.Context, id string) (*SRSClientInfo, error) {
+	resp, err := sc.clntSrvc.GetSRSClient(ctx, id)
 	if err != nil {
+		return nil, err
+	}
+	return resp.Client, nil
+}
+
+func (sc *srsClientService) Vhosts(ctx context.Context) ([]SRSVhost, error) {
+	resp, err := sc.clntSrvc.GetSRSVhosts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return *resp.Vhosts, nil
+}
+
+func (sc *srsClientService) Versions(ctx context.Context) (*SRSVersion, error) {
+	resp, err := sc.clntSrvc.GetSRSVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+func (sc *srsClientService) Summaries(ctx context.Context) (*SRSSummary, error) {
+	resp, err := sc.clntSrvc.GetSRSSummaries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// RawQuery выполняет запрос raw API rpc=query, например scope global или
+// vhost с именем vhost, и возвращает data ответа
+func (sc *srsClientService) RawQuery(ctx context.Context, scope, vhost string) (json.RawMessage, error) {
+	resp, err := sc.clntSrvc.GetSRSRawQuery(ctx, scope, vhost)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+func (sc *srsClientService) KickSRSStream(ctx context.Context, cid string) error {
+	if cid == "" {
 		return nil
 	}
-	return nil
+
+	return sc.clntSrvc.KickSRSStream(ctx, cid)
 }
 
 func indexOf(item SRSStream, stor []SRSStream) int {
@@ -0,0 +1,180 @@
+package srsclient
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+)
+
+// streamsServer отдает total стримов страницами; ignoreStart - SRS,
+// который не поддерживает start и всегда отдает первую страницу
+func streamsServer(total int, ignoreStart bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start, _ := strconv.Atoi(r.URL.Query().Get("start"))
+		count, _ := strconv.Atoi(r.URL.Query().Get("count"))
+		if ignoreStart {
+			start = 0
+		}
+		streams := []SRSStream{}
+		for i := start; i < total && i < start+count; i++ {
+			streams = append(streams, SRSStream{Id: fmt.Sprint("vid-", i), Name: fmt.Sprint("s", i), App: "live", Publish: &SRSPublish{Active: true}})
+		}
+		json.NewEncoder(w).Encode(GetSRSStreamsResponse{Streams: &streams})
+	}))
+}
+
+func TestStreamsPagination(t *testing.T) {
+	for _, tc := range []struct {
+		total       int
+		ignoreStart bool
+		want        int
+	}{
+		{0, false, 0},
+		{STREAMS_COUNT, false, STREAMS_COUNT},
+		{2*STREAMS_COUNT + 50, false, 2*STREAMS_COUNT + 50},
+		{2 * STREAMS_COUNT, true, STREAMS_COUNT},
+	} {
+		srv := streamsServer(tc.total, tc.ignoreStart)
+		client := New(srv.URL, DefaultOptions(), log.NewNopLogger())
+
+		streams, err := client.Streams(context.Background())
+		if err != nil || len(streams) != tc.want {
+			t.Errorf("total %d: want %d streams, have %d, %v", tc.total, tc.want, len(streams), err)
+		}
+		publishing, err := client.PublishingStreams(context.Background())
+		if err != nil || len(publishing) != tc.want {
+			t.Errorf("total %d: want %d publishing, have %d, %v", tc.total, tc.want, len(publishing), err)
+		}
+		srv.Close()
+	}
+}
+
+func TestErrors(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		switch r.URL.Path {
+		case "/api/v1/vhosts":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/api/v1/versions":
+			w.WriteHeader(http.StatusForbidden)
+		case "/api/v1/streams/missing":
+			json.NewEncoder(w).Encode(GetSRSStreamResponse{Code: CodeStreamNotFound})
+		case "/api/v1/clients/gone":
+			json.NewEncoder(w).Encode(GetSRSStreamsResponse{Code: CodeClientNotFound})
+		}
+	}))
+	defer srv.Close()
+	opts := Options{Retries: 2, BreakerThreshold: 10, BreakerCooldown: time.Minute}
+	client := New(srv.URL, opts, log.NewNopLogger())
+	ctx := context.Background()
+
+	if _, err := client.Vhosts(ctx); !errors.Is(err, ErrUnreachable) || atomic.LoadInt32(&calls) != 3 {
+		t.Errorf("5xx: want ErrUnreachable after 3 calls, have %v after %d", err, calls)
+	}
+	atomic.StoreInt32(&calls, 0)
+	if _, err := client.Versions(ctx); !errors.Is(err, ErrRejected) || atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("4xx: want ErrRejected without retries, have %v after %d", err, calls)
+	}
+	if _, err := client.Stream(ctx, "missing"); !IsCode(err, CodeStreamNotFound) || !errors.Is(err, ErrSRSCode) {
+		t.Errorf("code: want CodeStreamNotFound, have %v", err)
+	}
+	if err := client.KickSRSStream(ctx, "gone"); err != nil {
+		t.Errorf("kick of a gone client: %v", err)
+	}
+
+	srv.Close()
+	if err := client.ConfigReload(ctx); !errors.Is(err, ErrUnreachable) {
+		t.Errorf("closed server: want ErrUnreachable, have %v", err)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+	b := NewBreaker(2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if err := b.Allow(); err != nil {
+			t.Fatalf("closed breaker: %v", err)
+		}
+		b.Record(ErrUnreachable)
+	}
+	if err := b.Allow(); err != ErrCircuitOpen || b.State() != BreakerOpen {
+		t.Fatalf("want open breaker, have %s, %v", b.State(), err)
+	}
+
+	now = now.Add(time.Minute)
+	if err := b.Allow(); err != nil || b.State() != BreakerHalfOpen {
+		t.Fatalf("want trial request, have %s, %v", b.State(), err)
+	}
+	if err := b.Allow(); err != ErrCircuitOpen {
+		t.Errorf("second request during trial: %v", err)
+	}
+	b.Record(ErrUnreachable)
+	if b.State() != BreakerOpen {
+		t.Errorf("failed trial: want open, have %s", b.State())
+	}
+
+	now = now.Add(time.Minute)
+	b.Allow()
+	b.Record(ErrRejected)
+	if b.State() != BreakerClosed {
+		t.Errorf("any SRS response closes the breaker, have %s", b.State())
+	}
+}
+
+func TestAuthTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		bearer := r.Header.Get("Authorization") == "Bearer secret"
+		if !bearer && (!ok || user != "admin" || password != "secret") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(GetSRSVersionsResponse{Data: &SRSVersion{}})
+	}))
+	defer srv.Close()
+	caFile := path.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, ca, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tlsConfig, err := TLSOptions{CAFile: caFile}.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		name string
+		opts Options
+		want error
+	}{
+		{"basic", Options{TLSConfig: tlsConfig, Auth: Auth{User: "admin", Password: "secret"}}, nil},
+		{"bearer", Options{TLSConfig: tlsConfig, Auth: Auth{Token: "secret"}}, nil},
+		{"no credentials", Options{TLSConfig: tlsConfig}, ErrRejected},
+		{"unknown CA", Options{Auth: Auth{Token: "secret"}}, ErrUnreachable},
+	} {
+		_, err := New(srv.URL, tc.opts, log.NewNopLogger()).Versions(ctx)
+		if tc.want == nil && err != nil || tc.want != nil && !errors.Is(err, tc.want) {
+			t.Errorf("%s: want %v, have %v", tc.name, tc.want, err)
+		}
+	}
+
+	if _, err := (TLSOptions{CAFile: path.Join(t.TempDir(), "missing.pem")}).Config(); !errors.Is(err, ErrTLSConfig) {
+		t.Errorf("missing CA file: want ErrTLSConfig, have %v", err)
+	}
+}
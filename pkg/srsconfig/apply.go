@@ -0,0 +1,174 @@
+package srsconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	ErrConfigApply = errors.New("SRS_CONFIG_APPLY_FAILED")
+
+	VerifyAttempts = 5
+	VerifyInterval = 500 * time.Millisecond
+)
+
+// apply применяет конфигурацию транзакцией: файл пишется атомарно,
+// SRS перечитывает его, затем через API SRS проверяется, что vhost новой
+// конфигурации и публикуемые стримы активны. При ошибке восстанавливается
+// прежний файл и SRS перечитывает его. streams - стримы новой конфигурации
+func (s *SRSConfig) apply(cfg *Config, streams []SRSstream) error {
+	prev, err := ioutil.ReadFile(s.ConfigPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	publishing, err := s.SRSClient.PublishingStreams(context.Background())
+	if err != nil {
+		return fmt.Errorf("%w: streams: %v", ErrConfigApply, err)
+	}
+
+	if err := writeFileAtomic(s.ConfigPath, cfg.Bytes()); err != nil {
+		return err
+	}
+	err = s.SRSClient.ConfigReload(context.Background())
+	if err == nil {
+		err = s.verify(cfg, s.expectedStreams(publishing, streams))
+	}
+	if err != nil {
+		if rbErr := s.rollback(prev); rbErr != nil {
+			return fmt.Errorf("%w: %v, rollback: %v", ErrConfigApply, err, rbErr)
+		}
+		return fmt.Errorf("%w: %v", ErrConfigApply, err)
+	}
+
+	s.mu.Lock()
+	s.current = cfg
+	s.applied = streams
+	s.mu.Unlock()
+	return nil
+}
+
+// expectedStreams - стримы, которые должны остаться активными после
+// перезагрузки: публикуемые, кроме удаленных из конфигурации этим изменением
+func (s *SRSConfig) expectedStreams(publishing []string, streams []SRSstream) []string {
+	removed := map[string]bool{}
+	s.mu.Lock()
+	for _, v := range s.applied {
+		removed[v.ID] = true
+	}
+	s.mu.Unlock()
+	for _, v := range streams {
+		delete(removed, v.ID)
+	}
+
+	expected := []string{}
+	for _, name := range publishing {
+		if !removed[name] {
+			expected = append(expected, name)
+		}
+	}
+	return expected
+}
+
+// verify ждет, пока SRS применит конфигурацию: перезагрузка выполняется асинхронно
+func (s *SRSConfig) verify(cfg *Config, streams []string) error {
+	var err error
+	for i := 0; i < VerifyAttempts; i++ {
+		if i > 0 {
+			time.Sleep(VerifyInterval)
+		}
+		if err = s.checkActive(cfg, streams); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (s *SRSConfig) checkActive(cfg *Config, streams []string) error {
+	vhosts, err := s.SRSClient.ActiveVhosts(context.Background())
+	if err != nil {
+		return err
+	}
+	if missing := missingNames(cfg.vhostNames(), vhosts); len(missing) > 0 {
+		return fmt.Errorf("vhosts not active: %s", strings.Join(missing, ", "))
+	}
+
+	active, err := s.SRSClient.PublishingStreams(context.Background())
+	if err != nil {
+		return err
+	}
+	if missing := missingNames(streams, active); len(missing) > 0 {
+		return fmt.Errorf("streams not active: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func (s *SRSConfig) rollback(prev []byte) error {
+	if prev == nil {
+		if err := os.Remove(s.ConfigPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if err := writeFileAtomic(s.ConfigPath, prev); err != nil {
+		return err
+	}
+	return s.SRSClient.ConfigReload(context.Background())
+}
+
+// vhostNames возвращает имена vhost, не выключенных директивой enabled off
+func (c *Config) vhostNames() []string {
+	names := []string{}
+	for _, v := range c.Vhosts {
+		enabled := true
+		for _, d := range v.Extra {
+			if d.Name == "enabled" && d.Arg() == "off" {
+				enabled = false
+			}
+		}
+		if enabled {
+			names = append(names, v.Name)
+		}
+	}
+	return names
+}
+
+func missingNames(expected, active []string) []string {
+	set := map[string]bool{}
+	for _, name := range active {
+		set[name] = true
+	}
+	missing := []string{}
+	for _, name := range expected {
+		if !set[name] {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// writeFileAtomic пишет файл через временный в том же каталоге и переименование
+func writeFileAtomic(name string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
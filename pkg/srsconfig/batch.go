@@ -0,0 +1,112 @@
+package srsconfig
+
+import (
+	"time"
+)
+
+const DefaultBatchWindow = 200 * time.Millisecond
+
+// change - изменение конфигурации, ожидающее перезагрузки
+type change struct {
+	do   mutation // вызывается под mu
+	undo func()
+	done chan error
+}
+
+// mutation вносит изменение и возвращает его откат, nil - изменений нет
+type mutation func() func()
+
+// ReloadStats - метрики применения конфигурации SRS
+type ReloadStats struct {
+	Reloads      int64         `json:"reloads"`
+	Failures     int64         `json:"failures"`
+	Changes      int64         `json:"changes"` // изменения, примененные перезагрузками
+	Pending      int           `json:"pending"`
+	LastDuration time.Duration `json:"lastDuration"`
+	LastReloadAt *time.Time    `json:"lastReloadAt,omitempty"`
+	LastError    string        `json:"lastError,omitempty"`
+}
+
+// Stats возвращает метрики перезагрузок
+func (s *SRSConfig) Stats() ReloadStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.stats
+	stats.Pending = len(s.pending)
+	return stats
+}
+
+// submit вносит изменение, ставит его в очередь и ждет результата перезагрузки,
+// в которую оно попало. Вызывается под mu, mu освобождается
+func (s *SRSConfig) submit(do mutation) error {
+	done := make(chan error, 1)
+	c := change{do: do, done: done}
+	if do != nil {
+		c.undo = do()
+	}
+	s.pending = append(s.pending, c)
+	if len(s.pending) == 1 {
+		time.AfterFunc(s.BatchWindow, s.flush)
+	}
+	s.mu.Unlock()
+	return <-done
+}
+
+// flush применяет накопленные изменения одной перезагрузкой. Если конфигурация
+// не применилась, все изменения пачки откатываются и получают ошибку, а
+// изменения, поступившие во время применения, вносятся заново поверх отката
+func (s *SRSConfig) flush() {
+	s.applyMu.Lock()
+	defer s.applyMu.Unlock()
+
+	begin := time.Now()
+	s.mu.Lock()
+	batch := s.pending
+	s.pending = nil
+	if len(batch) == 0 {
+		s.mu.Unlock()
+		return
+	}
+	// некорректная конфигурация не записывается, SRS продолжает работать на прежней
+	cfg, err := s.render()
+	streams := append([]SRSstream{}, s.Streams...)
+	s.mu.Unlock()
+
+	if err == nil {
+		err = s.apply(cfg, streams)
+	}
+
+	s.mu.Lock()
+	now := time.Now()
+	s.stats.Reloads++
+	s.stats.Changes += int64(len(batch))
+	s.stats.LastDuration = now.Sub(begin)
+	s.stats.LastReloadAt = &now
+	s.stats.LastError = ""
+	if err != nil {
+		s.stats.Failures++
+		s.stats.LastError = err.Error()
+		later := s.pending
+		undo(later)
+		undo(batch)
+		for i := range later {
+			if later[i].do != nil {
+				later[i].undo = later[i].do()
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	for _, c := range batch {
+		c.done <- err
+	}
+}
+
+// undo откатывает изменения в обратном порядке
+func undo(changes []change) {
+	for i := len(changes) - 1; i >= 0; i-- {
+		if changes[i].undo != nil {
+			changes[i].undo()
+		}
+	}
+}
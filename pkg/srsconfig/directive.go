@@ -0,0 +1,172 @@
+package srsconfig
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+var (
+	ErrConfigSyntax = errors.New("SRS_CONFIG_SYNTAX")
+)
+
+// Directive - директива конфигурации SRS: имя, аргументы и вложенный блок
+type Directive struct {
+	Name  string      `json:"name"`
+	Args  []string    `json:"args,omitempty"`
+	Block []Directive `json:"block,omitempty"`
+}
+
+func (d Directive) Arg() string {
+	if len(d.Args) == 0 {
+		return ""
+	}
+	return d.Args[0]
+}
+
+// ParseDirectives разбирает текст конфигурации SRS. Комментарии отбрасываются
+func ParseDirectives(text string) ([]Directive, error) {
+	tokens, err := tokenize(text)
+	if err != nil {
+		return nil, err
+	}
+	ds, rest, err := parseBlock(tokens, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("%w: unexpected %q at line %d", ErrConfigSyntax, rest[0].text, rest[0].line)
+	}
+	return ds, nil
+}
+
+type token struct {
+	text   string
+	line   int
+	quoted bool
+}
+
+func tokenize(text string) ([]token, error) {
+	tokens := []token{}
+	line := 1
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case c == '\n':
+			line++
+		case unicode.IsSpace(c):
+		case c == '#':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			i--
+		case c == '{' || c == '}' || c == ';':
+			tokens = append(tokens, token{text: string(c), line: line})
+		case c == '"' || c == '\'':
+			start := i + 1
+			for i++; i < len(runes) && runes[i] != c; i++ {
+				if runes[i] == '\n' {
+					line++
+				}
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("%w: unterminated quote at line %d", ErrConfigSyntax, line)
+			}
+			tokens = append(tokens, token{text: string(runes[start:i]), line: line, quoted: true})
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && !strings.ContainsRune("{};#", runes[i]) {
+				i++
+			}
+			tokens = append(tokens, token{text: string(runes[start:i]), line: line})
+			i--
+		}
+	}
+	return tokens, nil
+}
+
+func parseBlock(tokens []token, depth int) ([]Directive, []token, error) {
+	ds := []Directive{}
+	for len(tokens) > 0 {
+		t := tokens[0]
+		if !t.quoted && t.text == "}" {
+			if depth == 0 {
+				return nil, nil, fmt.Errorf("%w: unexpected } at line %d", ErrConfigSyntax, t.line)
+			}
+			return ds, tokens[1:], nil
+		}
+		if !t.quoted && (t.text == "{" || t.text == ";") {
+			return nil, nil, fmt.Errorf("%w: unexpected %s at line %d", ErrConfigSyntax, t.text, t.line)
+		}
+
+		d := Directive{Name: t.text}
+		tokens = tokens[1:]
+		for {
+			if len(tokens) == 0 {
+				return nil, nil, fmt.Errorf("%w: unterminated directive %s at line %d", ErrConfigSyntax, d.Name, t.line)
+			}
+			next := tokens[0]
+			tokens = tokens[1:]
+			if !next.quoted && next.text == ";" {
+				break
+			}
+			if !next.quoted && next.text == "{" {
+				block, rest, err := parseBlock(tokens, depth+1)
+				if err != nil {
+					return nil, nil, err
+				}
+				d.Block, tokens = block, rest
+				if d.Block == nil {
+					d.Block = []Directive{}
+				}
+				break
+			}
+			if !next.quoted && next.text == "}" {
+				return nil, nil, fmt.Errorf("%w: unexpected } at line %d", ErrConfigSyntax, next.line)
+			}
+			d.Args = append(d.Args, next.text)
+		}
+		ds = append(ds, d)
+	}
+	if depth > 0 {
+		return nil, nil, fmt.Errorf("%w: missing }", ErrConfigSyntax)
+	}
+	return ds, nil, nil
+}
+
+// FormatDirectives сериализует директивы с отступом в 4 пробела
+func FormatDirectives(ds []Directive) []byte {
+	buf := bytes.NewBuffer(nil)
+	writeDirectives(buf, ds, 0)
+	return buf.Bytes()
+}
+
+func writeDirectives(buf *bytes.Buffer, ds []Directive, depth int) {
+	indent := strings.Repeat("    ", depth)
+	for i, d := range ds {
+		if depth == 0 && d.Block != nil && i > 0 {
+			buf.WriteString("\n")
+		}
+		buf.WriteString(indent + d.Name)
+		for _, arg := range d.Args {
+			buf.WriteString(" " + quoteArg(arg))
+		}
+		if d.Block == nil {
+			buf.WriteString(";\n")
+			continue
+		}
+		buf.WriteString(" {\n")
+		writeDirectives(buf, d.Block, depth+1)
+		buf.WriteString(indent + "}\n")
+	}
+}
+
+func quoteArg(arg string) string {
+	if arg == "" || strings.ContainsAny(arg, " \t\n{};#'\"") {
+		return "'" + arg + "'"
+	}
+	return arg
+}
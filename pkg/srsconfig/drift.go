@@ -0,0 +1,233 @@
+package srsconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// DriftPolicy - действие при расхождении конфигурации SRS с генерируемой
+type DriftPolicy string
+
+const (
+	DriftAlert     DriftPolicy = "alert"     // только сообщить
+	DriftOverwrite DriftPolicy = "overwrite" // записать генерируемую конфигурацию и перезагрузить SRS
+	DriftAdopt     DriftPolicy = "adopt"     // принять файл с диска как основу генерации
+)
+
+var ErrDriftPolicy = errors.New("SRS_DRIFT_POLICY_INVALID")
+
+func ParseDriftPolicy(policy string) (DriftPolicy, error) {
+	switch p := DriftPolicy(policy); p {
+	case DriftAlert, DriftOverwrite, DriftAdopt:
+		return p, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrDriftPolicy, policy)
+}
+
+// LiveConfigSource отдает загруженную в SRS конфигурацию через raw API
+type LiveConfigSource interface {
+	LiveConfig(ctx context.Context) (listen []string, vhosts []string, err error)
+}
+
+// DriftReport - результат сравнения файла SRS_CONF_PATH и конфигурации,
+// загруженной в SRS, с генерируемой. Строки расхождений начинаются с "-"
+// для отсутствующих директив и с "+" для лишних
+type DriftReport struct {
+	CheckedAt  *time.Time  `json:"checkedAt,omitempty"`
+	Policy     DriftPolicy `json:"policy"`
+	Drifted    bool        `json:"drifted"`
+	Disk       []string    `json:"disk,omitempty"`
+	Live       []string    `json:"live,omitempty"`
+	LiveError  string      `json:"liveError,omitempty"`
+	Action     string      `json:"action,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	Checks     int64       `json:"checks"`
+	Detections int64       `json:"detections"`
+}
+
+// Drift возвращает результат последней проверки расхождений
+func (s *SRSConfig) Drift() DriftReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.drift
+}
+
+// CheckDrift сравнивает файл на диске и конфигурацию SRS с генерируемой
+// и при расхождении действует по policy
+func (s *SRSConfig) CheckDrift(policy DriftPolicy) (DriftReport, error) {
+	s.applyMu.Lock()
+	defer s.applyMu.Unlock()
+
+	now := time.Now()
+	report := DriftReport{CheckedAt: &now, Policy: policy}
+	s.mu.Lock()
+	// ожидающие перезагрузки изменения еще не на диске
+	if len(s.pending) > 0 {
+		report = s.drift
+		s.mu.Unlock()
+		return report, nil
+	}
+	expected, err := s.render()
+	streams := append([]SRSstream{}, s.Streams...)
+	s.mu.Unlock()
+
+	var disk *Config
+	if err == nil {
+		disk, report.Disk, err = s.diskDrift(expected)
+	}
+	if err == nil {
+		if src, ok := s.SRSClient.(LiveConfigSource); ok {
+			listen, vhosts, liveErr := src.LiveConfig(context.Background())
+			if liveErr != nil {
+				report.LiveError = liveErr.Error()
+			} else {
+				report.Live = liveDrift(expected, listen, vhosts)
+			}
+		}
+		report.Drifted = len(report.Disk) > 0 || len(report.Live) > 0
+	}
+
+	if err == nil && report.Drifted {
+		switch policy {
+		case DriftOverwrite:
+			report.Action = "overwritten"
+			err = s.apply(expected, streams)
+		case DriftAdopt:
+			report.Action = "adopted"
+			if disk != nil && len(report.Disk) > 0 {
+				err = s.adopt(disk)
+			}
+			// SRS перечитывает принятый файл
+			if err == nil && len(report.Live) > 0 {
+				err = s.SRSClient.ConfigReload(context.Background())
+			}
+		}
+	}
+	if err != nil {
+		report.Error = err.Error()
+	}
+
+	s.mu.Lock()
+	report.Checks = s.drift.Checks + 1
+	report.Detections = s.drift.Detections
+	if report.Drifted {
+		report.Detections++
+	}
+	s.drift = report
+	s.mu.Unlock()
+	return report, err
+}
+
+// diskDrift сравнивает файл ConfigPath с генерируемой конфигурацией.
+// Файл, который не удалось разобрать, - расхождение целиком
+func (s *SRSConfig) diskDrift(expected *Config) (*Config, []string, error) {
+	data, err := ioutil.ReadFile(s.ConfigPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	disk, err := Parse(string(data))
+	if err != nil {
+		return nil, []string{"! " + err.Error()}, nil
+	}
+	return disk, Diff(expected, disk), nil
+}
+
+// adopt делает конфигурацию с диска основой генерации: из нее убираются
+// vhost профилей, которые генерируются заново. Некорректная конфигурация
+// не принимается
+func (s *SRSConfig) adopt(disk *Config) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	base := []Directive{}
+	for _, d := range disk.Directives() {
+		if d.Name == "vhost" && strings.HasPrefix(d.Arg(), profileVhostPrefix) {
+			continue
+		}
+		base = append(base, d)
+	}
+	cfg, err := s.build(base)
+	if err != nil {
+		return err
+	}
+
+	if s.AdoptPath != "" {
+		if err := writeFileAtomic(s.AdoptPath, FormatDirectives(base)); err != nil {
+			return err
+		}
+	}
+	s.adopted = base
+	s.current = cfg
+	return nil
+}
+
+func directiveKey(d Directive) string {
+	return strings.Join(append([]string{d.Name}, d.Args...), " ")
+}
+
+// Diff возвращает директивы, которых нет в actual ("- "), и лишние в actual ("+ ").
+// Вложенные директивы записываются путем через " > "
+func Diff(expected, actual *Config) []string {
+	want := flatten(expected.Directives(), "")
+	have := flatten(actual.Directives(), "")
+
+	count := map[string]int{}
+	for _, line := range have {
+		count[line]++
+	}
+	diff := []string{}
+	for _, line := range want {
+		if count[line] > 0 {
+			count[line]--
+			continue
+		}
+		diff = append(diff, "- "+line)
+	}
+	for _, line := range have {
+		if count[line] > 0 {
+			count[line]--
+			diff = append(diff, "+ "+line)
+		}
+	}
+	return diff
+}
+
+func flatten(ds []Directive, prefix string) []string {
+	lines := []string{}
+	for _, d := range ds {
+		line := prefix + directiveKey(d)
+		if d.Block == nil {
+			lines = append(lines, line)
+			continue
+		}
+		if len(d.Block) == 0 {
+			lines = append(lines, line+" {}")
+		}
+		lines = append(lines, flatten(d.Block, line+" > ")...)
+	}
+	return lines
+}
+
+// liveDrift сравнивает порты и vhost, загруженные в SRS, с генерируемыми
+func liveDrift(expected *Config, listen, vhosts []string) []string {
+	diff := []string{}
+	wantListen := strings.Fields(expected.Listen)
+	for _, port := range missingNames(wantListen, listen) {
+		diff = append(diff, "- listen "+port)
+	}
+	for _, port := range missingNames(listen, wantListen) {
+		diff = append(diff, "+ listen "+port)
+	}
+	wantVhosts := expected.vhostNames()
+	for _, name := range missingNames(wantVhosts, vhosts) {
+		diff = append(diff, "- vhost "+name)
+	}
+	for _, name := range missingNames(vhosts, wantVhosts) {
+		diff = append(diff, "+ vhost "+name)
+	}
+	return diff
+}
@@ -0,0 +1,26 @@
+package srsconfig
+
+// ApplyDVR включает запись стримов apply ("app/stream") во всех vhost
+// с блоком dvr. Без стримов запись выключается
+func (c *Config) ApplyDVR(apply []string) {
+	for i := range c.Vhosts {
+		if c.Vhosts[i].DVR == nil {
+			continue
+		}
+		// vhost профилей делят блок с __defaultVhost__
+		d := *c.Vhosts[i].DVR
+		d.Enabled = len(apply) > 0
+		d.Apply = apply
+		c.Vhosts[i].DVR = &d
+	}
+}
+
+func (s *SRSConfig) dvrApply() []string {
+	var apply []string
+	for _, v := range s.Streams {
+		if v.DVR && v.App != "" {
+			apply = append(apply, v.App+"/"+v.ID)
+		}
+	}
+	return apply
+}
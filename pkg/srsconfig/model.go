@@ -0,0 +1,462 @@
+package srsconfig
+
+import (
+	"strconv"
+)
+
+// Config - модель конфигурации SRS. Директивы, для которых нет полей,
+// сохраняются как есть в Extra соответствующего уровня
+type Config struct {
+	Listen     string      `json:"listen"`
+	HTTPServer *Server     `json:"httpServer,omitempty"`
+	HTTPAPI    *Server     `json:"httpApi,omitempty"`
+	SRTServer  *Server     `json:"srtServer,omitempty"`
+	RTCServer  *Server     `json:"rtcServer,omitempty"`
+	Vhosts     []Vhost     `json:"vhosts"`
+	Extra      []Directive `json:"extra,omitempty"`
+}
+
+// Server - блоки http_server, http_api, srt_server и rtc_server
+type Server struct {
+	Enabled bool        `json:"enabled"`
+	Listen  string      `json:"listen,omitempty"`
+	Extra   []Directive `json:"extra,omitempty"`
+}
+
+type Vhost struct {
+	Name       string      `json:"name"`
+	HLS        *HLS        `json:"hls,omitempty"`
+	HTTPHooks  *HTTPHooks  `json:"httpHooks,omitempty"`
+	Transcodes []Transcode `json:"transcodes,omitempty"`
+	RTC        *RTC        `json:"rtc,omitempty"`
+	SRT        *SRT        `json:"srt,omitempty"`
+	DVR        *DVR        `json:"dvr,omitempty"`
+	Extra      []Directive `json:"extra,omitempty"`
+}
+
+type HLS struct {
+	Enabled  bool        `json:"enabled"`
+	Path     string      `json:"path,omitempty"`
+	Fragment float64     `json:"fragment,omitempty"`
+	Window   float64     `json:"window,omitempty"`
+	M3U8File string      `json:"m3u8File,omitempty"`
+	TSFile   string      `json:"tsFile,omitempty"`
+	Extra    []Directive `json:"extra,omitempty"`
+}
+
+type HTTPHooks struct {
+	Enabled     bool        `json:"enabled"`
+	OnConnect   []string    `json:"onConnect,omitempty"`
+	OnClose     []string    `json:"onClose,omitempty"`
+	OnPublish   []string    `json:"onPublish,omitempty"`
+	OnUnpublish []string    `json:"onUnpublish,omitempty"`
+	OnPlay      []string    `json:"onPlay,omitempty"`
+	OnStop      []string    `json:"onStop,omitempty"`
+	OnDVR       []string    `json:"onDvr,omitempty"`
+	OnHLS       []string    `json:"onHls,omitempty"`
+	Extra       []Directive `json:"extra,omitempty"`
+}
+
+type Transcode struct {
+	Scope   string      `json:"scope,omitempty"`
+	Enabled bool        `json:"enabled"`
+	FFmpeg  string      `json:"ffmpeg,omitempty"`
+	Engines []Engine    `json:"engines,omitempty"`
+	Extra   []Directive `json:"extra,omitempty"`
+}
+
+type Engine struct {
+	Name        string      `json:"name"`
+	Enabled     bool        `json:"enabled"`
+	VFilter     []Directive `json:"vfilter,omitempty"`
+	VCodec      string      `json:"vcodec,omitempty"`
+	VBitrate    int         `json:"vbitrate,omitempty"`
+	VFPS        int         `json:"vfps,omitempty"`
+	VWidth      int         `json:"vwidth,omitempty"`
+	VHeight     int         `json:"vheight,omitempty"`
+	VThreads    int         `json:"vthreads,omitempty"`
+	VProfile    string      `json:"vprofile,omitempty"`
+	VPreset     string      `json:"vpreset,omitempty"`
+	VParams     []Directive `json:"vparams,omitempty"`
+	ACodec      string      `json:"acodec,omitempty"`
+	ABitrate    int         `json:"abitrate,omitempty"`
+	ASampleRate int         `json:"asampleRate,omitempty"`
+	AChannels   int         `json:"achannels,omitempty"`
+	AParams     []Directive `json:"aparams,omitempty"`
+	Output      string      `json:"output,omitempty"`
+	Extra       []Directive `json:"extra,omitempty"`
+}
+
+type RTC struct {
+	Enabled   bool        `json:"enabled"`
+	RTMPToRTC bool        `json:"rtmpToRtc"`
+	RTCToRTMP bool        `json:"rtcToRtmp"`
+	Extra     []Directive `json:"extra,omitempty"`
+}
+
+type SRT struct {
+	Enabled   bool        `json:"enabled"`
+	SRTToRTMP bool        `json:"srtToRtmp"`
+	Extra     []Directive `json:"extra,omitempty"`
+}
+
+type DVR struct {
+	Enabled bool        `json:"enabled"`
+	Apply   []string    `json:"apply,omitempty"`
+	Plan    string      `json:"plan,omitempty"`
+	Path    string      `json:"path,omitempty"`
+	Extra   []Directive `json:"extra,omitempty"`
+}
+
+// Parse разбирает текст конфигурации SRS в модель
+func Parse(text string) (*Config, error) {
+	ds, err := ParseDirectives(text)
+	if err != nil {
+		return nil, err
+	}
+	return FromDirectives(ds), nil
+}
+
+// Bytes сериализует модель в текст конфигурации SRS
+func (c *Config) Bytes() []byte {
+	return FormatDirectives(c.Directives())
+}
+
+// block помогает разбирать директивы блока: известные забираются,
+// остальные остаются в rest в исходном порядке
+type block struct {
+	rest []Directive
+}
+
+func (b *block) take(name string) (Directive, bool) {
+	for i, d := range b.rest {
+		if d.Name == name {
+			b.rest = append(b.rest[:i:i], b.rest[i+1:]...)
+			return d, true
+		}
+	}
+	return Directive{}, false
+}
+
+func (b *block) str(name string) string {
+	d, _ := b.take(name)
+	return d.Arg()
+}
+
+func (b *block) args(name string) []string {
+	d, _ := b.take(name)
+	return d.Args
+}
+
+func (b *block) flag(name string) bool {
+	return b.str(name) == "on"
+}
+
+func (b *block) num(name string) float64 {
+	v, _ := strconv.ParseFloat(b.str(name), 64)
+	return v
+}
+
+func (b *block) int(name string) int {
+	return int(b.num(name))
+}
+
+func (b *block) sub(name string) []Directive {
+	d, _ := b.take(name)
+	return d.Block
+}
+
+// builder собирает директивы блока, пропуская пустые значения
+type builder []Directive
+
+func (b *builder) str(name, value string) {
+	if value != "" {
+		*b = append(*b, Directive{Name: name, Args: []string{value}})
+	}
+}
+
+func (b *builder) args(name string, values []string) {
+	if len(values) > 0 {
+		*b = append(*b, Directive{Name: name, Args: values})
+	}
+}
+
+func (b *builder) flag(name string, value bool) {
+	v := "off"
+	if value {
+		v = "on"
+	}
+	*b = append(*b, Directive{Name: name, Args: []string{v}})
+}
+
+func (b *builder) num(name string, value float64) {
+	if value != 0 {
+		b.str(name, strconv.FormatFloat(value, 'f', -1, 64))
+	}
+}
+
+func (b *builder) int(name string, value int) {
+	if value != 0 {
+		b.str(name, strconv.Itoa(value))
+	}
+}
+
+func (b *builder) block(name string, args []string, ds []Directive) {
+	if ds == nil {
+		ds = []Directive{}
+	}
+	*b = append(*b, Directive{Name: name, Args: args, Block: ds})
+}
+
+func FromDirectives(ds []Directive) *Config {
+	c := &Config{Vhosts: []Vhost{}}
+	b := &block{rest: append([]Directive{}, ds...)}
+	c.Listen = b.str("listen")
+	for name, dst := range map[string]**Server{"http_server": &c.HTTPServer, "http_api": &c.HTTPAPI, "srt_server": &c.SRTServer, "rtc_server": &c.RTCServer} {
+		if d, ok := b.take(name); ok {
+			*dst = serverFrom(d.Block)
+		}
+	}
+	for {
+		d, ok := b.take("vhost")
+		if !ok {
+			break
+		}
+		c.Vhosts = append(c.Vhosts, vhostFrom(d))
+	}
+	c.Extra = b.rest
+	return c
+}
+
+func (c *Config) Directives() []Directive {
+	b := builder{}
+	b.str("listen", c.Listen)
+	b = append(b, c.Extra...)
+	for _, s := range []struct {
+		name   string
+		server *Server
+	}{{"http_server", c.HTTPServer}, {"http_api", c.HTTPAPI}, {"srt_server", c.SRTServer}, {"rtc_server", c.RTCServer}} {
+		if s.server != nil {
+			b.block(s.name, nil, s.server.directives())
+		}
+	}
+	for _, v := range c.Vhosts {
+		b.block("vhost", []string{v.Name}, v.directives())
+	}
+	return b
+}
+
+func serverFrom(ds []Directive) *Server {
+	b := &block{rest: append([]Directive{}, ds...)}
+	return &Server{Enabled: b.flag("enabled"), Listen: b.str("listen"), Extra: b.rest}
+}
+
+func (s *Server) directives() []Directive {
+	b := builder{}
+	b.flag("enabled", s.Enabled)
+	b.str("listen", s.Listen)
+	return append(b, s.Extra...)
+}
+
+func vhostFrom(d Directive) Vhost {
+	v := Vhost{Name: d.Arg()}
+	b := &block{rest: append([]Directive{}, d.Block...)}
+	if h, ok := b.take("hls"); ok {
+		v.HLS = hlsFrom(h.Block)
+	}
+	if h, ok := b.take("http_hooks"); ok {
+		v.HTTPHooks = hooksFrom(h.Block)
+	}
+	for {
+		t, ok := b.take("transcode")
+		if !ok {
+			break
+		}
+		v.Transcodes = append(v.Transcodes, transcodeFrom(t))
+	}
+	if r, ok := b.take("rtc"); ok {
+		rb := &block{rest: r.Block}
+		v.RTC = &RTC{Enabled: rb.flag("enabled"), RTMPToRTC: rb.flag("rtmp_to_rtc"), RTCToRTMP: rb.flag("rtc_to_rtmp")}
+		v.RTC.Extra = rb.rest
+	}
+	if s, ok := b.take("srt"); ok {
+		sb := &block{rest: s.Block}
+		v.SRT = &SRT{Enabled: sb.flag("enabled"), SRTToRTMP: sb.flag("srt_to_rtmp")}
+		v.SRT.Extra = sb.rest
+	}
+	if d, ok := b.take("dvr"); ok {
+		db := &block{rest: d.Block}
+		v.DVR = &DVR{Enabled: db.flag("enabled"), Apply: db.args("dvr_apply"), Plan: db.str("dvr_plan"), Path: db.str("dvr_path")}
+		v.DVR.Extra = db.rest
+	}
+	v.Extra = b.rest
+	return v
+}
+
+func (v *Vhost) directives() []Directive {
+	b := builder(append([]Directive{}, v.Extra...))
+	if v.HLS != nil {
+		b.block("hls", nil, v.HLS.directives())
+	}
+	if v.HTTPHooks != nil {
+		b.block("http_hooks", nil, v.HTTPHooks.directives())
+	}
+	for _, t := range v.Transcodes {
+		var args []string
+		if t.Scope != "" {
+			args = []string{t.Scope}
+		}
+		b.block("transcode", args, t.directives())
+	}
+	if v.RTC != nil {
+		rb := builder{}
+		rb.flag("enabled", v.RTC.Enabled)
+		rb.flag("rtmp_to_rtc", v.RTC.RTMPToRTC)
+		rb.flag("rtc_to_rtmp", v.RTC.RTCToRTMP)
+		b.block("rtc", nil, append(rb, v.RTC.Extra...))
+	}
+	if v.SRT != nil {
+		sb := builder{}
+		sb.flag("enabled", v.SRT.Enabled)
+		sb.flag("srt_to_rtmp", v.SRT.SRTToRTMP)
+		b.block("srt", nil, append(sb, v.SRT.Extra...))
+	}
+	if v.DVR != nil {
+		db := builder{}
+		db.flag("enabled", v.DVR.Enabled)
+		db.args("dvr_apply", v.DVR.Apply)
+		db.str("dvr_plan", v.DVR.Plan)
+		db.str("dvr_path", v.DVR.Path)
+		b.block("dvr", nil, append(db, v.DVR.Extra...))
+	}
+	return b
+}
+
+func hlsFrom(ds []Directive) *HLS {
+	b := &block{rest: append([]Directive{}, ds...)}
+	h := &HLS{
+		Enabled:  b.flag("enabled"),
+		Path:     b.str("hls_path"),
+		Fragment: b.num("hls_fragment"),
+		Window:   b.num("hls_window"),
+		M3U8File: b.str("hls_m3u8_file"),
+		TSFile:   b.str("hls_ts_file"),
+	}
+	h.Extra = b.rest
+	return h
+}
+
+func (h *HLS) directives() []Directive {
+	b := builder{}
+	b.flag("enabled", h.Enabled)
+	b.str("hls_path", h.Path)
+	b.num("hls_fragment", h.Fragment)
+	b.num("hls_window", h.Window)
+	b.str("hls_m3u8_file", h.M3U8File)
+	b.str("hls_ts_file", h.TSFile)
+	return append(b, h.Extra...)
+}
+
+func hooksFrom(ds []Directive) *HTTPHooks {
+	b := &block{rest: append([]Directive{}, ds...)}
+	h := &HTTPHooks{
+		Enabled:     b.flag("enabled"),
+		OnConnect:   b.args("on_connect"),
+		OnClose:     b.args("on_close"),
+		OnPublish:   b.args("on_publish"),
+		OnUnpublish: b.args("on_unpublish"),
+		OnPlay:      b.args("on_play"),
+		OnStop:      b.args("on_stop"),
+		OnDVR:       b.args("on_dvr"),
+		OnHLS:       b.args("on_hls"),
+	}
+	h.Extra = b.rest
+	return h
+}
+
+func (h *HTTPHooks) directives() []Directive {
+	b := builder{}
+	b.flag("enabled", h.Enabled)
+	b.args("on_connect", h.OnConnect)
+	b.args("on_close", h.OnClose)
+	b.args("on_publish", h.OnPublish)
+	b.args("on_unpublish", h.OnUnpublish)
+	b.args("on_play", h.OnPlay)
+	b.args("on_stop", h.OnStop)
+	b.args("on_dvr", h.OnDVR)
+	b.args("on_hls", h.OnHLS)
+	return append(b, h.Extra...)
+}
+
+func transcodeFrom(d Directive) Transcode {
+	b := &block{rest: append([]Directive{}, d.Block...)}
+	t := Transcode{Scope: d.Arg(), Enabled: b.flag("enabled"), FFmpeg: b.str("ffmpeg")}
+	for {
+		e, ok := b.take("engine")
+		if !ok {
+			break
+		}
+		t.Engines = append(t.Engines, engineFrom(e))
+	}
+	t.Extra = b.rest
+	return t
+}
+
+func (t *Transcode) directives() []Directive {
+	b := builder{}
+	b.flag("enabled", t.Enabled)
+	b.str("ffmpeg", t.FFmpeg)
+	b = append(b, t.Extra...)
+	for _, e := range t.Engines {
+		b.block("engine", []string{e.Name}, e.directives())
+	}
+	return b
+}
+
+func engineFrom(d Directive) Engine {
+	b := &block{rest: append([]Directive{}, d.Block...)}
+	e := Engine{
+		Name:        d.Arg(),
+		Enabled:     b.flag("enabled"),
+		VFilter:     b.sub("vfilter"),
+		VCodec:      b.str("vcodec"),
+		VBitrate:    b.int("vbitrate"),
+		VFPS:        b.int("vfps"),
+		VWidth:      b.int("vwidth"),
+		VHeight:     b.int("vheight"),
+		VThreads:    b.int("vthreads"),
+		VProfile:    b.str("vprofile"),
+		VPreset:     b.str("vpreset"),
+		VParams:     b.sub("vparams"),
+		ACodec:      b.str("acodec"),
+		ABitrate:    b.int("abitrate"),
+		ASampleRate: b.int("asample_rate"),
+		AChannels:   b.int("achannels"),
+		AParams:     b.sub("aparams"),
+		Output:      b.str("output"),
+	}
+	e.Extra = b.rest
+	return e
+}
+
+func (e *Engine) directives() []Directive {
+	b := builder{}
+	b.flag("enabled", e.Enabled)
+	b.block("vfilter", nil, e.VFilter)
+	b.str("vcodec", e.VCodec)
+	b.int("vbitrate", e.VBitrate)
+	b.int("vfps", e.VFPS)
+	b.int("vwidth", e.VWidth)
+	b.int("vheight", e.VHeight)
+	b.int("vthreads", e.VThreads)
+	b.str("vprofile", e.VProfile)
+	b.str("vpreset", e.VPreset)
+	b.block("vparams", nil, e.VParams)
+	b.str("acodec", e.ACodec)
+	b.int("abitrate", e.ABitrate)
+	b.int("asample_rate", e.ASampleRate)
+	b.int("achannels", e.AChannels)
+	b.block("aparams", nil, e.AParams)
+	b.str("output", e.Output)
+	return append(b, e.Extra...)
+}
@@ -0,0 +1,245 @@
+package srsconfig
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	DefaultVhost       = "__defaultVhost__"
+	profileVhostPrefix = "profile_"
+)
+
+var (
+	ErrProfileInvalid = errors.New("TRANSCODE_PROFILE_INVALID")
+	reProfileName     = regexp.MustCompile(`^[a-z0-9][a-z0-9_]{0,31}$`)
+
+	// RungNames - варианты, для которых в конфигурации есть vhost с HLS.
+	// low обязателен: из него извлекается звук и по нему выравниваются субтитры
+	RungNames = []string{"low", "mid", "high"}
+)
+
+// Profile - именованная лестница транскодирования. Стримы с профилем
+// публикуются в отдельный vhost, где вместо общих engine работают ступени профиля
+type Profile struct {
+	Name  string `json:"name"`
+	Rungs []Rung `json:"rungs"`
+}
+
+// Rung - ступень лестницы, выводится в vhost варианта с тем же именем
+type Rung struct {
+	Name        string `json:"name"`
+	Passthrough bool   `json:"passthrough,omitempty"` // без перекодирования, VBitrate - ожидаемый битрейт источника
+	VCodec      string `json:"vcodec,omitempty"`
+	VBitrate    int    `json:"vbitrate"`
+	VFPS        int    `json:"vfps,omitempty"`
+	VWidth      int    `json:"vwidth,omitempty"`
+	VHeight     int    `json:"vheight,omitempty"`
+	VProfile    string `json:"vprofile,omitempty"`
+	VPreset     string `json:"vpreset,omitempty"`
+	ACodec      string `json:"acodec,omitempty"`
+	ABitrate    int    `json:"abitrate,omitempty"`
+	ASampleRate int    `json:"asampleRate,omitempty"`
+	AChannels   int    `json:"achannels,omitempty"`
+}
+
+// ProfileVhost возвращает имя vhost, в который публикуются стримы профиля
+func ProfileVhost(name string) string {
+	return profileVhostPrefix + name
+}
+
+// Validate проверяет профиль до сохранения
+func (p Profile) Validate() error {
+	problems := []string{}
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if !reProfileName.MatchString(p.Name) {
+		add("name: must match %s", reProfileName)
+	}
+	if len(p.Rungs) == 0 {
+		add("rungs: empty")
+	}
+	seen := map[string]bool{}
+	for _, r := range p.Rungs {
+		known := false
+		for _, name := range RungNames {
+			known = known || r.Name == name
+		}
+		if !known {
+			add("rung %q: name must be one of %s", r.Name, strings.Join(RungNames, ", "))
+		}
+		if seen[r.Name] {
+			add("rung %s: duplicate", r.Name)
+		}
+		seen[r.Name] = true
+		if r.VBitrate <= 0 {
+			add("rung %s: vbitrate must be positive", r.Name)
+		}
+		if r.Passthrough {
+			continue
+		}
+		if r.VWidth <= 0 && r.VHeight <= 0 {
+			add("rung %s: vwidth or vheight is required", r.Name)
+		}
+		if r.VFPS < 0 {
+			add("rung %s: vfps is negative", r.Name)
+		}
+		if r.ABitrate <= 0 {
+			add("rung %s: abitrate must be positive", r.Name)
+		}
+	}
+	if len(p.Rungs) > 0 && !seen[RungNames[0]] {
+		add("rungs: %s is required", RungNames[0])
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrProfileInvalid, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Engine рендерит ступень в engine SRS с параметрами по умолчанию как в srs_base.tpl
+func (r Rung) Engine() Engine {
+	e := Engine{
+		Name:    r.Name,
+		Enabled: true,
+		VFilter: []Directive{},
+		AParams: []Directive{},
+		Output:  fmt.Sprintf("rtmp://127.0.0.1:[port]/%s?vhost=%s/[stream]", r.Name, r.Name),
+	}
+	if r.Passthrough {
+		e.VCodec, e.ACodec = "copy", "copy"
+		e.VParams = []Directive{}
+		return e
+	}
+
+	e.VCodec = orDefault(r.VCodec, "libx264")
+	e.VBitrate = r.VBitrate
+	e.VFPS = r.VFPS
+	if e.VFPS == 0 {
+		e.VFPS = 25
+	}
+	e.VWidth, e.VHeight = r.VWidth, r.VHeight
+	if e.VWidth == 0 {
+		e.VWidth = -1
+	}
+	if e.VHeight == 0 {
+		e.VHeight = -1
+	}
+	e.VThreads = 2
+	e.VProfile = orDefault(r.VProfile, "main")
+	e.VPreset = orDefault(r.VPreset, "veryfast")
+	e.VParams = []Directive{
+		{Name: "maxrate", Args: []string{fmt.Sprintf("%dk", r.VBitrate)}},
+		{Name: "bufsize", Args: []string{fmt.Sprintf("%dk", r.VBitrate/2)}},
+		{Name: "g", Args: []string{fmt.Sprint(e.VFPS * 2)}},
+	}
+	e.ACodec = orDefault(r.ACodec, "aac")
+	e.ABitrate = r.ABitrate
+	e.ASampleRate = r.ASampleRate
+	if e.ASampleRate == 0 {
+		e.ASampleRate = 44100
+	}
+	e.AChannels = r.AChannels
+	if e.AChannels == 0 {
+		e.AChannels = 2
+	}
+	return e
+}
+
+// Bandwidth - пиковый битрейт ступени для EXT-X-STREAM-INF, бит/с
+func (r Rung) Bandwidth() int {
+	return (r.VBitrate + r.ABitrate) * 1000 * 105 / 100
+}
+
+// Resolution возвращает размер кадра; при одной заданной стороне
+// вторая считается для 16:9 с округлением до четного, как у libx264 с -1
+func (r Rung) Resolution() (int, int) {
+	w, h := r.VWidth, r.VHeight
+	switch {
+	case w <= 0 && h > 0:
+		w = h * 16 / 9 &^ 1
+	case h <= 0 && w > 0:
+		h = w * 9 / 16 &^ 1
+	}
+	return w, h
+}
+
+// Codecs возвращает значение атрибута CODECS по RFC 6381
+func (r Rung) Codecs() string {
+	if r.Passthrough {
+		return "avc1.4d0028,mp4a.40.2"
+	}
+
+	video := "avc1.4d0028"
+	switch strings.ToLower(r.VCodec) {
+	case "libx265", "hevc":
+		video = "hvc1.1.6.L120.90"
+	default:
+		switch strings.ToLower(r.VProfile) {
+		case "baseline":
+			video = "avc1.42e01e"
+		case "high":
+			video = "avc1.640028"
+		}
+		if _, h := r.Resolution(); h > 1080 {
+			video = video[:len(video)-2] + "33"
+		}
+	}
+
+	audio := "mp4a.40.2"
+	switch strings.ToLower(r.ACodec) {
+	case "libmp3lame", "mp3":
+		audio = "mp4a.40.34"
+	case "libopus", "opus":
+		audio = "opus"
+	}
+	return video + "," + audio
+}
+
+// ApplyProfiles добавляет для каждого профиля vhost - копию __defaultVhost__,
+// в котором общие engine заменены ступенями профиля
+func (c *Config) ApplyProfiles(profiles []Profile) error {
+	var base *Vhost
+	for i := range c.Vhosts {
+		if c.Vhosts[i].Name == DefaultVhost {
+			base = &c.Vhosts[i]
+		}
+	}
+	if base == nil && len(profiles) > 0 {
+		return fmt.Errorf("%w: vhost %s is not defined", ErrConfigInvalid, DefaultVhost)
+	}
+
+	for _, p := range profiles {
+		ffmpeg := ""
+		transcodes := []Transcode{}
+		for _, t := range base.Transcodes {
+			if t.Scope == "" {
+				ffmpeg = t.FFmpeg
+				continue
+			}
+			transcodes = append(transcodes, t)
+		}
+		t := Transcode{Enabled: true, FFmpeg: ffmpeg}
+		for _, r := range p.Rungs {
+			t.Engines = append(t.Engines, r.Engine())
+		}
+
+		v := *base
+		v.Name = ProfileVhost(p.Name)
+		v.Transcodes = append([]Transcode{t}, transcodes...)
+		c.Vhosts = append(c.Vhosts, v)
+	}
+	return nil
+}
+
+func orDefault(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
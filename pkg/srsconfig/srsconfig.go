@@ -2,128 +2,220 @@ package srsconfig
 
 import (
 	"bytes"
-	"embed"
+	"context"
 	"fmt"
+	"io/fs"
 	"io/ioutil"
-	"text/template"
+	"sync"
+	"time"
 )
 
+// SRSstream - активный стрим узла, по стримам генерируется dvr_apply
 type SRSstream struct {
-	ID       string
-	Password string
+	ID  string
+	App string
+	DVR bool // запись стрима в файл, нужен App
 }
 
 type SRSConfig struct {
-	Streams    []SRSstream
-	ConfigPath string
-	SRSClient  ConfigReloader
-	tplStorage embed.FS
+	Streams      []SRSstream
+	Profiles     []Profile
+	ConfigPath   string
+	SRSClient    ConfigReloader
+	BatchWindow  time.Duration // изменения за это время применяются одной перезагрузкой
+	TemplateData interface{}   // доступна в шаблонах как .Config
+	AdoptPath    string        // куда сохраняется принятая с диска конфигурация, пусто - только в памяти
+	BaseTemplate string        // шаблон общей части узла, без него или файла - srs_base.tpl
+	tplStorage   fs.FS
+
+	mu      sync.Mutex  // Streams, Profiles и состояние ниже
+	applyMu sync.Mutex  // применение конфигурации
+	current *Config     // последняя примененная конфигурация
+	applied []SRSstream // стримы последней примененной конфигурации
+	pending []change
+	stats   ReloadStats
+	adopted []Directive // общая часть, принятая с диска вместо srs_base.tpl
+	drift   DriftReport
 }
 
+// ConfigReloader перечитывает конфигурацию SRS и позволяет проверить ее применение
 type ConfigReloader interface {
-	ConfigReload() error
+	ConfigReload(context.Context) error
+	ActiveVhosts(context.Context) ([]string, error)
+	PublishingStreams(context.Context) ([]string, error)
 }
 
-func New(srsConfigPath string, tplStorage embed.FS, srsClient ConfigReloader) *SRSConfig {
+func New(srsConfigPath string, tplStorage fs.FS, srsClient ConfigReloader) *SRSConfig {
 	return &SRSConfig{
-		Streams:    make([]SRSstream, 0),
-		ConfigPath: srsConfigPath,
-		SRSClient:  srsClient,
-		tplStorage: tplStorage,
+		Streams:     make([]SRSstream, 0),
+		Profiles:    make([]Profile, 0),
+		ConfigPath:  srsConfigPath,
+		SRSClient:   srsClient,
+		BatchWindow: DefaultBatchWindow,
+		tplStorage:  tplStorage,
 	}
 }
 
+// Init пишет начальную конфигурацию. SRS может быть еще не запущен,
+// поэтому ошибка перезагрузки не откатывает файл: SRS прочитает его при старте
 func (s *SRSConfig) Init(streams []SRSstream) {
-	for i := 0; i < len(streams); i++ {
-		s.Streams = append(s.Streams, SRSstream{
-			ID:       streams[i].ID,
-			Password: streams[i].Password,
-		})
-	}
-	err := s.configReload()
+	s.applyMu.Lock()
+	defer s.applyMu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Streams = append(s.Streams, streams...)
+
+	cfg, err := s.render()
 	if err != nil {
 		fmt.Printf("error: %v", err)
 		return
 	}
+	if err := writeFileAtomic(s.ConfigPath, cfg.Bytes()); err != nil {
+		fmt.Printf("error: %v", err)
+		return
+	}
+	s.current = cfg
+	s.applied = append([]SRSstream{}, s.Streams...)
+	if err := s.SRSClient.ConfigReload(context.Background()); err != nil {
+		fmt.Printf("error: %v", err)
+	}
 }
 
-func (s *SRSConfig) AddRTC(id, pass string) {
-	for i := 0; i < len(s.Streams); i++ {
-		if s.Streams[i].ID == id {
-			return
+// AddStream добавляет стрим или заменяет его параметры. Без изменений
+// конфигурация не применяется
+func (s *SRSConfig) AddStream(stream SRSstream) error {
+	s.mu.Lock()
+	for _, v := range s.Streams {
+		if v == stream {
+			s.mu.Unlock()
+			return nil
 		}
 	}
-	s.Streams = append(s.Streams, SRSstream{
-		ID:       id,
-		Password: pass,
+	return s.submit(func() func() {
+		for i := 0; i < len(s.Streams); i++ {
+			if s.Streams[i].ID == stream.ID {
+				prev := s.Streams[i]
+				s.Streams[i] = stream
+				return func() {
+					s.removeStream(stream.ID)
+					s.Streams = append(s.Streams, prev)
+				}
+			}
+		}
+		s.Streams = append(s.Streams, stream)
+		return func() { s.removeStream(stream.ID) }
 	})
-	err := s.configReload()
-	if err != nil {
-		fmt.Printf("error: %v", err)
-		return
-	}
+}
 
+// RemoveStream убирает стрим из конфигурации
+func (s *SRSConfig) RemoveStream(id string) error {
+	s.mu.Lock()
+	found := false
+	for _, v := range s.Streams {
+		found = found || v.ID == id
+	}
+	if !found {
+		s.mu.Unlock()
+		return nil
+	}
+	return s.submit(func() func() {
+		for i := 0; i < len(s.Streams); i++ {
+			if s.Streams[i].ID == id {
+				stream := s.Streams[i]
+				s.removeStream(id)
+				return func() { s.Streams = append(s.Streams, stream) }
+			}
+		}
+		return nil
+	})
 }
 
-func (s *SRSConfig) RemoveRTC(id string) {
+func (s *SRSConfig) removeStream(id string) {
 	for i := 0; i < len(s.Streams); i++ {
 		if s.Streams[i].ID == id {
-			s.Streams = append(s.Streams[:i], s.Streams[i+1:]...)
-			err := s.configReload()
-			if err != nil {
-				fmt.Printf("error: %v", err)
-				return
-			}
+			s.Streams = append(s.Streams[:i:i], s.Streams[i+1:]...)
+			return
 		}
 	}
 }
 
-func (s *SRSConfig) configReload() error {
-	var newConfig []byte
-	tData, err := s.tplStorage.ReadFile("srs_custom.tpl")
-	if err != nil {
-		return err
-	}
-	t, err := template.New("custom").Parse(string(tData))
-	if err != nil {
-		return err
-	}
+// SetProfiles заменяет профили транскодирования и применяет конфигурацию.
+// Если она не применилась, остаются прежние профили
+func (s *SRSConfig) SetProfiles(profiles []Profile) error {
+	s.mu.Lock()
+	return s.submit(func() func() {
+		prev := s.Profiles
+		s.Profiles = profiles
+		return func() { s.Profiles = prev }
+	})
+}
 
-	buf := bytes.NewBuffer(newConfig)
+// Reload перерисовывает конфигурацию и перезагружает SRS без изменений
+func (s *SRSConfig) Reload() error {
+	s.mu.Lock()
+	return s.submit(nil)
+}
 
-	for _, v := range s.Streams {
-		item := struct {
-			RTCStreamUUID     string
-			RTCStreamPassword string
-		}{
-			RTCStreamUUID:     v.ID,
-			RTCStreamPassword: v.Password,
-		}
+// Render возвращает конфигурацию, которую сгенерировали бы шаблоны
+// для текущих стримов и профилей, без записи и перезагрузки
+func (s *SRSConfig) Render() (*Config, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.render()
+}
 
-		if err := t.Execute(buf, item); err != nil {
-			return err
-		}
+// Current возвращает действующую конфигурацию: последнюю примененную
+// или, если ее еще нет, прочитанную из ConfigPath
+func (s *SRSConfig) Current() (*Config, error) {
+	s.mu.Lock()
+	current := s.current
+	s.mu.Unlock()
+	if current != nil {
+		return current, nil
 	}
 
-	tBaseData, err := s.tplStorage.ReadFile("srs_base.tpl")
+	data, err := ioutil.ReadFile(s.ConfigPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	tBase, err := template.New("base").Parse(string(tBaseData))
+	return Parse(string(data))
+}
+
+// render собирает конфигурацию из шаблонов и проверяет ее
+func (s *SRSConfig) render() (*Config, error) {
+	base, err := s.renderBase()
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return s.build(base)
+}
 
-	if err := tBase.Execute(buf, nil); err != nil {
-		return err
+// renderBase рендерит общую часть из шаблона узла или принятой с диска конфигурации
+func (s *SRSConfig) renderBase() ([]Directive, error) {
+	if s.adopted != nil {
+		return s.adopted, nil
 	}
-	s.SRSClient.ConfigReload()
 
-	// fmt.Printf("newConfig: %s", buf.String())
-	err = ioutil.WriteFile(s.ConfigPath, buf.Bytes(), 0644)
+	t, err := s.baseTemplate()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	if err := t.Execute(buf, templateData{Config: s.TemplateData}); err != nil {
+		return nil, err
 	}
+	return ParseDirectives(buf.String())
+}
 
-	return nil
+func (s *SRSConfig) build(base []Directive) (*Config, error) {
+	cfg := FromDirectives(append([]Directive{}, base...))
+	if err := cfg.ApplyProfiles(s.Profiles); err != nil {
+		return nil, err
+	}
+	cfg.ApplyDVR(s.dvrApply())
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
 }
@@ -0,0 +1,454 @@
+package srsconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"srsmgmt/config"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// renderBase рендерит встроенные шаблоны без стримов и профилей
+func renderBase(t *testing.T) *Config {
+	s := New("", config.GetConfig().TplStorage, nil)
+	s.TemplateData = &config.Config{HTTPAddr: "0.0.0.0:8887", RTCPort: 8000, RTCCandidate: "*"}
+	cfg, err := s.Render()
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	return cfg
+}
+
+func TestParseBaseTemplate(t *testing.T) {
+	cfg := renderBase(t)
+	if cfg.HTTPAPI == nil || !cfg.HTTPAPI.Enabled || len(cfg.Vhosts) != 4 {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+	if hooks := cfg.Vhosts[0].HTTPHooks; hooks == nil || len(hooks.OnPublish) != 1 || hooks.OnPublish[0] != "http://127.0.0.1:8887/api/v1/webhook/stream/live" {
+		t.Errorf("unexpected hooks %+v", hooks)
+	}
+	if cfg.RTCServer == nil || cfg.RTCServer.Listen != "8000" || cfg.Vhosts[0].RTC == nil || !cfg.Vhosts[0].RTC.RTCToRTMP {
+		t.Errorf("unexpected rtc %+v %+v", cfg.RTCServer, cfg.Vhosts[0].RTC)
+	}
+
+	again, err := Parse(string(cfg.Bytes()))
+	if err != nil {
+		t.Fatalf("Parse serialized: %v", err)
+	}
+	if !reflect.DeepEqual(cfg, again) {
+		t.Errorf("round trip mismatch:\n%s\n---\n%s", cfg.Bytes(), again.Bytes())
+	}
+}
+
+func TestTemplatesOverride(t *testing.T) {
+	dir := t.TempDir()
+	base := "listen 1935;\nhttp_api { enabled on; listen 1985; }\nvhost __defaultVhost__ { http_hooks { enabled on; on_publish http://{{hostport .Config.HTTPAddr}}/api/v1/webhook/stream/live; } }\n"
+	if err := os.WriteFile(dir+"/srs_base.tpl", []byte(base), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := New("", Templates(dir, config.GetConfig().TplStorage), nil)
+	s.TemplateData = &config.Config{HTTPAddr: "10.0.0.1:9000"}
+	s.Streams = []SRSstream{{ID: "s1"}}
+	cfg, err := s.Render()
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if len(cfg.Vhosts) != 1 {
+		t.Errorf("base template is not overridden:\n%s", cfg.Bytes())
+	}
+	if hooks := cfg.Vhosts[0].HTTPHooks; hooks == nil || len(hooks.OnPublish) != 1 || hooks.OnPublish[0] != "http://10.0.0.1:9000/api/v1/webhook/stream/live" {
+		t.Errorf("template data is not used: %+v", hooks)
+	}
+}
+
+func TestParseDirectives(t *testing.T) {
+	ds, err := ParseDirectives("# comment\nlisten 1935;\nvhost v { hls { hls_ts_file 'a b.ts'; } }\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Directive{
+		{Name: "listen", Args: []string{"1935"}},
+		{Name: "vhost", Args: []string{"v"}, Block: []Directive{
+			{Name: "hls", Block: []Directive{{Name: "hls_ts_file", Args: []string{"a b.ts"}}}},
+		}},
+	}
+	if !reflect.DeepEqual(ds, want) {
+		t.Errorf("want %+v, have %+v", want, ds)
+	}
+
+	for _, text := range []string{"listen 1935", "vhost v {", "}", "listen 'x;"} {
+		if _, err := ParseDirectives(text); !errors.Is(err, ErrConfigSyntax) {
+			t.Errorf("%q: want %v, have %v", text, ErrConfigSyntax, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg, err := Parse(`
+listen 1935;
+http_api { enabled on; listen 1985; }
+vhost a {
+    hls { enabled on; hls_path ./html; hls_fragment 2; hls_m3u8_file live/[stream].m3u8; hls_ts_file live/[stream].ts; }
+    transcode { enabled on; ffmpeg ./ffmpeg; engine e { enabled on; vcodec libx264; vbitrate 500; acodec copy; output rtmp://127.0.0.1/x?vhost=b/[stream]; } }
+    rtc { enabled on; }
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cfg.Validate()
+	if !errors.Is(err, ErrConfigInvalid) {
+		t.Fatalf("want %v, have %v", ErrConfigInvalid, err)
+	}
+	for _, problem := range []string{"hls_ts_file must contain [seq]", "output vhost b is not defined", "rtc requires rtc_server"} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Errorf("missing problem %q in %v", problem, err)
+		}
+	}
+}
+
+func TestApplyProfiles(t *testing.T) {
+	cfg := renderBase(t)
+
+	profile := Profile{Name: "sd", Rungs: []Rung{
+		{Name: "low", VBitrate: 800, VHeight: 360, ABitrate: 96},
+		{Name: "mid", Passthrough: true, VBitrate: 3000},
+	}}
+	if err := profile.Validate(); err != nil {
+		t.Fatalf("Validate profile: %v", err)
+	}
+	if err := cfg.ApplyProfiles([]Profile{profile}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate config: %v", err)
+	}
+
+	v := cfg.Vhosts[len(cfg.Vhosts)-1]
+	if v.Name != "profile_sd" || v.HTTPHooks == nil || len(v.Transcodes) != 1 {
+		t.Fatalf("unexpected vhost %+v", v)
+	}
+	engines := v.Transcodes[0].Engines
+	if len(engines) != 2 || engines[0].VHeight != 360 || engines[0].VWidth != -1 || engines[1].VCodec != "copy" {
+		t.Errorf("unexpected engines %+v", engines)
+	}
+	if engines[0].Output != "rtmp://127.0.0.1:[port]/low?vhost=low/[stream]" {
+		t.Errorf("unexpected output %s", engines[0].Output)
+	}
+
+	w, h := profile.Rungs[0].Resolution()
+	if w != 640 || h != 360 || profile.Rungs[0].Bandwidth() != 940800 {
+		t.Errorf("unexpected rendition %dx%d %d", w, h, profile.Rungs[0].Bandwidth())
+	}
+}
+
+func TestApplyDVR(t *testing.T) {
+	s := New("", config.GetConfig().TplStorage, nil)
+	s.TemplateData = &config.Config{HTTPAddr: "0.0.0.0:8887", RTCPort: 8000, RTCCandidate: "*", DVRPath: "/data/dvr", DVRFormat: "flv"}
+	s.Profiles = []Profile{{Name: "sd", Rungs: []Rung{{Name: "low", Passthrough: true, VBitrate: 1000}}}}
+	s.Streams = []SRSstream{{ID: "s1", App: "live", DVR: true}, {ID: "s2", App: "live"}}
+	cfg, err := s.Render()
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	for _, v := range cfg.Vhosts {
+		if v.Name != DefaultVhost && v.Name != "profile_sd" {
+			if v.DVR != nil {
+				t.Errorf("vhost %s: unexpected dvr %+v", v.Name, v.DVR)
+			}
+			continue
+		}
+		if d := v.DVR; d == nil || !d.Enabled || !reflect.DeepEqual(d.Apply, []string{"live/s1"}) || d.Path != "/data/dvr/[app]/[stream]/[2006]-[01]-[02]-[15]-[04]-[05].flv" {
+			t.Errorf("vhost %s: unexpected dvr %+v", v.Name, d)
+		}
+	}
+
+	// без стримов с записью блок остается выключенным
+	s.Streams = s.Streams[1:]
+	if cfg, err = s.Render(); err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if d := cfg.Vhosts[0].DVR; d == nil || d.Enabled || d.Apply != nil {
+		t.Errorf("unexpected dvr %+v", d)
+	}
+}
+
+func TestValidateProfile(t *testing.T) {
+	for _, p := range []Profile{
+		{Name: "Bad Name", Rungs: []Rung{{Name: "low", Passthrough: true, VBitrate: 1000}}},
+		{Name: "hd"},
+		{Name: "hd", Rungs: []Rung{{Name: "mid", Passthrough: true, VBitrate: 1000}}},
+		{Name: "hd", Rungs: []Rung{{Name: "low", VBitrate: 1000, ABitrate: 64}}},
+		{Name: "hd", Rungs: []Rung{{Name: "low", Passthrough: true, VBitrate: 1000}, {Name: "low", Passthrough: true, VBitrate: 1000}}},
+		{Name: "hd", Rungs: []Rung{{Name: "uhd", Passthrough: true, VBitrate: 1000}}},
+	} {
+		if err := p.Validate(); !errors.Is(err, ErrProfileInvalid) {
+			t.Errorf("%+v: want %v, have %v", p, ErrProfileInvalid, err)
+		}
+	}
+}
+
+type fakeReloader struct {
+	reloads    int
+	vhosts     []string
+	publishing []string
+	dropped    bool // перезагрузка обрывает публикации
+	onReload   func(n int)
+}
+
+func (f *fakeReloader) ConfigReload(context.Context) error {
+	f.reloads++
+	if f.onReload != nil {
+		f.onReload(f.reloads)
+	}
+	if f.dropped {
+		f.publishing = nil
+	}
+	return nil
+}
+
+func (f *fakeReloader) ActiveVhosts(context.Context) ([]string, error)      { return f.vhosts, nil }
+func (f *fakeReloader) PublishingStreams(context.Context) ([]string, error) { return f.publishing, nil }
+
+func TestApplyRollback(t *testing.T) {
+	VerifyAttempts, VerifyInterval = 2, 0
+	path := t.TempDir() + "/srs.conf"
+	if err := os.WriteFile(path, []byte("listen 1935;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Parse("listen 1936;\nhttp_api { enabled on; listen 1985; }\nvhost a { }\nvhost b { enabled off; }\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &fakeReloader{vhosts: []string{"other"}, publishing: []string{"s1"}}
+	s := &SRSConfig{ConfigPath: path, SRSClient: client}
+	if err := s.apply(cfg, nil); !errors.Is(err, ErrConfigApply) || !strings.Contains(err.Error(), "vhosts not active: a") {
+		t.Fatalf("want %v, have %v", ErrConfigApply, err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "listen 1935;\n" {
+		t.Errorf("config is not restored: %s", data)
+	}
+	if client.reloads != 2 {
+		t.Errorf("want reload and rollback reload, have %d reloads", client.reloads)
+	}
+
+	client.vhosts = []string{"a"}
+	if err := s.apply(cfg, nil); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != string(cfg.Bytes()) {
+		t.Errorf("config is not written: %s", data)
+	}
+	if current, _ := s.Current(); current != cfg {
+		t.Error("current config is not updated")
+	}
+
+	// стрим, пропавший после перезагрузки, откатывает изменение
+	client.dropped = true
+	if err := s.apply(cfg, nil); !errors.Is(err, ErrConfigApply) || !strings.Contains(err.Error(), "streams not active: s1") {
+		t.Fatalf("want %v, have %v", ErrConfigApply, err)
+	}
+
+	// стрим, удаленный из конфигурации, не проверяется
+	client.publishing = []string{"s1"}
+	s.applied = []SRSstream{{ID: "s1"}}
+	if err := s.apply(cfg, nil); err != nil {
+		t.Fatalf("apply with removed stream: %v", err)
+	}
+}
+
+func TestBatchReload(t *testing.T) {
+	VerifyAttempts, VerifyInterval = 1, 0
+	client := &fakeReloader{}
+	s := New(t.TempDir()+"/srs.conf", config.GetConfig().TplStorage, client)
+	s.TemplateData = config.GetConfig()
+	s.BatchWindow = 50 * time.Millisecond
+	cfg, err := s.render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.vhosts = cfg.vhostNames()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := s.AddStream(SRSstream{ID: fmt.Sprint("s", i)}); err != nil {
+				t.Errorf("AddStream: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	stats := s.Stats()
+	if client.reloads != 1 || stats.Reloads != 1 || stats.Changes != 10 {
+		t.Errorf("want 10 changes in 1 reload, have %d reloads, stats %+v", client.reloads, stats)
+	}
+	if len(s.Streams) != 10 {
+		t.Errorf("want 10 streams, have %d", len(s.Streams))
+	}
+
+	// неприменившаяся пачка откатывается целиком
+	client.vhosts = nil
+	errs := make(chan error, 2)
+	go func() { errs <- s.RemoveStream("s1") }()
+	go func() { errs <- s.AddStream(SRSstream{ID: "s10"}) }()
+	for i := 0; i < 2; i++ {
+		if err := <-errs; !errors.Is(err, ErrConfigApply) {
+			t.Errorf("want %v, have %v", ErrConfigApply, err)
+		}
+	}
+	if stats := s.Stats(); len(s.Streams) != 10 || stats.Failures != 1 || stats.LastError == "" {
+		t.Errorf("batch is not rolled back: %d streams, stats %+v", len(s.Streams), stats)
+	}
+}
+
+// TestRollbackKeepsLaterChanges: откат неприменившейся пачки не затирает
+// изменение, поступившее во время ее применения
+func TestRollbackKeepsLaterChanges(t *testing.T) {
+	VerifyAttempts, VerifyInterval = 1, 0
+	client := &fakeReloader{}
+	s := New(t.TempDir()+"/srs.conf", config.GetConfig().TplStorage, client)
+	s.TemplateData = config.GetConfig()
+	s.BatchWindow = 10 * time.Millisecond
+
+	sd := []Profile{{Name: "sd", Rungs: []Rung{{Name: "low", Passthrough: true, VBitrate: 1000}}}}
+	hd := []Profile{{Name: "hd", Rungs: []Rung{{Name: "high", Passthrough: true, VBitrate: 4000}}}}
+	later := make(chan error, 1)
+	client.onReload = func(n int) {
+		switch n {
+		case 1:
+			// первая пачка применяется и не пройдет проверку vhost
+			go func() { later <- s.SetProfiles(hd) }()
+			for s.Stats().Pending == 0 {
+				time.Sleep(time.Millisecond)
+			}
+		default:
+			// следующая пачка применяется успешно
+			cfg, err := s.Render()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			client.vhosts = cfg.vhostNames()
+		}
+	}
+
+	if err := s.SetProfiles(sd); !errors.Is(err, ErrConfigApply) {
+		t.Fatalf("want %v, have %v", ErrConfigApply, err)
+	}
+	if err := <-later; err != nil {
+		t.Fatalf("later change: %v", err)
+	}
+	if !reflect.DeepEqual(s.Profiles, hd) {
+		t.Errorf("later change is lost, profiles %+v", s.Profiles)
+	}
+	cfg, _ := s.Current()
+	if !strings.Contains(string(cfg.Bytes()), ProfileVhost("hd")) || strings.Contains(string(cfg.Bytes()), ProfileVhost("sd")) {
+		t.Errorf("unexpected applied config:\n%s", cfg.Bytes())
+	}
+}
+
+func TestCheckDrift(t *testing.T) {
+	VerifyAttempts, VerifyInterval = 1, 0
+	dir := t.TempDir()
+	client := &fakeReloader{}
+	s := New(dir+"/srs.conf", config.GetConfig().TplStorage, client)
+	s.TemplateData = config.GetConfig()
+	s.AdoptPath = dir + "/srs_base.tpl"
+	cfg, err := s.Render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.vhosts = cfg.vhostNames()
+	if err := os.WriteFile(s.ConfigPath, cfg.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if report, err := s.CheckDrift(DriftAlert); err != nil || report.Drifted {
+		t.Fatalf("unexpected drift %+v: %v", report, err)
+	}
+
+	edited := strings.Replace(string(cfg.Bytes()), "hls_fragment 2;", "hls_fragment 4;", 1)
+	if err := os.WriteFile(s.ConfigPath, []byte(edited), 0644); err != nil {
+		t.Fatal(err)
+	}
+	report, err := s.CheckDrift(DriftAlert)
+	if err != nil || !report.Drifted || report.Detections != 1 || report.Checks != 2 {
+		t.Fatalf("drift is not detected %+v: %v", report, err)
+	}
+	want := []string{"- vhost high > hls > hls_fragment 2", "+ vhost high > hls > hls_fragment 4"}
+	if !reflect.DeepEqual(report.Disk, want) {
+		t.Errorf("want %q, have %q", want, report.Disk)
+	}
+
+	if report, err := s.CheckDrift(DriftAdopt); err != nil || report.Action != "adopted" {
+		t.Fatalf("adopt %+v: %v", report, err)
+	}
+	if report, _ := s.CheckDrift(DriftAlert); report.Drifted {
+		t.Errorf("adopted config drifts: %q", report.Disk)
+	}
+	if data, err := os.ReadFile(s.AdoptPath); err != nil || !strings.Contains(string(data), "hls_fragment 4;") {
+		t.Errorf("adopted config is not saved: %v", err)
+	}
+
+	s.adopted = nil
+	if report, err := s.CheckDrift(DriftOverwrite); err != nil || report.Action != "overwritten" {
+		t.Fatalf("overwrite %+v: %v", report, err)
+	}
+	if data, _ := os.ReadFile(s.ConfigPath); string(data) != string(cfg.Bytes()) {
+		t.Errorf("config is not overwritten")
+	}
+}
+
+// TestNodeBaseTemplate: принятая конфигурация узла сохраняется в его шаблон
+// и не меняет общую часть других узлов
+func TestNodeBaseTemplate(t *testing.T) {
+	VerifyAttempts, VerifyInterval = 1, 0
+	dir := t.TempDir()
+	nodes := map[string]*SRSConfig{}
+	for _, name := range []string{"a", "b"} {
+		s := New(dir+"/srs."+name+".conf", Templates(dir, config.GetConfig().TplStorage), &fakeReloader{})
+		s.TemplateData = config.GetConfig().TemplateData(config.SRSNode{Name: name, LiveTSPath: "/hls/" + name})
+		s.BaseTemplate = "srs_base." + name + ".tpl"
+		s.AdoptPath = dir + "/" + s.BaseTemplate
+		nodes[name] = s
+	}
+
+	cfg, err := nodes["a"].Render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	edited := strings.Replace(string(cfg.Bytes()), "hls_fragment 2;", "hls_fragment 4;", 1)
+	if err := os.WriteFile(nodes["a"].ConfigPath, []byte(edited), 0644); err != nil {
+		t.Fatal(err)
+	}
+	nodes["a"].SRSClient.(*fakeReloader).vhosts = cfg.vhostNames()
+	if report, err := nodes["a"].CheckDrift(DriftAdopt); err != nil || report.Action != "adopted" {
+		t.Fatalf("adopt %+v: %v", report, err)
+	}
+	if _, err := os.Stat(dir + "/srs_base.tpl"); !os.IsNotExist(err) {
+		t.Errorf("shared srs_base.tpl is written: %v", err)
+	}
+
+	for name, want := range map[string]string{"a": "hls_fragment 4;", "b": "hls_fragment 2;"} {
+		// после перезапуска узел читает свой шаблон
+		s := New("", Templates(dir, config.GetConfig().TplStorage), nil)
+		s.TemplateData = nodes[name].TemplateData
+		s.BaseTemplate = nodes[name].BaseTemplate
+		cfg, err := s.Render()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(cfg.Bytes()), want) {
+			t.Errorf("node %s: want %q in config", name, want)
+		}
+	}
+}
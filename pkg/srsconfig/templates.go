@@ -0,0 +1,72 @@
+package srsconfig
+
+import (
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"text/template"
+)
+
+// templateFS отдает шаблон из каталога, если он там есть, иначе встроенный
+type templateFS struct {
+	dir      fs.FS
+	embedded fs.FS
+}
+
+// Templates возвращает шаблоны, в которых файлы каталога dir заменяют
+// одноименные встроенные. Пустой dir - только встроенные шаблоны
+func Templates(dir string, embedded fs.FS) fs.FS {
+	if dir == "" {
+		return embedded
+	}
+	return templateFS{dir: os.DirFS(dir), embedded: embedded}
+}
+
+func (t templateFS) Open(name string) (fs.File, error) {
+	f, err := t.dir.Open(name)
+	if err == nil {
+		return f, nil
+	}
+	return t.embedded.Open(name)
+}
+
+// templateData - данные шаблонов: Config - конфигурация сервиса
+type templateData struct {
+	Config interface{}
+}
+
+var templateFuncs = template.FuncMap{
+	"hostport": hostport,
+}
+
+// hostport делает адрес прослушивания доступным для подключения:
+// пустой или 0.0.0.0 хост заменяется на 127.0.0.1
+func hostport(listen string) string {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return listen
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+func (s *SRSConfig) template(name string) (*template.Template, error) {
+	data, err := fs.ReadFile(s.tplStorage, name)
+	if err != nil {
+		return nil, err
+	}
+	return template.New(name).Funcs(templateFuncs).Parse(string(data))
+}
+
+// baseTemplate - шаблон общей части: BaseTemplate узла, если он есть, иначе srs_base.tpl
+func (s *SRSConfig) baseTemplate() (*template.Template, error) {
+	if s.BaseTemplate != "" {
+		if t, err := s.template(s.BaseTemplate); !errors.Is(err, fs.ErrNotExist) {
+			return t, err
+		}
+	}
+	return s.template("srs_base.tpl")
+}
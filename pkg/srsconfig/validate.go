@@ -0,0 +1,163 @@
+package srsconfig
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrConfigInvalid = errors.New("SRS_CONFIG_INVALID")
+	reOutputVhost    = regexp.MustCompile(`[?&]vhost=([^/&]+)`)
+)
+
+// ValidationError перечисляет все найденные в конфигурации проблемы
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrConfigInvalid, strings.Join(e.Problems, "; "))
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrConfigInvalid
+}
+
+// Validate проверяет согласованность конфигурации до записи на диск
+func (c *Config) Validate() error {
+	problems := []string{}
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if !validPort(c.Listen) {
+		add("listen: invalid port %q", c.Listen)
+	}
+	for _, s := range []struct {
+		name   string
+		server *Server
+	}{{"http_server", c.HTTPServer}, {"http_api", c.HTTPAPI}, {"srt_server", c.SRTServer}, {"rtc_server", c.RTCServer}} {
+		if s.server != nil && s.server.Enabled && !validListen(s.server.Listen) {
+			add("%s: invalid listen %q", s.name, s.server.Listen)
+		}
+	}
+	// перезагрузка конфигурации выполняется через HTTP API
+	if c.HTTPAPI == nil || !c.HTTPAPI.Enabled {
+		add("http_api: must be enabled")
+	}
+
+	vhosts := map[string]bool{}
+	for _, v := range c.Vhosts {
+		if v.Name == "" {
+			add("vhost: missing name")
+			continue
+		}
+		if vhosts[v.Name] {
+			add("vhost %s: duplicate", v.Name)
+		}
+		vhosts[v.Name] = true
+	}
+
+	for _, v := range c.Vhosts {
+		prefix := "vhost " + v.Name
+		if h := v.HLS; h != nil && h.Enabled {
+			if h.Path == "" {
+				add("%s: hls_path is empty", prefix)
+			}
+			if h.Fragment <= 0 {
+				add("%s: hls_fragment must be positive", prefix)
+			}
+			if h.Window != 0 && h.Window < h.Fragment {
+				add("%s: hls_window is shorter than hls_fragment", prefix)
+			}
+			if !strings.Contains(h.M3U8File, "[stream]") {
+				add("%s: hls_m3u8_file must contain [stream]", prefix)
+			}
+			if !strings.Contains(h.TSFile, "[seq]") {
+				add("%s: hls_ts_file must contain [seq]", prefix)
+			}
+		}
+
+		if h := v.HTTPHooks; h != nil && h.Enabled {
+			for _, d := range h.directives() {
+				if !strings.HasPrefix(d.Name, "on_") {
+					continue
+				}
+				for _, u := range d.Args {
+					if parsed, err := url.Parse(u); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+						add("%s: %s: invalid url %q", prefix, d.Name, u)
+					}
+				}
+			}
+		}
+
+		for _, t := range v.Transcodes {
+			if !t.Enabled {
+				continue
+			}
+			if t.FFmpeg == "" {
+				add("%s: transcode: ffmpeg is empty", prefix)
+			}
+			engines := map[string]bool{}
+			for _, e := range t.Engines {
+				if engines[e.Name] {
+					add("%s: engine %s: duplicate", prefix, e.Name)
+				}
+				engines[e.Name] = true
+				if !e.Enabled {
+					continue
+				}
+				if e.Output == "" {
+					add("%s: engine %s: output is empty", prefix, e.Name)
+				}
+				if m := reOutputVhost.FindStringSubmatch(e.Output); m != nil && !vhosts[m[1]] {
+					add("%s: engine %s: output vhost %s is not defined", prefix, e.Name, m[1])
+				}
+				if e.VCodec != "copy" && e.VCodec != "vn" && e.VBitrate <= 0 {
+					add("%s: engine %s: vbitrate must be positive", prefix, e.Name)
+				}
+				if e.ACodec != "copy" && e.ACodec != "an" && e.ABitrate <= 0 {
+					add("%s: engine %s: abitrate must be positive", prefix, e.Name)
+				}
+			}
+		}
+
+		if v.RTC != nil && v.RTC.Enabled && (c.RTCServer == nil || !c.RTCServer.Enabled) {
+			add("%s: rtc requires rtc_server", prefix)
+		}
+		if v.SRT != nil && v.SRT.Enabled && (c.SRTServer == nil || !c.SRTServer.Enabled) {
+			add("%s: srt requires srt_server", prefix)
+		}
+		// SRS выбирает формат записи по расширению dvr_path
+		if d := v.DVR; d != nil && d.Enabled {
+			if !strings.Contains(d.Path, "[stream]") {
+				add("%s: dvr_path must contain [stream]", prefix)
+			}
+			if !strings.HasSuffix(d.Path, ".flv") && !strings.HasSuffix(d.Path, ".mp4") {
+				add("%s: dvr_path must end with .flv or .mp4", prefix)
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n < 65536
+}
+
+// validListen принимает порт или адрес host:port
+func validListen(listen string) bool {
+	if i := strings.LastIndex(listen, ":"); i >= 0 {
+		listen = listen[i+1:]
+	}
+	return validPort(listen)
+}
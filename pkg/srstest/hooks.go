@@ -0,0 +1,236 @@
+package srstest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"srsmgmt/pkg/srsclient"
+)
+
+var (
+	ErrHookRejected   = errors.New("SRS_HOOK_REJECTED")
+	ErrNotPublishing  = errors.New("SRS_STREAM_NOT_PUBLISHING")
+	ErrClientNotFound = errors.New("SRS_CLIENT_NOT_FOUND")
+)
+
+// Hook - тело webhook SRS
+type Hook struct {
+	Action   string  `json:"action"`
+	ClientID string  `json:"client_id"`
+	IP       string  `json:"ip"`
+	Vhost    string  `json:"vhost"`
+	App      string  `json:"app"`
+	Stream   string  `json:"stream"`
+	Param    string  `json:"param"`
+	Duration float64 `json:"duration,omitempty"`
+	Cwd      string  `json:"cwd,omitempty"`
+	File     string  `json:"file,omitempty"`
+	URL      string  `json:"url,omitempty"`
+	M3U8     string  `json:"m3u8,omitempty"`
+	M3U8URL  string  `json:"m3u8_url,omitempty"`
+	SeqNo    int     `json:"seq_no,omitempty"`
+}
+
+// Publish подключает публикатора app/stream. param - строка запроса
+// публикации, например "?password=123"; vhost берется из параметра vhost.
+// Если srsmgmt отклоняет on_publish, возвращается ErrHookRejected
+func (s *Server) Publish(app, stream, param string) (string, error) {
+	vhost := DefaultVhost
+	if q, err := url.ParseQuery(strings.TrimPrefix(param, "?")); err == nil && q.Get("vhost") != "" {
+		vhost = q.Get("vhost")
+	}
+
+	s.mu.Lock()
+	s.nextID++
+	cid := fmt.Sprintf("c%04d", s.nextID)
+	s.mu.Unlock()
+
+	hook := Hook{Action: "on_publish", ClientID: cid, IP: "127.0.0.1", Vhost: vhost, App: app, Stream: stream, Param: param}
+	if err := s.fire("/api/v1/webhook/stream/live", hook); err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clients[cid] = &srsclient.SRSClientInfo{
+		Id: cid, Vhost: vhost, Stream: stream, IP: "127.0.0.1", Type: "fmle-publish", Publish: true,
+		TcUrl: fmt.Sprintf("rtmp://127.0.0.1/%s", app), URL: fmt.Sprintf("/%s/%s", app, stream),
+	}
+	st := s.findStream(vhost, app, stream)
+	if st == nil {
+		s.nextID++
+		st = &srsclient.SRSStream{Id: fmt.Sprintf("vid-%04d", s.nextID), Name: stream, Vhost: vhost, App: app, URL: fmt.Sprintf("/%s/%s", app, stream)}
+		s.streams[st.Id] = st
+	}
+	st.Clients++
+	st.Publish = &srsclient.SRSPublish{Active: true, Cid: cid}
+	return cid, nil
+}
+
+// Unpublish отключает публикатора cid и отправляет on_unpublish
+func (s *Server) Unpublish(cid string) error {
+	hook, err := s.disconnect(cid)
+	if err != nil {
+		return err
+	}
+	return s.fire("/api/v1/webhook/stream/live", hook)
+}
+
+// kick отключает клиента по запросу API и возвращает on_unpublish,
+// который отправляется после ответа на запрос
+func (s *Server) kick(cid string) (Hook, error) {
+	hook, err := s.disconnect(cid)
+	if err != nil {
+		return Hook{}, err
+	}
+	s.mu.Lock()
+	s.kicks++
+	s.mu.Unlock()
+	return hook, nil
+}
+
+// disconnect удаляет клиента и возвращает on_unpublish, если это публикатор
+func (s *Server) disconnect(cid string) (Hook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.clients[cid]
+	if !ok {
+		return Hook{}, fmt.Errorf("%s: %w", cid, ErrClientNotFound)
+	}
+	delete(s.clients, cid)
+	if !c.Publish {
+		return Hook{}, nil
+	}
+
+	app := strings.TrimPrefix(path.Dir(c.URL), "/")
+	st := s.findStream(c.Vhost, app, c.Stream)
+	if st != nil {
+		st.Clients--
+		st.Publish = &srsclient.SRSPublish{}
+		if st.Clients <= 0 {
+			delete(s.streams, st.Id)
+		}
+	}
+	return Hook{Action: "on_unpublish", ClientID: cid, IP: c.IP, Vhost: c.Vhost, App: app, Stream: c.Stream}, nil
+}
+
+// Segment пишет очередной сегмент варианта rendition публикуемого стрима
+// в LiveTSPath/stream, дописывает его в плейлист варианта и отправляет on_hls
+func (s *Server) Segment(stream, rendition string) (string, error) {
+	s.mu.Lock()
+	var st *srsclient.SRSStream
+	for _, v := range s.streams {
+		if v.Name == stream && v.Publish != nil && v.Publish.Active {
+			st = v
+		}
+	}
+	if st == nil {
+		s.mu.Unlock()
+		return "", fmt.Errorf("%s: %w", stream, ErrNotPublishing)
+	}
+	app, vhost, cid := st.App, st.Vhost, st.Publish.Cid
+	key := stream + "/" + rendition
+	seq := s.segments[key]
+	s.segments[key]++
+	s.mu.Unlock()
+
+	dir := path.Join(s.LiveTSPath, stream)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	ms := int(s.Fragment / time.Millisecond)
+	name := fmt.Sprintf("%s-%s-%d-%d.ts", rendition, time.Now().Format("2006-01-02-15-04-05"), ms, seq)
+	file := path.Join(dir, name)
+	if err := ioutil.WriteFile(file, makeSegment(s.Fragment, int64(seq)*int64(ms)*90), 0644); err != nil {
+		return "", err
+	}
+
+	m3u8 := path.Join(dir, rendition+".m3u8")
+	if err := s.appendPlaylist(m3u8, name, seq); err != nil {
+		return "", err
+	}
+
+	hook := Hook{
+		Action: "on_hls", ClientID: cid, IP: "127.0.0.1", Vhost: vhost, App: app, Stream: stream,
+		Duration: s.Fragment.Seconds(), Cwd: s.LiveTSPath, File: file, URL: path.Join(app, stream, name),
+		M3U8: m3u8, M3U8URL: path.Join(app, stream, rendition+".m3u8"), SeqNo: seq,
+	}
+	return file, s.fire("/api/v1/webhook/stream/hls", hook)
+}
+
+// Segments пишет по сегменту каждого варианта Renditions
+func (s *Server) Segments(stream string) error {
+	for _, r := range s.Renditions {
+		if _, err := s.Segment(stream, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendPlaylist дописывает сегмент в плейлист варианта так же, как SRS
+// при hls_window больше длительности публикации
+func (s *Server) appendPlaylist(m3u8, name string, seq int) error {
+	seconds := s.Fragment.Seconds()
+	var b bytes.Buffer
+	if seq == 0 {
+		fmt.Fprintf(&b, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-TARGETDURATION:%d\n", int(seconds+0.999))
+	}
+	fmt.Fprintf(&b, "#EXTINF:%.3f, no desc\n%s\n", seconds, name)
+	f, err := os.OpenFile(m3u8, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(b.Bytes())
+	return err
+}
+
+func (s *Server) findStream(vhost, app, name string) *srsclient.SRSStream {
+	for _, st := range s.streams {
+		if st.Vhost == vhost && st.App == app && st.Name == name {
+			return st
+		}
+	}
+	return nil
+}
+
+// fire отправляет webhook в srsmgmt. Как и SRS, ответ считается
+// разрешением, если статус 200 и code равен 0
+func (s *Server) fire(route string, hook Hook) error {
+	if s.HookURL == "" {
+		return nil
+	}
+	body, err := json.Marshal(hook)
+	if err != nil {
+		return err
+	}
+	resp, err := http.Post(strings.TrimSuffix(s.HookURL, "/")+route, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %d: %w", hook.Action, resp.StatusCode, ErrHookRejected)
+	}
+	var result struct {
+		Code int `json:"code"`
+	}
+	if strings.TrimSpace(string(data)) == "0" {
+		return nil
+	}
+	if err := json.Unmarshal(data, &result); err != nil || result.Code != 0 {
+		return fmt.Errorf("%s code %d: %w", hook.Action, result.Code, ErrHookRejected)
+	}
+	return nil
+}
@@ -0,0 +1,323 @@
+// Package srstest - поддельный SRS для интеграционных тестов: HTTP API
+// на httptest, клиенты и стримы, kick и reload, webhooks в srsmgmt и
+// сегменты HLS в LiveTSPath
+package srstest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"srsmgmt/pkg/srsclient"
+	"srsmgmt/pkg/srsconfig"
+)
+
+const DefaultVhost = "__defaultVhost__"
+
+// Коды ошибок SRS
+const (
+	CodeStreamNotFound = srsclient.CodeStreamNotFound
+	CodeClientNotFound = srsclient.CodeClientNotFound
+	CodeReloadFailed   = 1023
+)
+
+// Server - поддельный SRS. URL - адрес HTTP API для SRS_ADDR
+type Server struct {
+	*httptest.Server
+
+	// HookURL - адрес srsmgmt, на который отправляются webhooks. Пустой -
+	// webhooks не отправляются
+	HookURL string
+	// LiveTSPath - каталог, куда пишутся плейлисты и сегменты
+	LiveTSPath string
+	// ConfigPath - конфигурация, которую сервер перечитывает при reload.
+	// Пустой - активен только DefaultVhost
+	ConfigPath string
+	// Renditions - варианты транскодирования, для которых пишутся сегменты
+	Renditions []string
+	Fragment   time.Duration
+
+	mu          sync.Mutex
+	vhosts      []string
+	listen      []string
+	clients     map[string]*srsclient.SRSClientInfo
+	streams     map[string]*srsclient.SRSStream
+	segments    map[string]int
+	nextID      int
+	reloads     int
+	kicks       int
+	unavailable bool
+	hooks       sync.WaitGroup
+}
+
+// NewServer запускает поддельный SRS, сегменты пишутся в liveTSPath
+func NewServer(liveTSPath string) *Server {
+	s := &Server{
+		LiveTSPath: liveTSPath,
+		Renditions: []string{"low", "mid", "high"},
+		Fragment:   2 * time.Second,
+		vhosts:     []string{DefaultVhost},
+		clients:    map[string]*srsclient.SRSClientInfo{},
+		streams:    map[string]*srsclient.SRSStream{},
+		segments:   map[string]int{},
+	}
+	s.Server = httptest.NewServer(s.handler())
+	return s
+}
+
+// Close дожидается отправленных webhooks и останавливает сервер
+func (s *Server) Close() {
+	s.hooks.Wait()
+	s.Server.Close()
+}
+
+// Wait дожидается on_unpublish, отправляемых после kick
+func (s *Server) Wait() {
+	s.hooks.Wait()
+}
+
+// SetUnavailable переводит API в состояние, когда все запросы
+// отвечают 503, как перегруженный или перезапускающийся SRS
+func (s *Server) SetUnavailable(unavailable bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unavailable = unavailable
+}
+
+func (s *Server) Reloads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reloads
+}
+
+func (s *Server) Kicks() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.kicks
+}
+
+// Vhosts возвращает активные vhost
+func (s *Server) Vhosts() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.vhosts...)
+}
+
+// Stream возвращает стрим по имени или nil
+func (s *Server) Stream(name string) *srsclient.SRSStream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, st := range s.streams {
+		if st.Name == name {
+			c := *st
+			return &c
+		}
+	}
+	return nil
+}
+
+func (s *Server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/versions", s.handleVersions)
+	mux.HandleFunc("/api/v1/summaries", s.handleSummaries)
+	mux.HandleFunc("/api/v1/vhosts", s.handleVhosts)
+	mux.HandleFunc("/api/v1/vhosts/", s.handleVhosts)
+	mux.HandleFunc("/api/v1/streams", s.handleStreams)
+	mux.HandleFunc("/api/v1/streams/", s.handleStreams)
+	mux.HandleFunc("/api/v1/clients", s.handleClients)
+	mux.HandleFunc("/api/v1/clients/", s.handleClients)
+	mux.HandleFunc("/api/v1/raw", s.handleRaw)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		unavailable := s.unavailable
+		s.mu.Unlock()
+		if unavailable {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeCode(w http.ResponseWriter, code int) {
+	writeJSON(w, map[string]int{"code": code})
+}
+
+// page возвращает границы страницы start/count списка длины n
+func page(r *http.Request, n int) (int, int) {
+	start, _ := strconv.Atoi(r.URL.Query().Get("start"))
+	count, err := strconv.Atoi(r.URL.Query().Get("count"))
+	if err != nil || count <= 0 {
+		count = 10
+	}
+	if start > n {
+		start = n
+	}
+	end := start + count
+	if end > n {
+		end = n
+	}
+	return start, end
+}
+
+func (s *Server) handleVersions(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, srsclient.GetSRSVersionsResponse{Data: &srsclient.SRSVersion{Major: 5, Version: "5.0.0"}})
+}
+
+func (s *Server) handleSummaries(w http.ResponseWriter, r *http.Request) {
+	summary := &srsclient.SRSSummary{OK: true, NowMs: time.Now().UnixNano() / int64(time.Millisecond)}
+	s.mu.Lock()
+	summary.System.ConnSrs = len(s.clients)
+	s.mu.Unlock()
+	writeJSON(w, srsclient.GetSRSSummariesResponse{Data: summary})
+}
+
+func (s *Server) handleVhosts(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	vhosts := []srsclient.SRSVhost{}
+	for i, name := range s.vhosts {
+		v := srsclient.SRSVhost{Id: fmt.Sprint("vhost-", i), Name: name, Enabled: true}
+		for _, st := range s.streams {
+			if st.Vhost == name {
+				v.Streams++
+				v.Clients += st.Clients
+			}
+		}
+		vhosts = append(vhosts, v)
+	}
+	writeJSON(w, srsclient.GetSRSVhostsResponse{Vhosts: &vhosts})
+}
+
+func (s *Server) handleStreams(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id := strings.TrimPrefix(r.URL.Path, "/api/v1/streams/"); id != "" && id != r.URL.Path {
+		st, ok := s.streams[id]
+		if !ok {
+			writeCode(w, CodeStreamNotFound)
+			return
+		}
+		writeJSON(w, srsclient.GetSRSStreamResponse{Stream: st})
+		return
+	}
+
+	all := []srsclient.SRSStream{}
+	for _, st := range s.streams {
+		all = append(all, *st)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Id < all[j].Id })
+	start, end := page(r, len(all))
+	streams := all[start:end]
+	writeJSON(w, srsclient.GetSRSStreamsResponse{Streams: &streams})
+}
+
+func (s *Server) handleClients(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/v1/clients/")
+	if id == r.URL.Path {
+		id = ""
+	}
+	if r.Method == http.MethodDelete {
+		hook, err := s.kick(id)
+		if err != nil {
+			writeCode(w, CodeClientNotFound)
+			return
+		}
+		writeCode(w, 0)
+		if hook.Action != "" {
+			// как SRS, on_unpublish приходит после ответа на kick
+			w.(http.Flusher).Flush()
+			s.hooks.Add(1)
+			defer s.hooks.Done()
+			s.fire("/api/v1/webhook/stream/live", hook)
+		}
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id != "" {
+		c, ok := s.clients[id]
+		if !ok {
+			writeCode(w, CodeClientNotFound)
+			return
+		}
+		writeJSON(w, srsclient.GetSRSClientResponse{Client: c})
+		return
+	}
+
+	all := []srsclient.SRSClientInfo{}
+	for _, c := range s.clients {
+		all = append(all, *c)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Id < all[j].Id })
+	start, end := page(r, len(all))
+	clients := all[start:end]
+	writeJSON(w, srsclient.GetSRSClientsResponse{Clients: &clients})
+}
+
+func (s *Server) handleRaw(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Query().Get("rpc") {
+	case "reload":
+		if err := s.reload(); err != nil {
+			writeCode(w, CodeReloadFailed)
+			return
+		}
+		writeCode(w, 0)
+	case "query":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		listen, _ := json.Marshal(strings.Join(s.listen, " "))
+		vhosts, _ := json.Marshal(s.vhosts)
+		writeJSON(w, srsclient.GetSRSRawConfigResponse{Global: &srsclient.SRSRawGlobal{Listen: listen, Vhosts: vhosts}})
+	default:
+		writeCode(w, CodeReloadFailed)
+	}
+}
+
+// reload перечитывает ConfigPath, как SRS по rpc=reload: активными
+// становятся vhost конфигурации, кроме выключенных
+func (s *Server) reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reloads++
+	if s.ConfigPath == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(s.ConfigPath)
+	if err != nil {
+		return err
+	}
+	cfg, err := srsconfig.Parse(string(data))
+	if err != nil {
+		return err
+	}
+
+	vhosts := []string{}
+	for _, v := range cfg.Vhosts {
+		enabled := true
+		for _, d := range v.Extra {
+			if d.Name == "enabled" && d.Arg() == "off" {
+				enabled = false
+			}
+		}
+		if enabled {
+			vhosts = append(vhosts, v.Name)
+		}
+	}
+	s.vhosts = vhosts
+	s.listen = strings.Fields(cfg.Listen)
+	return nil
+}
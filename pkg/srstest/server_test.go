@@ -0,0 +1,147 @@
+package srstest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"sync"
+	"testing"
+
+	"srsmgmt/pkg/playlist"
+	"srsmgmt/pkg/srsclient"
+
+	"github.com/go-kit/log"
+)
+
+// hookRecorder принимает webhooks и отклоняет on_publish с неверным паролем
+type hookRecorder struct {
+	mu    sync.Mutex
+	hooks []Hook
+}
+
+func (h *hookRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var hook Hook
+	json.NewDecoder(r.Body).Decode(&hook)
+	h.mu.Lock()
+	h.hooks = append(h.hooks, hook)
+	h.mu.Unlock()
+	if hook.Action == "on_publish" && hook.Param != "?password=123" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]int{"code": 0})
+}
+
+func (h *hookRecorder) actions() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	actions := []string{}
+	for _, v := range h.hooks {
+		actions = append(actions, v.Action)
+	}
+	return actions
+}
+
+func TestServer(t *testing.T) {
+	hooks := &hookRecorder{}
+	mgmt := httptest.NewServer(hooks)
+	defer mgmt.Close()
+	srs := NewServer(t.TempDir())
+	defer srs.Close()
+	srs.HookURL = mgmt.URL
+	client := srsclient.New(srs.URL, srsclient.Options{}, log.NewNopLogger())
+	ctx := context.Background()
+
+	if _, err := srs.Publish("live", "s0", "?password=bad"); !errors.Is(err, ErrHookRejected) {
+		t.Fatalf("want rejected publish, have %v", err)
+	}
+	cids := []string{}
+	for i := 0; i < srsclient.STREAMS_COUNT+1; i++ {
+		cid, err := srs.Publish("live", fmt.Sprint("s", i), "?password=123")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cids = append(cids, cid)
+	}
+	publishing, err := client.PublishingStreams(ctx)
+	if err != nil || len(publishing) != srsclient.STREAMS_COUNT+1 {
+		t.Fatalf("want %d publishing streams, have %d, %v", srsclient.STREAMS_COUNT+1, len(publishing), err)
+	}
+
+	if err := srs.Segments("s0"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srs.Segment("s0", "low"); err != nil {
+		t.Fatal(err)
+	}
+	report, err := playlist.New().Verify(path.Join(srs.LiveTSPath, "s0"), false)
+	if err != nil || report.Segments != 4 || report.Broken != 0 {
+		t.Errorf("want 4 valid segments, have %+v, %v", report, err)
+	}
+
+	if err := client.KickSRSStream(ctx, cids[0]); err != nil {
+		t.Fatal(err)
+	}
+	srs.Wait()
+	if err := client.KickSRSStream(ctx, cids[0]); err != nil {
+		t.Errorf("kick of a gone client: %v", err)
+	}
+	if st := srs.Stream("s0"); st != nil {
+		t.Errorf("kicked stream is still published: %+v", st)
+	}
+	if _, err := srs.Segment("s0", "low"); !errors.Is(err, ErrNotPublishing) {
+		t.Errorf("want ErrNotPublishing, have %v", err)
+	}
+	if err := srs.Unpublish(cids[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"on_publish"}
+	for range cids {
+		want = append(want, "on_publish")
+	}
+	want = append(want, "on_hls", "on_hls", "on_hls", "on_hls", "on_unpublish", "on_unpublish")
+	if have := hooks.actions(); !reflect.DeepEqual(have, want) {
+		t.Errorf("want hooks %v, have %v", want, have)
+	}
+
+	srs.SetUnavailable(true)
+	if err := client.ConfigReload(ctx); !errors.Is(err, srsclient.ErrUnreachable) {
+		t.Errorf("want ErrUnreachable, have %v", err)
+	}
+}
+
+func TestServerReload(t *testing.T) {
+	srs := NewServer(t.TempDir())
+	defer srs.Close()
+	srs.ConfigPath = path.Join(t.TempDir(), "srs.conf")
+	conf := "listen 1935;\nvhost __defaultVhost__ {\n}\nvhost high {\n}\nvhost off {\n    enabled off;\n}\n"
+	if err := os.WriteFile(srs.ConfigPath, []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+	client := srsclient.New(srs.URL, srsclient.Options{}, log.NewNopLogger())
+	ctx := context.Background()
+
+	if err := client.ConfigReload(ctx); err != nil {
+		t.Fatal(err)
+	}
+	vhosts, err := client.ActiveVhosts(ctx)
+	if want := []string{"__defaultVhost__", "high"}; err != nil || !reflect.DeepEqual(vhosts, want) {
+		t.Errorf("want vhosts %v, have %v, %v", want, vhosts, err)
+	}
+	listen, _, err := client.LiveConfig(ctx)
+	if err != nil || !reflect.DeepEqual(listen, []string{"1935"}) || srs.Reloads() != 1 {
+		t.Errorf("unexpected live config %v, reloads %d, %v", listen, srs.Reloads(), err)
+	}
+
+	os.WriteFile(srs.ConfigPath, []byte("vhost {"), 0644)
+	if err := client.ConfigReload(ctx); !srsclient.IsCode(err, CodeReloadFailed) {
+		t.Errorf("broken config: want code %d, have %v", CodeReloadFailed, err)
+	}
+}
@@ -0,0 +1,52 @@
+package srstest
+
+import "time"
+
+const (
+	tsPacketSize = 188
+	videoPID     = 0x100
+	audioPID     = 0x101
+	pmtPID       = 0x1000
+	frameRate    = 25
+)
+
+// makeSegment собирает MPEG-TS сегмент длительностью d: PAT, PMT с H.264
+// и AAC, по PES-пакету видео и звука на кадр, первый кадр - IDR
+func makeSegment(d time.Duration, startPTS int64) []byte {
+	cc := map[uint16]byte{}
+	packet := func(pid uint16, payload []byte) []byte {
+		pkt := make([]byte, tsPacketSize)
+		pkt[0] = 0x47
+		pkt[1] = 0x40 | byte(pid>>8)
+		pkt[2] = byte(pid)
+		pkt[3] = 0x10 | cc[pid]&0x0f
+		cc[pid]++
+		for i := copy(pkt[4:], payload) + 4; i < tsPacketSize; i++ {
+			pkt[i] = 0xff
+		}
+		return pkt
+	}
+	pes := func(streamID byte, pts int64, es ...byte) []byte {
+		return append([]byte{0, 0, 1, streamID, 0, 0, 0x80, 0x80, 5,
+			byte(0x21 | (pts>>29)&0x0e), byte(pts >> 22), byte(0x01 | (pts>>14)&0xfe), byte(pts >> 7), byte(0x01 | (pts<<1)&0xfe)}, es...)
+	}
+
+	pat := []byte{0x00, 0x00, 0xb0, 0x0d, 0x00, 0x01, 0xc1, 0x00, 0x00, 0x00, 0x01, 0xf0, 0x00, 0, 0, 0, 0}
+	pmt := []byte{0x00, 0x02, 0xb0, 0x17, 0x00, 0x01, 0xc1, 0x00, 0x00, 0xe1, 0x00, 0xf0, 0x00,
+		0x1b, 0xe1, 0x00, 0xf0, 0x00,
+		0x0f, 0xe1, 0x01, 0xf0, 0x00,
+		0, 0, 0, 0}
+	data := append(packet(0, pat), packet(pmtPID, pmt)...)
+
+	frames := int(d.Seconds() * frameRate)
+	for i := 0; i < frames; i++ {
+		pts := startPTS + int64(i)*90000/frameRate
+		nal := byte(0x41)
+		if i == 0 {
+			nal = 0x65
+		}
+		data = append(data, packet(videoPID, pes(0xe0, pts, 0, 0, 0, 1, 0x09, 0xf0, 0, 0, 0, 1, nal))...)
+		data = append(data, packet(audioPID, pes(0xc0, pts))...)
+	}
+	return data
+}